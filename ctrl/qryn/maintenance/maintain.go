@@ -10,6 +10,7 @@ import (
 	"github.com/metrico/cloki-config/config"
 	"github.com/metrico/qryn/v5/ctrl/logger"
 	"github.com/metrico/qryn/v5/ctrl/maintenance"
+	"github.com/metrico/qryn/v5/shared/retention"
 )
 
 func upgradeDB(dbObject *config.ClokiBaseDataBase, logger logger.ILogger) error {
@@ -127,8 +128,22 @@ func rotateDB(dbObject *config.ClokiBaseDataBase) error {
 			MoveTo: p.MoveTo,
 		}
 	}
+	rollupsDays := RollupsDays{
+		Metrics5m: rollupDays("METRICS_5M_DAYS", dbObject.TTLDays),
+		Metrics1h: rollupDays("METRICS_1H_DAYS", dbObject.TTLDays),
+	}
 	return Rotate(connDb, dbObject.ClusterName, dbObject.ClusterName != "",
-		ttlPolicy, dbObject.TTLDays, dbObject.StoragePolicy, logger.Logger)
+		ttlPolicy, dbObject.TTLDays, rollupsDays, dbObject.StoragePolicy, logger.Logger)
+}
+
+// rollupDays reads the retention of a rollup of the samples from the name
+// environment variable, the retention of the samples by default.
+func rollupDays(name string, ttlDays int) int {
+	days, err := retention.RollupDays(name, ttlDays)
+	if err != nil {
+		logger.Error(err)
+	}
+	return days
 }
 
 func RecodecDB(dbObject *config.ClokiBaseDataBase) error {
@@ -119,14 +119,31 @@ type RotatePolicy struct {
 	MoveTo string
 }
 
+// RollupsDays are the retentions in days of the 5m and the 1h rollups of the
+// samples.
+type RollupsDays struct {
+	Metrics5m int
+	Metrics1h int
+}
+
 func Rotate(db clickhouse.Conn, clusterName string, distributed bool, days []RotatePolicy, dropTTLDays int,
-	storagePolicy string, logger logger.ILogger) error {
+	rollupsDays RollupsDays, storagePolicy string, logger logger.ILogger) error {
 	//TODO: add pluggable extension
 	err := storagePolicyUpdate(db, clusterName, distributed, storagePolicy, "v3_storage_policy",
 		"time_series", "time_series_gin", "samples_v3")
 	if err != nil {
 		return err
 	}
+	err = storagePolicyUpdate(db, clusterName, distributed, storagePolicy, "v1_native_histograms_storage_policy",
+		"native_histograms")
+	if err != nil {
+		return err
+	}
+	err = storagePolicyUpdate(db, clusterName, distributed, storagePolicy, "v1_exemplars_storage_policy",
+		"exemplars")
+	if err != nil {
+		return err
+	}
 	err = storagePolicyUpdate(db, clusterName, distributed, storagePolicy, "v1_traces_storage_policy",
 		"tempo_traces", "tempo_traces_attrs_gin", "tempo_traces_kv")
 	if err != nil {
@@ -136,6 +153,11 @@ func Rotate(db clickhouse.Conn, clusterName string, distributed bool, days []Rot
 	if err != nil {
 		return err
 	}
+	err = storagePolicyUpdate(db, clusterName, distributed, storagePolicy, "v1_metrics_rollups_storage_policy",
+		"metrics_5m", "metrics_1h")
+	if err != nil {
+		return err
+	}
 
 	logDefaultTTLString := func(column string) string {
 		return fmt.Sprintf(
@@ -152,6 +174,10 @@ func Rotate(db clickhouse.Conn, clusterName string, distributed bool, days []Rot
 	minTTL := time.Minute
 	dayTTL := time.Hour * 24
 
+	// The series of the rollups kept longer than the samples have to stay in
+	// the index to be selected.
+	indexTTLDays := max(dropTTLDays, rollupsDays.Metrics5m, rollupsDays.Metrics1h)
+
 	err = rotateTables(
 		db,
 		clusterName,
@@ -164,10 +190,28 @@ func Rotate(db clickhouse.Conn, clusterName string, distributed bool, days []Rot
 	if err != nil {
 		return err
 	}
+	err = rotateTables(db, clusterName, distributed, days,
+		minTTL,
+		"toDateTime(timestamp_ns / 1000000000)",
+		logDefaultTTLString("toDateTime(timestamp_ns / 1000000000)"),
+		"v1_native_histograms_days",
+		logger, "native_histograms")
+	if err != nil {
+		return err
+	}
+	err = rotateTables(db, clusterName, distributed, days,
+		minTTL,
+		"toDateTime(timestamp_ns / 1000000000)",
+		logDefaultTTLString("toDateTime(timestamp_ns / 1000000000)"),
+		"v1_exemplars_days",
+		logger, "exemplars")
+	if err != nil {
+		return err
+	}
 	err = rotateTables(db, clusterName, distributed, days,
 		dayTTL,
 		"date",
-		logDefaultTTLString("date"), "v3_time_series_days", logger,
+		fmt.Sprintf("date + toIntervalDay(%d)", indexTTLDays), "v3_time_series_days", logger,
 		"time_series", "time_series_gin")
 	if err != nil {
 		return err
@@ -198,6 +242,24 @@ func Rotate(db clickhouse.Conn, clusterName string, distributed bool, days []Rot
 	if err != nil {
 		return err
 	}
+	err = rotateTables(db, clusterName, distributed, days,
+		minTTL,
+		"toDateTime(timestamp_ns / 1000000000)",
+		fmt.Sprintf("toDateTime(timestamp_ns / 1000000000) + toIntervalDay(%d)", rollupsDays.Metrics5m),
+		"v1_metrics_5m_days",
+		logger, "metrics_5m")
+	if err != nil {
+		return err
+	}
+	err = rotateTables(db, clusterName, distributed, days,
+		minTTL,
+		"toDateTime(timestamp_ns / 1000000000)",
+		fmt.Sprintf("toDateTime(timestamp_ns / 1000000000) + toIntervalDay(%d)", rollupsDays.Metrics1h),
+		"v1_metrics_1h_days",
+		logger, "metrics_1h")
+	if err != nil {
+		return err
+	}
 
 	err = rotateTables(db, clusterName, distributed, days,
 		minTTL,
@@ -88,6 +88,20 @@ func UpdateWithReadCluster(db clickhouse.Conn, dbname string, clusterName string
 		}
 	}
 
+	// Deletion requests of the Loki delete API and the series deletion API.
+	err = updateScripts(db, dbname, clusterName, 12, sql.DeleteRequestsScript,
+		checkMode(CLUST_MODE_CLOUD), ttlDays, storagePolicy, advancedSamplesOrdering, skipUnavailableShards, logger)
+	if err != nil {
+		return err
+	}
+	if checkMode(CLUST_MODE_DISTRIBUTED) {
+		err = updateScripts(db, dbname, clusterName, 13, sql.DeleteRequestsDistScript,
+			checkMode(CLUST_MODE_CLOUD), ttlDays, storagePolicy, advancedSamplesOrdering, skipUnavailableShards, logger)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Cross-cluster read-path tables: when a separate read cluster is configured,
 	// create distributed tables that aggregate queries across multiple clusters.
 	if readCluster != "" && readCluster != clusterName && checkMode(CLUST_MODE_DISTRIBUTED) {
@@ -0,0 +1,24 @@
+## The file is for the deletion requests of the logs and the metrics series
+## Queries are separated with ";" and one empty string
+## APPEND ONLY!!!!!
+## Templating tokens: see log.sql
+## Every status change inserts a new version of the request, ReplacingMergeTree
+## keeps the latest one.
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.delete_requests {{.OnCluster}} (
+    request_id String,
+    query      String,
+    start_ns   Int64,
+    end_ns     Int64,
+    status     String,
+    error      String,
+    created_at DateTime64(3, 'UTC'),
+    updated_at DateTime64(9, 'UTC')
+) ENGINE = {{.ReplacingMergeTree}}(updated_at)
+ORDER BY request_id {{.CREATE_SETTINGS}};
+
+## The type is the type of the deleted samples: 1 for the log lines, 2 for
+## the metrics series.
+
+ALTER TABLE {{.DB}}.delete_requests {{.OnCluster}}
+    ADD COLUMN IF NOT EXISTS type UInt8 DEFAULT 1;
@@ -0,0 +1,20 @@
+## The file is for the distributed table of the deletion requests
+## Queries are separated with ";" and one empty string
+## APPEND ONLY!!!!!
+## Templating tokens: see log.sql
+## Sharded by request_id so all versions of a request co-locate on one shard,
+## letting ReplacingMergeTree FINAL keep the latest status.
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.delete_requests_dist {{.OnCluster}} (
+    request_id String,
+    query      String,
+    start_ns   Int64,
+    end_ns     Int64,
+    status     String,
+    error      String,
+    created_at DateTime64(3, 'UTC'),
+    updated_at DateTime64(9, 'UTC')
+) ENGINE = Distributed('{{.CLUSTER}}', '{{.DB}}', 'delete_requests', cityHash64(request_id)) {{.DIST_CREATE_SETTINGS}};
+
+ALTER TABLE {{.DB}}.delete_requests_dist {{.OnCluster}}
+    ADD COLUMN IF NOT EXISTS type UInt8 DEFAULT 1;
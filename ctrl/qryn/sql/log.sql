@@ -191,3 +191,89 @@ ALTER TABLE {{.DB}}.time_series {{.OnCluster}}
 
 ALTER TABLE {{.DB}}.time_series {{.OnCluster}}
     ADD COLUMN IF NOT EXISTS updated_at_ns Int64 DEFAULT toUnixTimestamp64Nano(now64(9));
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.native_histograms {{.OnCluster}} (
+    fingerprint UInt64,
+    timestamp_ns Int64 CODEC(DoubleDelta),
+    count Float64 CODEC(Gorilla),
+    sum Float64 CODEC(Gorilla),
+    histogram String CODEC(ZSTD)
+) ENGINE = {{.MergeTree}}
+PARTITION BY toStartOfDay(toDateTime(timestamp_ns / 1000000000))
+ORDER BY (fingerprint, timestamp_ns) {{.CREATE_SETTINGS}};
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.exemplars {{.OnCluster}} (
+    fingerprint UInt64,
+    timestamp_ns Int64 CODEC(DoubleDelta),
+    value Float64 CODEC(Gorilla),
+    trace_id String,
+    labels String CODEC(ZSTD)
+) ENGINE = {{.MergeTree}}
+PARTITION BY toStartOfDay(toDateTime(timestamp_ns / 1000000000))
+ORDER BY (fingerprint, timestamp_ns) {{.CREATE_SETTINGS}};
+
+ALTER TABLE {{.DB}}.samples_v3 {{.OnCluster}}
+    ADD COLUMN IF NOT EXISTS structured_metadata String DEFAULT '' CODEC(ZSTD);
+
+## The 5m and 1h rollups of the samples, read instead of metrics_15s by the
+## queries with coarse enough steps and ranges. The settings update marks the
+## time they are filled from.
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.metrics_5m {{.OnCluster}} (
+    fingerprint UInt64,
+    timestamp_ns Int64 CODEC(DoubleDelta),
+    last AggregateFunction(argMax, Float64, Int64),
+    max SimpleAggregateFunction(max, Float64),
+    min SimpleAggregateFunction(min, Float64),
+    count AggregateFunction(count),
+    sum SimpleAggregateFunction(sum, Float64),
+    bytes SimpleAggregateFunction(sum, Float64),
+    type UInt8
+) ENGINE = {{.AggregatingMergeTree}}
+PARTITION BY toDate(toDateTime(intDiv(timestamp_ns, 1000000000)))
+ORDER BY (fingerprint, timestamp_ns, type) {{.CREATE_SETTINGS}};
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS {{.DB}}.metrics_5m_mv {{.OnCluster}} TO {{.DB}}.metrics_5m
+AS SELECT
+    fingerprint,
+    intDiv(samples.timestamp_ns, 300000000000) * 300000000000 as timestamp_ns,
+    argMaxState(value, samples.timestamp_ns) as last,
+    maxSimpleState(value) as max,
+    minSimpleState(value) as min,
+    countState() as count,
+    sumSimpleState(value) as sum,
+    sumSimpleState(length(string)) as bytes,
+    type
+FROM {{.DB}}.samples_v3 as samples
+GROUP BY fingerprint, timestamp_ns, type;
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.metrics_1h {{.OnCluster}} (
+    fingerprint UInt64,
+    timestamp_ns Int64 CODEC(DoubleDelta),
+    last AggregateFunction(argMax, Float64, Int64),
+    max SimpleAggregateFunction(max, Float64),
+    min SimpleAggregateFunction(min, Float64),
+    count AggregateFunction(count),
+    sum SimpleAggregateFunction(sum, Float64),
+    bytes SimpleAggregateFunction(sum, Float64),
+    type UInt8
+) ENGINE = {{.AggregatingMergeTree}}
+PARTITION BY toStartOfMonth(toDateTime(intDiv(timestamp_ns, 1000000000)))
+ORDER BY (fingerprint, timestamp_ns, type) {{.CREATE_SETTINGS}};
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS {{.DB}}.metrics_1h_mv {{.OnCluster}} TO {{.DB}}.metrics_1h
+AS SELECT
+    fingerprint,
+    intDiv(samples.timestamp_ns, 3600000000000) * 3600000000000 as timestamp_ns,
+    argMaxState(value, samples.timestamp_ns) as last,
+    maxSimpleState(value) as max,
+    minSimpleState(value) as min,
+    countState() as count,
+    sumSimpleState(value) as sum,
+    sumSimpleState(length(string)) as bytes,
+    type
+FROM {{.DB}}.samples_v3 as samples
+GROUP BY fingerprint, timestamp_ns, type;
+
+INSERT INTO {{.DB}}.settings (fingerprint, type, name, value, inserted_at)
+VALUES (cityHash64('update_metrics_rollups_v1'), 'update', 'metrics_rollups_v1', toString(toUnixTimestamp(NOW())), NOW());
@@ -82,3 +82,46 @@ ALTER TABLE {{.DB}}.time_series_dist {{.OnCluster}}
 
 ALTER TABLE {{.DB}}.time_series_dist {{.OnCluster}}
     ADD COLUMN IF NOT EXISTS updated_at_ns Int64 DEFAULT toUnixTimestamp64Nano(now64(9));
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.native_histograms_dist {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `count` Float64 CODEC(Gorilla),
+    `sum` Float64 CODEC(Gorilla),
+    `histogram` String CODEC(ZSTD)
+) ENGINE = Distributed('{{.CLUSTER}}','{{.DB}}', 'native_histograms', fingerprint) {{.DIST_CREATE_SETTINGS}};
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.exemplars_dist {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `value` Float64 CODEC(Gorilla),
+    `trace_id` String,
+    `labels` String CODEC(ZSTD)
+) ENGINE = Distributed('{{.CLUSTER}}','{{.DB}}', 'exemplars', fingerprint) {{.DIST_CREATE_SETTINGS}};
+
+ALTER TABLE {{.DB}}.samples_v3_dist {{.OnCluster}}
+    ADD COLUMN IF NOT EXISTS `structured_metadata` String DEFAULT '' CODEC(ZSTD);
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.metrics_5m_dist {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `last` AggregateFunction(argMax, Float64, Int64),
+    `max` SimpleAggregateFunction(max, Float64),
+    `min` SimpleAggregateFunction(min, Float64),
+    `count` AggregateFunction(count),
+    `sum` SimpleAggregateFunction(sum, Float64),
+    `bytes` SimpleAggregateFunction(sum, Float64),
+    `type` UInt8
+) ENGINE = Distributed('{{.CLUSTER}}', '{{.DB}}', 'metrics_5m', fingerprint) {{.DIST_CREATE_SETTINGS}};
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.metrics_1h_dist {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `last` AggregateFunction(argMax, Float64, Int64),
+    `max` SimpleAggregateFunction(max, Float64),
+    `min` SimpleAggregateFunction(min, Float64),
+    `count` AggregateFunction(count),
+    `sum` SimpleAggregateFunction(sum, Float64),
+    `bytes` SimpleAggregateFunction(sum, Float64),
+    `type` UInt8
+) ENGINE = Distributed('{{.CLUSTER}}', '{{.DB}}', 'metrics_1h', fingerprint) {{.DIST_CREATE_SETTINGS}};
@@ -73,3 +73,46 @@ ALTER TABLE {{.DB}}.time_series{{.READ_SUFFIX}} {{.OnCluster}}
 
 ALTER TABLE {{.DB}}.time_series{{.READ_SUFFIX}} {{.OnCluster}}
     ADD COLUMN IF NOT EXISTS updated_at_ns Int64 DEFAULT toUnixTimestamp64Nano(now64(9));
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.native_histograms{{.READ_SUFFIX}} {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `count` Float64 CODEC(Gorilla),
+    `sum` Float64 CODEC(Gorilla),
+    `histogram` String CODEC(ZSTD)
+) ENGINE = Distributed('{{.READ_CLUSTER}}','{{.DB}}', 'native_histograms', fingerprint) SETTINGS skip_unavailable_shards = 1;
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.exemplars{{.READ_SUFFIX}} {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `value` Float64 CODEC(Gorilla),
+    `trace_id` String,
+    `labels` String CODEC(ZSTD)
+) ENGINE = Distributed('{{.READ_CLUSTER}}','{{.DB}}', 'exemplars', fingerprint) SETTINGS skip_unavailable_shards = 1;
+
+ALTER TABLE {{.DB}}.samples_v3{{.READ_SUFFIX}} {{.OnCluster}}
+    ADD COLUMN IF NOT EXISTS `structured_metadata` String DEFAULT '' CODEC(ZSTD);
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.metrics_5m{{.READ_SUFFIX}} {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `last` AggregateFunction(argMax, Float64, Int64),
+    `max` SimpleAggregateFunction(max, Float64),
+    `min` SimpleAggregateFunction(min, Float64),
+    `count` AggregateFunction(count),
+    `sum` SimpleAggregateFunction(sum, Float64),
+    `bytes` SimpleAggregateFunction(sum, Float64),
+    `type` UInt8
+) ENGINE = Distributed('{{.READ_CLUSTER}}', '{{.DB}}', 'metrics_5m', fingerprint) SETTINGS skip_unavailable_shards = 1;
+
+CREATE TABLE IF NOT EXISTS {{.DB}}.metrics_1h{{.READ_SUFFIX}} {{.OnCluster}} (
+    `fingerprint` UInt64,
+    `timestamp_ns` Int64 CODEC(DoubleDelta),
+    `last` AggregateFunction(argMax, Float64, Int64),
+    `max` SimpleAggregateFunction(max, Float64),
+    `min` SimpleAggregateFunction(min, Float64),
+    `count` AggregateFunction(count),
+    `sum` SimpleAggregateFunction(sum, Float64),
+    `bytes` SimpleAggregateFunction(sum, Float64),
+    `type` UInt8
+) ENGINE = Distributed('{{.READ_CLUSTER}}', '{{.DB}}', 'metrics_1h', fingerprint) SETTINGS skip_unavailable_shards = 1;
@@ -34,3 +34,9 @@ var RulesScript string
 
 //go:embed rules_dist.sql
 var RulesDistScript string
+
+//go:embed delete_requests.sql
+var DeleteRequestsScript string
+
+//go:embed delete_requests_dist.sql
+var DeleteRequestsDistScript string
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/service"
+)
+
+// defaultCardinalityLimit is the default length of the lists of the
+// cardinality APIs, as in Prometheus.
+const defaultCardinalityLimit = 10
+
+type CardinalityController struct {
+	Controller
+	CardinalityService *service.CardinalityService
+}
+
+type cardinalityParams struct {
+	startMs int64
+	endMs   int64
+	limit   int
+}
+
+// parseCardinalityParams parses the time window, the last day by default,
+// and the length of the lists of the request.
+func parseCardinalityParams(r *http.Request) (cardinalityParams, error) {
+	var res cardinalityParams
+	end, err := ParseTimeSecOrRFC(r.FormValue("end"), time.Now())
+	if err != nil {
+		return res, err
+	}
+	start, err := ParseTimeSecOrRFC(r.FormValue("start"), end.Add(-24*time.Hour))
+	if err != nil {
+		return res, err
+	}
+	res.startMs, res.endMs, res.limit = start.UnixMilli(), end.UnixMilli(), defaultCardinalityLimit
+	if v := r.FormValue("limit"); v != "" {
+		res.limit, err = strconv.Atoi(v)
+		if err != nil || res.limit <= 0 {
+			return res, errors.New("limit must be a positive integer")
+		}
+	}
+	return res, nil
+}
+
+// TSDBStatus serves the cardinality of the metrics series in the format of
+// the Prometheus /api/v1/status/tsdb API.
+func (c *CardinalityController) TSDBStatus(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	params, err := parseCardinalityParams(r)
+	if err != nil {
+		PromError(400, "invalid parameters: "+err.Error(), w)
+		return
+	}
+	res, err := c.CardinalityService.TSDBStatus(internalCtx, params.startMs, params.endMs, params.limit,
+		r.FormValue("focusLabel"))
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	writeCardinality(w, res)
+}
+
+// StreamsStatus serves the stream selectors and the labels with the most log
+// streams.
+func (c *CardinalityController) StreamsStatus(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	params, err := parseCardinalityParams(r)
+	if err != nil {
+		PromError(400, "invalid parameters: "+err.Error(), w)
+		return
+	}
+	res, err := c.CardinalityService.StreamsStatus(internalCtx, params.startMs, params.endMs, params.limit)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	writeCardinality(w, res)
+}
+
+func writeCardinality(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "success",
+		"data":   data,
+	})
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/service"
+)
+
+type DeleteController struct {
+	Controller
+	DeleteService *service.DeleteService
+}
+
+// Create stores a delete request of the log lines matching query between
+// start and end, end defaults to now.
+func (d *DeleteController) Create(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	query := r.FormValue("query")
+	if query == "" {
+		PromError(400, "query parameter is required", w)
+		return
+	}
+	if r.FormValue("start") == "" {
+		PromError(400, "start parameter is required", w)
+		return
+	}
+	start, err := ParseTimeSecOrRFC(r.FormValue("start"), time.Time{})
+	if err != nil {
+		PromError(400, "invalid start time: "+err.Error(), w)
+		return
+	}
+	end, err := ParseTimeSecOrRFC(r.FormValue("end"), time.Now())
+	if err != nil {
+		PromError(400, "invalid end time: "+err.Error(), w)
+		return
+	}
+	_, err = d.DeleteService.Create(internalCtx, query, start, end)
+	if err != nil {
+		deleteError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List returns all the delete requests.
+func (d *DeleteController) List(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	reqs, err := d.DeleteService.List(internalCtx)
+	if err != nil {
+		deleteError(err, w)
+		return
+	}
+	if reqs == nil {
+		reqs = []*service.DeleteRequest{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reqs)
+}
+
+// Cancel cancels the delete request request_id if it is not processed yet.
+func (d *DeleteController) Cancel(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	requestID := r.FormValue("request_id")
+	if requestID == "" {
+		PromError(400, "request_id parameter is required", w)
+		return
+	}
+	if err := d.DeleteService.Cancel(internalCtx, requestID); err != nil {
+		deleteError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteSeries stores a delete request of the samples of the series matching
+// every match[] selector between start and end, in the format of the
+// Prometheus delete_series API. start defaults to the epoch, end to now.
+func (d *DeleteController) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	start, err := ParseTimeSecOrRFC(r.FormValue("start"), time.Unix(0, 0))
+	if err != nil {
+		PromError(400, "invalid start time: "+err.Error(), w)
+		return
+	}
+	end, err := ParseTimeSecOrRFC(r.FormValue("end"), time.Now())
+	if err != nil {
+		PromError(400, "invalid end time: "+err.Error(), w)
+		return
+	}
+	_, err = d.DeleteService.CreateSeries(internalCtx, r.Form["match[]"], start, end)
+	if err != nil {
+		deleteError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSeries returns all the series delete requests.
+func (d *DeleteController) ListSeries(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	reqs, err := d.DeleteService.ListSeries(internalCtx)
+	if err != nil {
+		deleteError(err, w)
+		return
+	}
+	if reqs == nil {
+		reqs = []*service.DeleteRequest{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "success",
+		"data":   reqs,
+	})
+}
+
+// CleanTombstones removes the rows of the processed series delete requests
+// from the disk.
+func (d *DeleteController) CleanTombstones(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	if err := d.DeleteService.CleanTombstones(internalCtx); err != nil {
+		deleteError(err, w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteError(err error, w http.ResponseWriter) {
+	if service.IsDeleteRequestError(err) {
+		PromError(400, err.Error(), w)
+		return
+	}
+	PromError(500, err.Error(), w)
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
+	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler"
+	"github.com/metrico/qryn/v5/reader/service"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// The explain endpoints return the planner chain and the SQL requests of a
+// query without running it. With `indexes=1` every request is analysed with
+// ClickHouse `EXPLAIN indexes = 1`.
+
+func explainIndexes(r *http.Request) bool {
+	return r.URL.Query().Get("indexes") == "1"
+}
+
+func writeExplain(w http.ResponseWriter, res *model.ExplainResult) {
+	bRes, err := jsoniter.Marshal(res)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"success","data":`))
+	w.Write(bRes)
+	w.Write([]byte("}"))
+}
+
+// Explain explains a LogQL query with the parameters of query_range.
+func (q *QueryRangeController) Explain(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		PromError(400, "query parameter is required", w)
+		return
+	}
+	now := time.Now()
+	start, err := getRequiredFloat(r, "start", strconv.FormatInt(now.Add(-time.Hour).UnixNano(), 10), nil)
+	end, err := getRequiredFloat(r, "end", strconv.FormatInt(now.UnixNano(), 10), err)
+	step, err := getRequiredDuration(r, "step", "1", err)
+	limit, err := getRequiredI64(r, "limit", strconv.FormatInt(queryDefaultLimit, 10), err)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	res, err := q.QueryRangeService.Explain(internalCtx, query, int64(start), int64(end), int64(step*1000),
+		limit, explainIndexes(r))
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	writeExplain(w, res)
+}
+
+// Explain explains a PromQL query: a range query when step is set, an instant
+// query at end otherwise.
+func (q *PromQueryRangeController) Explain(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	req, err := parseQueryRangePropsV3(r)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	if req.Query == "" {
+		PromError(400, "query is undefined", w)
+		return
+	}
+	expr, err := promql_parser.Parse(req.Query)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	expr, err = promql_transpiler.TranspileExpressionV2(expr)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	storage := q.Storage.SetOidAndDB(internalCtx, expr)
+	storage.Explain = &shared.Explain{}
+
+	var query promql.Query
+	if req.Step > 0 {
+		// the same alignment as QueryRange
+		req.Start = time.Unix(req.Start.Unix()/15*15, 0)
+		req.End = time.Unix(int64(math.Ceil(float64(req.End.Unix())/15)*15), 0)
+		query, err = q.Api.QueryEngine.NewRangeQuery(internalCtx, storage, nil, expr.Expr.String(),
+			req.Start, req.End, req.Step)
+	} else {
+		query, err = q.Api.QueryEngine.NewInstantQuery(internalCtx, storage, nil, expr.Expr.String(), req.End)
+	}
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	defer query.Close()
+	if res := query.Exec(internalCtx); res.Err != nil {
+		PromError(500, res.Err.Error(), w)
+		return
+	}
+
+	res := &model.ExplainResult{
+		Query: req.Query,
+		Steps: storage.Explain.Steps(),
+	}
+	plan := []string{expr.Expr.String()}
+	names := make([]string, 0, len(expr.Substitutes))
+	for name := range expr.Substitutes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		plan = append(plan, fmt.Sprintf("%s:\n%s", name, shared.DescribePlanner(expr.Substitutes[name].Request)))
+	}
+	res.Plan = strings.Join(plan, "\n")
+	if explainIndexes(r) {
+		db, err := q.Storage.Session.GetDB(internalCtx)
+		if err != nil {
+			PromError(500, err.Error(), w)
+			return
+		}
+		if err = service.ExplainIndexes(internalCtx, db, res.Steps); err != nil {
+			PromError(500, err.Error(), w)
+			return
+		}
+	}
+	writeExplain(w, res)
+}
+
+// Explain explains a TraceQL search with the parameters of search.
+func (t *TempoController) Explain(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	params, err := parseTraceSearchParams(r)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	if params.Q == "" {
+		PromError(400, "q parameter is required", w)
+		return
+	}
+	res, err := t.Service.ExplainTraceQL(internalCtx, params.Q, params.Limit, params.Start, params.End,
+		explainIndexes(r))
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	writeExplain(w, res)
+}
+
+// Explain explains the flame graph request of /pyroscope/render.
+func (pc *ProfController) Explain(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	for _, param := range []string{"query", "from", "until"} {
+		if r.URL.Query().Get(param) == "" {
+			defaultError(w, 400, fmt.Sprintf("Missing required parameter: %s", param))
+			return
+		}
+	}
+	var from, to time.Time
+	for _, v := range [][2]any{{"from", &from}, {"until", &to}} {
+		strVal := r.URL.Query().Get(v[0].(string))
+		iVal, err := strconv.ParseInt(strVal, 10, 64)
+		if err != nil {
+			defaultError(w, 400, fmt.Sprintf("Invalid value for %s", v[0].(string)))
+			return
+		}
+		*(v[1].(*time.Time)) = time.Unix(iVal/1000, 0)
+	}
+	res, err := pc.ProfService.ExplainRender(r.Context(), r.URL.Query().Get("query"), from, to, explainIndexes(r))
+	if err != nil {
+		defaultError(w, 500, err.Error())
+		return
+	}
+	writeExplain(w, res)
+}
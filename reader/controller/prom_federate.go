@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
+	"github.com/metrico/qryn/v5/reader/service"
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultFederateLookback is the default window the latest samples are looked
+// up in, the lookback delta of Prometheus.
+const defaultFederateLookback = time.Minute * 5
+
+// FederateConfig configures the /federate endpoint.
+type FederateConfig struct {
+	// Lookback is the window before now the latest sample of a series is
+	// looked up in
+	Lookback time.Duration
+	// ExternalLabels are attached to the series not having them, as the
+	// external labels of a federated Prometheus
+	ExternalLabels labels.Labels
+}
+
+// FederateConfigFromEnv reads the configuration of /federate from
+// QRYN_FEDERATE_LOOKBACK and QRYN_FEDERATE_EXTERNAL_LABELS, a comma separated
+// list of name=value pairs.
+func FederateConfigFromEnv() FederateConfig {
+	cfg := FederateConfig{Lookback: defaultFederateLookback, ExternalLabels: labels.EmptyLabels()}
+	if v := os.Getenv("QRYN_FEDERATE_LOOKBACK"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logger.Error("Invalid QRYN_FEDERATE_LOOKBACK value: ", v)
+		} else {
+			cfg.Lookback = d
+		}
+	}
+	if v := os.Getenv("QRYN_FEDERATE_EXTERNAL_LABELS"); v != "" {
+		external := map[string]string{}
+		for _, pair := range strings.Split(v, ",") {
+			name, val, ok := strings.Cut(pair, "=")
+			name = strings.TrimSpace(name)
+			if !ok || !model.LabelName(name).IsValidLegacy() {
+				logger.Error("Invalid QRYN_FEDERATE_EXTERNAL_LABELS value: ", v)
+				return cfg
+			}
+			external[name] = strings.TrimSpace(val)
+		}
+		cfg.ExternalLabels = labels.FromMap(external)
+	}
+	return cfg
+}
+
+type PromFederateController struct {
+	Controller
+	Storage *service.CLokiQueriable
+	Config  FederateConfig
+}
+
+// Federate serves the latest sample of every series matching a match[]
+// selector within the lookback window, in the Prometheus text or the
+// OpenMetrics format as negotiated by the client. As in Prometheus, the
+// series keep their own job and instance labels for the federating servers
+// scraping with honor_labels, and get the external labels they do not have.
+func (f *PromFederateController) Federate(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	ctx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	if len(r.Form["match[]"]) == 0 {
+		PromError(400, "no match[] parameter provided", w)
+		return
+	}
+	matcherSets, err := parser.NewParser(parser.Options{}).ParseMetricSelectors(r.Form["match[]"])
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	now := time.Now()
+	vec, err := f.latestSamples(ctx, now.Add(-f.Config.Lookback).UnixMilli(), now.UnixMilli(), matcherSets)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	if err := encodeFederation(expfmt.NewEncoder(w, format), vec, f.externalLabels()); err != nil {
+		logger.Error("federation failed: ", err)
+	}
+}
+
+// latestSamples returns the latest sample between mint and maxt of every
+// series matching one of matcherSets.
+func (f *PromFederateController) latestSamples(ctx context.Context, mint, maxt int64,
+	matcherSets [][]*labels.Matcher,
+) (promql.Vector, error) {
+	queryable := f.Storage.SetOidAndDB(ctx, &promql_parser.Expr{})
+	queryable.Raw = true
+	q, err := queryable.Querier(mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	hints := &storage.SelectHints{Start: mint, End: maxt}
+	sets := make([]storage.SeriesSet, len(matcherSets))
+	for i, matchers := range matcherSets {
+		sets[i] = q.Select(ctx, true, hints, matchers...)
+	}
+	set := storage.NewMergeSeriesSet(sets, 0, storage.ChainedSeriesMerge)
+	var (
+		vec promql.Vector
+		it  chunkenc.Iterator
+	)
+	for set.Next() {
+		s := set.At()
+		it = s.Iterator(it)
+		if sample, ok := latestFloat(it, maxt); ok {
+			sample.Metric = s.Labels()
+			vec = append(vec, sample)
+		}
+	}
+	return vec, set.Err()
+}
+
+// latestFloat returns the latest float sample of it up to maxt, unless it is
+// a staleness marker.
+func latestFloat(it chunkenc.Iterator, maxt int64) (promql.Sample, bool) {
+	var (
+		res promql.Sample
+		ok  bool
+	)
+	for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+		if vt != chunkenc.ValFloat {
+			continue
+		}
+		t, v := it.At()
+		if t > maxt {
+			break
+		}
+		res.T, res.F, ok = t, v, true
+	}
+	return res, ok && !value.IsStaleNaN(res.F)
+}
+
+// externalLabels returns the external labels of the series. As in Prometheus,
+// an empty instance label keeps the federating servers from setting their own.
+func (f *PromFederateController) externalLabels() []labels.Label {
+	res := f.Config.ExternalLabels.Copy()
+	external := make([]labels.Label, 0, res.Len()+1)
+	res.Range(func(l labels.Label) {
+		external = append(external, l)
+	})
+	if !res.Has(model.InstanceLabel) {
+		external = append(external, labels.Label{Name: model.InstanceLabel})
+	}
+	return external
+}
+
+// encodeFederation writes the samples of vec as untyped metric families, the
+// external labels the series do not have added.
+func encodeFederation(enc expfmt.Encoder, vec promql.Vector, external []labels.Label) error {
+	slices.SortFunc(vec, func(a, b promql.Sample) int {
+		if c := strings.Compare(a.Metric.Get(labels.MetricName), b.Metric.Get(labels.MetricName)); c != 0 {
+			return c
+		}
+		return labels.Compare(a.Metric, b.Metric)
+	})
+	var fam *dto.MetricFamily
+	for _, s := range vec {
+		name := s.Metric.Get(labels.MetricName)
+		if name == "" {
+			continue
+		}
+		if fam == nil || fam.GetName() != name {
+			if fam != nil {
+				if err := enc.Encode(fam); err != nil {
+					return err
+				}
+			}
+			fam = &dto.MetricFamily{Name: proto.String(name), Type: dto.MetricType_UNTYPED.Enum()}
+		}
+		m := &dto.Metric{
+			Untyped:     &dto.Untyped{Value: proto.Float64(s.F)},
+			TimestampMs: proto.Int64(s.T),
+		}
+		s.Metric.Range(func(l labels.Label) {
+			if l.Name != labels.MetricName && l.Value != "" {
+				m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+			}
+		})
+		for _, l := range external {
+			if s.Metric.Get(l.Name) == "" {
+				m.Label = append(m.Label, &dto.LabelPair{Name: proto.String(l.Name), Value: proto.String(l.Value)})
+			}
+		}
+		fam.Metric = append(fam.Metric, m)
+	}
+	if fam != nil {
+		if err := enc.Encode(fam); err != nil {
+			return err
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
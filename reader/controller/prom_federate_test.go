@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+)
+
+func TestEncodeFederation(t *testing.T) {
+	vec := promql.Vector{
+		{Metric: labels.FromStrings("__name__", "up", "job", "node", "instance", "b:9100"), T: 2000, F: 1},
+		{Metric: labels.FromStrings("__name__", "http_requests_total", "job", "api"), T: 1000, F: 12.5},
+		{Metric: labels.FromStrings("__name__", "up", "job", "node", "instance", "a:9100", "cluster", "eu"), T: 2000, F: 0},
+	}
+	ctrl := &PromFederateController{Config: FederateConfig{ExternalLabels: labels.FromStrings("cluster", "us")}}
+
+	var buf bytes.Buffer
+	if err := encodeFederation(expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeTextPlain)), vec,
+		ctrl.externalLabels()); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE http_requests_total untyped
+http_requests_total{job="api",cluster="us",instance=""} 12.5 1000
+# TYPE up untyped
+up{cluster="eu",instance="a:9100",job="node"} 0 2000
+up{instance="b:9100",job="node",cluster="us"} 1 2000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("text federation:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	vec = promql.Vector{{Metric: labels.FromStrings("__name__", "http_requests_total", "job", "api"), T: 1000, F: 12.5}}
+	if err := encodeFederation(expfmt.NewEncoder(&buf, expfmt.NewFormat(expfmt.TypeOpenMetrics)), vec,
+		ctrl.externalLabels()); err != nil {
+		t.Fatal(err)
+	}
+	want = `# TYPE http_requests_total unknown
+http_requests_total{job="api",cluster="us",instance=""} 12.5 1.0
+# EOF
+`
+	if got := buf.String(); got != want {
+		t.Errorf("OpenMetrics federation:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFederateBadRequest(t *testing.T) {
+	ctrl := &PromFederateController{Config: FederateConfig{Lookback: defaultFederateLookback}}
+	for name, url := range map[string]string{
+		"no match[]":      "/federate",
+		"invalid match[]": "/federate?match[]=" + "%7Bjob%3D%7D",
+	} {
+		rec := httptest.NewRecorder()
+		ctrl.Federate(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestFederateConfigFromEnv(t *testing.T) {
+	t.Setenv("QRYN_FEDERATE_LOOKBACK", "10m")
+	t.Setenv("QRYN_FEDERATE_EXTERNAL_LABELS", "cluster=eu, replica=a")
+	cfg := FederateConfigFromEnv()
+	if cfg.Lookback != 10*time.Minute {
+		t.Errorf("Lookback = %s, want 10m", cfg.Lookback)
+	}
+	if want := labels.FromStrings("cluster", "eu", "replica", "a"); !labels.Equal(cfg.ExternalLabels, want) {
+		t.Errorf("ExternalLabels = %s, want %s", cfg.ExternalLabels, want)
+	}
+
+	t.Setenv("QRYN_FEDERATE_LOOKBACK", "-1m")
+	t.Setenv("QRYN_FEDERATE_EXTERNAL_LABELS", "cluster")
+	cfg = FederateConfigFromEnv()
+	if cfg.Lookback != defaultFederateLookback || !cfg.ExternalLabels.IsEmpty() {
+		t.Errorf("invalid values must fall back to the defaults, got %+v", cfg)
+	}
+}
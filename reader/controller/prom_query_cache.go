@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
+	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler"
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/util/stats"
+)
+
+// cacheable reports if the result of every step of expr is independent of
+// the range of the query: `@ start()` and `@ end()` are not.
+func cacheable(expr parser.Expr) bool {
+	res := true
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			res = res && n.StartOrEnd == 0
+		case *parser.SubqueryExpr:
+			res = res && n.StartOrEnd == 0
+		}
+		return nil
+	})
+	return res
+}
+
+// cachedQueryRange runs a range query through the results cache. Every
+// missing range is planned anew, the planners keep per request state. The
+// statistics are the ones of the last query run by the engine.
+func (q *PromQueryRangeController) cachedQueryRange(ctx context.Context, query string, req QueryRangeProps,
+) (*promql.Result, *stats.Statistics, error) {
+	st := &stats.Statistics{Timers: stats.NewQueryTimers()}
+	series, err := q.Cache.Query(ctx, "prometheus", query, req.Start.UnixMilli(), req.End.UnixMilli(),
+		req.Step.Milliseconds(), func(ctx context.Context, start, end int64) ([]resultscache.Series, error) {
+			expr, err := promql_parser.Parse(req.Query)
+			if err != nil {
+				return nil, err
+			}
+			expr, err = promql_transpiler.TranspileExpressionV2(expr)
+			if err != nil {
+				return nil, err
+			}
+			rangeQuery, err := q.Api.QueryEngine.NewRangeQuery(ctx, q.Storage.SetOidAndDB(ctx, expr), nil,
+				expr.Expr.String(), time.UnixMilli(start), time.UnixMilli(end), req.Step)
+			if err != nil {
+				return nil, err
+			}
+			defer rangeQuery.Close()
+			res := rangeQuery.Exec(ctx)
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			st = rangeQuery.Stats()
+			matrix, err := res.Matrix()
+			if err != nil {
+				return nil, err
+			}
+			return fromMatrix(matrix), nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &promql.Result{Value: toMatrix(series)}, st, nil
+}
+
+// fromMatrix converts the float and the native histogram samples of a
+// matrix.
+func fromMatrix(matrix promql.Matrix) []resultscache.Series {
+	res := make([]resultscache.Series, len(matrix))
+	for i, s := range matrix {
+		samples := make([]resultscache.Sample, 0, len(s.Floats)+len(s.Histograms))
+		for _, p := range s.Floats {
+			samples = append(samples, resultscache.Sample{T: p.T, V: p.F})
+		}
+		for _, p := range s.Histograms {
+			samples = append(samples, resultscache.Sample{T: p.T, H: p.H})
+		}
+		if len(s.Floats) > 0 && len(s.Histograms) > 0 {
+			sort.Slice(samples, func(i, j int) bool { return samples[i].T < samples[j].T })
+		}
+		res[i] = resultscache.Series{Labels: s.Metric.Map(), Samples: samples}
+	}
+	return res
+}
+
+func toMatrix(series []resultscache.Series) promql.Matrix {
+	res := make(promql.Matrix, len(series))
+	for i, s := range series {
+		res[i] = promql.Series{Metric: labels.FromMap(s.Labels)}
+		for _, sample := range s.Samples {
+			if sample.H != nil {
+				res[i].Histograms = append(res[i].Histograms, promql.HPoint{T: sample.T, H: sample.H})
+				continue
+			}
+			res[i].Floats = append(res[i].Floats, promql.FPoint{T: sample.T, F: sample.V})
+		}
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func TestCacheable(t *testing.T) {
+	for query, want := range map[string]bool{
+		`sum by (job) (rate(http_requests_total[5m]))`:                true,
+		`http_requests_total @ 1700000000`:                            true,
+		`rate(http_requests_total[5m] @ end())`:                       false,
+		`max_over_time(rate(http_requests_total[1m])[1h:] @ start())`: false,
+	} {
+		expr, err := parser.NewParser(parser.Options{}).ParseExpr(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cacheable(expr); got != want {
+			t.Errorf("cacheable(%s) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestCachedMatrixKeepsHistograms(t *testing.T) {
+	h := &histogram.FloatHistogram{
+		Count:           3,
+		Sum:             1.5,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+		PositiveBuckets: []float64{1, 2},
+	}
+	matrix := promql.Matrix{
+		{
+			Metric:     labels.FromStrings("__name__", "mixed"),
+			Floats:     []promql.FPoint{{T: 1000, F: 1}, {T: 3000, F: 3}},
+			Histograms: []promql.HPoint{{T: 2000, H: h}},
+		},
+		{
+			Metric:     labels.FromStrings("__name__", "native"),
+			Histograms: []promql.HPoint{{T: 1000, H: h}, {T: 2000, H: h}},
+		},
+	}
+	c := resultscache.NewWithBackend(resultscache.Config{TTL: time.Hour, Interval: time.Hour}, resultscache.NewLRU(1<<20))
+	fetched := 0
+	for i := 0; i < 2; i++ {
+		series, err := c.Query(context.Background(), "prometheus", "q", 1000, 3000, 1000,
+			func(context.Context, int64, int64) ([]resultscache.Series, error) {
+				fetched++
+				return fromMatrix(matrix), nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := toMatrix(series); !reflect.DeepEqual(res, matrix) {
+			t.Errorf("query %d returned %v, want %v", i, res, matrix)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("fetched %d times, want the cached matrix", fetched)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
 	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler"
 	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/metrico/qryn/v5/reader/utils/querystats"
 	"net/http"
 	"time"
 
@@ -43,6 +44,7 @@ func (q *PromQueryRangeController) QueryInstant(w http.ResponseWriter, r *http.R
 		PromError(500, err.Error(), w)
 		return
 	}
+	ctx, st := querystats.NewContext(ctx)
 	promQuery, err := q.Api.QueryEngine.NewInstantQuery(ctx, q.Storage.SetOidAndDB(ctx, expr), nil,
 		expr.Expr.String(), req.Time)
 	if err != nil {
@@ -54,7 +56,7 @@ func (q *PromQueryRangeController) QueryInstant(w http.ResponseWriter, r *http.R
 		PromError(500, res.Err.Error(), w)
 		return
 	}
-	err = writeResponse(res, w)
+	err = writeResponse(res, w, q.queryStats(r, promQuery.Stats(), res, st))
 	if err != nil {
 		PromError(500, err.Error(), w)
 		return
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/schema"
+	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
 	"github.com/metrico/qryn/v5/reader/service"
 )
 
@@ -14,6 +15,7 @@ type PromQueryLabelsController struct {
 	Controller
 	QueryLabelsService *service.QueryLabelsService
 	MetadataService    *service.MetadataService
+	ExemplarsService   *service.ExemplarsService
 }
 
 type promLabelsParams struct {
@@ -164,6 +166,42 @@ func getPromSeriesParamsV2(r *http.Request) (promSeriesParams, error) {
 	return res, nil
 }
 
+func (p *PromQueryLabelsController) QueryExemplars(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	query := r.Form.Get("query")
+	if query == "" {
+		PromError(400, "query is required", w)
+		return
+	}
+	start := parserTimeString(r.Form.Get("start"), time.Now().Add(time.Hour*-6))
+	end := parserTimeString(r.Form.Get("end"), time.Now())
+	if end.Before(start) {
+		PromError(400, "end timestamp must not be before start time", w)
+		return
+	}
+	expr, err := promql_parser.Parse(query)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	res, err := p.ExemplarsService.QueryExemplars(internalCtx, expr, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	SmartBufferServe(w, res)
+}
+
 func parserTimeString(strTime string, def time.Time) time.Time {
 	tTime, err := time.Parse(time.RFC3339, strTime)
 	if err == nil {
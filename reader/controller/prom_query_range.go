@@ -15,9 +15,12 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/metrico/qryn/v5/reader/service"
 	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/metrico/qryn/v5/reader/utils/querystats"
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/util/stats"
 	api_v1 "github.com/prometheus/prometheus/web/api/v1"
 )
 
@@ -26,6 +29,8 @@ type PromQueryRangeController struct {
 	Api     *api_v1.API
 	Storage *service.CLokiQueriable
 	Stats   bool
+	// Cache is the results cache of the range queries, nil if disabled
+	Cache *resultscache.Cache
 }
 type QueryRangeProps struct {
 	Start time.Time
@@ -75,6 +80,21 @@ func (q *PromQueryRangeController) QueryRange(w http.ResponseWriter, r *http.Req
 		PromError(400, err.Error(), w)
 		return
 	}
+	internalCtx, st := querystats.NewContext(internalCtx)
+	if q.Cache != nil && cacheable(expr.Expr) {
+		res, engineStats, err := q.cachedQueryRange(internalCtx, expr.Expr.String(), req)
+		if err != nil {
+			logger.Error("[PQRC006] " + err.Error())
+			PromError(500, err.Error(), w)
+			return
+		}
+		err = writeResponse(res, w, q.queryStats(r, engineStats, res, st))
+		if err != nil {
+			logger.Error("[PQRC003] " + err.Error())
+			PromError(500, err.Error(), w)
+		}
+		return
+	}
 	expr, err = promql_transpiler.TranspileExpressionV2(expr)
 	if err != nil {
 		logger.Error("[PQRC005] " + err.Error())
@@ -94,7 +114,7 @@ func (q *PromQueryRangeController) QueryRange(w http.ResponseWriter, r *http.Req
 		PromError(500, res.Err.Error(), w)
 		return
 	}
-	err = writeResponse(res, w)
+	err = writeResponse(res, w, q.queryStats(r, rangeQuery.Stats(), res, st))
 	if err != nil {
 		logger.Error("[PQRC003] " + err.Error())
 		PromError(500, err.Error(), w)
@@ -167,7 +187,36 @@ func PromError(code int, msg string, w http.ResponseWriter) {
 	})
 }
 
-func writeResponse(res *promql.Result, w http.ResponseWriter) error {
+// promQueryStats is the stats field of the response: the timings of the
+// engine followed by the statistics of the ClickHouse requests.
+type promQueryStats struct {
+	stats.BuiltinStats
+	ClickHouse querystats.Summary `json:"clickhouse"`
+}
+
+// queryStats ends the collection of the statistics of the query and returns
+// them if they are requested with the `stats` parameter or enabled in the
+// settings, nil otherwise.
+func (q *PromQueryRangeController) queryStats(r *http.Request, engineStats *stats.Statistics,
+	res *promql.Result, st *querystats.Stats,
+) *promQueryStats {
+	switch val := res.Value.(type) {
+	case promql.Matrix:
+		st.AddSeries(len(val))
+	case promql.Vector:
+		st.AddSeries(len(val))
+	}
+	sum := st.Finish("prometheus")
+	if !q.Stats && r.FormValue("stats") == "" {
+		return nil
+	}
+	return &promQueryStats{
+		BuiltinStats: stats.NewQueryStats(engineStats).Builtin(),
+		ClickHouse:   sum,
+	}
+}
+
+func writeResponse(res *promql.Result, w http.ResponseWriter, queryStats *promQueryStats) error {
 	w.Header().Set("Content-Type", "application/json")
 
 	json := jsoniter.ConfigFastest
@@ -205,7 +254,17 @@ func writeResponse(res *promql.Result, w http.ResponseWriter) error {
 		return err
 	}
 
-	w.Write([]byte("]}}"))
+	if queryStats == nil {
+		w.Write([]byte("]}}"))
+		return nil
+	}
+	bStats, err := json.Marshal(queryStats)
+	if err != nil {
+		return err
+	}
+	w.Write([]byte(`],"stats":`))
+	w.Write(bStats)
+	w.Write([]byte("}}"))
 	return nil
 }
 
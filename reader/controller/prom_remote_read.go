@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
+	"github.com/metrico/qryn/v5/reader/service"
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/storage/remote"
+)
+
+// defaultRemoteReadMaxBytesInFrame is the default size of the frames of the
+// streamed responses, as in Prometheus.
+const defaultRemoteReadMaxBytesInFrame = 1024 * 1024
+
+// RemoteReadMaxBytesInFrameFromEnv reads the maximum size of the frames of the
+// streamed remote read responses from QRYN_REMOTE_READ_MAX_BYTES_IN_FRAME.
+func RemoteReadMaxBytesInFrameFromEnv() int {
+	v := os.Getenv("QRYN_REMOTE_READ_MAX_BYTES_IN_FRAME")
+	if v == "" {
+		return defaultRemoteReadMaxBytesInFrame
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		logger.Error("Invalid QRYN_REMOTE_READ_MAX_BYTES_IN_FRAME value: ", v)
+		return defaultRemoteReadMaxBytesInFrame
+	}
+	return n
+}
+
+type PromRemoteReadController struct {
+	Controller
+	Storage *service.CLokiQueriable
+	// SampleLimit is the maximum number of samples of a query of the sampled
+	// responses, 0 for no limit
+	SampleLimit int
+	// MaxBytesInFrame is the maximum size of a frame of the streamed
+	// responses, a series bigger than that is split over several frames
+	MaxBytesInFrame int
+
+	marshalPool sync.Pool
+}
+
+// Read serves the Prometheus remote read requests, either as a sampled
+// response or as a stream of XOR chunks as negotiated by the client.
+func (q *PromRemoteReadController) Read(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	ctx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	req, err := remote.DecodeReadRequest(r)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	responseType, err := remote.NegotiateResponseType(req.AcceptedResponseTypes)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	if responseType == prompb.ReadRequest_STREAMED_XOR_CHUNKS {
+		q.readChunks(ctx, w, req)
+		return
+	}
+	q.readSamples(ctx, w, req)
+}
+
+func (q *PromRemoteReadController) readSamples(ctx context.Context, w http.ResponseWriter, req *prompb.ReadRequest) {
+	resp := prompb.ReadResponse{
+		Results: make([]*prompb.QueryResult, len(req.Queries)),
+	}
+	for i, query := range req.Queries {
+		matchers, err := remote.FromLabelMatchers(query.Matchers)
+		if err != nil {
+			PromError(400, err.Error(), w)
+			return
+		}
+		querier, err := q.queryable(ctx, query).Querier(query.StartTimestampMs, query.EndTimestampMs)
+		if err != nil {
+			PromError(500, err.Error(), w)
+			return
+		}
+		resp.Results[i], _, err = remote.ToQueryResult(
+			querier.Select(ctx, false, remoteReadHints(query), matchers...), q.SampleLimit)
+		querier.Close()
+		if err != nil {
+			remoteReadError(err, w)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	if err := remote.EncodeReadResponse(&resp, w); err != nil {
+		PromError(500, err.Error(), w)
+	}
+}
+
+func (q *PromRemoteReadController) readChunks(ctx context.Context, w http.ResponseWriter, req *prompb.ReadRequest) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		PromError(500, "the response writer does not support streaming", w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+	for i, query := range req.Queries {
+		matchers, err := remote.FromLabelMatchers(query.Matchers)
+		if err != nil {
+			PromError(400, err.Error(), w)
+			return
+		}
+		querier, err := q.queryable(ctx, query).ChunkQuerier(query.StartTimestampMs, query.EndTimestampMs)
+		if err != nil {
+			PromError(500, err.Error(), w)
+			return
+		}
+		// The streamed series have to be sorted.
+		_, err = remote.StreamChunkedReadResponses(remote.NewChunkedWriter(w, f), int64(i),
+			querier.Select(ctx, true, remoteReadHints(query), matchers...), nil, q.MaxBytesInFrame,
+			&q.marshalPool)
+		querier.Close()
+		if err != nil {
+			remoteReadError(err, w)
+			return
+		}
+	}
+}
+
+// queryable returns the storage of query. The queries without hints, as
+// sent by the backfill tools, get the stored samples as they are. The ones
+// with the hints of a PromQL engine get the samples the engine of qryn would.
+func (q *PromRemoteReadController) queryable(ctx context.Context, query *prompb.Query) *service.CLokiQueriable {
+	res := q.Storage.SetOidAndDB(ctx, &promql_parser.Expr{})
+	res.Raw = query.Hints == nil
+	return res
+}
+
+// remoteReadHints returns the select hints of query, the time range of the
+// query if it has none.
+func remoteReadHints(query *prompb.Query) *storage.SelectHints {
+	if query.Hints == nil {
+		return &storage.SelectHints{
+			Start: query.StartTimestampMs,
+			End:   query.EndTimestampMs,
+		}
+	}
+	return &storage.SelectHints{
+		Start:    query.Hints.StartMs,
+		End:      query.Hints.EndMs,
+		Step:     query.Hints.StepMs,
+		Func:     query.Hints.Func,
+		Grouping: query.Hints.Grouping,
+		By:       query.Hints.By,
+		Range:    query.Hints.RangeMs,
+	}
+}
+
+func remoteReadError(err error, w http.ResponseWriter) {
+	var httpErr remote.HTTPError
+	if errors.As(err, &httpErr) {
+		PromError(httpErr.Status(), httpErr.Error(), w)
+		return
+	}
+	PromError(500, err.Error(), w)
+}
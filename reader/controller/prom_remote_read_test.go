@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+)
+
+func remoteReadRequest(t *testing.T, req *prompb.ReadRequest) *http.Request {
+	t.Helper()
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader(snappy.Encode(nil, b)))
+}
+
+func TestRemoteRead(t *testing.T) {
+	ctrl := &PromRemoteReadController{MaxBytesInFrame: defaultRemoteReadMaxBytesInFrame}
+
+	rec := httptest.NewRecorder()
+	ctrl.Read(rec, remoteReadRequest(t, &prompb.ReadRequest{}))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "snappy" {
+		t.Fatalf("sampled response: %d, %v", rec.Code, rec.Header())
+	}
+	b, err := snappy.Decode(nil, rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp prompb.ReadResponse
+	if err := resp.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	ctrl.Read(rec, remoteReadRequest(t, &prompb.ReadRequest{
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	}))
+	if rec.Code != http.StatusOK ||
+		rec.Header().Get("Content-Type") != "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse" {
+		t.Fatalf("streamed response: %d, %v", rec.Code, rec.Header())
+	}
+
+	for name, r := range map[string]*http.Request{
+		"unsupported response type": remoteReadRequest(t, &prompb.ReadRequest{
+			AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{5},
+		}),
+		"not snappy": httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader([]byte("{}"))),
+	} {
+		rec = httptest.NewRecorder()
+		ctrl.Read(rec, r)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", name, rec.Code)
+		}
+	}
+}
+
+func TestRemoteReadHints(t *testing.T) {
+	query := &prompb.Query{StartTimestampMs: 1000, EndTimestampMs: 2000}
+	if got, want := remoteReadHints(query), (&storage.SelectHints{Start: 1000, End: 2000}); !reflect.DeepEqual(got, want) {
+		t.Errorf("remoteReadHints() = %+v, want %+v", got, want)
+	}
+
+	query.Hints = &prompb.ReadHints{StartMs: 500, EndMs: 2000, StepMs: 15000, Func: "rate", RangeMs: 300000}
+	want := &storage.SelectHints{Start: 500, End: 2000, Step: 15000, Func: "rate", Range: 300000}
+	if got := remoteReadHints(query); !reflect.DeepEqual(got, want) {
+		t.Errorf("remoteReadHints() = %+v, want %+v", got, want)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/service"
 	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/metrico/qryn/v5/reader/utils/querystats"
 )
 
 const (
@@ -54,8 +55,9 @@ func (q *QueryRangeController) QueryRange(w http.ResponseWriter, r *http.Request
 		PromError(400, err.Error(), w)
 		return
 	}
+	internalCtx, _ = querystats.NewContext(internalCtx)
 	ch, err := q.QueryRangeService.QueryRange(internalCtx, query, int64(start), int64(end), int64(step*1000),
-		limit, direction == "forward")
+		limit, direction == "forward", hasEncodingFlag(r, service.CategorizeLabelsFlag))
 	if err != nil {
 		PromError(500, err.Error(), w)
 		return
@@ -140,8 +142,9 @@ func (q *QueryRangeController) Query(w http.ResponseWriter, r *http.Request) {
 		PromError(400, err.Error(), w)
 		return
 	}
+	internalCtx, _ = querystats.NewContext(internalCtx)
 	ch, err := q.QueryRangeService.QueryInstant(internalCtx, query, iTime, int64(step*1000),
-		limit)
+		limit, hasEncodingFlag(r, service.CategorizeLabelsFlag))
 	if err != nil {
 		PromError(500, err.Error(), w)
 		return
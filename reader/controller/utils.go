@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/metrico/qryn/v5/reader/model"
@@ -116,6 +117,19 @@ func epochToTime(v int64, frac float64) time.Time {
 	}
 }
 
+// hasEncodingFlag reports if the client requested the Loki response encoding
+// flag in the X-Loki-Response-Encoding-Flags header.
+func hasEncodingFlag(r *http.Request, flag string) bool {
+	for _, h := range r.Header.Values("X-Loki-Response-Encoding-Flags") {
+		for _, f := range strings.Split(h, ",") {
+			if strings.TrimSpace(f) == flag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func tamePanic(w http.ResponseWriter, r *http.Request) {
 	if err := recover(); err != nil {
 		logger.Error("panic:", err, " stack:", string(debug.Stack()))
@@ -113,15 +113,55 @@ func (q *VolumeController) DetectedLabels(w http.ResponseWriter, r *http.Request
 	w.Write(stream.Buffer())
 }
 
+// DetectedFields returns the structured metadata keys of the log lines
+// matching the query.
 func (q *VolumeController) DetectedFields(w http.ResponseWriter, r *http.Request) {
+	defer tamePanic(w, r)
+	internalCtx, err := RunPreRequestPlugins(r)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+	req, err := parseQueryRangePropsV3(r)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	limit, err := getRequiredI64(r, "limit", "1000", nil)
+	lineLimit, err := getRequiredI64(r, "line_limit", "1000", err)
+	if err != nil {
+		PromError(400, err.Error(), w)
+		return
+	}
+	res := []service.QueryDetectedFieldsResult{}
+	if query := r.URL.Query().Get("query"); query != "" {
+		res, err = q.QueryRangeService.QueryDetectedFields(internalCtx, query, req.Start.UnixNano(),
+			req.End.UnixNano(), lineLimit)
+		if err != nil {
+			PromError(500, err.Error(), w)
+			return
+		}
+	}
+	if int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	bRes, err := jsoniter.Marshal(res)
+	if err != nil {
+		PromError(500, err.Error(), w)
+		return
+	}
+
 	json := jsoniter.ConfigFastest
 	stream := json.BorrowStream(nil)
 	defer json.ReturnStream(stream)
 
 	stream.WriteObjectStart()
 	stream.WriteObjectField("fields")
-	stream.WriteArrayStart()
-	stream.WriteArrayEnd()
+	stream.WriteRaw(string(bRes))
+	stream.WriteMore()
+	stream.WriteObjectField("limit")
+	stream.WriteInt64(limit)
 	stream.WriteObjectEnd()
 
 	w.Write(stream.Buffer())
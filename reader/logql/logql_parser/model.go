@@ -20,7 +20,7 @@ func (l LogQLScript) String() string {
 	parts := make([]string, 0, 1+len(l.BinOps)*2)
 	parts = append(parts, l.Head.String())
 	for _, b := range l.BinOps {
-		parts = append(parts, b.Op, b.Right.String())
+		parts = append(parts, b.OpString(), b.Right.String())
 	}
 	return strings.Join(parts, " ")
 }
@@ -30,8 +30,60 @@ func (l *LogQLScript) IsBinary() bool {
 }
 
 type BinOpPart struct {
-	Op    string   `@("/" | "*" | "+" | "-" | "%")`
-	Right AtomExpr `@@`
+	Op       string          `@("/" | "*" | "+" | "-" | "%" | "==" | "!=" | ">=" | ">" | "<=" | "<" | "and" | "or" | "unless")`
+	Bool     bool            `@"bool"?`
+	Matching *VectorMatching `@@?`
+	Right    AtomExpr        `@@`
+}
+
+// OpString returns the operator with its bool and vector matching modifiers.
+func (b *BinOpPart) OpString() string {
+	res := b.Op
+	if b.Bool {
+		res += " bool"
+	}
+	if b.Matching != nil {
+		res += " " + b.Matching.String()
+	}
+	return res
+}
+
+// IsComparison reports whether the operator is a comparison.
+func (b *BinOpPart) IsComparison() bool {
+	switch b.Op {
+	case "==", "!=", ">=", ">", "<=", "<":
+		return true
+	}
+	return false
+}
+
+// IsSetOperator reports whether the operator is and, or or unless.
+func (b *BinOpPart) IsSetOperator() bool {
+	return b.Op == "and" || b.Op == "or" || b.Op == "unless"
+}
+
+// VectorMatching is the `on(...)`/`ignoring(...)` modifier of a binary
+// operator, optionally followed by `group_left(...)` or `group_right(...)`.
+type VectorMatching struct {
+	Fn          string      `@("on" | "ignoring")`
+	Labels      []LabelName `"(" (@@ ("," @@)*)? ")"`
+	Group       string      `(@("group_left" | "group_right")`
+	GroupLabels []LabelName `("(" (@@ ("," @@)*)? ")")?)?`
+}
+
+func (v *VectorMatching) String() string {
+	labelList := func(labels []LabelName) string {
+		names := make([]string, len(labels))
+		for i, l := range labels {
+			names[i] = l.String()
+		}
+		return "(" + strings.Join(names, ", ") + ")"
+	}
+	res := v.Fn + labelList(v.Labels)
+	if v.Group != "" {
+		res += " " + v.Group + labelList(v.GroupLabels)
+	}
+	return res
 }
 
 // AtomExpr is a single non-binary expression, optionally wrapped in parentheses.
@@ -43,6 +95,10 @@ type AtomExpr struct {
 	Macros           *MacrosOp         `| @@`
 	TopK             *TopK             `| @@`
 	QuantileOverTime *QuantileOverTime `| @@`
+	LabelReplace     *LabelReplace     `| @@`
+	Vector           *Vector           `| @@`
+	Sort             *Sort             `| @@`
+	Absent           *Absent           `| @@`
 	Scalar           string            `| @(Integer ("." Integer?)?)`
 }
 
@@ -68,9 +124,71 @@ func (a AtomExpr) String() string {
 	if a.QuantileOverTime != nil {
 		return a.QuantileOverTime.String()
 	}
+	if a.LabelReplace != nil {
+		return a.LabelReplace.String()
+	}
+	if a.Vector != nil {
+		return a.Vector.String()
+	}
+	if a.Sort != nil {
+		return a.Sort.String()
+	}
+	if a.Absent != nil {
+		return a.Absent.String()
+	}
 	return a.Scalar
 }
 
+// IsFunction reports whether the expression is one of the functions applied
+// to the result of a metric query: label_replace, vector, sort, sort_desc or
+// absent.
+func (a AtomExpr) IsFunction() bool {
+	return a.LabelReplace != nil || a.Vector != nil || a.Sort != nil || a.Absent != nil
+}
+
+// LabelReplace is `label_replace(v, "dst", "replacement", "src", "regex")`.
+type LabelReplace struct {
+	Expr        LogQLScript  `"label_replace" "(" @@ ","`
+	Dst         QuotedString `@@ ","`
+	Replacement QuotedString `@@ ","`
+	Src         QuotedString `@@ ","`
+	Regex       QuotedString `@@ ")"`
+}
+
+func (l LabelReplace) String() string {
+	return fmt.Sprintf("label_replace(%s, %s, %s, %s, %s)",
+		l.Expr.String(), l.Dst.String(), l.Replacement.String(), l.Src.String(), l.Regex.String())
+}
+
+// Vector is `vector(s)`: a series without labels with the value s at every
+// step.
+type Vector struct {
+	Val string `"vector" "(" @(Integer ("." Integer?)?) ")"`
+}
+
+func (v Vector) String() string {
+	return "vector(" + v.Val + ")"
+}
+
+// Sort is `sort(v)` or `sort_desc(v)`.
+type Sort struct {
+	Fn   string      `@("sort" | "sort_desc")`
+	Expr LogQLScript `"(" @@ ")"`
+}
+
+func (s Sort) String() string {
+	return s.Fn + "(" + s.Expr.String() + ")"
+}
+
+// Absent is `absent(v)`.
+type Absent struct {
+	Expr LogQLScript `"absent" "(" @@ ")"`
+}
+
+func (a Absent) String() string {
+	return "absent(" + a.Expr.String() + ")"
+}
+
 type StrSelector struct {
 	StrSelCmds []StrSelCmd           `"{" @@? ("," @@ )* "}" `
 	Pipelines  []StrSelectorPipeline `@@*`
@@ -208,10 +326,14 @@ func (h *LineFilterHead) String() string {
 }
 
 type LineFilterSimple struct {
-	Val QuotedString `@@`
+	IP  *QuotedString `( "ip" "(" @@ ")"`
+	Val QuotedString  `| @@ )`
 }
 
 func (s *LineFilterSimple) String() string {
+	if s.IP != nil {
+		return fmt.Sprintf("ip(%s)", s.IP.String())
+	}
 	return fmt.Sprintf("%s", s.Val.String())
 }
 
@@ -249,14 +371,17 @@ func (h *Head) String() string {
 type SimpleLabelFilter struct {
 	Label  LabelName     `@@`
 	Fn     string        `@("="|"!="|"!~"|"=="|">="|">"|"<="|"<"|"=~")`
-	StrVal *QuotedString `(@@`
+	IPVal  *QuotedString `( "ip" "(" @@ ")"`
+	StrVal *QuotedString `| @@`
 	NumVal string        `| @(Integer "."? Integer*))`
 }
 
 func (s *SimpleLabelFilter) String() string {
 	bld := strings.Builder{}
 	bld.WriteString(fmt.Sprintf("%s %s ", s.Label, s.Fn))
-	if s.StrVal != nil {
+	if s.IPVal != nil {
+		bld.WriteString(fmt.Sprintf("ip(%s)", s.IPVal.String()))
+	} else if s.StrVal != nil {
 		bld.WriteString(s.StrVal.String())
 	} else {
 		bld.WriteString(s.NumVal)
@@ -266,19 +391,47 @@ func (s *SimpleLabelFilter) String() string {
 }
 
 type Parser struct {
-	Fn           string        `@("json"|"logfmt"|"regexp")`
+	Fn           string        `@("json"|"logfmt"|"regexp"|"pattern"|"unpack")`
+	Flags        []ParserFlag  `@@*`
 	ParserParams []ParserParam `@@? ("," @@)*`
 }
 
 func (p *Parser) String() string {
+	fn := p.Fn
+	for _, flag := range p.Flags {
+		fn += " " + flag.String()
+	}
 	if p.ParserParams == nil {
-		return fmt.Sprintf("| %s", p.Fn)
+		return fmt.Sprintf("| %s", fn)
 	}
 	params := make([]string, len(p.ParserParams))
 	for i, param := range p.ParserParams {
 		params[i] = param.String()
 	}
-	return fmt.Sprintf("| %s %s", p.Fn, strings.Join(params, ", "))
+	return fmt.Sprintf("| %s %s", fn, strings.Join(params, ", "))
+}
+
+// HasFlag reports whether the parser has the flag (e.g. "--strict") set.
+func (p *Parser) HasFlag(flag string) bool {
+	for _, f := range p.Flags {
+		if f.String() == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// ParserFlag is a `--strict` or `--keep-empty` flag of the logfmt parser.
+type ParserFlag struct {
+	Strict    bool `"-" "-" ( @"strict"`
+	KeepEmpty bool `| @"keep" "-" "empty" )`
+}
+
+func (f *ParserFlag) String() string {
+	if f.Strict {
+		return "--strict"
+	}
+	return "--keep-empty"
 }
 
 type ParserParam struct {
@@ -106,6 +106,23 @@ func TestParserKeepRequiresParam(t *testing.T) {
 	}
 }
 
+func TestParserFlags(t *testing.T) {
+	ast, err := Parse(`{app="x"} | logfmt --strict --keep-empty lvl="level" | unpack`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := FindFirst[Parser](ast)
+	if !parser.HasFlag("--strict") || !parser.HasFlag("--keep-empty") {
+		t.Errorf("flags = %v", parser.Flags)
+	}
+	if s := ast.String(); s != `{app="x"}| logfmt --strict --keep-empty lvl = "level" | unpack` {
+		t.Errorf("String() = %s", s)
+	}
+	if _, err := Parse(`{app="x"} | logfmt --lenient`); err == nil {
+		t.Error("expected an error for an unknown flag")
+	}
+}
+
 func TestParser2(t *testing.T) {
 	ast, err := Parse(`{sender="logtest"} |= "GET"`)
 	if err != nil {
@@ -211,3 +228,45 @@ func TestParserBinary(t *testing.T) {
 		}
 	}
 }
+
+func TestParserFunctions(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantString string
+		headIsAtom func(a AtomExpr) bool
+	}{
+		{
+			query:      `label_replace(rate({app="a"}[1m]), "svc", "$1", "app", "(.*)-api")`,
+			wantString: `label_replace(rate ({app="a"}[1m]), "svc", "$1", "app", "(.*)-api")`,
+			headIsAtom: func(a AtomExpr) bool { return a.LabelReplace != nil && a.LabelReplace.Src.Str == `"app"` },
+		},
+		{
+			query:      `sum(rate({app="a"}[1m])) or vector(0)`,
+			wantString: `sum (rate ({app="a"}[1m])) or vector(0)`,
+			headIsAtom: func(a AtomExpr) bool { return a.AggOperator != nil },
+		},
+		{
+			query:      `sort_desc(sum by (app) (rate({app="a"}[1m])))`,
+			wantString: `sort_desc(sum by (app) (rate ({app="a"}[1m])))`,
+			headIsAtom: func(a AtomExpr) bool { return a.Sort != nil && a.Sort.Fn == "sort_desc" },
+		},
+		{
+			query:      `absent(rate({app="a"}[1m]))`,
+			wantString: `absent(rate ({app="a"}[1m]))`,
+			headIsAtom: func(a AtomExpr) bool { return a.Absent != nil },
+		},
+	}
+	for _, tc := range tests {
+		ast, err := Parse(tc.query)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", tc.query, err)
+			continue
+		}
+		if got := ast.String(); got != tc.wantString {
+			t.Errorf("Parse(%q).String() = %q, want %q", tc.query, got, tc.wantString)
+		}
+		if !tc.headIsAtom(ast.Head) {
+			t.Errorf("Parse(%q): Head atom type check failed", tc.query)
+		}
+	}
+}
@@ -23,10 +23,11 @@ func (p *planner) analyzeScript() {
 		return
 	}
 
+	streamSelector := getStreamSelector(p.script)
 	p.simpleLabelOperation = make([]bool, len(pipeline))
 	for i, ppl := range pipeline {
 		if ppl.LabelFilter != nil {
-			p.simpleLabelOperation[i] = true
+			p.simpleLabelOperation[i] = labelFilterOnStreamSelector(ppl.LabelFilter, streamSelector)
 		}
 		if ppl.Parser != nil {
 			break
@@ -128,6 +129,31 @@ func AnalyzeMetrics15sShortcut(script *logql_parser.LogQLScript) bool {
 		if ppl.LineFilter != nil && lineFilterHasContent(ppl.LineFilter) {
 			return false
 		}
+		if ppl.LabelFilter != nil && !labelFilterOnStreamSelector(ppl.LabelFilter, &lraOrUnwrap.StrSel) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelFilterOnStreamSelector reports if the label filter only references
+// labels of the stream selector. Other labels may come from the structured
+// metadata of the log lines, so they can't be filtered on the time_series table.
+func labelFilterOnStreamSelector(filter *logql_parser.LabelFilter, sel *logql_parser.StrSelector) bool {
+	for ; filter != nil; filter = filter.Tail {
+		if filter.Head.ComplexHead != nil && !labelFilterOnStreamSelector(filter.Head.ComplexHead, sel) {
+			return false
+		}
+		if filter.Head.SimpleHead == nil {
+			continue
+		}
+		found := false
+		for _, cmd := range sel.StrSelCmds {
+			found = found || cmd.Label.Name == filter.Head.SimpleHead.Label.Name
+		}
+		if !found {
+			return false
+		}
 	}
 	return true
 }
@@ -139,6 +165,9 @@ func lineFilterHasContent(lf *logql_parser.LineFilter) bool {
 func lineFilterExpHasContent(exp *logql_parser.LineFilterExp) bool {
 	head := &exp.Head
 	if head.Simple != nil {
+		if head.Simple.IP != nil {
+			return true
+		}
 		val, err := head.Simple.Val.Unquote()
 		if val != "" || err != nil {
 			return true
@@ -24,6 +24,10 @@ func PlanDetectLabels(script *logql_parser.LogQLScript) (shared.SQLRequestPlanne
 	return (&planner{script: script}).planDetectLabels()
 }
 
+func PlanDetectFields(script *logql_parser.LogQLScript, lineLimit int64) (shared.SQLRequestPlanner, error) {
+	return (&planner{script: script}).planDetectFields(lineLimit)
+}
+
 func PlanPatterns(script *logql_parser.LogQLScript) (shared.SQLRequestPlanner, error) {
 	return (&planner{script: script}).planPatterns()
 }
@@ -106,11 +110,12 @@ func (p *planner) plan() (shared.SQLRequestPlanner, error) {
 
 	if p.labelsJoinIdx == -1 && p.matrixFunctionsLabelsIDX == -1 {
 		p.samplesPlanner = &LabelsJoinPlanner{
-			NoStreamSelect: p.noStreamSelect,
-			Main:           p.samplesPlanner,
-			Fingerprints:   p.fpPlanner,
-			TimeSeries:     NewTimeSeriesInitPlanner(p.offsetModifier),
-			FpCache:        &p.fpCache,
+			NoStreamSelect:     p.noStreamSelect,
+			Main:               p.samplesPlanner,
+			Fingerprints:       p.fpPlanner,
+			TimeSeries:         NewTimeSeriesInitPlanner(p.offsetModifier),
+			FpCache:            &p.fpCache,
+			StructuredMetadata: p.script.Head.StrSelector != nil,
 		}
 	}
 
@@ -194,6 +199,22 @@ func (p *planner) planDetectLabels() (shared.SQLRequestPlanner, error) {
 	return &DetectLabelsPlanner{NoStreamSelect: p.noStreamSelect, fpPlanner: p.fpPlanner}, nil
 }
 
+func (p *planner) planDetectFields(lineLimit int64) (shared.SQLRequestPlanner, error) {
+	if p.script == nil || p.script.Head.StrSelector == nil {
+		return nil, fmt.Errorf("unsupported query")
+	}
+	p.analyzeStreamSelect()
+	err := p.planTS()
+	if err != nil {
+		return nil, err
+	}
+	return &DetectFieldsPlanner{
+		NoStreamSelect: p.noStreamSelect,
+		LineLimit:      lineLimit,
+		fpPlanner:      p.fpPlanner,
+	}, nil
+}
+
 func (p *planner) planPatterns() (shared.SQLRequestPlanner, error) {
 	if p.script == nil {
 		return nil, fmt.Errorf("unsupported query")
@@ -263,12 +284,13 @@ func (p *planner) planSpl() error {
 	for i, ppl := range streamSelector.Pipelines {
 		if i == p.labelsJoinIdx {
 			p.samplesPlanner = &LabelsJoinPlanner{
-				NoStreamSelect: p.noStreamSelect,
-				Main:           &MainOrderByPlanner{[]string{"timestamp_ns"}, p.samplesPlanner},
-				Fingerprints:   p.fpPlanner,
-				TimeSeries:     NewTimeSeriesInitPlanner(p.offsetModifier),
-				FpCache:        &p.fpCache,
-				LabelsCache:    &p.labelsCache,
+				NoStreamSelect:     p.noStreamSelect,
+				Main:               &MainOrderByPlanner{[]string{"timestamp_ns"}, p.samplesPlanner},
+				Fingerprints:       p.fpPlanner,
+				TimeSeries:         NewTimeSeriesInitPlanner(p.offsetModifier),
+				FpCache:            &p.fpCache,
+				LabelsCache:        &p.labelsCache,
+				StructuredMetadata: true,
 			}
 		}
 		var err error
@@ -533,7 +555,10 @@ func (p *planner) planParser(ppl *logql_parser.StrSelectorPipeline) error {
 		}
 		vals = append(vals, val)
 	}
-	if ppl.Parser.Fn == "json" {
+	if len(ppl.Parser.Flags) > 0 && ppl.Parser.Fn != "logfmt" {
+		return fmt.Errorf("%s parser does not support flags", ppl.Parser.Fn)
+	}
+	if ppl.Parser.Fn == "json" || ppl.Parser.Fn == "unpack" {
 		p.jsonParserSeen = true
 	}
 	p.samplesPlanner = &ParserPlanner{
@@ -0,0 +1,48 @@
+package clickhouse_planner
+
+import (
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+// DetectFieldsPlanner counts the distinct values of the structured metadata
+// keys of the latest LineLimit log lines matching the stream selector.
+type DetectFieldsPlanner struct {
+	NoStreamSelect bool
+	LineLimit      int64
+	fpPlanner      shared.SQLRequestPlanner
+}
+
+func (d *DetectFieldsPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
+	lines := sql.NewSelect().
+		Select(sql.NewSimpleCol("samples.structured_metadata", "structured_metadata")).
+		From(sql.NewSimpleCol(ctx.SamplesDistTableName, "samples")).
+		AndPreWhere(
+			sql.Ge(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(ctx.From.UnixNano())),
+			sql.Lt(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(ctx.To.UnixNano()))).
+		AndWhere(sql.Neq(sql.NewRawObject("samples.structured_metadata"), sql.NewStringVal(""))).
+		OrderBy(sql.NewOrderBy(sql.NewRawObject("samples.timestamp_ns"), sql.ORDER_BY_DIRECTION_DESC)).
+		Limit(sql.NewIntVal(d.LineLimit))
+
+	if !d.NoStreamSelect {
+		fp, err := d.fpPlanner.Process(ctx)
+		if err != nil {
+			return nil, err
+		}
+		withFp := sql.NewWith(fp, "fp_sel")
+		lines = lines.With(withFp).
+			AndPreWhere(sql.NewIn(sql.NewRawObject("samples.fingerprint"), sql.NewWithRef(withFp)))
+	}
+
+	withLines := sql.NewWith(lines, "lines")
+	return sql.NewSelect().
+		With(withLines).
+		Select(
+			sql.NewSimpleCol("pairs.1", "key"),
+			sql.NewSimpleCol("count(distinct pairs.2)", "cardinality")).
+		From(sql.NewWithRef(withLines)).
+		Join(sql.NewJoin("array",
+			sql.NewSimpleCol("JSONExtractKeysAndValues(lines.structured_metadata, 'String')", "pairs"), nil)).
+		GroupBy(sql.NewRawObject("key")).
+		OrderBy(sql.NewOrderBy(sql.NewRawObject("key"), sql.ORDER_BY_DIRECTION_ASC)), nil
+}
@@ -72,6 +72,9 @@ func (s *LabelFilterPlanner) makeSqlCond(ctx *shared.PlannerContext,
 }
 
 func (s *LabelFilterPlanner) makeSimpleSqlCond(ctx *shared.PlannerContext, expr *logql_parser.SimpleLabelFilter) (sql.SQLCondition, error) {
+	if expr.IPVal != nil {
+		return s.makeSimpleIPSqlCond(ctx, expr)
+	}
 	isNumeric := slices.Contains([]string{"==", ">", ">=", "<", "<="}, expr.Fn) ||
 		(expr.Fn == "!=" && expr.StrVal == nil)
 
@@ -165,6 +168,18 @@ func (s *LabelFilterPlanner) makeSimpleStrSqlCond(_ *shared.PlannerContext, expr
 	return sqlOp(label, sql.NewStringVal(val)), nil
 }
 
+func (s *LabelFilterPlanner) makeSimpleIPSqlCond(_ *shared.PlannerContext, expr *logql_parser.SimpleLabelFilter) (sql.SQLCondition, error) {
+	var label sql.SQLObject = sql.NewRawObject(fmt.Sprintf("labels['%s']", expr.Label.Name))
+	if s.LabelValGetter != nil {
+		label = s.LabelValGetter(expr.Label.Name)
+	}
+	val, err := expr.IPVal.Unquote()
+	if err != nil {
+		return nil, err
+	}
+	return newIPMatchCond(label, val, expr.Fn, false)
+}
+
 func (s *LabelFilterPlanner) makeSimpleNumSqlCond(_ *shared.PlannerContext, expr *logql_parser.SimpleLabelFilter) (sql.SQLCondition, error) {
 	var label sql.SQLObject = sql.NewRawObject(fmt.Sprintf("labels['%s']", expr.Label.Name))
 	if s.LabelValGetter != nil {
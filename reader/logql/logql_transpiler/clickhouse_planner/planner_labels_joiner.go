@@ -37,6 +37,9 @@ type LabelsJoinPlanner struct {
 	TimeSeries     shared.SQLRequestPlanner
 	FpCache        **sql.With
 	LabelsCache    **sql.With
+	// StructuredMetadata merges the structured metadata of the log lines
+	// selected by Main into their labels.
+	StructuredMetadata bool
 }
 
 func (l *LabelsJoinPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
@@ -94,26 +97,39 @@ func (l *LabelsJoinPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, er
 		})
 		return sql.NewSelect().
 			With(withMain, withTS).
-			Select(
-				sql.NewSimpleCol("main.fingerprint", "fingerprint"),
-				sql.NewSimpleCol("main.timestamp_ns", "timestamp_ns"),
-				sql.NewCol(labelsCol, "labels"),
-				sql.NewSimpleCol("main.string", "string"),
-				sql.NewSimpleCol("main.value", "value")).
+			Select(l.selectCols(labelsCol)...).
 			From(sql.NewWithRef(withMain)), nil
 
 	}
 	return sql.NewSelect().
 		With(withMain, withTS).
-		Select(
-			sql.NewSimpleCol("main.fingerprint", "fingerprint"),
-			sql.NewSimpleCol("main.timestamp_ns", "timestamp_ns"),
-			sql.NewSimpleCol("_time_series.labels", "labels"),
-			sql.NewSimpleCol("main.string", "string"),
-			sql.NewSimpleCol("main.value", "value")).
+		Select(l.selectCols(sql.NewRawObject("_time_series.labels"))...).
 		From(sql.NewWithRef(withMain)).
 		Join(sql.NewJoin(
 			joinType,
 			sql.NewWithRef(withTS),
 			sql.Eq(sql.NewRawObject("main.fingerprint"), sql.NewRawObject("_time_series.fingerprint")))), nil
 }
+
+func (l *LabelsJoinPlanner) selectCols(labels sql.SQLObject) []sql.SQLObject {
+	if !l.StructuredMetadata {
+		return []sql.SQLObject{
+			sql.NewSimpleCol("main.fingerprint", "fingerprint"),
+			sql.NewSimpleCol("main.timestamp_ns", "timestamp_ns"),
+			sql.NewCol(labels, "labels"),
+			sql.NewSimpleCol("main.string", "string"),
+			sql.NewSimpleCol("main.value", "value")}
+	}
+	// The structured metadata is merged into the labels for the filters, the
+	// lines keep the fingerprint of their stream.
+	return []sql.SQLObject{
+		sql.NewSimpleCol("main.fingerprint", "fingerprint"),
+		sql.NewSimpleCol("main.timestamp_ns", "timestamp_ns"),
+		sql.NewCol(&sqlMapUpdate{
+			labels,
+			sql.NewRawObject("JSONExtract(main.structured_metadata, 'Map(String, String)')"),
+		}, "labels"),
+		sql.NewSimpleCol("main.string", "string"),
+		sql.NewSimpleCol("main.value", "value"),
+		sql.NewSimpleCol("main.structured_metadata", "structured_metadata")}
+}
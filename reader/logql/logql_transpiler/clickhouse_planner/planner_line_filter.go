@@ -53,6 +53,13 @@ func (l *LineFilterPlanner) buildHeadCondition(fn string, head *log_parser.LineF
 }
 
 func (l *LineFilterPlanner) buildSimpleCondition(fn string, s *log_parser.LineFilterSimple) (sql.SQLCondition, error) {
+	if s.IP != nil {
+		arg, err := s.IP.Unquote()
+		if err != nil {
+			return nil, err
+		}
+		return newIPMatchCond(sql.NewRawObject("string"), arg, fn, true)
+	}
 	val, err := s.Val.Unquote()
 	if err != nil {
 		return nil, err
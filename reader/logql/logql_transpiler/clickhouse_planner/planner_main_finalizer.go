@@ -52,7 +52,8 @@ func (m *MainFinalizerPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect,
 			sql.NewSimpleCol(m.Alias+".fingerprint", "fingerprint"),
 			sql.NewSimpleCol(m.Alias+".labels", "labels"),
 			sql.NewSimpleCol(m.Alias+".string", "string"),
-			sql.NewSimpleCol(m.Alias+".timestamp_ns", "timestamp_ns")).
+			sql.NewSimpleCol(m.Alias+".timestamp_ns", "timestamp_ns"),
+			sql.NewSimpleCol(m.Alias+".structured_metadata", "structured_metadata")).
 		From(sql.NewWithRef(withReq)).
 		OrderBy(orderBy...), nil
 }
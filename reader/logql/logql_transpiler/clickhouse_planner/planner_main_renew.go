@@ -34,5 +34,9 @@ func (m *MainRenewPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, err
 	req.Select(append(req.GetSelect(),
 		sql.NewSimpleCol("samples.string", "string"),
 		sql.NewSimpleCol("samples.value", "value"))...)
+	if getCol(main, "structured_metadata") != nil {
+		req.Select(append(req.GetSelect(),
+			sql.NewSimpleCol("samples.structured_metadata", "structured_metadata"))...)
+	}
 	return req, nil
 }
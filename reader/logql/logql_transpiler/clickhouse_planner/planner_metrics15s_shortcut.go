@@ -28,15 +28,16 @@ func NewMetrics15ShortcutPlanner(function string, duration time.Duration,
 	}
 }
 
-func (m *Metrics15ShortcutPlanner) GetQuery(ctx *shared.PlannerContext, col sql.SQLObject, table string) sql.ISelect {
-	from := ctx.From
-	to := ctx.To
+// GetQuery selects col by buckets of the range from the rollup, between the
+// bounds of ctx rounded to the buckets of the rollup.
+func (m *Metrics15ShortcutPlanner) GetQuery(ctx *shared.PlannerContext, col sql.SQLObject,
+	rollup shared.MetricsRollup) sql.ISelect {
+	from, to := m.bounds(ctx)
 	offsetNsStr := ""
 	if m.Offset != nil {
-		from = from.Add(*m.Offset)
-		to = to.Add(*m.Offset)
 		offsetNsStr = fmt.Sprintf(" + %d", m.Offset.Nanoseconds())
 	}
+	resNs := rollup.Resolution.Nanoseconds()
 	return sql.NewSelect().
 		Select(
 			sql.NewSimpleCol(
@@ -48,16 +49,22 @@ func (m *Metrics15ShortcutPlanner) GetQuery(ctx *shared.PlannerContext, col sql.
 			sql.NewSimpleCol("fingerprint", "fingerprint"),
 			sql.NewSimpleCol(`''`, "string"),
 			sql.NewCol(col, "value")).
-		From(sql.NewSimpleCol(table, "samples")).
+		From(sql.NewSimpleCol(rollup.Table, "samples")).
 		AndWhere(
-			sql.Ge(sql.NewRawObject("samples.timestamp_ns"),
-				sql.NewIntVal(from.UnixNano()/15000000000*15000000000)),
-			sql.Lt(sql.NewRawObject("samples.timestamp_ns"),
-				sql.NewIntVal((to.UnixNano()/15000000000)*15000000000)),
+			sql.Ge(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(from.UnixNano()/resNs*resNs)),
+			sql.Lt(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(to.UnixNano()/resNs*resNs)),
 			GetTypes(ctx)).
 		GroupBy(sql.NewRawObject("fingerprint"), sql.NewRawObject("timestamp_ns"))
 }
 
+// bounds returns the time range of the samples of the query.
+func (m *Metrics15ShortcutPlanner) bounds(ctx *shared.PlannerContext) (time.Time, time.Time) {
+	if m.Offset == nil {
+		return ctx.From, ctx.To
+	}
+	return ctx.From.Add(*m.Offset), ctx.To.Add(*m.Offset)
+}
+
 func (m *Metrics15ShortcutPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
 	var col sql.SQLObject
 	switch m.Function {
@@ -68,7 +75,10 @@ func (m *Metrics15ShortcutPlanner) Process(ctx *shared.PlannerContext) (sql.ISel
 	case "count_over_time":
 		col = sql.NewRawObject("countMerge(count)")
 	}
-	v1 := m.GetQuery(ctx, col, ctx.Metrics15sDistTableName)
+	// the rollup has to cover the whole range, so that no sample is cut from
+	// the first and the last buckets
+	from, to := m.bounds(ctx)
+	v1 := m.GetQuery(ctx, col, ctx.MetricsRollup(from, m.Duration, to.Sub(from)))
 	return v1, nil
 }
 
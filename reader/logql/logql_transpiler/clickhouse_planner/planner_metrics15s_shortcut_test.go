@@ -0,0 +1,56 @@
+package clickhouse_planner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	dbversion "github.com/metrico/qryn/v5/reader/utils/dbVersion"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+func TestMetrics15ShortcutRollup(t *testing.T) {
+	to := time.Unix(1700000000, 0).Truncate(time.Hour)
+	offset := time.Minute * 5
+	for _, c := range []struct {
+		name     string
+		from     time.Time
+		duration time.Duration
+		offset   *time.Duration
+		want     []string
+	}{
+		{"hour range", to.Add(-time.Hour * 24), time.Hour, nil,
+			[]string{"FROM metrics_1h", "intDiv(samples.timestamp_ns, 3600000000000)"}},
+		{"5m range", to.Add(-time.Hour * 24), time.Minute * 5, nil, []string{"FROM metrics_5m"}},
+		{"minute range", to.Add(-time.Hour * 24), time.Minute, nil, []string{"FROM metrics_15s"}},
+		{"unaligned start", to.Add(-time.Hour*24 + time.Minute), time.Hour, nil, []string{"FROM metrics_15s"}},
+		{"offset", to.Add(-time.Hour * 24), time.Hour, &offset,
+			[]string{"FROM metrics_5m", "intDiv(samples.timestamp_ns + 300000000000, 3600000000000)"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := &shared.PlannerContext{
+				From:                    c.from,
+				To:                      to,
+				Metrics15sDistTableName: "metrics_15s",
+				Metrics5mDistTableName:  "metrics_5m",
+				Metrics1hDistTableName:  "metrics_1h",
+				Type:                    shared.SAMPLES_TYPE_LOGS,
+				VersionInfo:             dbversion.VersionInfo{shared.MetricsRollupsVersion: 0},
+			}
+			query, err := NewMetrics15ShortcutPlanner("count_over_time", c.duration, c.offset).Process(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := query.String(sql.DefaultCtx())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range c.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("missing %q in:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
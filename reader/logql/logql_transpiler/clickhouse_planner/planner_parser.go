@@ -24,6 +24,10 @@ func (p *ParserPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error)
 		req, err = p.regexp(ctx)
 	case "json":
 		req, err = p.json(ctx)
+	case "pattern":
+		req, err = p.pattern(ctx)
+	case "unpack":
+		req, err = p.unpack(ctx)
 	default:
 		return nil, &shared.NotSupportedError{Msg: fmt.Sprintf("%s not supported", p.Op)}
 	}
@@ -31,8 +35,15 @@ func (p *ParserPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error)
 		return nil, err
 	}
 
+	fp := `cityHash64(arraySort(arrayZip(mapKeys(labels),mapValues(labels))))`
+	if getCol(req, "structured_metadata") != nil {
+		// The structured metadata merged into the labels does not split the
+		// streams.
+		fp = `cityHash64(arraySort(arrayFilter(x -> NOT JSONHas(structured_metadata, x.1) OR ` +
+			`JSONExtractString(structured_metadata, x.1) != x.2, arrayZip(mapKeys(labels),mapValues(labels)))))`
+	}
 	sel, err := patchCol(req.GetSelect(), "fingerprint", func(object sql.SQLObject) (sql.SQLObject, error) {
-		return sql.NewRawObject(`cityHash64(arraySort(arrayZip(mapKeys(labels),mapValues(labels))))`), nil
+		return sql.NewRawObject(fp), nil
 	})
 	if err != nil {
 		return nil, err
@@ -14,7 +14,7 @@ func (p *ParserPlanner) json(ctx *shared.PlannerContext) (sql.ISelect, error) {
 		return nil, err
 	}
 
-	jsonPaths := make([][]string, len(p.Vals))
+	jsonPaths := make([][]any, len(p.Vals))
 	for i, val := range p.Vals {
 		jsonPaths[i], err = shared.JsonPathParamToArray(val)
 		if err != nil {
@@ -47,7 +47,7 @@ func (p *ParserPlanner) json(ctx *shared.PlannerContext) (sql.ISelect, error) {
 type sqlJsonParser struct {
 	col    sql.SQLObject
 	labels []string
-	paths  [][]string
+	paths  [][]any
 }
 
 func (s *sqlJsonParser) String(ctx *sql.Ctx, opts ...int) (string, error) {
@@ -70,7 +70,7 @@ func (s *sqlJsonParser) String(ctx *sql.Ctx, opts ...int) (string, error) {
 		strings.Join(strVals, ",")), nil
 }
 
-func (s *sqlJsonParser) path2Sql(path []string, ctx *sql.Ctx, opts ...int) (string, error) {
+func (s *sqlJsonParser) path2Sql(path []any, ctx *sql.Ctx, opts ...int) (string, error) {
 	colName, err := s.col.String(ctx, opts...)
 	if err != nil {
 		return "", err
@@ -78,8 +78,17 @@ func (s *sqlJsonParser) path2Sql(path []string, ctx *sql.Ctx, opts ...int) (stri
 
 	res := make([]string, len(path))
 	for i, part := range path {
-		var err error
-		res[i], err = (sql.NewStringVal(part)).String(ctx, opts...)
+		var obj sql.SQLObject
+		switch part := part.(type) {
+		case int:
+			// JSON functions index arrays from 1
+			obj = sql.NewIntVal(int64(part) + 1)
+		case string:
+			obj = sql.NewStringVal(part)
+		default:
+			return "", fmt.Errorf("unexpected json path part %v", part)
+		}
+		res[i], err = obj.String(ctx, opts...)
 		if err != nil {
 			return "", err
 		}
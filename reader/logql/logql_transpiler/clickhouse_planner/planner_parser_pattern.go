@@ -0,0 +1,113 @@
+package clickhouse_planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+func (p *ParserPlanner) pattern(ctx *shared.PlannerContext) (sql.ISelect, error) {
+	if len(p.Vals) != 1 || p.labels[0] != "" {
+		return nil, fmt.Errorf("pattern parser requires exactly one pattern expression")
+	}
+	pattern, err := shared.ParsePattern(p.Vals[0])
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := p.Main.Process(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sel, err := patchCol(req.GetSelect(), "labels", func(object sql.SQLObject) (sql.SQLObject, error) {
+		return &sqlMapUpdate{
+			m1: object,
+			m2: &patternMap{
+				col:     sql.NewRawObject("string"),
+				pattern: pattern,
+			},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return req.Select(sel...), nil
+}
+
+// patternMap extracts the named captures of a pattern into a map with the same
+// semantics as shared.Pattern.Match. Every capture ends at the position() of
+// the following literal, searched from the end of the previous one; an offset
+// of 0 marks that the line stopped matching.
+type patternMap struct {
+	col     sql.SQLObject
+	pattern shared.Pattern
+}
+
+func (r *patternMap) String(ctx *sql.Ctx, opts ...int) (string, error) {
+	col, err := r.col.String(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	id := ctx.Id()
+
+	// Every alias is defined at its first use and referenced by name later.
+	defined := map[string]bool{}
+	ref := func(name string, def string) string {
+		if defined[name] {
+			return name
+		}
+		defined[name] = true
+		return fmt.Sprintf("(%s AS %s)", def, name)
+	}
+	quote := func(s string) (string, error) {
+		return sql.NewStringVal(s).String(ctx, opts...)
+	}
+
+	nodes := r.pattern
+	offsetDef := "1"
+	if !nodes[0].IsCapture {
+		lit, err := quote(nodes[0].Literal)
+		if err != nil {
+			return "", err
+		}
+		offsetDef = fmt.Sprintf("if(startsWith(%s, %s), %d, 0)", col, lit, len(nodes[0].Literal)+1)
+		nodes = nodes[1:]
+	}
+
+	var names, values []string
+	for i := 0; len(nodes) > 0; i++ {
+		offset := fmt.Sprintf("pattern_o_%d_%d", id, i)
+		var value string
+		if len(nodes) == 1 {
+			value = fmt.Sprintf("if(%s = 0, '', substring(%s, %s))", ref(offset, offsetDef), col, offset)
+		} else {
+			lit, err := quote(nodes[1].Literal)
+			if err != nil {
+				return "", err
+			}
+			pos := fmt.Sprintf("pattern_p_%d_%d", id, i)
+			posDef := fmt.Sprintf("if(%s = 0, 0, position(%s, %s, %s))", ref(offset, offsetDef), col, lit, offset)
+			value = fmt.Sprintf("if(%[1]s = 0, if(%[3]s = 0, '', substring(%[4]s, %[3]s)), substring(%[4]s, %[3]s, %[2]s - %[3]s))",
+				ref(pos, posDef), pos, offset, col)
+			offsetDef = fmt.Sprintf("if(%[1]s = 0, 0, %[1]s + %[2]d)", pos, len(nodes[1].Literal))
+		}
+		// Unnamed captures get an empty name and are filtered out of the map,
+		// they are still listed for the aliases they define.
+		name, err := quote(nodes[0].Name)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, name)
+		values = append(values, value)
+		nodes = nodes[min(2, len(nodes)):]
+	}
+
+	return fmt.Sprintf("mapFromArrays("+
+		"arrayFilter((x,y) -> x != '' AND y != '', [%[1]s] as pattern_lbls_%[3]d, [%[2]s] as pattern_vals_%[3]d),"+
+		"arrayFilter((x,y) -> x != '' AND y != '', pattern_vals_%[3]d, pattern_lbls_%[3]d))",
+		strings.Join(names, ","), strings.Join(values, ","), id), nil
+}
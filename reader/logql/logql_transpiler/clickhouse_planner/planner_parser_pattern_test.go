@@ -0,0 +1,40 @@
+package clickhouse_planner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+func TestPatternParser(t *testing.T) {
+	str := planString(t, `{app="x"} | pattern "<ip> - <_> [<ts>] \"<method> <path> <_>\" <status>" | status = "500"`)
+	for _, part := range []string{"mapUpdate(", "mapFromArrays(", "position(", "'method'", "pattern_vals_"} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %q in %s", part, str)
+		}
+	}
+
+	str = planString(t, `{app="x"} | pattern "level=<level> <_>"`)
+	if !strings.Contains(str, "startsWith(") {
+		t.Errorf("expected the leading literal to be checked in %s", str)
+	}
+}
+
+func TestPatternParserInvalid(t *testing.T) {
+	script, err := logql_parser.Parse(`{app="x"} | pattern "<a><b>"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planner, err := Plan(script, true)
+	if err == nil {
+		_, err = planner.Process(&shared.PlannerContext{
+			SamplesTableName:    "samples_v3",
+			TimeSeriesTableName: "time_series",
+		})
+	}
+	if err == nil {
+		t.Error("expected an error for consecutive captures")
+	}
+}
@@ -0,0 +1,80 @@
+package clickhouse_planner
+
+import (
+	"fmt"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+func (p *ParserPlanner) unpack(ctx *shared.PlannerContext) (sql.ISelect, error) {
+	if len(p.Vals) > 0 {
+		return nil, fmt.Errorf("unpack parser does not accept parameters")
+	}
+	req, err := p.Main.Process(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The labels are extracted from the packed line, so they must not refer
+	// to the `string` alias which is replaced with the unpacked one below.
+	var line sql.SQLObject = sql.NewRawObject("string")
+	sel, err := patchCol(req.GetSelect(), "string", func(object sql.SQLObject) (sql.SQLObject, error) {
+		line = object
+		return &sqlUnpackLine{col: object}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sel, err = patchCol(sel, "labels", func(object sql.SQLObject) (sql.SQLObject, error) {
+		return &sqlMapUpdate{
+			object,
+			&sqlParserError{
+				col:     line,
+				errType: shared.JSONParserErr,
+				detail:  "line is not a valid json object",
+				success: &sqlUnpackLabels{col: line},
+			},
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return req.Select(sel...), nil
+}
+
+// sqlUnpackLine is the `_entry` field of a packed line, or the line itself if
+// it has none.
+type sqlUnpackLine struct {
+	col sql.SQLObject
+}
+
+func (s *sqlUnpackLine) String(ctx *sql.Ctx, opts ...int) (string, error) {
+	col, err := s.col.String(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("if(JSONType(%[1]s, '_entry') = 'String', JSONExtractString(%[1]s, '_entry'), %[1]s)",
+		col), nil
+}
+
+// sqlUnpackLabels is the map of the non-empty string fields of a packed line
+// except `_entry`.
+type sqlUnpackLabels struct {
+	col sql.SQLObject
+}
+
+func (s *sqlUnpackLabels) String(ctx *sql.Ctx, opts ...int) (string, error) {
+	col, err := s.col.String(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("mapFilter((k, v) -> v != '', "+
+		"mapFromArrays("+
+		"arrayMap(x -> replaceRegexpAll(x.1, '[^a-zA-Z0-9_]', '_'), "+
+		"arrayFilter(x -> x.1 != '_entry' AND JSONType(x.2) = 'String', JSONExtractKeysAndValuesRaw(%[1]s)) as unpack_%[2]d), "+
+		"arrayMap(x -> JSONExtractString(x.2), unpack_%[2]d)))",
+		col, ctx.Id()), nil
+}
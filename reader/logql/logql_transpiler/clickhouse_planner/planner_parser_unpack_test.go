@@ -0,0 +1,32 @@
+package clickhouse_planner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+)
+
+func TestUnpackParser(t *testing.T) {
+	str := planString(t, `{app="x"} | unpack | json first="items[0][1].name" | first="a"`)
+	for _, part := range []string{
+		"JSONExtractKeysAndValuesRaw(main.string)",
+		"JSONExtractString(main.string, '_entry'), main.string) as string",
+		// the json parser reads the unpacked line, array indexes are 1-based
+		"JSONExtractString(string, 'items',1,2,'name')",
+	} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %q in:\n%s", part, str)
+		}
+	}
+}
+
+func TestParserFlagsOnlyForLogfmt(t *testing.T) {
+	script, err := logql_parser.Parse(`{app="x"} | json --strict a="b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Plan(script, true); err == nil {
+		t.Error("expected an error for flags on the json parser")
+	}
+}
@@ -0,0 +1,111 @@
+package clickhouse_planner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	clconfig "github.com/metrico/cloki-config"
+	"github.com/metrico/qryn/v5/reader/config"
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+func planString(t *testing.T, query string) string {
+	t.Helper()
+	if config.Cloki == nil {
+		config.Cloki = clconfig.New(clconfig.CLOKI_READER, nil, "", "")
+	}
+	script, err := logql_parser.Parse(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planner, err := Plan(script, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	sel, err := planner.Process(&shared.PlannerContext{
+		From:                    now.Add(-time.Hour),
+		To:                      now,
+		Limit:                   100,
+		CHFinalize:              true,
+		SamplesTableName:        "samples_v3",
+		SamplesDistTableName:    "samples_v3",
+		TimeSeriesTableName:     "time_series",
+		TimeSeriesDistTableName: "time_series",
+		TimeSeriesGinTableName:  "time_series_gin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, err := sel.String(newCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return str
+}
+
+func TestPlanStructuredMetadataLabels(t *testing.T) {
+	str := planString(t, `{app="api"}`)
+	for _, part := range []string{
+		"samples.structured_metadata as structured_metadata",
+		"JSONExtract(main.structured_metadata, 'Map(String, String)')",
+		"prefinal.structured_metadata as structured_metadata",
+		"main.fingerprint as fingerprint",
+	} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %q in:\n%s", part, str)
+		}
+	}
+}
+
+func TestPlanStructuredMetadataLabelFilter(t *testing.T) {
+	// trace_id is not a stream selector label, it may be structured metadata
+	// and must be filtered on the log lines.
+	str := planString(t, `{app="api"} | trace_id="4bf92f35"`)
+	if strings.Contains(str, "JSONExtractString(labels, 'trace_id')") {
+		t.Errorf("trace_id filtered on time_series:\n%s", str)
+	}
+	if !strings.Contains(str, "JSONExtract(main.structured_metadata") {
+		t.Errorf("structured metadata is not merged into labels:\n%s", str)
+	}
+
+	str = planString(t, `{app=~"api|web"} | app="api"`)
+	if !strings.Contains(str, "JSONExtractString(labels, 'app')") {
+		t.Errorf("stream selector label not filtered on time_series:\n%s", str)
+	}
+}
+
+func TestPlanDetectFields(t *testing.T) {
+	script, err := logql_parser.Parse(`{app="api"} | json`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planner, err := PlanDetectFields(script, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel, err := planner.Process(&shared.PlannerContext{
+		From:                   time.Unix(1700000000, 0),
+		To:                     time.Unix(1700003600, 0),
+		SamplesDistTableName:   "samples_v3",
+		TimeSeriesGinTableName: "time_series_gin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, err := sel.String(newCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		"array JOIN JSONExtractKeysAndValues(lines.structured_metadata, 'String')",
+		"LIMIT 500",
+		"fp_sel",
+	} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %q in:\n%s", part, str)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package clickhouse_planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+// sqlIPMatch is 1 if col is an address matched by the `ip()` filter or, for
+// line filters, if col contains one. isIPAddressInRange throws on the strings
+// which are not addresses, such as the empty labels or the timestamps found by
+// IPCandidateRe, so every check is guarded by isIPv4String and isIPv6String.
+type sqlIPMatch struct {
+	col     sql.SQLObject
+	matcher *shared.IPMatcher
+	line    bool
+}
+
+func newIPMatchCond(col sql.SQLObject, arg string, fn string, line bool) (sql.SQLCondition, error) {
+	matcher, err := shared.ParseIPMatcher(arg)
+	if err != nil {
+		return nil, err
+	}
+	match := &sqlIPMatch{col: col, matcher: matcher, line: line}
+	switch fn {
+	case "=", "|=":
+		return sql.Eq(match, sql.NewIntVal(1)), nil
+	case "!=":
+		return sql.Eq(match, sql.NewIntVal(0)), nil
+	}
+	return nil, fmt.Errorf("ip() is not supported by the %s operator", fn)
+}
+
+func (s *sqlIPMatch) String(ctx *sql.Ctx, opts ...int) (string, error) {
+	col, err := s.col.String(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	arg := col
+	if s.line {
+		arg = "x"
+	}
+	prefixes := s.matcher.Prefixes()
+	conds := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		prefix, err := sql.NewStringVal(p).String(ctx, opts...)
+		if err != nil {
+			return "", err
+		}
+		conds[i] = fmt.Sprintf("(isIPv4String(%[1]s) OR isIPv6String(%[1]s)) AND isIPAddressInRange(%[1]s, %[2]s)",
+			arg, prefix)
+	}
+	if !s.line {
+		return "((" + strings.Join(conds, ") OR (") + "))", nil
+	}
+	re, err := sql.NewStringVal(shared.IPCandidateRe).String(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("arrayExists(x -> (%s), extractAll(%s, %s))", strings.Join(conds, ") OR ("), col, re), nil
+}
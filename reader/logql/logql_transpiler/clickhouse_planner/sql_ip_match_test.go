@@ -0,0 +1,67 @@
+package clickhouse_planner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+func TestIPFilters(t *testing.T) {
+	str := planString(t, `{app="x"} |= ip("192.168.0.0-192.168.1.255") | json addr="a" | addr != ip("2001:db8::/32")`)
+	for _, part := range []string{
+		"arrayExists(x -> ((isIPv4String(x) OR isIPv6String(x)) AND isIPAddressInRange(x, '192.168.0.0/23')), extractAll(string, ",
+		"(((isIPv4String(labels['addr']) OR isIPv6String(labels['addr'])) AND isIPAddressInRange(labels['addr'], '2001:db8::/32')))) == (0)",
+	} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %q in:\n%s", part, str)
+		}
+	}
+}
+
+// TestIPFiltersGuard checks that isIPAddressInRange, throwing on anything but
+// an address, only gets the candidates and the labels which are addresses:
+// the timestamps, the out of range octets and the empty labels are skipped.
+func TestIPFiltersGuard(t *testing.T) {
+	for _, query := range []string{
+		`{app="x"} |= ip("192.168.0.1-192.168.0.6")`,
+		`{app="x"} != ip("::/0")`,
+		`{app="x"} | json addr="a" | addr = ip("10.0.0.1-10.0.0.2")`,
+	} {
+		str := planString(t, query)
+		n := strings.Count(str, "isIPAddressInRange(")
+		if n == 0 {
+			t.Fatalf("%s: no isIPAddressInRange in:\n%s", query, str)
+		}
+		guarded := strings.Count(str, "(isIPv4String(x) OR isIPv6String(x)) AND isIPAddressInRange(x, ") +
+			strings.Count(str, "(isIPv4String(labels['addr']) OR isIPv6String(labels['addr'])) AND "+
+				"isIPAddressInRange(labels['addr'], ")
+		if guarded != n {
+			t.Errorf("%s: %d of %d isIPAddressInRange calls are guarded in:\n%s", query, guarded, n, str)
+		}
+	}
+}
+
+func TestIPFiltersInvalid(t *testing.T) {
+	for _, query := range []string{
+		`{app="x"} |~ ip("10.0.0.1")`,
+		`{app="x"} | json addr="a" | addr =~ ip("10.0.0.1")`,
+		`{app="x"} |= ip("10.0.0.300")`,
+	} {
+		script, err := logql_parser.Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		planner, err := Plan(script, true)
+		if err == nil {
+			_, err = planner.Process(&shared.PlannerContext{
+				SamplesTableName:    "samples_v3",
+				TimeSeriesTableName: "time_series",
+			})
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package logql_transpiler
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	clconfig "github.com/metrico/cloki-config"
+	cfg "github.com/metrico/cloki-config/config"
+	"github.com/metrico/qryn/v5/reader/config"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+	"github.com/metrico/qryn/v5/reader/utils/tables"
+)
+
+// In explain mode the SQL requests are recorded instead of being sent, so the
+// chain runs without a ClickHouse connection.
+func TestExplain(t *testing.T) {
+	if config.Cloki == nil {
+		config.Cloki = clconfig.New(clconfig.CLOKI_READER, nil, "", "")
+	}
+	chain, err := Transpile(`sum by (app) (rate({app="a"}[1m])) / on (app) sum by (app) (rate({app="b"} |= "err" [1m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := tables.PopulateTableNames(&shared.PlannerContext{
+		Ctx:      context.Background(),
+		From:     time.Unix(0, 0),
+		To:       time.Unix(3600, 0),
+		Step:     time.Minute,
+		Limit:    100,
+		CHSqlCtx: &sql.Ctx{Params: map[string]sql.SQLObject{}, Result: map[string]sql.SQLObject{}},
+		Explain:  &shared.Explain{},
+	}, &model.DataDatabasesMap{Config: &cfg.ClokiBaseDataBase{}})
+	out, err := chain[0].Process(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for entries := range out {
+		for _, e := range entries {
+			if e.Err != nil && e.Err != io.EOF {
+				t.Fatal(e.Err)
+			}
+		}
+	}
+
+	steps := ctx.Explain.Steps()
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(steps))
+	}
+	for i, val := range []string{"'a'", "'b'"} {
+		if !strings.Contains(steps[i].SQL, val) || steps[i].Planner == "" {
+			t.Errorf("step %d = %+v, want a request for app=%s", i, steps[i], val)
+		}
+	}
+
+	plan := shared.DescribePlanner(chain)
+	if !strings.Contains(plan, "\n  *logql_transpiler.BinaryExprProcessor\n") ||
+		strings.Count(plan, "*shared.ClickhouseGetterPlanner") != 2 {
+		t.Errorf("unexpected plan:\n%s", plan)
+	}
+}
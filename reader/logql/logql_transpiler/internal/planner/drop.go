@@ -37,7 +37,7 @@ func (a *DropPlanner) cutLabels(e *shared.LogEntry) error {
 		}
 	}
 	if recountFP {
-		e.Fingerprint = fingerprint(e.Labels)
+		e.Fingerprint = streamFingerprint(e)
 	}
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/go-faster/city"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 )
 
 // fingerprint computes a deterministic hash of a label set.
@@ -29,6 +30,22 @@ func fingerprint(labels map[string]string) uint64 {
 	return city.CH64([]byte(strings.Join(parts, ",")))
 }
 
+// streamFingerprint computes the fingerprint of the labels of the entry
+// without its structured metadata, so the lines of a stream stay in the same
+// stream whatever their structured metadata.
+func streamFingerprint(e *shared.LogEntry) uint64 {
+	if len(e.StructuredMetadata) == 0 {
+		return fingerprint(e.Labels)
+	}
+	labels := make(map[string]string, len(e.Labels))
+	for k, v := range e.Labels {
+		if mv, ok := e.StructuredMetadata[k]; !ok || mv != v {
+			labels[k] = v
+		}
+	}
+	return fingerprint(labels)
+}
+
 func contains(slice []string, s string) bool {
 	for _, v := range slice {
 		if v == s {
@@ -37,3 +54,9 @@ func contains(slice []string, s string) bool {
 	}
 	return false
 }
+
+// Fingerprint computes the fingerprint of a label set the same way the
+// planners of this package do.
+func Fingerprint(labels map[string]string) uint64 {
+	return fingerprint(labels)
+}
@@ -154,3 +154,23 @@ func TestParser(t *testing.T) {
 	}()
 	fmt.Println(<-in)
 }
+
+func TestStreamFingerprint(t *testing.T) {
+	a := shared.LogEntry{
+		Labels:             map[string]string{"app": "api", "trace_id": "a"},
+		StructuredMetadata: map[string]string{"trace_id": "a"},
+	}
+	b := shared.LogEntry{
+		Labels:             map[string]string{"app": "api", "trace_id": "b"},
+		StructuredMetadata: map[string]string{"trace_id": "b"},
+	}
+	if streamFingerprint(&a) != streamFingerprint(&b) ||
+		streamFingerprint(&a) != fingerprint(map[string]string{"app": "api"}) {
+		t.Error("structured metadata must not change the stream fingerprint")
+	}
+	// A label overwritten by the parser is part of the stream
+	b.Labels["trace_id"] = "c"
+	if streamFingerprint(&a) == streamFingerprint(&b) {
+		t.Error("labels different from the structured metadata must change the stream fingerprint")
+	}
+}
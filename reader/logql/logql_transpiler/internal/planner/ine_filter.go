@@ -71,6 +71,9 @@ func buildHeadEval(fn string, head *logql_parser.LineFilterHead) (lineEval, erro
 }
 
 func buildSimpleEval(fn string, s *logql_parser.LineFilterSimple) (lineEval, error) {
+	if s.IP != nil {
+		return buildIPEval(fn, s.IP)
+	}
 	val, err := s.Val.Unquote()
 	if err != nil {
 		return nil, err
@@ -95,3 +98,21 @@ func buildSimpleEval(fn string, s *logql_parser.LineFilterSimple) (lineEval, err
 	}
 	return nil, fmt.Errorf("unsupported line filter op: %s", fn)
 }
+
+func buildIPEval(fn string, arg *logql_parser.QuotedString) (lineEval, error) {
+	val, err := arg.Unquote()
+	if err != nil {
+		return nil, err
+	}
+	matcher, err := shared.ParseIPMatcher(val)
+	if err != nil {
+		return nil, err
+	}
+	switch fn {
+	case "|=":
+		return matcher.MatchLine, nil
+	case "!=":
+		return func(msg string) bool { return !matcher.MatchLine(msg) }, nil
+	}
+	return nil, fmt.Errorf("ip() is not supported by the %s operator", fn)
+}
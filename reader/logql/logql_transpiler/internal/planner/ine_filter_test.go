@@ -0,0 +1,33 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+)
+
+func TestIPLineAndLabelFilters(t *testing.T) {
+	script, err := logql_parser.Parse(`{app="x"} != ip("10.0.0.0/8") | addr = ip("192.168.0.1-192.168.0.9")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ppls := script.Head.StrSelector.Pipelines
+
+	eval, err := buildLineFilterEval(ppls[0].LineFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eval("from 10.1.2.3:80") || !eval("from 11.1.2.3:80") {
+		t.Error("unexpected line filter result")
+	}
+
+	fn, err := (&LabelFilterPlanner{}).makeFilter(ppls[1].LabelFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{"192.168.0.9": true, "192.168.0.10": false, "": false} {
+		if fn(map[string]string{"addr": addr}) != want {
+			t.Errorf("addr=%q: want %v", addr, want)
+		}
+	}
+}
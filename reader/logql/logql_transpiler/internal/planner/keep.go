@@ -38,7 +38,7 @@ func (a *KeepPlanner) filterLabels(e *shared.LogEntry) error {
 		}
 	}
 	if recountFP {
-		e.Fingerprint = fingerprint(e.Labels)
+		e.Fingerprint = streamFingerprint(e)
 	}
 	return nil
 }
@@ -45,7 +45,12 @@ func (a *LabelFilterPlanner) makeFilter(filter *logql_parser.LabelFilter) (func(
 		res func(map[string]string) bool
 		err error
 	)
-	if filter.Head.SimpleHead != nil {
+	if filter.Head.SimpleHead != nil && filter.Head.SimpleHead.IPVal != nil {
+		res, err = a.ipSimpleFilter(filter.Head.SimpleHead)
+		if err != nil {
+			return nil, err
+		}
+	} else if filter.Head.SimpleHead != nil {
 		if contains([]string{"=", "=~", "!~"}, filter.Head.SimpleHead.Fn) ||
 			(filter.Head.SimpleHead.Fn == "!=" && filter.Head.SimpleHead.StrVal != nil) {
 			res, err = a.stringSimpleFilter(filter.Head.SimpleHead)
@@ -124,6 +129,29 @@ func (a *LabelFilterPlanner) stringSimpleFilter(filter *logql_parser.SimpleLabel
 	return nil, fmt.Errorf("invalid simple label filter")
 }
 
+func (a *LabelFilterPlanner) ipSimpleFilter(filter *logql_parser.SimpleLabelFilter,
+) (func(map[string]string) bool, error) {
+	val, err := filter.IPVal.Unquote()
+	if err != nil {
+		return nil, err
+	}
+	matcher, err := shared.ParseIPMatcher(val)
+	if err != nil {
+		return nil, err
+	}
+	switch filter.Fn {
+	case "=":
+		return func(m map[string]string) bool {
+			return matcher.Match(m[filter.Label.Name])
+		}, nil
+	case "!=":
+		return func(m map[string]string) bool {
+			return !matcher.Match(m[filter.Label.Name])
+		}, nil
+	}
+	return nil, fmt.Errorf("ip() is not supported by the %s operator", filter.Fn)
+}
+
 func (a *LabelFilterPlanner) numberSimpleFilter(filter *logql_parser.SimpleLabelFilter,
 ) (func(map[string]string) bool, error) {
 	iVal, err := strconv.ParseFloat(filter.NumVal, 64)
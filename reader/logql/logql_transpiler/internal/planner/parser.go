@@ -16,6 +16,9 @@ type ParserPlanner struct {
 	Op              string
 	ParameterNames  []string
 	ParameterValues []string
+	// Strict and KeepEmpty are the `--strict` and `--keep-empty` logfmt flags
+	Strict    bool
+	KeepEmpty bool
 
 	parameterTypedValues [][]string
 }
@@ -25,18 +28,21 @@ func (p *ParserPlanner) IsMatrix() bool { return false }
 func (p *ParserPlanner) Process(ctx *shared.PlannerContext,
 	in chan []shared.LogEntry) (chan []shared.LogEntry, error) {
 
-	p.parameterTypedValues = make([][]string, len(p.ParameterValues))
-	for i, v := range p.ParameterValues {
-		var err error
-		p.parameterTypedValues[i], err = shared.JsonPathParamToTypedArray(v)
-		if err != nil {
-			return nil, err
-		}
+	if (p.Strict || p.KeepEmpty) && p.Op != "logfmt" {
+		return nil, fmt.Errorf("%s parser does not support flags", p.Op)
 	}
 
 	var parser parserHelper
 	switch p.Op {
 	case "json":
+		p.parameterTypedValues = make([][]string, len(p.ParameterValues))
+		for i, v := range p.ParameterValues {
+			var err error
+			p.parameterTypedValues[i], err = shared.JsonPathParamToTypedArray(v)
+			if err != nil {
+				return nil, err
+			}
+		}
 		if len(p.ParameterNames) > 0 {
 			parser = &parameterJsonHelper{
 				paths: p.parameterTypedValues,
@@ -46,14 +52,30 @@ func (p *ParserPlanner) Process(ctx *shared.PlannerContext,
 			parser = &plainJsonParserHelper{}
 		}
 	case "logfmt":
+		flags := logfmtFlags{strict: p.Strict, keepEmpty: p.KeepEmpty}
 		if len(p.ParameterNames) > 0 {
 			parser = &parameterLogfmtHelper{
-				keys:  p.ParameterNames,
-				paths: p.ParameterValues,
+				logfmtFlags: flags,
+				keys:        p.ParameterNames,
+				paths:       p.ParameterValues,
 			}
 		} else {
-			parser = &plainLogfmtHelper{}
+			parser = &plainLogfmtHelper{logfmtFlags: flags}
 		}
+	case "unpack":
+		if len(p.ParameterNames) > 0 {
+			return nil, fmt.Errorf("unpack parser does not accept parameters")
+		}
+		parser = &unpackParserHelper{}
+	case "pattern":
+		if len(p.ParameterValues) != 1 || p.ParameterNames[0] != "" {
+			return nil, fmt.Errorf("pattern parser requires exactly one pattern expression")
+		}
+		pattern, err := shared.ParsePattern(p.ParameterValues[0])
+		if err != nil {
+			return nil, err
+		}
+		parser = &patternParserHelper{pattern: pattern, names: pattern.Names()}
 	default:
 		return nil, &shared.NotSupportedError{Msg: fmt.Sprintf("%s not supported", p.Op)}
 	}
@@ -75,8 +97,12 @@ func (p *ParserPlanner) Process(ctx *shared.PlannerContext,
 				}
 				entry.Labels[shared.ErrorLabel] = errType
 				entry.Labels[shared.ErrorDetailsLabel] = err.Error()
+			} else if u, ok := parser.(*unpackParserHelper); ok {
+				if line, ok := u.line(); ok {
+					entry.Message = line
+				}
 			}
-			entry.Fingerprint = fingerprint(entry.Labels)
+			entry.Fingerprint = streamFingerprint(entry)
 			return nil
 		},
 		OnAfterEntriesSlice: func(entries []shared.LogEntry, c chan []shared.LogEntry) error {
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/go-faster/jx"
+	gologfmt "github.com/go-logfmt/logfmt"
 	"github.com/kr/logfmt"
-	"golang.org/x/exp/slices"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 )
 
 // errNotJSONObject is returned when a `json` parser is applied to a line whose
@@ -89,10 +91,24 @@ func (p *parameterJsonHelper) dec(path []string, d *jx.Decoder) error {
 		return d.Skip()
 	}
 	switch d.Next() {
-	case jx.Object:
-		return d.Obj(func(d *jx.Decoder, key string) error {
-			return p.dec(append(path, key), d)
-		})
+	case jx.Object, jx.Array:
+		// An expression pointing at an object or an array extracts its raw
+		// json, deeper expressions are resolved from the same value.
+		full := p.pathIdxs(path, true)
+		if len(full) == 0 {
+			return p.decNested(path, d)
+		}
+		val, err := d.Raw()
+		if err != nil {
+			return err
+		}
+		for _, i := range full {
+			(*p.lbls)[p.keys[i]] = string(val)
+		}
+		if len(full) == len(idxs) {
+			return nil
+		}
+		return p.decNested(path, jx.DecodeBytes(val))
 	case jx.String:
 		idxs = p.pathIdxs(path, true)
 		val, err := d.Str()
@@ -111,19 +127,26 @@ func (p *parameterJsonHelper) dec(path []string, d *jx.Decoder) error {
 		for _, i := range idxs {
 			(*p.lbls)[p.keys[i]] = string(val)
 		}
-	case jx.Array:
-		i := 0
-		return d.Arr(func(d *jx.Decoder) error {
-			err := p.dec(append(path, strconv.FormatInt(int64(i), 10)), d)
-			i++
-			return err
-		})
 	default:
 		return d.Skip()
 	}
 	return nil
 }
 
+func (p *parameterJsonHelper) decNested(path []string, d *jx.Decoder) error {
+	if d.Next() == jx.Object {
+		return d.Obj(func(d *jx.Decoder, key string) error {
+			return p.dec(append(path, key), d)
+		})
+	}
+	i := 0
+	return d.Arr(func(d *jx.Decoder) error {
+		err := p.dec(append(path, strconv.FormatInt(int64(i), 10)), d)
+		i++
+		return err
+	})
+}
+
 func (p *parameterJsonHelper) pathIdxs(path []string, fullMatch bool) []int {
 	var res []int
 	for i := range p.paths {
@@ -144,7 +167,43 @@ func (p *parameterJsonHelper) pathIdxs(path []string, fullMatch bool) []int {
 	return res
 }
 
+// logfmtFlags are the `--strict` and `--keep-empty` flags of the logfmt parser.
+type logfmtFlags struct {
+	strict    bool
+	keepEmpty bool
+}
+
+// scan calls fn for every key value pair of line. The default mode is lenient
+// and skips what it can't parse, strict mode stops at the first malformed pair
+// and returns the error. Keys without a value are skipped unless keepEmpty is
+// set.
+func (f logfmtFlags) scan(line string, fn func(key, val string)) error {
+	onPair := func(key, val []byte) {
+		if len(val) > 0 || f.keepEmpty {
+			fn(string(key), string(val))
+		}
+	}
+	if !f.strict {
+		return logfmt.Unmarshal([]byte(line), logfmtHandlerFunc(onPair))
+	}
+	dec := gologfmt.NewDecoder(strings.NewReader(line))
+	for dec.ScanRecord() {
+		for dec.ScanKeyval() {
+			onPair(dec.Key(), dec.Value())
+		}
+	}
+	return dec.Err()
+}
+
+type logfmtHandlerFunc func(key, val []byte)
+
+func (f logfmtHandlerFunc) HandleLogfmt(key, val []byte) error {
+	f(key, val)
+	return nil
+}
+
 type plainLogfmtHelper struct {
+	logfmtFlags
 	lbls *map[string]string
 }
 
@@ -152,17 +211,14 @@ func (l *plainLogfmtHelper) setLabels(m *map[string]string) {
 	l.lbls = m
 }
 
-func (l *plainLogfmtHelper) HandleLogfmt(key, val []byte) error {
-	(*l.lbls)[sanitizeLabel(string(key))] = string(val)
-	return nil
-}
-
 func (l *plainLogfmtHelper) parse(line string) error {
-	err := logfmt.Unmarshal([]byte(line), l)
-	return err
+	return l.scan(line, func(key, val string) {
+		(*l.lbls)[sanitizeLabel(key)] = val
+	})
 }
 
 type parameterLogfmtHelper struct {
+	logfmtFlags
 	lbls  *map[string]string
 	keys  []string
 	paths []string
@@ -172,18 +228,84 @@ func (p *parameterLogfmtHelper) setLabels(m *map[string]string) {
 	p.lbls = m
 }
 
-func (p *parameterLogfmtHelper) HandleLogfmt(key, val []byte) error {
-	_key := string(key)
-	idx := slices.Index(p.paths, _key)
-	if idx != -1 {
-		(*p.lbls)[sanitizeLabel(_key)] = string(val)
+func (p *parameterLogfmtHelper) parse(line string) error {
+	return p.scan(line, func(key, val string) {
+		for i, path := range p.paths {
+			if path != key {
+				continue
+			}
+			if p.keys[i] != "" {
+				(*p.lbls)[p.keys[i]] = val
+			} else {
+				(*p.lbls)[sanitizeLabel(key)] = val
+			}
+		}
+	})
+}
+
+// unpackParserHelper reads back the lines packed by promtail's `pack` stage:
+// the string fields of the json object become labels and `_entry` replaces
+// the line.
+type unpackParserHelper struct {
+	lbls  *map[string]string
+	entry *string
+}
+
+func (u *unpackParserHelper) setLabels(m *map[string]string) {
+	u.lbls = m
+}
+
+func (u *unpackParserHelper) parse(line string) error {
+	u.entry = nil
+	dec := jx.DecodeStr(line)
+	if dec.Next() != jx.Object {
+		return errNotJSONObject
 	}
-	return nil
+	return dec.Obj(func(d *jx.Decoder, key string) error {
+		if d.Next() != jx.String {
+			return d.Skip()
+		}
+		val, err := d.Str()
+		if err != nil {
+			return err
+		}
+		if key == packedEntryKey {
+			u.entry = &val
+		} else if val != "" {
+			(*u.lbls)[sanitizeLabel(key)] = val
+		}
+		return nil
+	})
 }
 
-func (p *parameterLogfmtHelper) parse(line string) error {
-	err := logfmt.Unmarshal([]byte(line), p)
-	return err
+// line returns the unpacked line of the last parse if it had one.
+func (u *unpackParserHelper) line() (string, bool) {
+	if u.entry == nil {
+		return "", false
+	}
+	return *u.entry, true
+}
+
+// packedEntryKey is the field promtail's `pack` stage stores the line in.
+const packedEntryKey = "_entry"
+
+type patternParserHelper struct {
+	pattern shared.Pattern
+	names   []string
+	lbls    *map[string]string
+}
+
+func (p *patternParserHelper) setLabels(m *map[string]string) {
+	p.lbls = m
+}
+
+func (p *patternParserHelper) parse(line string) error {
+	for i, val := range p.pattern.Match(line) {
+		if val != "" {
+			(*p.lbls)[p.names[i]] = val
+		}
+	}
+	return nil
 }
 
 var sanitizeRe = regexp.MustCompile("[^a-zA-Z0-9_]")
@@ -0,0 +1,96 @@
+package planner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+func runParser(t *testing.T, p *ParserPlanner, lines ...string) []shared.LogEntry {
+	t.Helper()
+	in := make(chan []shared.LogEntry, 1)
+	entries := make([]shared.LogEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = shared.LogEntry{Message: line, Labels: map[string]string{"app": "x"}}
+	}
+	in <- entries
+	close(in)
+	p.GenericPlanner = GenericPlanner{&passthroughProcessor{in}}
+	out, err := p.Process(&shared.PlannerContext{Ctx: context.Background()}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return collectEntries(out)
+}
+
+func TestParserLogfmtFlags(t *testing.T) {
+	line := `level=info msg= standalone caller="main.go"`
+	got := runParser(t, &ParserPlanner{Op: "logfmt"}, line)[0].Labels
+	want := map[string]string{"app": "x", "level": "info", "caller": "main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logfmt = %v", got)
+	}
+
+	got = runParser(t, &ParserPlanner{Op: "logfmt", KeepEmpty: true}, line)[0].Labels
+	want = map[string]string{"app": "x", "level": "info", "msg": "", "standalone": "", "caller": "main.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logfmt --keep-empty = %v", got)
+	}
+
+	got = runParser(t, &ParserPlanner{Op: "logfmt", Strict: true}, `level=info msg="unterminated`)[0].Labels
+	if got["level"] != "info" || got[shared.ErrorLabel] != shared.LogfmtParserErr {
+		t.Errorf("logfmt --strict = %v", got)
+	}
+
+	got = runParser(t, &ParserPlanner{
+		Op:              "logfmt",
+		ParameterNames:  []string{"lvl"},
+		ParameterValues: []string{"level"},
+	}, line)[0].Labels
+	if !reflect.DeepEqual(got, map[string]string{"app": "x", "lvl": "info"}) {
+		t.Errorf("logfmt lvl=\"level\" = %v", got)
+	}
+}
+
+func TestParserJsonExpressions(t *testing.T) {
+	p := &ParserPlanner{
+		Op:              "json",
+		ParameterNames:  []string{"first", "nested", "items", "obj"},
+		ParameterValues: []string{"items[0].name", "matrix[1][0]", "items", "obj"},
+	}
+	got := runParser(t, p, `{"items":[{"name":"a"},{"name":"b"}],"matrix":[[1,2],[3,4]],"obj":{"k":true}}`)[0].Labels
+	want := map[string]string{
+		"app":    "x",
+		"first":  "a",
+		"nested": "3",
+		"items":  `[{"name":"a"},{"name":"b"}]`,
+		"obj":    `{"k":true}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json = %v", got)
+	}
+}
+
+func TestParserUnpack(t *testing.T) {
+	got := runParser(t, &ParserPlanner{Op: "unpack"},
+		`{"_entry":"level=info msg=hello","pod":"api-1","count":3}`,
+		`plain line`)
+	if got[0].Message != "level=info msg=hello" {
+		t.Errorf("message = %q", got[0].Message)
+	}
+	if !reflect.DeepEqual(got[0].Labels, map[string]string{"app": "x", "pod": "api-1"}) {
+		t.Errorf("labels = %v", got[0].Labels)
+	}
+	if got[1].Message != "plain line" || got[1].Labels[shared.ErrorLabel] != shared.JSONParserErr {
+		t.Errorf("entry = %+v", got[1])
+	}
+}
+
+func TestParserFlagsOnlyForLogfmt(t *testing.T) {
+	p := &ParserPlanner{Op: "json", Strict: true, GenericPlanner: GenericPlanner{&passthroughProcessor{}}}
+	if _, err := p.Process(&shared.PlannerContext{Ctx: context.Background()}, nil); err == nil {
+		t.Error("expected an error")
+	}
+}
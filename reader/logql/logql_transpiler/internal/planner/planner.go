@@ -57,7 +57,9 @@ func Plan(script *logql_parser.LogQLScript,
 			vals := make([]string, len(ppl.Parser.ParserParams))
 			for i, param := range ppl.Parser.ParserParams {
 				var err error
-				names[i] = param.Label.Name
+				if param.Label != nil {
+					names[i] = param.Label.Name
+				}
 				vals[i], err = param.Val.Unquote()
 				if err != nil {
 					return nil, err
@@ -68,6 +70,8 @@ func Plan(script *logql_parser.LogQLScript,
 				Op:              ppl.Parser.Fn,
 				ParameterNames:  names,
 				ParameterValues: vals,
+				Strict:          ppl.Parser.HasFlag("--strict"),
+				KeepEmpty:       ppl.Parser.HasFlag("--keep-empty"),
 			}
 			continue
 		}
@@ -33,6 +33,14 @@ const (
 func decidePlanMode(script *log_parser.LogQLScript) planMode {
 	script = unwrapParens(script)
 	if script.IsBinary() {
+		if script.Head.Scalar != "" {
+			return planModeInternal
+		}
+		for i := range script.BinOps {
+			if needsVectorMatching(&script.BinOps[i]) {
+				return planModeInternal
+			}
+		}
 		for _, atom := range allBinaryAtoms(script) {
 			if decidePlanModeAtom(atom) == planModeInternal {
 				return planModeInternal
@@ -54,6 +62,9 @@ func decidePlanModeAtom(atom log_parser.AtomExpr) planMode {
 	if atom.Paren != nil {
 		return decidePlanMode(atom.Paren)
 	}
+	if atom.IsFunction() {
+		return planModeInternal
+	}
 	return decidePlanMode(&log_parser.LogQLScript{Head: atom})
 }
 
@@ -73,6 +84,60 @@ func unwrapParens(script *log_parser.LogQLScript) *log_parser.LogQLScript {
 	return script
 }
 
+// binOpPrecedence returns the precedence of a binary operator, the higher the
+// tighter it binds.
+func binOpPrecedence(op string) int {
+	switch op {
+	case "*", "/", "%":
+		return 4
+	case "+", "-":
+		return 3
+	case "==", "!=", ">", ">=", "<", "<=":
+		return 2
+	case "and", "unless":
+		return 1
+	}
+	return 0 // or
+}
+
+// groupByPrecedence regroups the flat operator list of a binary expression so
+// that it is correct to evaluate it from left to right: the operands of the
+// operators binding tighter than the lowest precedence one are wrapped into
+// parentheses, e.g. `a + b * c` becomes `a + (b * c)`.
+func groupByPrecedence(script *log_parser.LogQLScript) *log_parser.LogQLScript {
+	if len(script.BinOps) < 2 {
+		return script
+	}
+	lowest := binOpPrecedence(script.BinOps[0].Op)
+	for _, b := range script.BinOps[1:] {
+		lowest = min(lowest, binOpPrecedence(b.Op))
+	}
+
+	toAtom := func(s *log_parser.LogQLScript) log_parser.AtomExpr {
+		if !s.IsBinary() {
+			return s.Head
+		}
+		return log_parser.AtomExpr{Paren: groupByPrecedence(s)}
+	}
+	res := &log_parser.LogQLScript{}
+	operand := &log_parser.LogQLScript{Head: script.Head}
+	for _, b := range script.BinOps {
+		if binOpPrecedence(b.Op) != lowest {
+			operand.BinOps = append(operand.BinOps, b)
+			continue
+		}
+		if len(res.BinOps) == 0 {
+			res.Head = toAtom(operand)
+		} else {
+			res.BinOps[len(res.BinOps)-1].Right = toAtom(operand)
+		}
+		res.BinOps = append(res.BinOps, b)
+		operand = &log_parser.LogQLScript{Head: b.Right}
+	}
+	res.BinOps[len(res.BinOps)-1].Right = toAtom(operand)
+	return res
+}
+
 // validateBinaryOps returns an error if any operand of a binary expression is a
 // raw log stream selector. Arithmetic can only be applied to matrix (metric) outputs.
 func validateBinaryOps(script *log_parser.LogQLScript) error {
@@ -110,10 +175,13 @@ func validateAtomForBinaryOp(a log_parser.AtomExpr) error {
 }
 
 func Plan(script *log_parser.LogQLScript) (shared.RequestProcessorChain, error) {
-	script = unwrapParens(script)
+	script = groupByPrecedence(unwrapParens(script))
 	if err := validateBinaryOps(script); err != nil {
 		return nil, err
 	}
+	if !script.IsBinary() && script.Head.IsFunction() {
+		return planFunction(script.Head)
+	}
 
 	mode := decidePlanMode(script)
 
@@ -212,6 +280,10 @@ func PlanDetectLabels(script *log_parser.LogQLScript) (shared.SQLRequestPlanner,
 	return clickhouse_planner.PlanDetectLabels(script)
 }
 
+func PlanDetectFields(script *log_parser.LogQLScript, lineLimit int64) (shared.SQLRequestPlanner, error) {
+	return clickhouse_planner.PlanDetectFields(script, lineLimit)
+}
+
 func PlanPatterns(script *log_parser.LogQLScript) (shared.SQLRequestPlanner, error) {
 	return clickhouse_planner.PlanPatterns(script)
 }
@@ -292,7 +364,7 @@ func planBinaryExpr(script *log_parser.LogQLScript) (shared.RequestProcessorChai
 // planScriptToSQL converts any LogQLScript (binary or not) into a SQLRequestPlanner.
 // For nested binary expressions it recursively builds a BinaryExprSQLPlanner tree.
 func planScriptToSQL(script *log_parser.LogQLScript) (shared.SQLRequestPlanner, error) {
-	script = unwrapParens(script)
+	script = groupByPrecedence(unwrapParens(script))
 	if !script.IsBinary() {
 		return clickhouse_planner.Plan(script, true)
 	}
@@ -2,10 +2,12 @@ package logql_transpiler
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"sort"
 	"strconv"
+	"strings"
 
 	log_parser "github.com/metrico/qryn/v5/reader/logql/logql_parser"
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/internal/planner"
@@ -13,14 +15,22 @@ import (
 )
 
 // BinaryExprProcessor merges two independently-run RequestProcessorChains in memory,
-// applying a binary arithmetic operator to matching (fingerprint, timestamp_ns) pairs.
+// applying a binary operator to the samples matched at every timestamp with the
+// Prometheus vector matching semantics.
 // Both chains are started from nil (i.e. they source their own data from the DB).
 type BinaryExprProcessor struct {
-	Left        shared.RequestProcessorChain
-	Right       shared.RequestProcessorChain // nil when IsScalar
-	Op          string
-	RightScalar float64
-	IsScalar    bool
+	Left     shared.RequestProcessorChain
+	Right    shared.RequestProcessorChain // nil when IsScalar
+	Op       string
+	Scalar   float64
+	IsScalar bool
+	// ScalarLeft is set when the scalar is the left operand, Left is the vector then.
+	ScalarLeft bool
+	// ReturnBool makes comparisons return 0 or 1 instead of filtering the samples.
+	ReturnBool bool
+	// Matching is the on/ignoring and group_left/group_right modifier, nil to
+	// match on all the labels.
+	Matching *log_parser.VectorMatching
 }
 
 func (b *BinaryExprProcessor) IsMatrix() bool { return true }
@@ -35,30 +45,29 @@ func (b *BinaryExprProcessor) Process(ctx *shared.PlannerContext, _ chan []share
 		return nil, err
 	}
 
-	out := make(chan []shared.LogEntry)
-
+	var res []shared.LogEntry
 	if b.IsScalar {
-		go func() {
-			defer close(out)
-			defer func() { shared.TamePanic(out) }()
-			emitScalar(leftMap, b.Op, b.RightScalar, out)
-		}()
-		return out, nil
-	}
-
-	rightCh, err := b.Right[0].Process(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-	rightMap, err := drainMatrix(rightCh)
-	if err != nil {
-		return nil, err
+		res = b.applyScalar(leftMap)
+	} else {
+		rightCh, err := b.Right[0].Process(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		rightMap, err := drainMatrix(rightCh)
+		if err != nil {
+			return nil, err
+		}
+		res, err = b.applyVector(leftMap, rightMap)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	out := make(chan []shared.LogEntry)
 	go func() {
 		defer close(out)
 		defer func() { shared.TamePanic(out) }()
-		emitBinary(leftMap, rightMap, b.Op, out)
+		emitSorted(res, out)
 	}()
 	return out, nil
 }
@@ -87,41 +96,262 @@ func drainMatrix(ch chan []shared.LogEntry) (map[sampleKey]shared.LogEntry, erro
 	return m, nil
 }
 
-func emitScalar(left map[sampleKey]shared.LogEntry, op string, scalar float64, out chan []shared.LogEntry) {
-	keys := sortedSampleKeys(left)
-	batch := make([]shared.LogEntry, 0, min(len(keys), 100))
-	for _, k := range keys {
-		e := left[k]
-		e.Value = applyBinaryOp(e.Value, op, scalar)
-		batch = append(batch, e)
-		if len(batch) == 100 {
-			out <- batch
-			batch = make([]shared.LogEntry, 0, 100)
+func (b *BinaryExprProcessor) applyScalar(vector map[sampleKey]shared.LogEntry) []shared.LogEntry {
+	res := make([]shared.LogEntry, 0, len(vector))
+	for _, e := range vector {
+		left, right := e.Value, b.Scalar
+		if b.ScalarLeft {
+			left, right = right, left
+		}
+		val, keep := b.apply(left, right)
+		if !keep {
+			continue
+		}
+		// A filtering comparison keeps the value of the vector side.
+		if b.ScalarLeft && isComparison(b.Op) && !b.ReturnBool {
+			val = e.Value
 		}
+		e.Value = val
+		res = append(res, e)
 	}
-	out <- append(batch, shared.LogEntry{Err: io.EOF})
+	return res
 }
 
-// emitBinary inner-joins left and right on (fingerprint, timestamp_ns).
-// Entries present in only one side are dropped (Prometheus vector matching semantics).
-func emitBinary(left, right map[sampleKey]shared.LogEntry, op string, out chan []shared.LogEntry) {
-	var keys []sampleKey
-	for k := range left {
-		if _, ok := right[k]; ok {
-			keys = append(keys, k)
+// applyVector matches the samples of both sides at every timestamp.
+func (b *BinaryExprProcessor) applyVector(left, right map[sampleKey]shared.LogEntry) ([]shared.LogEntry, error) {
+	leftByTs := groupByTimestamp(left)
+	rightByTs := groupByTimestamp(right)
+	var res []shared.LogEntry
+	if b.Op == "or" {
+		// timestamps with samples on the right side only
+		for ts, r := range rightByTs {
+			if _, ok := leftByTs[ts]; !ok {
+				res = append(res, r...)
+			}
 		}
 	}
-	sort.Slice(keys, func(i, j int) bool {
-		if keys[i].Fingerprint != keys[j].Fingerprint {
-			return keys[i].Fingerprint < keys[j].Fingerprint
+	for ts, l := range leftByTs {
+		var (
+			matched []shared.LogEntry
+			err     error
+		)
+		switch b.Op {
+		case "and", "or", "unless":
+			matched = b.applySet(l, rightByTs[ts])
+		default:
+			matched, err = b.applyMatched(l, rightByTs[ts])
 		}
-		return keys[i].TimestampNS < keys[j].TimestampNS
-	})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, matched...)
+	}
+	return res, nil
+}
+
+func (b *BinaryExprProcessor) applySet(left, right []shared.LogEntry) []shared.LogEntry {
+	leftSigs := make(map[string]bool, len(left))
+	for _, e := range left {
+		leftSigs[b.signature(e.Labels)] = true
+	}
+	rightSigs := make(map[string]bool, len(right))
+	for _, e := range right {
+		rightSigs[b.signature(e.Labels)] = true
+	}
+
+	var res []shared.LogEntry
+	for _, e := range left {
+		inRight := rightSigs[b.signature(e.Labels)]
+		if b.Op == "or" || (b.Op == "and" && inRight) || (b.Op == "unless" && !inRight) {
+			res = append(res, e)
+		}
+	}
+	if b.Op == "or" {
+		for _, e := range right {
+			if !leftSigs[b.signature(e.Labels)] {
+				res = append(res, e)
+			}
+		}
+	}
+	return res
+}
+
+// applyMatched applies an arithmetic or comparison operator. Every sample of
+// the "many" side is matched with the only sample of the "one" side having
+// the same signature.
+func (b *BinaryExprProcessor) applyMatched(left, right []shared.LogEntry) ([]shared.LogEntry, error) {
+	many, one := left, right
+	oneSide := "right"
+	groupRight := b.Matching != nil && b.Matching.Group == "group_right"
+	if groupRight {
+		many, one = right, left
+		oneSide = "left"
+	}
+
+	oneBySig := make(map[string]*shared.LogEntry, len(one))
+	for i := range one {
+		sig := b.signature(one[i].Labels)
+		if _, ok := oneBySig[sig]; ok {
+			return nil, fmt.Errorf("found duplicate series for the match group %s on the %s hand-side of the operation; "+
+				"many-to-many matching not allowed: matching labels must be unique on one side", sig, oneSide)
+		}
+		oneBySig[sig] = &one[i]
+	}
+
+	oneToOne := b.Matching == nil || b.Matching.Group == ""
+	matchedSigs := map[string]bool{}
+	resultFps := map[uint64]bool{}
+	var res []shared.LogEntry
+	for _, e := range many {
+		sig := b.signature(e.Labels)
+		o, ok := oneBySig[sig]
+		if !ok {
+			continue
+		}
+		if oneToOne {
+			if matchedSigs[sig] {
+				return nil, fmt.Errorf("multiple matches for labels %s: many-to-one matching must be explicit (group_left/group_right)", sig)
+			}
+			matchedSigs[sig] = true
+		}
+
+		lv, rv := e.Value, o.Value
+		if groupRight {
+			lv, rv = rv, lv
+		}
+		val, keep := b.apply(lv, rv)
+		if !keep {
+			continue
+		}
+		labels := b.resultLabels(e.Labels, o.Labels)
+		fp := planner.Fingerprint(labels)
+		if resultFps[fp] {
+			return nil, fmt.Errorf("multiple matches for labels %s: grouping labels must ensure unique matches", sig)
+		}
+		resultFps[fp] = true
+		res = append(res, shared.LogEntry{
+			TimestampNS: e.TimestampNS,
+			Fingerprint: fp,
+			Labels:      labels,
+			Value:       val,
+		})
+	}
+	return res, nil
+}
+
+// signature returns the labels used to match the samples of both sides.
+func (b *BinaryExprProcessor) signature(labels map[string]string) string {
+	var names []string
+	if b.Matching != nil && b.Matching.Fn == "on" {
+		for _, l := range b.Matching.Labels {
+			names = append(names, l.Name)
+		}
+	} else {
+		for name := range labels {
+			if b.Matching == nil || !vectorMatchingHas(b.Matching.Labels, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// resultLabels returns the labels of a sample computed from a sample of the
+// "many" side and its match on the "one" side.
+func (b *BinaryExprProcessor) resultLabels(many, one map[string]string) map[string]string {
+	res := make(map[string]string, len(many))
+	for k, v := range many {
+		res[k] = v
+	}
+	if b.Matching == nil {
+		return res
+	}
+	if b.Matching.Group == "" {
+		for k := range res {
+			if vectorMatchingHas(b.Matching.Labels, k) != (b.Matching.Fn == "on") {
+				delete(res, k)
+			}
+		}
+	}
+	for _, l := range b.Matching.GroupLabels {
+		if v := one[l.Name]; v != "" {
+			res[l.Name] = v
+		} else {
+			delete(res, l.Name)
+		}
+	}
+	return res
+}
+
+func vectorMatchingHas(labels []log_parser.LabelName, name string) bool {
+	for _, l := range labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the result of the operator and whether the sample is kept.
+func (b *BinaryExprProcessor) apply(left, right float64) (float64, bool) {
+	if !isComparison(b.Op) {
+		return applyBinaryOp(left, b.Op, right), true
+	}
+	var res bool
+	switch b.Op {
+	case "==":
+		res = left == right
+	case "!=":
+		res = left != right
+	case ">":
+		res = left > right
+	case ">=":
+		res = left >= right
+	case "<":
+		res = left < right
+	case "<=":
+		res = left <= right
+	}
+	if b.ReturnBool {
+		if res {
+			return 1, true
+		}
+		return 0, true
+	}
+	return left, res
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", ">", ">=", "<", "<=":
+		return true
+	}
+	return false
+}
+
+func groupByTimestamp(m map[sampleKey]shared.LogEntry) map[int64][]shared.LogEntry {
+	res := make(map[int64][]shared.LogEntry)
+	for _, k := range sortedSampleKeys(m) {
+		res[k.TimestampNS] = append(res[k.TimestampNS], m[k])
+	}
+	return res
+}
 
-	batch := make([]shared.LogEntry, 0, min(len(keys), 100))
-	for _, k := range keys {
-		e := left[k]
-		e.Value = applyBinaryOp(e.Value, op, right[k].Value)
+// emitSorted sends the entries ordered by (fingerprint, timestamp_ns).
+func emitSorted(entries []shared.LogEntry, out chan []shared.LogEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Fingerprint != entries[j].Fingerprint {
+			return entries[i].Fingerprint < entries[j].Fingerprint
+		}
+		return entries[i].TimestampNS < entries[j].TimestampNS
+	})
+	batch := make([]shared.LogEntry, 0, min(len(entries), 100))
+	for _, e := range entries {
 		batch = append(batch, e)
 		if len(batch) == 100 {
 			out <- batch
@@ -167,51 +397,117 @@ func applyBinaryOp(left float64, op string, right float64) float64 {
 	return 0
 }
 
+// needsVectorMatching reports whether the operator can't be evaluated by the
+// fingerprint join of BinaryExprSQLPlanner: comparisons, set operators and
+// vector matching modifiers are only evaluated in memory.
+func needsVectorMatching(binOp *log_parser.BinOpPart) bool {
+	return binOp.Matching != nil || binOp.Bool || binOp.IsComparison() || binOp.IsSetOperator()
+}
+
+// validateBinOp checks the modifiers of a binary operator.
+func validateBinOp(binOp *log_parser.BinOpPart, scalar bool) error {
+	if binOp.Bool && !binOp.IsComparison() {
+		return fmt.Errorf("bool modifier can only be used on comparison operators")
+	}
+	if binOp.IsSetOperator() && scalar {
+		return fmt.Errorf("set operator %q not allowed in binary scalar expression", binOp.Op)
+	}
+	if binOp.Matching != nil && scalar {
+		return fmt.Errorf("vector matching only allowed between vectors")
+	}
+	if binOp.IsSetOperator() && binOp.Matching != nil && binOp.Matching.Group != "" {
+		return fmt.Errorf("no grouping allowed for %q operation", binOp.Op)
+	}
+	if binOp.Matching != nil && binOp.Matching.Fn == "on" {
+		for _, l := range binOp.Matching.GroupLabels {
+			if vectorMatchingHas(binOp.Matching.Labels, l.Name) {
+				return fmt.Errorf("label %q must not occur in ON and GROUP clause at once", l.Name)
+			}
+		}
+	}
+	return nil
+}
+
 // planBinaryExprRAM plans a binary expression using in-process merging.
 // Each operand is planned as an independent RequestProcessorChain (including its
 // own ZeroEater + FixPeriod). The merged result has ZeroEater applied once more to
-// eat zeros produced by the arithmetic itself (e.g. a - a = 0).
+// eat zeros produced by the arithmetic itself (e.g. a - a = 0), unless the last
+// operator is a `bool` comparison whose zeros are meaningful.
 // FixPeriod is intentionally NOT re-applied: sub-chain timestamps are already at
 // step intervals, and re-expanding them would duplicate entries.
 func planBinaryExprRAM(script *log_parser.LogQLScript) (shared.RequestProcessorChain, error) {
-	current, err := planAtomChain(script.Head)
-	if err != nil {
-		return nil, err
+	var (
+		current shared.RequestProcessorChain
+		err     error
+	)
+	if script.Head.Scalar == "" {
+		current, err = planAtomChain(script.Head)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	for _, binOp := range script.BinOps {
-		var next shared.RequestProcessor
+	for i := range script.BinOps {
+		binOp := &script.BinOps[i]
+		scalarOperand := current == nil || binOp.Right.Scalar != ""
+		if err := validateBinOp(binOp, scalarOperand); err != nil {
+			return nil, err
+		}
+		next := &BinaryExprProcessor{
+			Op:         binOp.Op,
+			ReturnBool: binOp.Bool,
+			Matching:   binOp.Matching,
+		}
 
-		if binOp.Right.Scalar != "" {
-			scalar, err := strconv.ParseFloat(binOp.Right.Scalar, 64)
+		switch {
+		case current == nil && binOp.Right.Scalar != "":
+			return nil, &shared.NotSupportedError{Msg: "binary expressions between two scalars are not supported"}
+		case current == nil:
+			next.Scalar, err = strconv.ParseFloat(script.Head.Scalar, 64)
 			if err != nil {
 				return nil, err
 			}
-			next = &BinaryExprProcessor{
-				Left:        current,
-				Op:          binOp.Op,
-				RightScalar: scalar,
-				IsScalar:    true,
+			next.Left, err = planAtomChain(binOp.Right)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			right, err := planAtomChain(binOp.Right)
+			next.IsScalar = true
+			next.ScalarLeft = true
+		case binOp.Right.Scalar != "":
+			next.Scalar, err = strconv.ParseFloat(binOp.Right.Scalar, 64)
 			if err != nil {
 				return nil, err
 			}
-			next = &BinaryExprProcessor{
-				Left:  current,
-				Right: right,
-				Op:    binOp.Op,
+			next.Left = current
+			next.IsScalar = true
+		default:
+			next.Right, err = planAtomChain(binOp.Right)
+			if err != nil {
+				return nil, err
 			}
+			next.Left = current
 		}
 
 		current = shared.RequestProcessorChain{next}
 	}
 
+	// bool comparisons and vector() return meaningful zeros
+	if script.BinOps[len(script.BinOps)-1].Bool || hasVectorOperand(script) {
+		return current, nil
+	}
 	var proc shared.RequestProcessor = &ZeroEaterPlanner{planner.GenericPlanner{Main: current[0]}}
 	return shared.RequestProcessorChain{proc}, nil
 }
 
+func hasVectorOperand(script *log_parser.LogQLScript) bool {
+	for _, atom := range allBinaryAtoms(script) {
+		if atom.Vector != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // planAtomChain plans a single AtomExpr as a RequestProcessorChain.
 func planAtomChain(atom log_parser.AtomExpr) (shared.RequestProcessorChain, error) {
 	if atom.Paren != nil {
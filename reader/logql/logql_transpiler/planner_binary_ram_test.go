@@ -0,0 +1,196 @@
+package logql_transpiler
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	log_parser "github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/internal/planner"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+type testSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// staticMatrix is a processor returning fixed samples at a single timestamp.
+type staticMatrix []testSample
+
+func (s staticMatrix) IsMatrix() bool { return true }
+
+func (s staticMatrix) Process(*shared.PlannerContext, chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	out := make(chan []shared.LogEntry, 1)
+	entries := make([]shared.LogEntry, 0, len(s)+1)
+	for _, sample := range s {
+		entries = append(entries, shared.LogEntry{
+			TimestampNS: 1,
+			Fingerprint: planner.Fingerprint(sample.labels),
+			Labels:      sample.labels,
+			Value:       sample.value,
+		})
+	}
+	out <- append(entries, shared.LogEntry{Err: io.EOF})
+	close(out)
+	return out, nil
+}
+
+// runBinary evaluates left and right with the operator of query, written as
+// `x <op> y`, and returns the results as sorted `{labels} value` strings.
+func runBinary(t *testing.T, query string, left, right staticMatrix) ([]string, error) {
+	t.Helper()
+	query = strings.NewReplacer("x", `rate({a="1"}[1m])`, "y", `rate({a="2"}[1m])`).Replace(query)
+	script, err := log_parser.Parse(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	binOp := script.BinOps[0]
+	if err := validateBinOp(&binOp, false); err != nil {
+		return nil, err
+	}
+	proc := &BinaryExprProcessor{
+		Left:       shared.RequestProcessorChain{left},
+		Right:      shared.RequestProcessorChain{right},
+		Op:         binOp.Op,
+		ReturnBool: binOp.Bool,
+		Matching:   binOp.Matching,
+	}
+	out, err := proc.Process(&shared.PlannerContext{Ctx: context.Background()}, nil)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := drainMatrix(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, e := range entries {
+		if e.Fingerprint != planner.Fingerprint(e.Labels) {
+			t.Errorf("fingerprint of %v not updated", e.Labels)
+		}
+		var lbls []string
+		for k, v := range e.Labels {
+			lbls = append(lbls, k+"="+v)
+		}
+		sort.Strings(lbls)
+		res = append(res, "{"+strings.Join(lbls, ",")+"} "+strconv.FormatFloat(e.Value, 'g', -1, 64))
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func TestBinaryVectorMatching(t *testing.T) {
+	errors := staticMatrix{
+		{map[string]string{"app": "api", "level": "error"}, 2},
+		{map[string]string{"app": "web", "level": "error"}, 1},
+	}
+	total := staticMatrix{
+		{map[string]string{"app": "api"}, 8},
+		{map[string]string{"app": "web"}, 4},
+		{map[string]string{"app": "db"}, 4},
+	}
+
+	cases := []struct {
+		query       string
+		left, right staticMatrix
+		want        []string
+	}{
+		// without modifiers the label sets differ and nothing matches
+		{`x / y`, errors, total, nil},
+		{`x / on(app) y`, errors, total, []string{"{app=api} 0.25", "{app=web} 0.25"}},
+		{`x / ignoring(level) y`, errors, total, []string{"{app=api} 0.25", "{app=web} 0.25"}},
+		{`x / on(app) group_left y`, errors, total,
+			[]string{"{app=api,level=error} 0.25", "{app=web,level=error} 0.25"}},
+		{`y * on(app) group_right x`, total, errors,
+			[]string{"{app=api,level=error} 16", "{app=web,level=error} 4"}},
+		{`x > on(app) y`, total, total, nil},
+		{`x >= on(app) y`, total, total, []string{"{app=api} 8", "{app=db} 4", "{app=web} 4"}},
+		{`x > bool on(app) group_left y`, errors, total,
+			[]string{"{app=api,level=error} 0", "{app=web,level=error} 0"}},
+		{`x and on(app) y`, total, errors, []string{"{app=api} 8", "{app=web} 4"}},
+		{`x unless on(app) y`, total, errors, []string{"{app=db} 4"}},
+		{`x or on(app) y`, staticMatrix{total[0]}, errors, []string{"{app=api} 8", "{app=web,level=error} 1"}},
+	}
+	for _, c := range cases {
+		got, err := runBinary(t, c.query, c.left, c.right)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestBinaryVectorMatchingErrors(t *testing.T) {
+	errors := staticMatrix{
+		{map[string]string{"app": "api", "level": "error"}, 2},
+		{map[string]string{"app": "api", "level": "warn"}, 1},
+	}
+	total := staticMatrix{{map[string]string{"app": "api"}, 8}}
+	for _, query := range []string{
+		`x / on(app) y`,                 // many-to-one without group_left
+		`x / on(app) group_right y`,     // the "one" side has duplicates
+		`x + bool y`,                    // bool on an arithmetic operator
+		`x and on(app) group_left y`,    // grouping on a set operator
+		`x / on(app) group_left(app) y`, // label in both on and group_left
+	} {
+		if _, err := runBinary(t, query, errors, total); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestBinaryScalar(t *testing.T) {
+	vector := staticMatrix{
+		{map[string]string{"app": "api"}, 8},
+		{map[string]string{"app": "web"}, 2},
+	}
+	cases := []struct {
+		proc *BinaryExprProcessor
+		want []float64
+	}{
+		{&BinaryExprProcessor{Op: ">", Scalar: 4}, []float64{8}},
+		{&BinaryExprProcessor{Op: ">", Scalar: 4, ReturnBool: true}, []float64{0, 1}},
+		{&BinaryExprProcessor{Op: "<", Scalar: 4, ScalarLeft: true}, []float64{8}},
+		{&BinaryExprProcessor{Op: "-", Scalar: 10, ScalarLeft: true}, []float64{2, 8}},
+	}
+	for _, c := range cases {
+		c.proc.Left = shared.RequestProcessorChain{vector}
+		c.proc.IsScalar = true
+		out, err := c.proc.Process(&shared.PlannerContext{Ctx: context.Background()}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := drainMatrix(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []float64
+		for _, e := range entries {
+			got = append(got, e.Value)
+		}
+		sort.Float64s(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+v = %v, want %v", c.proc, got, c.want)
+		}
+	}
+}
+
+func TestGroupByPrecedence(t *testing.T) {
+	script, err := log_parser.Parse(`1 + rate({a="1"}[1m]) * 2 > 3 and rate({a="2"}[1m]) or rate({a="3"}[1m]) - 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := groupByPrecedence(script).String()
+	want := `(((1 + (rate ({a="1"}[1m]) * 2)) > 3) and rate ({a="2"}[1m])) or (rate ({a="3"}[1m]) - 1)`
+	if got != want {
+		t.Errorf("groupByPrecedence() = %s\nwant %s", got, want)
+	}
+}
@@ -18,10 +18,13 @@ func (m *FixPeriodPlanner) Process(ctx *shared.PlannerContext,
 	in chan []shared.LogEntry) (chan []shared.LogEntry, error) {
 	_from := ctx.From.UnixNano()
 	_to := ctx.To.UnixNano()
-	ctx.From = ctx.From.Truncate(m.Duration)
-	ctx.To = ctx.To.Truncate(m.Duration).Add(m.Duration)
+	// The context is shared with the other operands of the query, they must
+	// keep seeing the requested range.
+	_ctx := *ctx
+	_ctx.From = ctx.From.Truncate(m.Duration)
+	_ctx.To = ctx.To.Truncate(m.Duration).Add(m.Duration)
 
-	_in, err := m.Main.Process(ctx, in)
+	_in, err := m.Main.Process(&_ctx, in)
 	if err != nil {
 		return nil, err
 	}
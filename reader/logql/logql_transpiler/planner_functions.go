@@ -0,0 +1,316 @@
+package logql_transpiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	log_parser "github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/internal/planner"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// planFunction plans label_replace, vector, sort, sort_desc and absent. They
+// are evaluated in memory on top of the plan of their argument.
+func planFunction(atom log_parser.AtomExpr) (shared.RequestProcessorChain, error) {
+	if atom.Vector != nil {
+		val, err := strconv.ParseFloat(atom.Vector.Val, 64)
+		if err != nil {
+			return nil, err
+		}
+		return shared.RequestProcessorChain{&VectorProcessor{Value: val}}, nil
+	}
+
+	var (
+		fn   string
+		expr *log_parser.LogQLScript
+	)
+	switch {
+	case atom.LabelReplace != nil:
+		fn, expr = "label_replace", &atom.LabelReplace.Expr
+	case atom.Sort != nil:
+		fn, expr = atom.Sort.Fn, &atom.Sort.Expr
+	case atom.Absent != nil:
+		fn, expr = "absent", &atom.Absent.Expr
+	default:
+		return nil, fmt.Errorf("unsupported function %s", atom.String())
+	}
+	main, err := Plan(expr)
+	if err != nil {
+		return nil, err
+	}
+	if !main[0].IsMatrix() {
+		return nil, fmt.Errorf("%s: expected a metric query, got a log stream selector", fn)
+	}
+
+	var proc shared.RequestProcessor
+	switch {
+	case atom.LabelReplace != nil:
+		proc, err = newLabelReplaceProcessor(atom.LabelReplace, main[0])
+	case atom.Sort != nil:
+		proc = &SortProcessor{Main: main[0], Desc: atom.Sort.Fn == "sort_desc"}
+	default:
+		proc = &AbsentProcessor{Main: main[0], Labels: absentLabels(unwrapParens(expr))}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return shared.RequestProcessorChain{proc}, nil
+}
+
+// stepTimestamps returns the timestamps of the steps of the request, aligned
+// the same way as FixPeriodPlanner aligns the samples of the range queries.
+func stepTimestamps(ctx *shared.PlannerContext) []int64 {
+	from, to := ctx.From.UnixNano(), ctx.To.UnixNano()
+	if ctx.Step <= 0 {
+		return []int64{to}
+	}
+	res := make([]int64, 0, (to-from)/ctx.Step.Nanoseconds()+1)
+	for ts := from; ts <= to; ts += ctx.Step.Nanoseconds() {
+		res = append(res, ts)
+	}
+	return res
+}
+
+// LabelReplaceProcessor implements label_replace(v, dst, replacement, src,
+// regex): when the anchored regex matches the value of src, dst is set to the
+// expanded replacement, or removed if the replacement is empty.
+type LabelReplaceProcessor struct {
+	planner.GenericPlanner
+	Dst         string
+	Replacement string
+	Src         string
+	Regex       *regexp.Regexp
+}
+
+func newLabelReplaceProcessor(fn *log_parser.LabelReplace, main shared.RequestProcessor) (*LabelReplaceProcessor, error) {
+	var args [4]string
+	for i, q := range []*log_parser.QuotedString{&fn.Dst, &fn.Replacement, &fn.Src, &fn.Regex} {
+		var err error
+		if args[i], err = q.Unquote(); err != nil {
+			return nil, err
+		}
+	}
+	if !labelNameRe.MatchString(args[0]) {
+		return nil, fmt.Errorf("label_replace: invalid destination label name %q", args[0])
+	}
+	re, err := regexp.Compile("^(?:" + args[3] + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("label_replace: invalid regular expression %q: %w", args[3], err)
+	}
+	return &LabelReplaceProcessor{
+		GenericPlanner: planner.GenericPlanner{Main: main},
+		Dst:            args[0],
+		Replacement:    args[1],
+		Src:            args[2],
+		Regex:          re,
+	}, nil
+}
+
+func (l *LabelReplaceProcessor) IsMatrix() bool { return true }
+
+func (l *LabelReplaceProcessor) Process(ctx *shared.PlannerContext,
+	in chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	type replaced struct {
+		fingerprint uint64
+		labels      map[string]string
+	}
+	series := map[uint64]replaced{}
+	sources := map[uint64]uint64{}
+	return l.GenericPlanner.WrapProcess(ctx, in, planner.GenericPlannerOps{
+		OnEntry: func(entry *shared.LogEntry) error {
+			if entry.Err != nil {
+				return nil
+			}
+			r, ok := series[entry.Fingerprint]
+			if !ok {
+				r.labels = l.replace(entry.Labels)
+				r.fingerprint = planner.Fingerprint(r.labels)
+				if src, ok := sources[r.fingerprint]; ok && src != entry.Fingerprint {
+					return errors.New("label_replace: vector cannot contain metrics with the same labelset")
+				}
+				sources[r.fingerprint] = entry.Fingerprint
+				series[entry.Fingerprint] = r
+			}
+			entry.Fingerprint, entry.Labels = r.fingerprint, r.labels
+			return nil
+		},
+		OnAfterEntriesSlice: func(entries []shared.LogEntry, c chan []shared.LogEntry) error {
+			if len(entries) > 0 {
+				c <- entries
+			}
+			return nil
+		},
+		OnAfterEntries: func(c chan []shared.LogEntry) error {
+			return nil
+		},
+	})
+}
+
+func (l *LabelReplaceProcessor) replace(labels map[string]string) map[string]string {
+	val := labels[l.Src]
+	idx := l.Regex.FindStringSubmatchIndex(val)
+	if idx == nil {
+		return labels
+	}
+	dst := string(l.Regex.ExpandString(nil, l.Replacement, val, idx))
+	res := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	if dst == "" {
+		delete(res, l.Dst)
+	} else {
+		res[l.Dst] = dst
+	}
+	return res
+}
+
+// VectorProcessor implements vector(s): a series without labels with the value
+// s at every step.
+type VectorProcessor struct {
+	Value float64
+}
+
+func (v *VectorProcessor) IsMatrix() bool { return true }
+
+func (v *VectorProcessor) Process(ctx *shared.PlannerContext,
+	_ chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	labels := map[string]string{}
+	fingerprint := planner.Fingerprint(labels)
+	timestamps := stepTimestamps(ctx)
+	entries := make([]shared.LogEntry, 0, len(timestamps)+1)
+	for _, ts := range timestamps {
+		entries = append(entries, shared.LogEntry{
+			TimestampNS: ts,
+			Fingerprint: fingerprint,
+			Labels:      labels,
+			Value:       v.Value,
+		})
+	}
+	out := make(chan []shared.LogEntry, 1)
+	out <- append(entries, shared.LogEntry{Err: io.EOF})
+	close(out)
+	return out, nil
+}
+
+// SortProcessor implements sort and sort_desc: the series are returned ordered
+// by the value of their latest sample, which is the value an instant query
+// returns.
+type SortProcessor struct {
+	Main shared.RequestProcessor
+	Desc bool
+}
+
+func (s *SortProcessor) IsMatrix() bool { return true }
+
+func (s *SortProcessor) Process(ctx *shared.PlannerContext,
+	in chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	_in, err := s.Main.Process(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	series, err := shared.DrainSeries(_in)
+	if err != nil {
+		return nil, err
+	}
+	latest := func(entries []shared.LogEntry) shared.LogEntry {
+		res := entries[0]
+		for _, e := range entries[1:] {
+			if e.TimestampNS > res.TimestampNS {
+				res = e
+			}
+		}
+		return res
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		a, b := latest(series[i]).Value, latest(series[j]).Value
+		if s.Desc {
+			a, b = b, a
+		}
+		return a < b
+	})
+
+	out := make(chan []shared.LogEntry)
+	go func() {
+		defer close(out)
+		defer func() { shared.TamePanic(out) }()
+		for _, entries := range series {
+			out <- entries
+		}
+		out <- []shared.LogEntry{{Err: io.EOF}}
+	}()
+	return out, nil
+}
+
+// AbsentProcessor implements absent(v): a series with the value 1 at every
+// step v has no sample at.
+type AbsentProcessor struct {
+	Main   shared.RequestProcessor
+	Labels map[string]string
+}
+
+func (a *AbsentProcessor) IsMatrix() bool { return true }
+
+func (a *AbsentProcessor) Process(ctx *shared.PlannerContext,
+	in chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	timestamps := stepTimestamps(ctx)
+	_in, err := a.Main.Process(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	series, err := shared.DrainSeries(_in)
+	if err != nil {
+		return nil, err
+	}
+	present := map[int64]bool{}
+	for _, entries := range series {
+		for _, e := range entries {
+			present[e.TimestampNS] = true
+		}
+	}
+
+	fingerprint := planner.Fingerprint(a.Labels)
+	entries := make([]shared.LogEntry, 0, len(timestamps)+1)
+	for _, ts := range timestamps {
+		if !present[ts] {
+			entries = append(entries, shared.LogEntry{
+				TimestampNS: ts,
+				Fingerprint: fingerprint,
+				Labels:      a.Labels,
+				Value:       1,
+			})
+		}
+	}
+	out := make(chan []shared.LogEntry, 1)
+	out <- append(entries, shared.LogEntry{Err: io.EOF})
+	close(out)
+	return out, nil
+}
+
+// absentLabels returns the labels of the result of absent(): the equality
+// matchers of the stream selector of a range aggregation, except the labels
+// matched more than once.
+func absentLabels(script *log_parser.LogQLScript) map[string]string {
+	res := map[string]string{}
+	if script.IsBinary() || script.Head.LRAOrUnwrap == nil {
+		return res
+	}
+	seen := map[string]bool{}
+	for _, cmd := range script.Head.LRAOrUnwrap.StrSel.StrSelCmds {
+		name := cmd.Label.Name
+		val, err := cmd.Val.Unquote()
+		if cmd.Op != "=" || seen[name] || err != nil {
+			delete(res, name)
+		} else {
+			res[name] = val
+		}
+		seen[name] = true
+	}
+	return res
+}
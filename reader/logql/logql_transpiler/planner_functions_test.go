@@ -0,0 +1,197 @@
+package logql_transpiler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	log_parser "github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/internal/planner"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+// stepContext returns a context with the steps 1ns, 2ns and 3ns, the samples
+// of staticMatrix are at the first one.
+func stepContext() *shared.PlannerContext {
+	return &shared.PlannerContext{
+		Ctx:  context.Background(),
+		From: time.Unix(0, 1),
+		To:   time.Unix(0, 3),
+		Step: time.Nanosecond,
+	}
+}
+
+func runProcessor(t *testing.T, proc shared.RequestProcessor) [][]shared.LogEntry {
+	t.Helper()
+	out, err := proc.Process(stepContext(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := shared.DrainSeries(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestLabelReplace(t *testing.T) {
+	script, err := log_parser.Parse(`label_replace(rate({a="1"}[1m]), "svc", "$1", "app", "(.*)-api")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := staticMatrix{
+		{map[string]string{"app": "web-api"}, 1},
+		{map[string]string{"app": "db"}, 2},
+	}
+	proc, err := newLabelReplaceProcessor(script.Head.LabelReplace, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]string
+	for _, series := range runProcessor(t, proc) {
+		if series[0].Fingerprint != planner.Fingerprint(series[0].Labels) {
+			t.Errorf("fingerprint of %v not updated", series[0].Labels)
+		}
+		got = append(got, series[0].Labels)
+	}
+	want := []map[string]string{{"app": "web-api", "svc": "web"}, {"app": "db"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("label_replace = %v, want %v", got, want)
+	}
+	if input[0].labels["svc"] != "" {
+		t.Error("label_replace modified the labels of its input")
+	}
+}
+
+func TestLabelReplaceErrors(t *testing.T) {
+	for _, query := range []string{
+		`label_replace(rate({a="1"}[1m]), "1svc", "$1", "app", "(.*)")`,
+		`label_replace(rate({a="1"}[1m]), "svc", "$1", "app", "(.*")`,
+	} {
+		script, err := log_parser.Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newLabelReplaceProcessor(script.Head.LabelReplace, staticMatrix{}); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+
+	// dropping the only distinguishing label merges two series
+	script, err := log_parser.Parse(`label_replace(rate({a="1"}[1m]), "app", "", "app", ".*")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := newLabelReplaceProcessor(script.Head.LabelReplace, staticMatrix{
+		{map[string]string{"app": "web"}, 1},
+		{map[string]string{"app": "db"}, 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := proc.Process(stepContext(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shared.DrainSeries(out); err == nil {
+		t.Error("expected a duplicate labelset error")
+	}
+}
+
+func TestVector(t *testing.T) {
+	series := runProcessor(t, &VectorProcessor{Value: 0})
+	if len(series) != 1 || len(series[0]) != 3 {
+		t.Fatalf("vector(0) = %v", series)
+	}
+	for i, e := range series[0] {
+		if e.TimestampNS != int64(i+1) || e.Value != 0 || len(e.Labels) != 0 {
+			t.Errorf("vector(0)[%d] = %+v", i, e)
+		}
+	}
+}
+
+func TestVectorZeroFill(t *testing.T) {
+	script, err := log_parser.Parse(`sum(rate({a="1"}[1m])) or vector(0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := &BinaryExprProcessor{
+		Left:     shared.RequestProcessorChain{staticMatrix{{map[string]string{}, 5}}},
+		Right:    shared.RequestProcessorChain{&VectorProcessor{}},
+		Op:       script.BinOps[0].Op,
+		Matching: script.BinOps[0].Matching,
+	}
+	series := runProcessor(t, proc)
+	var got []float64
+	for _, e := range series[0] {
+		got = append(got, e.Value)
+	}
+	if len(series) != 1 || !reflect.DeepEqual(got, []float64{5, 0, 0}) {
+		t.Errorf("or vector(0) = %v", series)
+	}
+}
+
+func TestSort(t *testing.T) {
+	input := staticMatrix{
+		{map[string]string{"app": "a"}, 2},
+		{map[string]string{"app": "b"}, 3},
+		{map[string]string{"app": "c"}, 1},
+	}
+	for desc, want := range map[bool][]string{false: {"c", "a", "b"}, true: {"b", "a", "c"}} {
+		var got []string
+		for _, series := range runProcessor(t, &SortProcessor{Main: input, Desc: desc}) {
+			got = append(got, series[0].Labels["app"])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sort (desc=%v) = %v, want %v", desc, got, want)
+		}
+	}
+}
+
+func TestAbsent(t *testing.T) {
+	labels := map[string]string{"app": "a"}
+	series := runProcessor(t, &AbsentProcessor{Main: staticMatrix{{labels, 1}}, Labels: labels})
+	if len(series) != 1 || len(series[0]) != 2 {
+		t.Fatalf("absent = %v", series)
+	}
+	for i, e := range series[0] {
+		if e.TimestampNS != int64(i+2) || e.Value != 1 || !reflect.DeepEqual(e.Labels, labels) {
+			t.Errorf("absent[%d] = %+v", i, e)
+		}
+	}
+
+	script, err := log_parser.Parse(`absent(rate({app="a", env=~"prod.*", x="1", x="2"}[1m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := absentLabels(&script.Head.Absent.Expr); !reflect.DeepEqual(got, labels) {
+		t.Errorf("absentLabels() = %v, want %v", got, labels)
+	}
+}
+
+func TestPlanFunctions(t *testing.T) {
+	for _, query := range []string{
+		`sum(rate({a="1"}[1m])) or vector(0)`,
+		`sort_desc(sum by (app) (rate({a="1"}[1m])))`,
+		`label_replace(sum by (app) (rate({a="1"}[1m])), "svc", "$1", "app", "(.*)")`,
+		`absent(rate({a="1"} | json [1m]))`,
+		`vector(1)`,
+	} {
+		script, err := log_parser.Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Plan(script); err != nil {
+			t.Errorf("%s: %v", query, err)
+		}
+	}
+
+	script, err := log_parser.Parse(`sort({a="1"})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Plan(script); err == nil {
+		t.Error("expected an error for a log stream selector")
+	}
+}
@@ -0,0 +1,96 @@
+package shared
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/metrico/qryn/v5/reader/model"
+)
+
+// Explain collects the SQL requests of a query instead of running them. When
+// PlannerContext.Explain is set the request processors record their requests
+// here and return empty results.
+type Explain struct {
+	mtx   sync.Mutex
+	steps []model.ExplainStep
+}
+
+// AddStep records the SQL request generated by planner.
+func (e *Explain) AddStep(planner any, sql string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.steps = append(e.steps, model.ExplainStep{
+		Planner: fmt.Sprintf("%T", planner),
+		SQL:     sql,
+	})
+}
+
+// Steps returns the recorded requests in order.
+func (e *Explain) Steps() []model.ExplainStep {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	return append([]model.ExplainStep(nil), e.steps...)
+}
+
+var (
+	requestProcessorType  = reflect.TypeOf((*RequestProcessor)(nil)).Elem()
+	sqlRequestPlannerType = reflect.TypeOf((*SQLRequestPlanner)(nil)).Elem()
+)
+
+// DescribePlanner returns the tree of the planners and request processors
+// nested in planner, one type per line indented by depth.
+func DescribePlanner(planner any) string {
+	b := &strings.Builder{}
+	describePlanner(b, reflect.ValueOf(planner), 0, map[uintptr]bool{})
+	return b.String()
+}
+
+func describePlanner(b *strings.Builder, v reflect.Value, depth int, seen map[uintptr]bool) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			describePlanner(b, v.Index(i), depth, seen)
+		}
+		return
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+	}
+	fmt.Fprintf(b, "%s%s\n", strings.Repeat("  ", depth), v.Type())
+	describeFields(b, reflect.Indirect(v), depth+1, seen)
+}
+
+// describeFields describes the planners in the fields of a struct, the fields
+// of embedded structs are described at the same depth.
+func describeFields(b *strings.Builder, v reflect.Value, depth int, seen map[uintptr]bool) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		switch {
+		case v.Type().Field(i).Anonymous && f.Kind() == reflect.Struct:
+			describeFields(b, f, depth, seen)
+		case isPlanner(f.Type()):
+			describePlanner(b, f, depth, seen)
+		case f.Kind() == reflect.Slice && isPlanner(f.Type().Elem()):
+			describePlanner(b, f, depth, seen)
+		}
+	}
+}
+
+func isPlanner(t reflect.Type) bool {
+	return t.Implements(requestProcessorType) || t.Implements(sqlRequestPlannerType)
+}
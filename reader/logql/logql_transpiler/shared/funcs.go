@@ -1,6 +1,8 @@
 package shared
 
 import (
+	"errors"
+	"io"
 	"reflect"
 	"time"
 
@@ -74,3 +76,32 @@ func GetStrSelector(script any) *logql_parser.StrSelector {
 	}
 	return nil
 }
+
+// DrainSeries consumes a matrix channel and groups its entries by series in
+// the order the series were received.
+func DrainSeries(ch chan []LogEntry) ([][]LogEntry, error) {
+	var res [][]LogEntry
+	idx := map[uint64]int{}
+	for batch := range ch {
+		for _, e := range batch {
+			if errors.Is(e.Err, io.EOF) {
+				continue
+			}
+			if e.Err != nil {
+				go func() {
+					for range ch {
+					}
+				}()
+				return nil, e.Err
+			}
+			i, ok := idx[e.Fingerprint]
+			if !ok {
+				i = len(res)
+				idx[e.Fingerprint] = i
+				res = append(res, nil)
+			}
+			res[i] = append(res[i], e)
+		}
+	}
+	return res, nil
+}
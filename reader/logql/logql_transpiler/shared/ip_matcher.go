@@ -0,0 +1,124 @@
+package shared
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// IPCandidateRe finds the substrings of a log line which may be IPv4 or IPv6
+// addresses. It is RE2 compatible so the same expression is used in
+// ClickHouse.
+const IPCandidateRe = `(?:[0-9]{1,3}\.){3}[0-9]{1,3}|[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7}(?:(?:[0-9]{1,3}\.){3}[0-9]{1,3})?`
+
+var ipCandidateRe = regexp.MustCompile(IPCandidateRe)
+
+// IPMatcher is the argument of the LogQL `ip()` filters: a single address
+// (`192.168.0.1`), a range (`192.168.0.1-192.168.0.255`) or a CIDR
+// (`10.0.0.0/8`), IPv4 or IPv6. It is kept as the list of CIDR prefixes
+// covering it.
+type IPMatcher struct {
+	prefixes []netip.Prefix
+}
+
+// ParseIPMatcher parses the argument of an `ip()` filter.
+func ParseIPMatcher(expr string) (*IPMatcher, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.Contains(expr, "/") {
+		prefix, err := netip.ParsePrefix(expr)
+		if err != nil {
+			return nil, fmt.Errorf("ip(%q): %w", expr, err)
+		}
+		return &IPMatcher{prefixes: []netip.Prefix{prefix.Masked()}}, nil
+	}
+	if from, to, ok := strings.Cut(expr, "-"); ok {
+		start, err := netip.ParseAddr(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("ip(%q): %w", expr, err)
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("ip(%q): %w", expr, err)
+		}
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("ip(%q): invalid range", expr)
+		}
+		return &IPMatcher{prefixes: rangeToPrefixes(start, end)}, nil
+	}
+	addr, err := netip.ParseAddr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("ip(%q): %w", expr, err)
+	}
+	return &IPMatcher{prefixes: []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}}, nil
+}
+
+// rangeToPrefixes splits the range from start to end into the smallest list of
+// CIDR prefixes covering it.
+func rangeToPrefixes(start, end netip.Addr) []netip.Prefix {
+	var res []netip.Prefix
+	for {
+		// the largest block aligned on start and not going past end
+		ones := start.BitLen()
+		for ones > 0 {
+			p := netip.PrefixFrom(start, ones-1).Masked()
+			if p.Addr() != start || lastAddr(p).Compare(end) > 0 {
+				break
+			}
+			ones--
+		}
+		p := netip.PrefixFrom(start, ones)
+		res = append(res, p)
+		last := lastAddr(p)
+		if last.Compare(end) >= 0 {
+			return res
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr returns the last address of the prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	hostBits := p.Addr().BitLen() - p.Bits()
+	for i := len(b) - 1; i >= 0 && hostBits > 0; i-- {
+		n := min(hostBits, 8)
+		b[i] |= byte(1<<n - 1)
+		hostBits -= n
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Prefixes returns the CIDR prefixes of the matcher as strings.
+func (m *IPMatcher) Prefixes() []string {
+	res := make([]string, len(m.prefixes))
+	for i, p := range m.prefixes {
+		res[i] = p.String()
+	}
+	return res
+}
+
+// Match reports whether val is an address matched by m.
+func (m *IPMatcher) Match(val string) bool {
+	addr, err := netip.ParseAddr(val)
+	if err != nil {
+		return false
+	}
+	for _, p := range m.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchLine reports whether the line contains an address matched by m.
+func (m *IPMatcher) MatchLine(line string) bool {
+	for _, candidate := range ipCandidateRe.FindAllString(line, -1) {
+		if m.Match(candidate) {
+			return true
+		}
+	}
+	return false
+}
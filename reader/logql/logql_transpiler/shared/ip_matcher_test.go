@@ -0,0 +1,87 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIPMatcher(t *testing.T) {
+	cases := []struct {
+		expr     string
+		prefixes []string
+	}{
+		{"192.168.0.1", []string{"192.168.0.1/32"}},
+		{"10.1.2.3/8", []string{"10.0.0.0/8"}},
+		{"192.168.0.0-192.168.0.255", []string{"192.168.0.0/24"}},
+		{"192.168.0.1-192.168.0.6", []string{"192.168.0.1/32", "192.168.0.2/31", "192.168.0.4/31", "192.168.0.6/32"}},
+		{"2001:db8::/32", []string{"2001:db8::/32"}},
+		{"::1-::2", []string{"::1/128", "::2/128"}},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+	}
+	for _, c := range cases {
+		m, err := ParseIPMatcher(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if !reflect.DeepEqual(m.Prefixes(), c.prefixes) {
+			t.Errorf("%s: prefixes = %v, want %v", c.expr, m.Prefixes(), c.prefixes)
+		}
+	}
+
+	for _, expr := range []string{"foo", "10.0.0.0/33", "10.0.0.2-10.0.0.1", "10.0.0.1-::1"} {
+		if _, err := ParseIPMatcher(expr); err == nil {
+			t.Errorf("ParseIPMatcher(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestIPMatcherMatch(t *testing.T) {
+	m, err := ParseIPMatcher("192.168.0.1-192.168.0.6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for val, want := range map[string]bool{"192.168.0.1": true, "192.168.0.6": true, "192.168.0.7": false, "x": false} {
+		if m.Match(val) != want {
+			t.Errorf("Match(%q) != %v", val, want)
+		}
+	}
+
+	m, err = ParseIPMatcher("2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line, want := range map[string]bool{
+		`ts=10:00:00 client=[2001:db8::1]:443`: true,
+		`client=2001:db9::1 ts=10:00:00`:       false,
+		`client=10.0.0.1:8080`:                 false,
+	} {
+		if m.MatchLine(line) != want {
+			t.Errorf("MatchLine(%q) != %v", line, want)
+		}
+	}
+
+	m, err = ParseIPMatcher("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.MatchLine(`GET / from 10.0.0.1:8080`) || m.MatchLine(`GET / from 110.0.0.1`) {
+		t.Error("unexpected MatchLine result for 10.0.0.0/8")
+	}
+}
+
+func TestIPMatcherNotAddresses(t *testing.T) {
+	for _, expr := range []string{"0.0.0.0/0", "::/0"} {
+		m, err := ParseIPMatcher(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, val := range []string{"", "12:30:45", "999.1.1.1", "ts"} {
+			if m.Match(val) {
+				t.Errorf("%s: Match(%q) = true", expr, val)
+			}
+		}
+		if m.MatchLine(`12:30:45 level=info from 999.1.1.1 addr=`) {
+			t.Errorf("%s: MatchLine matched a line without an address", expr)
+		}
+	}
+}
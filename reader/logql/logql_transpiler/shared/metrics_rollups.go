@@ -0,0 +1,66 @@
+package shared
+
+import "time"
+
+// MetricsRollupsVersion is the update of the settings table recording when the
+// 5m and the 1h rollups of the samples started to be filled.
+const MetricsRollupsVersion = "metrics_rollups_v1"
+
+// MetricsRollup is a table of the samples aggregated by buckets of Resolution,
+// with the columns of metrics_15s.
+type MetricsRollup struct {
+	Resolution time.Duration
+	Table      string
+	// TTL is the retention of the rollup, zero if unbounded
+	TTL time.Duration
+}
+
+// MetricsRollup returns the coarsest rollup whose buckets start at from, fit
+// every duration and are kept since from, metrics_15s if no coarser one does.
+// The coarser rollups are only read from the time they were filled from. If
+// none of the fitting rollups is kept since from, the one kept the longest is
+// returned.
+func (p *PlannerContext) MetricsRollup(from time.Time, durations ...time.Duration) MetricsRollup {
+	rollups := []MetricsRollup{
+		{Resolution: time.Second * 15, Table: p.Metrics15sDistTableName, TTL: p.Metrics15sTTL},
+	}
+	if p.VersionInfo.IsVersionSupported(MetricsRollupsVersion, from.UnixNano(), p.To.UnixNano()) {
+		rollups = append([]MetricsRollup{
+			{Resolution: time.Hour, Table: p.Metrics1hDistTableName, TTL: p.Metrics1hTTL},
+			{Resolution: time.Minute * 5, Table: p.Metrics5mDistTableName, TTL: p.Metrics5mTTL},
+		}, rollups...)
+	}
+	var longest *MetricsRollup
+	for i, r := range rollups {
+		if r.Table == "" || !r.fits(from, durations) {
+			continue
+		}
+		if r.keeps(from) {
+			return r
+		}
+		if longest == nil || longest.TTL < r.TTL {
+			longest = &rollups[i]
+		}
+	}
+	if longest != nil {
+		return *longest
+	}
+	return rollups[len(rollups)-1]
+}
+
+// keeps reports if the rollup still holds the buckets starting at from.
+func (r MetricsRollup) keeps(from time.Time) bool {
+	return r.TTL <= 0 || !from.Before(time.Now().Add(-r.TTL))
+}
+
+func (r MetricsRollup) fits(from time.Time, durations []time.Duration) bool {
+	if from.UnixNano()%r.Resolution.Nanoseconds() != 0 {
+		return false
+	}
+	for _, d := range durations {
+		if d%r.Resolution != 0 {
+			return false
+		}
+	}
+	return true
+}
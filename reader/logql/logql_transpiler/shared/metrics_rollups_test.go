@@ -0,0 +1,45 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	dbversion "github.com/metrico/qryn/v5/reader/utils/dbVersion"
+)
+
+func TestMetricsRollupRetention(t *testing.T) {
+	const day = 24 * time.Hour
+	to := time.Now().Truncate(time.Hour)
+	for _, c := range []struct {
+		name                 string
+		from                 time.Time
+		step                 time.Duration
+		ttl15s, ttl5m, ttl1h time.Duration
+		want                 string
+	}{
+		{"all kept", to.Add(-day), time.Hour, 7 * day, 7 * day, 7 * day, "metrics_1h"},
+		{"unbounded", to.Add(-90 * day), time.Hour, 0, 0, 0, "metrics_1h"},
+		{"1h expired", to.Add(-30 * day), time.Hour, 7 * day, 90 * day, 7 * day, "metrics_5m"},
+		{"rollups expired", to.Add(-20 * day), time.Hour, 30 * day, 7 * day, 7 * day, "metrics_15s"},
+		{"15s past SAMPLES_DAYS", to.Add(-30 * day), 10 * time.Minute, 7 * day, 90 * day, 365 * day, "metrics_5m"},
+		{"none kept", to.Add(-90 * day), time.Minute, 30 * day, 7 * day, 365 * day, "metrics_15s"},
+		{"longest kept", to.Add(-90 * day), 10 * time.Minute, 7 * day, 30 * day, 7 * day, "metrics_5m"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := &PlannerContext{
+				From:                    c.from,
+				To:                      to,
+				Metrics15sDistTableName: "metrics_15s",
+				Metrics5mDistTableName:  "metrics_5m",
+				Metrics1hDistTableName:  "metrics_1h",
+				Metrics15sTTL:           c.ttl15s,
+				Metrics5mTTL:            c.ttl5m,
+				Metrics1hTTL:            c.ttl1h,
+				VersionInfo:             dbversion.VersionInfo{MetricsRollupsVersion: 0},
+			}
+			if got := ctx.MetricsRollup(c.from, c.step); got.Table != c.want {
+				t.Errorf("MetricsRollup() = %s, want %s", got.Table, c.want)
+			}
+		})
+	}
+}
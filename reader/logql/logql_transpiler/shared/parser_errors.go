@@ -19,4 +19,5 @@ const (
 var ParserErrorType = map[string]string{
 	"json":   JSONParserErr,
 	"logfmt": LogfmtParserErr,
+	"unpack": JSONParserErr,
 }
@@ -1,7 +1,6 @@
 package shared
 
 import (
-	"fmt"
 	"io"
 	"strconv"
 	"text/scanner"
@@ -30,20 +29,23 @@ func JsonPathParamToTypedArray(param string) ([]string, error) {
 	return parts, nil
 }
 
-func JsonPathParamToArray(param string) ([]string, error) {
+// JsonPathParamToArray parses a json parser expression such as
+// `items[0].name` to its parts: strings for the fields and ints for the array
+// indexes.
+func JsonPathParamToArray(param string) ([]any, error) {
 	parser, err := participle.Build[jsonPath](participle.Lexer(&jsonDefinitionImpl{}))
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
 	oPath, err := parser.ParseString("", param)
 	if err != nil {
-		return []string{}, err
+		return nil, err
 	}
-	parts := make([]string, len(oPath.Path))
+	parts := make([]any, len(oPath.Path))
 	for i, part := range oPath.Path {
-		parts[i], err = part.String()
+		parts[i], err = part.Value()
 		if err != nil {
-			return []string{}, err
+			return nil, err
 		}
 	}
 	return parts, nil
@@ -59,17 +61,6 @@ type jsonPathPart struct {
 	Idx   string `| OSQBrack @Int CSQBrack`
 }
 
-func (j *jsonPathPart) String() (string, error) {
-	if j.Ident != "" {
-		return j.Ident, nil
-	}
-	if j.Idx != "" {
-		i, err := strconv.Atoi(j.Idx)
-		return fmt.Sprintf("%d", i+1), err
-	}
-	return (&logql_parser.QuotedString{Str: j.Field}).Unquote()
-}
-
 func (j *jsonPathPart) ToPathPart() (string, error) {
 	if j.Ident != "" {
 		return j.Ident, nil
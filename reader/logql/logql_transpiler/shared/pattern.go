@@ -0,0 +1,125 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PatternNode is a literal or a capture of a LogQL `| pattern` expression.
+// Unnamed captures (`<_>`) have IsCapture set and an empty Name.
+type PatternNode struct {
+	IsCapture bool
+	Name      string
+	Literal   string
+}
+
+// Pattern is a parsed `| pattern` expression. Captures and literals alternate:
+// two captures never follow each other.
+type Pattern []PatternNode
+
+// ParsePattern parses a Loki pattern expression such as
+// `<ip> - <_> [<ts>] "<method> <path> <_>" <status>`. A `<` not starting a
+// valid capture is part of the literal.
+func ParsePattern(expr string) (Pattern, error) {
+	var res Pattern
+	literal := strings.Builder{}
+	names := map[string]bool{}
+	for i := 0; i < len(expr); {
+		if name, ok := patternCapture(expr[i:]); ok {
+			if literal.Len() > 0 {
+				res = append(res, PatternNode{Literal: literal.String()})
+				literal.Reset()
+			}
+			if len(res) > 0 && res[len(res)-1].IsCapture {
+				return nil, fmt.Errorf("pattern %q: found consecutive capture <%s>", expr, name)
+			}
+			i += len(name) + 2
+			if name == "_" {
+				name = ""
+			} else if names[name] {
+				return nil, fmt.Errorf("pattern %q: duplicate capture name <%s>", expr, name)
+			}
+			names[name] = true
+			res = append(res, PatternNode{IsCapture: true, Name: name})
+			continue
+		}
+		literal.WriteByte(expr[i])
+		i++
+	}
+	if literal.Len() > 0 {
+		res = append(res, PatternNode{Literal: literal.String()})
+	}
+	if len(res.Names()) == 0 {
+		return nil, fmt.Errorf("pattern %q: at least one named capture is required", expr)
+	}
+	return res, nil
+}
+
+// patternCapture returns the name of the capture expr starts with.
+func patternCapture(expr string) (string, bool) {
+	if len(expr) < 3 || expr[0] != '<' {
+		return "", false
+	}
+	end := strings.IndexByte(expr, '>')
+	if end < 2 {
+		return "", false
+	}
+	name := expr[1:end]
+	for i, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// Names returns the names of the named captures in order.
+func (p Pattern) Names() []string {
+	var res []string
+	for _, n := range p {
+		if n.IsCapture && n.Name != "" {
+			res = append(res, n.Name)
+		}
+	}
+	return res
+}
+
+// Match returns the values of the named captures, in the order of Names, the
+// way Loki does: a line not starting with the leading literal matches nothing,
+// every capture ends at the first occurrence of the following literal and when
+// that literal is missing the capture takes the rest of the line and the
+// following captures stay empty.
+func (p Pattern) Match(line string) []string {
+	res := make([]string, 0, len(p))
+	nodes := p
+	if len(nodes) > 0 && !nodes[0].IsCapture {
+		if !strings.HasPrefix(line, nodes[0].Literal) {
+			return nil
+		}
+		line = line[len(nodes[0].Literal):]
+		nodes = nodes[1:]
+	}
+	for len(nodes) > 0 {
+		capture := nodes[0]
+		if len(nodes) == 1 {
+			if capture.Name != "" {
+				res = append(res, line)
+			}
+			break
+		}
+		literal := nodes[1].Literal
+		nodes = nodes[2:]
+		i := strings.Index(line, literal)
+		if i < 0 {
+			if capture.Name != "" {
+				res = append(res, line)
+			}
+			break
+		}
+		if capture.Name != "" {
+			res = append(res, line[:i])
+		}
+		line = line[i+len(literal):]
+	}
+	return res
+}
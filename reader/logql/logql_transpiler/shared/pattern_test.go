@@ -0,0 +1,59 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	p, err := ParsePattern(`<ip> - <_> [<ts>] "<method> <path> <_>" <status> <a<b>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Names(), []string{"ip", "ts", "method", "path", "status", "b"}) {
+		t.Errorf("names = %v", p.Names())
+	}
+	if p[len(p)-2].Literal != " <a" {
+		t.Errorf("an invalid capture must be a literal, got %+v", p)
+	}
+
+	for _, expr := range []string{"<a><b>", "<a> <a>", "<_> foo", "no captures"} {
+		if _, err := ParsePattern(expr); err == nil {
+			t.Errorf("ParsePattern(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	p, err := ParsePattern(`<ip> - <_> [<ts>] "<method> <path> <_>" <status>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{`10.0.0.1 - frank [10/Oct/2000:13:55:36] "GET /index.html HTTP/1.0" 200 2326`,
+			[]string{"10.0.0.1", "10/Oct/2000:13:55:36", "GET", "/index.html", "200 2326"}},
+		// The capture takes the rest of the line when its literal is missing.
+		{`10.0.0.1 - frank [10/Oct/2000:13:55:36] "GET`,
+			[]string{"10.0.0.1", "10/Oct/2000:13:55:36", `GET`}},
+		{`garbage`, []string{"garbage"}},
+	}
+	for _, c := range cases {
+		if got := p.Match(c.line); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Match(%q) = %q, want %q", c.line, got, c.want)
+		}
+	}
+
+	p, err = ParsePattern(`level=<level> msg`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Match(`msg level=info msg`); got != nil {
+		t.Errorf("a line not starting with the leading literal must not match, got %q", got)
+	}
+	if got := p.Match(`level=info msg=hello`); !reflect.DeepEqual(got, []string{"info"}) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"io"
 
+	jsoniter "github.com/json-iterator/go"
+
 	sql2 "github.com/metrico/qryn/v5/reader/utils/sql_select"
 )
 
@@ -30,6 +32,13 @@ func (c *ClickhouseGetterPlanner) Process(ctx *PlannerContext,
 	if err != nil {
 		return nil, err
 	}
+	if ctx.Explain != nil {
+		ctx.Explain.AddStep(c.ClickhouseRequestPlanner, strReq)
+		res := make(chan []LogEntry, 1)
+		res <- []LogEntry{{Err: io.EOF}}
+		close(res)
+		return res, nil
+	}
 	rows, err := ctx.CHDb.QueryCtx(ctx.Ctx, strReq)
 	if err != nil {
 		return nil, err
@@ -60,9 +69,14 @@ func (c *ClickhouseGetterPlanner) Scan(ctx *PlannerContext, rows *sql.Rows, res
 		default:
 		}
 		var (
-			labels map[string]string
+			labels             map[string]string
+			structuredMetadata string
 		)
-		err := rows.Scan(&entries[i].Fingerprint, &labels, &entries[i].Message, &entries[i].TimestampNS)
+		err := rows.Scan(&entries[i].Fingerprint, &labels, &entries[i].Message, &entries[i].TimestampNS,
+			&structuredMetadata)
+		if err == nil && structuredMetadata != "" {
+			err = jsoniter.ConfigFastest.UnmarshalFromString(structuredMetadata, &entries[i].StructuredMetadata)
+		}
 		if err != nil {
 			entries[i].Err = err
 			res <- entries[:i+1]
@@ -39,8 +39,22 @@ type PlannerContext struct {
 	TimeSeriesDistTableName    string
 	Metrics15sTableName        string
 	Metrics15sDistTableName    string
+	Metrics5mTableName         string
+	Metrics5mDistTableName     string
+	Metrics1hTableName         string
+	Metrics1hDistTableName     string
+	HistogramsTableName        string
+	HistogramsDistTableName    string
+	ExemplarsTableName         string
+	ExemplarsDistTableName     string
 	PatternsTable              string
 
+	// Metrics15sTTL, Metrics5mTTL and Metrics1hTTL are the retentions of the
+	// rollups of the samples, zero if unbounded
+	Metrics15sTTL time.Duration
+	Metrics5mTTL  time.Duration
+	Metrics1hTTL  time.Duration
+
 	TracesAttrsTable     string
 	TracesAttrsDistTable string
 	TracesTable          string
@@ -73,6 +87,9 @@ type PlannerContext struct {
 
 	DeleteID string
 
+	// Explain is set to record the SQL requests instead of running them.
+	Explain *Explain
+
 	Type uint8
 
 	id int
@@ -101,6 +118,9 @@ type LogEntry struct {
 	Labels      map[string]string
 	Message     string
 	Value       float64
+	// StructuredMetadata holds the structured metadata of the log line.
+	// It is merged into Labels as well.
+	StructuredMetadata map[string]string
 
 	Err error
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/util/annotations"
+	"sort"
 	"sync"
 )
 
@@ -52,10 +53,17 @@ type Sample struct {
 
 var _ storage.Series = &SeriesV2{}
 
+// HistogramSample is a native histogram sample.
+type HistogramSample struct {
+	TimestampMs int64
+	H           *histogram.FloatHistogram
+}
+
 type SeriesV2 struct {
 	LabelsGetter ILabelsGetter
 	Fp           uint64
 	Samples      []Sample
+	Histograms   []HistogramSample
 	Prolong      bool
 	StepMs       int64
 }
@@ -69,6 +77,12 @@ func (s *SeriesV2) LabelsArray() Labels {
 }
 
 func (s *SeriesV2) Iterator(it chunkenc.Iterator) chunkenc.Iterator {
+	if len(s.Histograms) > 0 {
+		return &histogramSeriesIt{
+			samples:    s.Samples,
+			histograms: s.Histograms,
+		}
+	}
 	if !s.Prolong {
 		return &seriesIt{
 			samples: s.Samples,
@@ -255,3 +269,78 @@ func (p *prolongSeriesIt) AtT() int64 {
 func (p *prolongSeriesIt) AtST() int64 {
 	return 0
 }
+
+var _ chunkenc.Iterator = &histogramSeriesIt{}
+
+// histogramSeriesIt iterates over a series holding native histograms. Float
+// samples of the same series, if any, are merged in timestamp order and are
+// not prolonged.
+type histogramSeriesIt struct {
+	samples    []Sample
+	histograms []HistogramSample
+	// sIdx and hIdx point to the next unread sample and histogram.
+	sIdx int
+	hIdx int
+	cur  chunkenc.ValueType
+}
+
+func (h *histogramSeriesIt) Next() chunkenc.ValueType {
+	hasSample := h.sIdx < len(h.samples)
+	hasHist := h.hIdx < len(h.histograms)
+	switch {
+	case hasSample && (!hasHist || h.samples[h.sIdx].TimestampMs < h.histograms[h.hIdx].TimestampMs):
+		h.sIdx++
+		h.cur = chunkenc.ValFloat
+	case hasHist:
+		h.hIdx++
+		h.cur = chunkenc.ValFloatHistogram
+	default:
+		h.cur = chunkenc.ValNone
+	}
+	return h.cur
+}
+
+func (h *histogramSeriesIt) Seek(t int64) chunkenc.ValueType {
+	if h.cur != chunkenc.ValNone && h.AtT() >= t {
+		return h.cur
+	}
+	h.sIdx += sort.Search(len(h.samples)-h.sIdx, func(i int) bool {
+		return h.samples[h.sIdx+i].TimestampMs >= t
+	})
+	h.hIdx += sort.Search(len(h.histograms)-h.hIdx, func(i int) bool {
+		return h.histograms[h.hIdx+i].TimestampMs >= t
+	})
+	return h.Next()
+}
+
+func (h *histogramSeriesIt) At() (int64, float64) {
+	return h.samples[h.sIdx-1].TimestampMs, h.samples[h.sIdx-1].Value
+}
+
+func (h *histogramSeriesIt) AtHistogram(*histogram.Histogram) (int64, *histogram.Histogram) {
+	return 0, nil
+}
+
+func (h *histogramSeriesIt) AtFloatHistogram(fh *histogram.FloatHistogram) (int64, *histogram.FloatHistogram) {
+	smpl := h.histograms[h.hIdx-1]
+	if fh == nil {
+		return smpl.TimestampMs, smpl.H.Copy()
+	}
+	smpl.H.CopyTo(fh)
+	return smpl.TimestampMs, fh
+}
+
+func (h *histogramSeriesIt) AtT() int64 {
+	if h.cur == chunkenc.ValFloatHistogram {
+		return h.histograms[h.hIdx-1].TimestampMs
+	}
+	return h.samples[h.sIdx-1].TimestampMs
+}
+
+func (h *histogramSeriesIt) AtST() int64 {
+	return 0
+}
+
+func (h *histogramSeriesIt) Err() error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package model
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/util/annotations"
+)
+
+type staticLabels map[uint64]labels.Labels
+
+func (s staticLabels) Get(fp uint64) Labels {
+	var res Labels
+	s[fp].Range(func(l labels.Label) { res = append(res, l) })
+	return res
+}
+
+func (s staticLabels) GetNative(fp uint64) labels.Labels {
+	return s[fp]
+}
+
+type staticQueryable struct {
+	series []*SeriesV2
+}
+
+func (q *staticQueryable) Querier(mint, maxt int64) (storage.Querier, error) {
+	return q, nil
+}
+
+func (q *staticQueryable) Select(context.Context, bool, *storage.SelectHints, ...*labels.Matcher) storage.SeriesSet {
+	res := &SeriesSet{Series: q.series}
+	res.Reset()
+	return res
+}
+
+func (q *staticQueryable) LabelValues(context.Context, string, *storage.LabelHints, ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	return nil, nil, nil
+}
+
+func (q *staticQueryable) LabelNames(context.Context, *storage.LabelHints, ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	return nil, nil, nil
+}
+
+func (q *staticQueryable) Close() error {
+	return nil
+}
+
+func testHistogram(count float64) *histogram.FloatHistogram {
+	return &histogram.FloatHistogram{
+		Count:           count,
+		Sum:             count * 2,
+		Schema:          0,
+		PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+		PositiveBuckets: []float64{count / 2, count / 2},
+	}
+}
+
+func TestHistogramSeriesIterator(t *testing.T) {
+	s := &SeriesV2{
+		Samples: []Sample{{TimestampMs: 15, Value: 1}},
+		Histograms: []HistogramSample{
+			{TimestampMs: 10, H: testHistogram(4)},
+			{TimestampMs: 20, H: testHistogram(8)},
+		},
+	}
+	it := s.Iterator(nil)
+	expected := []chunkenc.ValueType{chunkenc.ValFloatHistogram, chunkenc.ValFloat, chunkenc.ValFloatHistogram, chunkenc.ValNone}
+	for i, tp := range expected {
+		if got := it.Next(); got != tp {
+			t.Fatalf("Next() #%d = %v, want %v", i, got, tp)
+		}
+	}
+
+	it = s.Iterator(nil)
+	if it.Seek(16) != chunkenc.ValFloatHistogram || it.AtT() != 20 {
+		t.Fatalf("Seek(16) did not land on the second histogram")
+	}
+	if _, h := it.AtFloatHistogram(nil); h.Count != 8 {
+		t.Errorf("histogram count = %v, want 8", h.Count)
+	}
+	if it.Seek(5) != chunkenc.ValFloatHistogram || it.AtT() != 20 {
+		t.Errorf("Seek must not move backwards")
+	}
+}
+
+func TestHistogramSeriesEngine(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var hists []HistogramSample
+	for i := 0; i <= 10; i++ {
+		hists = append(hists, HistogramSample{
+			TimestampMs: start.Add(time.Duration(i) * 15 * time.Second).UnixMilli(),
+			H:           testHistogram(float64(i * 30)),
+		})
+	}
+	q := &staticQueryable{series: []*SeriesV2{{
+		LabelsGetter: staticLabels{1: labels.FromStrings("__name__", "rpc_duration_seconds")},
+		Fp:           1,
+		Histograms:   hists,
+	}}}
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1000, Timeout: time.Minute})
+	ts := start.Add(150 * time.Second)
+
+	for query, expected := range map[string]float64{
+		"histogram_count(rpc_duration_seconds)":           300,
+		"histogram_sum(rpc_duration_seconds)":             600,
+		"histogram_count(rate(rpc_duration_seconds[2m]))": 2,
+	} {
+		qry, err := engine.NewInstantQuery(context.Background(), q, nil, query, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := qry.Exec(context.Background())
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		vec, err := res.Vector()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vec) != 1 || math.Abs(vec[0].F-expected) > 1e-9 {
+			t.Errorf("%s = %v, want %v", query, vec, expected)
+		}
+	}
+}
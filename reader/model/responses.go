@@ -17,20 +17,42 @@ type TraceResponse struct {
 	DurationMs        int64  `json:"durationMs"`
 }
 
+// TSDBStatus is the cardinality of the metrics series, in the format of both
+// the Prometheus and the VictoriaMetrics TSDB status APIs.
 type TSDBStatus struct {
-	TotalSeries                  int32              `json:"totalSeries"`
-	TotalLabelValuePairs         int32              `json:"totalLabelValuePairs"`
+	HeadStats                    TSDBHeadStats      `json:"headStats"`
+	TotalSeries                  uint64             `json:"totalSeries"`
+	TotalLabelValuePairs         uint64             `json:"totalLabelValuePairs"`
 	SeriesCountByMetricName      []TSDBStatusMetric `json:"seriesCountByMetricName"`
 	SeriesCountByLabelName       []TSDBStatusMetric `json:"seriesCountByLabelName"`
 	SeriesCountByFocusLabelValue []TSDBStatusMetric `json:"seriesCountByFocusLabelValue"`
 	SeriesCountByLabelValuePair  []TSDBStatusMetric `json:"seriesCountByLabelValuePair"`
 	LabelValueCountByLabelName   []TSDBStatusMetric `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName     []TSDBStatusMetric `json:"memoryInBytesByLabelName"`
 	Quota                        int32              `json:"quota"`
 }
 
+// TSDBHeadStats describes the series of the chosen time window.
+type TSDBHeadStats struct {
+	NumSeries     uint64 `json:"numSeries"`
+	NumLabelPairs uint64 `json:"numLabelPairs"`
+	ChunkCount    int64  `json:"chunkCount"`
+	MinTime       int64  `json:"minTime"`
+	MaxTime       int64  `json:"maxTime"`
+}
+
 type TSDBStatusMetric struct {
 	Name  string `json:"name"`
-	Value int32  `json:"value"`
+	Value uint64 `json:"value"`
+}
+
+// StreamsStatus is the cardinality of the log streams.
+type StreamsStatus struct {
+	TotalStreams               uint64             `json:"totalStreams"`
+	TotalLabelValuePairs       uint64             `json:"totalLabelValuePairs"`
+	StreamsBySelector          []TSDBStatusMetric `json:"streamsBySelector"`
+	StreamsByLabelName         []TSDBStatusMetric `json:"streamsByLabelName"`
+	LabelValueCountByLabelName []TSDBStatusMetric `json:"labelValueCountByLabelName"`
 }
 
 type TraceInfo struct {
@@ -61,3 +83,19 @@ type SpanAttr struct {
 		StringValue string `json:"stringValue"`
 	} `json:"value"`
 }
+
+// ExplainResult is the response of the explain endpoints: the planner chain of
+// a query and the SQL requests it runs, computed without running them.
+type ExplainResult struct {
+	Query string        `json:"query"`
+	Plan  string        `json:"plan"`
+	Steps []ExplainStep `json:"steps"`
+}
+
+// ExplainStep is a SQL request of an explained query. Indexes is the output of
+// ClickHouse `EXPLAIN indexes = 1` for it, when requested.
+type ExplainStep struct {
+	Planner string `json:"planner"`
+	SQL     string `json:"sql"`
+	Indexes string `json:"indexes,omitempty"`
+}
@@ -18,6 +18,8 @@ type ITempoService interface {
 	TagsV2(ctx context.Context, query string, from time.Time, to time.Time, limit int) (chan string, error)
 	MetricsQueryRange(ctx context.Context, req *MetricsQueryRequest) (*MetricsQueryRangeResponse, error)
 	MetricsQueryInstant(ctx context.Context, req *MetricsQueryRequest) (*MetricsQueryInstantResponse, error)
+	ExplainTraceQL(ctx context.Context, q string, limit int, from time.Time, to time.Time,
+		indexes bool) (*ExplainResult, error)
 }
 
 type IQueryLabelsService interface {
@@ -32,9 +34,9 @@ type IQueryLabelsService interface {
 }
 type IQueryRangeService interface {
 	QueryRange(ctx context.Context, query string, fromNs int64, toNs int64, stepMs int64,
-		limit int64, forward bool) (chan QueryRangeOutput, error)
+		limit int64, forward bool, categorizeLabels bool) (chan QueryRangeOutput, error)
 	QueryInstant(ctx context.Context, query string, timeNs int64, stepMs int64,
-		limit int64) (chan QueryRangeOutput, error)
+		limit int64, categorizeLabels bool) (chan QueryRangeOutput, error)
 	Tail(ctx context.Context, query string, tailLimit int64, startNs int64) (IWatcher, error)
 	QueryIndexStats(ctx context.Context, query string, fromNs, toNs int64) (*IndexStatsResult, error)
 }
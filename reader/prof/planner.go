@@ -87,3 +87,23 @@ func plannerCtx(ctx context.Context, db *model.DataDatabasesMap, from, to time.T
 	tables.PopulateTableNames(&sqlCtx, db)
 	return &sqlCtx
 }
+
+// ExplainMergeTraces records the SQL request of PlanMergeTraces in explain
+// without running it and returns its planner chain.
+func ExplainMergeTraces(ctx context.Context, script *prof_parser.Script, typeId *shared2.TypeId,
+	from time.Time, to time.Time, db *model.DataDatabasesMap, explain *shared.Explain) (string, error) {
+	planner, err := prof_transpiler.PlanMergeTraces(script, typeId)
+	if err != nil {
+		return "", err
+	}
+	sel, err := planner.Process(plannerCtx(ctx, db, from, to))
+	if err != nil {
+		return "", err
+	}
+	strSel, err := sel.String(sql.DefaultCtx())
+	if err != nil {
+		return "", err
+	}
+	explain.AddStep(planner, strSel)
+	return shared.DescribePlanner(planner), nil
+}
@@ -8,10 +8,11 @@ import (
 	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
 )
 
-// BucketProducer reads the 15s downsampled table and produces one row per
-// (fingerprint, step bucket) with the requested partial aggregates. It is the
-// raw per-step value extractor: no source column, no grid fill, just the real
-// buckets. FillGapsPlanner is layered on top to densify it onto the step grid.
+// BucketProducer reads the coarsest rollup of the samples fitting the step and
+// the read window (15s, 5m or 1h) and produces one row per (fingerprint, step
+// bucket) with the requested partial aggregates. It is the raw per-step value
+// extractor: no source column, no grid fill, just the real buckets.
+// FillGapsPlanner is layered on top to densify it onto the step grid.
 //
 // Lookback extends the read window before ctx.From so the earliest steps see the
 // buckets their frame or fill reaches back into. It is the same quantity the fill
@@ -48,10 +49,12 @@ func (b *BucketProducer) Process(ctx *shared.PlannerContext) (sql.ISelect, error
 	}
 	sel = append(sel, b.Cols...)
 
+	from := ctx.From.Add(-b.Lookback)
+	rollup := ctx.MetricsRollup(from, ctx.Step)
 	return sql.NewSelect().With(withFp).Select(sel...).
-		From(sql.NewRawObject(ctx.Metrics15sDistTableName)).
+		From(sql.NewRawObject(rollup.Table)).
 		AndWhere(
-			sql.Ge(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(ctx.From.Add(-b.Lookback).UnixNano())),
+			sql.Ge(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(from.UnixNano())),
 			sql.Le(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(ctx.To.UnixNano())),
 			sql.NewIn(sql.NewRawObject("fingerprint"), sql.NewWithRef(withFp))).
 		GroupBy(sql.NewRawObject("fingerprint"), sql.NewRawObject("timestamp_ms")), nil
@@ -2,12 +2,17 @@ package planner
 
 import (
 	"fmt"
+	"time"
+
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
 )
 
+// DownsampleValuesPlanner selects the last values by step from the coarsest
+// rollup of the samples fitting the step and Range.
 type DownsampleValuesPlanner struct {
 	ValuesPlanner
+	Range time.Duration
 }
 
 func (d *DownsampleValuesPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
@@ -15,6 +20,9 @@ func (d *DownsampleValuesPlanner) Process(ctx *shared.PlannerContext) (sql.ISele
 	if err != nil {
 		return nil, err
 	}
+	// the rollup must fit and be kept from the first sample read, the
+	// lookback of the first step included
+	rollup := ctx.MetricsRollup(d.readFrom(ctx), ctx.Step, d.Range)
 	sel := req.GetSelect()
 	for i, s := range sel {
 		_s := s.(sql.Aliased)
@@ -29,7 +37,7 @@ func (d *DownsampleValuesPlanner) Process(ctx *shared.PlannerContext) (sql.ISele
 		}
 	}
 	req = req.Select(sel...).
-		From(sql.NewSimpleCol(ctx.Metrics15sDistTableName, "samples")).
+		From(sql.NewSimpleCol(rollup.Table, "samples")).
 		GroupBy(sql.NewRawObject("fingerprint"), sql.NewRawObject("timestamp_ms")).
 		OrderBy(sql.NewOrderBy(sql.NewRawObject("fingerprint"), sql.ORDER_BY_DIRECTION_ASC),
 			sql.NewOrderBy(sql.NewRawObject("timestamp_ms"), sql.ORDER_BY_DIRECTION_ASC))
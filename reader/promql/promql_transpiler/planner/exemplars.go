@@ -0,0 +1,52 @@
+package planner
+
+import (
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/clickhouse_planner"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+// ExemplarsPlanner selects the exemplars of the series matched by Fp along
+// with the labels of their series, ordered by fingerprint and timestamp.
+type ExemplarsPlanner struct {
+	Fp shared.SQLRequestPlanner
+}
+
+func (e *ExemplarsPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
+	fp, err := e.Fp.Process(ctx)
+	if err != nil {
+		return nil, err
+	}
+	withFp := sql.NewWith(fp, "fp")
+	series := sql.NewSelect().
+		Distinct(true).
+		Select(
+			sql.NewSimpleCol("fingerprint", "fingerprint"),
+			sql.NewSimpleCol("labels", "series_labels")).
+		From(sql.NewRawObject(ctx.TimeSeriesDistTableName)).
+		AndWhere(
+			sql.Ge(sql.NewRawObject("date"), sql.NewStringVal(clickhouse_planner.FormatFromDate(ctx.From))),
+			sql.NewIn(sql.NewRawObject("fingerprint"), sql.NewWithRef(withFp)))
+	withSeries := sql.NewWith(series, "series")
+	res := sql.NewSelect().
+		With(withFp, withSeries).
+		Select(
+			sql.NewSimpleCol("exemplars.fingerprint", "fingerprint"),
+			sql.NewSimpleCol("series.series_labels", "series_labels"),
+			sql.NewSimpleCol("intDiv(exemplars.timestamp_ns, 1000000)", "timestamp_ms"),
+			sql.NewSimpleCol("exemplars.value", "value"),
+			sql.NewSimpleCol("exemplars.labels", "exemplar_labels")).
+		From(sql.NewSimpleCol(ctx.ExemplarsDistTableName, "exemplars")).
+		Join(sql.NewJoin("any left", sql.NewWithRef(withSeries),
+			sql.Eq(sql.NewRawObject("exemplars.fingerprint"), sql.NewRawObject("series.fingerprint")))).
+		AndWhere(
+			sql.Ge(sql.NewRawObject("exemplars.timestamp_ns"), sql.NewIntVal(ctx.From.UnixNano())),
+			sql.Le(sql.NewRawObject("exemplars.timestamp_ns"), sql.NewIntVal(ctx.To.UnixNano())),
+			sql.NewIn(sql.NewRawObject("exemplars.fingerprint"), sql.NewWithRef(withFp))).
+		OrderBy(sql.NewOrderBy(sql.NewRawObject("fingerprint"), sql.ORDER_BY_DIRECTION_ASC),
+			sql.NewOrderBy(sql.NewRawObject("timestamp_ms"), sql.ORDER_BY_DIRECTION_ASC))
+	if ctx.Limit > 0 {
+		res.Limit(sql.NewIntVal(ctx.Limit))
+	}
+	return res, nil
+}
@@ -14,6 +14,9 @@ type LabelsPlanner struct {
 	// (rate, increase, *_over_time, ...). A bare selector leaves it false and
 	// keeps the metric name.
 	DropMetricName bool
+	// Histograms adds the native histograms of the selected series as rows of
+	// type 3: val is the histogram count and labels the encoded histogram.
+	Histograms bool
 }
 
 func (l *LabelsPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
@@ -63,13 +66,34 @@ func (l *LabelsPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error)
 		AndWhere(
 			sql.Ge(sql.NewRawObject("date"), sql.NewStringVal(clickhouse_planner.FormatFromDate(ctx.From))),
 			sql.NewIn(sql.NewRawObject("fingerprint"), sql.NewWithRef(withFp)))
+	unions := []sql.ISelect{labels}
+	if l.Histograms {
+		unions = append(unions, histograms(ctx, withFp))
+	}
 	res := sql.NewSelect().
 		With(withMain).
 		Select(sql.NewRawObject("*")).
-		From(&unionAll{values, []sql.ISelect{labels}})
+		From(&unionAll{values, unions})
 	return res, nil
 }
 
+func histograms(ctx *shared.PlannerContext, withFp *sql.With) sql.ISelect {
+	return sql.NewSelect().
+		Select(
+			sql.NewSimpleCol("3", "type"),
+			sql.NewSimpleCol("fingerprint", "fingerprint"),
+			sql.NewSimpleCol("intDiv(timestamp_ns, 1000000)", "timestamp_ms"),
+			sql.NewSimpleCol("count", "val"),
+			sql.NewSimpleCol("histogram", "labels")).
+		From(sql.NewRawObject(ctx.HistogramsDistTableName)).
+		AndWhere(
+			sql.Gt(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(ctx.From.UnixNano())),
+			sql.Le(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(ctx.To.UnixNano())),
+			sql.NewIn(sql.NewRawObject("fingerprint"), sql.NewWithRef(withFp))).
+		OrderBy(sql.NewOrderBy(sql.NewRawObject("fingerprint"), sql.ORDER_BY_DIRECTION_ASC),
+			sql.NewOrderBy(sql.NewRawObject("timestamp_ns"), sql.ORDER_BY_DIRECTION_ASC))
+}
+
 type unionAll struct {
 	sql.ISelect
 	unions []sql.ISelect
@@ -0,0 +1,49 @@
+package planner
+
+import (
+	"fmt"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+// NativeHistogramsPlanner selects one native histogram of the series read by
+// Main. The SQL planners only see float samples, so a substituted request
+// whose series have native histograms must fail instead of dropping them.
+type NativeHistogramsPlanner struct {
+	Main shared.SQLRequestPlanner
+}
+
+func (n *NativeHistogramsPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error) {
+	main, err := n.Main.Process(ctx)
+	if err != nil {
+		return nil, err
+	}
+	withFp := findWith(main, "fp")
+	if withFp == nil {
+		return nil, fmt.Errorf("could not find fingerprint with alias 'fp'")
+	}
+	return sql.NewSelect().
+		With(withFp).
+		Select(sql.NewSimpleCol("fingerprint", "fingerprint")).
+		From(sql.NewRawObject(ctx.HistogramsDistTableName)).
+		AndWhere(
+			sql.Gt(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(ctx.From.UnixNano())),
+			sql.Le(sql.NewRawObject("timestamp_ns"), sql.NewIntVal(ctx.To.UnixNano())),
+			sql.NewIn(sql.NewRawObject("fingerprint"), sql.NewWithRef(withFp))).
+		Limit(sql.NewIntVal(1)), nil
+}
+
+// findWith looks for the alias in the with clauses of the request and of the
+// requests they wrap, as LabelsPlanner wraps the substituted request.
+func findWith(req sql.ISelect, alias string) *sql.With {
+	for _, with := range req.GetWith() {
+		if with.GetAlias() == alias {
+			return with
+		}
+		if res := findWith(with.GetQuery(), alias); res != nil {
+			return res
+		}
+	}
+	return nil
+}
@@ -17,7 +17,7 @@ type overTimeCol struct {
 // samples of (t-range, t]: no lookback outside the frame, no dependency on the
 // order of the samples other than through an aggregate.
 type overTimeDef struct {
-	// bucket holds the partial aggregates read per step from metrics_15s.
+	// bucket holds the partial aggregates read per step from the rollups.
 	bucket []overTimeCol
 	// window holds the aggregates evaluated over the range frame. They must all
 	// be -If(..., source = 1) forms to skip the rows added by WITH FILL.
@@ -54,7 +54,7 @@ func windowOffset(d time.Duration) (int32, error) {
 	return int32(ms), nil
 }
 
-// bucketedValues builds the per-step value CTE over the 15s downsampled table:
+// bucketedValues builds the per-step value CTE over the downsampled tables:
 // a BucketProducer read densified by FillGapsPlanner. cols are the bucket level
 // partial aggregates to expose.
 //
@@ -1,6 +1,8 @@
 package planner
 
 import (
+	"time"
+
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/clickhouse_planner"
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
@@ -21,7 +23,7 @@ func (v *ValuesPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error)
 		sql.NewSimpleCol("samples.value", "val"),
 		sql.NewSimpleCol("intDiv(samples.timestamp_ns, 1000000)", "timestamp_ms"),
 	).From(sql.NewSimpleCol(ctx.SamplesDistTableName, "samples")).AndWhere(
-		sql.Gt(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(ctx.From.UnixNano())),
+		sql.Gt(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(v.readFrom(ctx).UnixNano())),
 		sql.Le(sql.NewRawObject("samples.timestamp_ns"), sql.NewIntVal(ctx.To.UnixNano())),
 		sql.NewIn(sql.NewRawObject("fingerprint"), sql.NewWithRef(withFp)),
 		clickhouse_planner.GetTypes(ctx),
@@ -32,3 +34,10 @@ func (v *ValuesPlanner) Process(ctx *shared.PlannerContext) (sql.ISelect, error)
 	}
 	return res, nil
 }
+
+// readFrom is the lower bound of the samples read. The querier moves ctx.From
+// back by the range of the selector, so it includes the lookback of the first
+// step.
+func (v *ValuesPlanner) readFrom(ctx *shared.PlannerContext) time.Time {
+	return ctx.From
+}
@@ -1,6 +1,9 @@
 package promql_transpiler
 
 import (
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/clickhouse_planner"
 	logql_transpiler_shared "github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler/planner"
@@ -12,15 +15,27 @@ import (
 type TranspileResponse struct {
 	MapResult func(samples []model.Sample) []model.Sample
 	Query     sql.ISelect
+	// Planner is the planner chain Query is generated by.
+	Planner logql_transpiler_shared.SQLRequestPlanner
 }
 
 func TranspileLabelMatchers(hints *storage.SelectHints,
 	ctx *logql_transpiler_shared.PlannerContext, matchers ...*labels.Matcher) (*TranspileResponse, error) {
 	var p logql_transpiler_shared.SQLRequestPlanner = &planner.ValuesPlanner{Fp: streamSelect(matchers...)}
 	p = &planner.HintsPlanner{Main: p, Hints: hints}
-	p = &planner.LabelsPlanner{Main: p}
+	p = &planner.LabelsPlanner{Main: p, Histograms: ctx.HistogramsDistTableName != ""}
+	query, err := p.Process(ctx)
+	return &TranspileResponse{nil, query, p}, err
+}
+
+// TranspileRawLabelMatchers selects the stored samples of the series matched
+// by matchers, as they are.
+func TranspileRawLabelMatchers(ctx *logql_transpiler_shared.PlannerContext,
+	matchers ...*labels.Matcher) (*TranspileResponse, error) {
+	var p logql_transpiler_shared.SQLRequestPlanner = &planner.ValuesPlanner{Fp: streamSelect(matchers...)}
+	p = &planner.LabelsPlanner{Main: p, Histograms: ctx.HistogramsDistTableName != ""}
 	query, err := p.Process(ctx)
-	return &TranspileResponse{nil, query}, err
+	return &TranspileResponse{nil, query, p}, err
 }
 
 func TranspileLabelMatchersDownsample(hints *storage.SelectHints,
@@ -29,11 +44,24 @@ func TranspileLabelMatchersDownsample(hints *storage.SelectHints,
 		ValuesPlanner: planner.ValuesPlanner{
 			Fp: streamSelect(matchers...),
 		},
+		Range: time.Duration(hints.Range) * time.Millisecond,
 	}
 	p = &planner.DownsampleHintsPlanner{Main: p, Hints: hints}
-	p = &planner.LabelsPlanner{Main: p}
+	p = &planner.LabelsPlanner{Main: p, Histograms: ctx.HistogramsDistTableName != ""}
 	query, err := p.Process(ctx)
-	return &TranspileResponse{nil, query}, err
+	return &TranspileResponse{nil, query, p}, err
+}
+
+// TranspileExemplars selects the exemplars of the series matched by any of
+// the selectors.
+func TranspileExemplars(ctx *logql_transpiler_shared.PlannerContext,
+	selectors [][]*labels.Matcher) (sql.ISelect, error) {
+	fps := make([]logql_transpiler_shared.SQLRequestPlanner, len(selectors))
+	for i, matchers := range selectors {
+		fps[i] = streamSelect(matchers...)
+	}
+	p := &planner.ExemplarsPlanner{Fp: &clickhouse_planner.MultiStreamSelectPlanner{Mains: fps}}
+	return p.Process(ctx)
 }
 
 func streamSelect(matchers ...*labels.Matcher) logql_transpiler_shared.SQLRequestPlanner {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
+	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler/planner"
 	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
@@ -158,3 +159,126 @@ func TestCountOverTime_DoesNotGenerateRange(t *testing.T) {
 			"Got SQL:\n%s", strQ)
 	}
 }
+
+func TestNativeHistogramsAreNotSubstituted(t *testing.T) {
+	for query, substituted := range map[string]bool{
+		"histogram_quantile(0.9, rate(rpc_duration_seconds[5m]))":                      false,
+		"histogram_count(rate(rpc_duration_seconds[5m]))":                              false,
+		"histogram_sum(sum(rate(rpc_duration_seconds[5m])))":                           false,
+		"histogram_quantile(0.9, sum by (le) (rate(rpc_duration_seconds_bucket[5m])))": true,
+		"rate(rpc_duration_seconds_count[5m])":                                         true,
+	} {
+		expr, err := promql_parser.Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err = TranspileExpressionV2(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(expr.Substitutes) > 0) != substituted {
+			t.Errorf("%s: substituted = %v, want %v", query, len(expr.Substitutes) > 0, substituted)
+		}
+	}
+}
+
+func TestTranspileLabelMatchersHistograms(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ctx := &shared.PlannerContext{
+		From:                    now.Add(-time.Hour),
+		To:                      now,
+		TimeSeriesGinTableName:  "time_series_gin",
+		SamplesTableName:        "samples_v3",
+		SamplesDistTableName:    "samples_v3",
+		TimeSeriesTableName:     "time_series",
+		TimeSeriesDistTableName: "time_series",
+		HistogramsTableName:     "native_histograms",
+		HistogramsDistTableName: "native_histograms",
+		Type:                    2,
+	}
+	q, err := TranspileLabelMatchers(&storage.SelectHints{
+		Start: now.Add(-time.Hour).UnixMilli(),
+		End:   now.UnixMilli(),
+		Step:  60000,
+		Range: 300000,
+		Func:  "rate",
+	}, ctx, &labels.Matcher{Type: labels.MatchEqual, Name: "__name__", Value: "rpc_duration_seconds"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strQ, err := q.Query.String(sql.DefaultCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strQ, "SELECT 3 as type") || !strings.Contains(strQ, "FROM native_histograms") {
+		t.Errorf("expected a native histograms union, got:\n%s", strQ)
+	}
+}
+
+func TestTranspileExemplars(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ctx := &shared.PlannerContext{
+		From:                    now.Add(-time.Hour),
+		To:                      now,
+		TimeSeriesGinTableName:  "time_series_gin",
+		TimeSeriesTableName:     "time_series",
+		TimeSeriesDistTableName: "time_series",
+		ExemplarsTableName:      "exemplars",
+		ExemplarsDistTableName:  "exemplars",
+		Type:                    2,
+	}
+	q, err := TranspileExemplars(ctx, [][]*labels.Matcher{
+		{&labels.Matcher{Type: labels.MatchEqual, Name: "__name__", Value: "rpc_duration_seconds_bucket"}},
+		{&labels.Matcher{Type: labels.MatchEqual, Name: "__name__", Value: "http_requests_total"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strQ, err := q.String(sql.DefaultCtx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range []string{
+		"FROM exemplars as exemplars",
+		"any left JOIN series",
+		"rpc_duration_seconds_bucket",
+		"http_requests_total",
+		fmt.Sprintf("(exemplars.timestamp_ns) <= (%d)", now.UnixNano()),
+	} {
+		if !strings.Contains(strQ, part) {
+			t.Errorf("expected %q in:\n%s", part, strQ)
+		}
+	}
+}
+
+func TestNativeHistogramsCheckOfSubstitutes(t *testing.T) {
+	ctx := rangeTestCtx()
+	ctx.HistogramsDistTableName = "native_histograms"
+	for _, query := range []string{"rate(rpc_duration_seconds[5m])", "sum(rate(rpc_duration_seconds[5m]))"} {
+		expr, err := promql_parser.Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err = TranspileExpressionV2(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expr.Substitutes) != 1 {
+			t.Fatalf("%s: expected 1 substitute, got %d", query, len(expr.Substitutes))
+		}
+		for _, s := range expr.Substitutes {
+			q, err := (&planner.NativeHistogramsPlanner{Main: s.Request}).Process(ctx)
+			if err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			strQ, err := q.String(sql.DefaultCtx())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(strQ, "WITH fp as (") || !strings.Contains(strQ, "FROM native_histograms") ||
+				!strings.Contains(strQ, "fingerprint IN (fp)") || !strings.HasSuffix(strQ, "LIMIT 1") {
+				t.Errorf("%s: unexpected native histograms check:\n%s", query, strQ)
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package promql_transpiler
 
 import (
+	"strings"
+
 	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
 	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler/optimizer"
 	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler/planner"
@@ -13,7 +15,11 @@ var optimizers = []func() optimizer.Optimizer{
 }
 
 func TranspileExpressionV2(expr *promql_parser.Expr) (*promql_parser.Expr, error) {
+	native := nativeHistogramNodes(expr.Expr)
 	_expr, err := Walk(expr, expr.Expr, func(node parser.Expr) (parser.Expr, error) {
+		if native[node] {
+			return node, nil
+		}
 		for _, opt := range optimizers {
 			_opt := opt()
 			if _opt.Applicable(node) {
@@ -35,6 +41,42 @@ func TranspileExpressionV2(expr *promql_parser.Expr) (*promql_parser.Expr, error
 	return expr, nil
 }
 
+// nativeHistogramNodes returns the nodes that may read native histograms and
+// so must be left to the prometheus engine: the SQL planners only see float
+// samples. These are the arguments of the histogram_* functions, except
+// histogram_quantile over classic "_bucket" series.
+func nativeHistogramNodes(root parser.Expr) map[parser.Node]bool {
+	res := map[parser.Node]bool{}
+	parser.Inspect(root, func(node parser.Node, _ []parser.Node) error {
+		call, ok := node.(*parser.Call)
+		if !ok || !strings.HasPrefix(call.Func.Name, "histogram_") {
+			return nil
+		}
+		for _, arg := range call.Args {
+			if call.Func.Name == "histogram_quantile" && !readsNativeHistograms(arg) {
+				continue
+			}
+			parser.Inspect(arg, func(node parser.Node, _ []parser.Node) error {
+				res[node] = true
+				return nil
+			})
+		}
+		return nil
+	})
+	return res
+}
+
+func readsNativeHistograms(expr parser.Expr) bool {
+	res := false
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if sel, ok := node.(*parser.VectorSelector); ok && !strings.HasSuffix(sel.Name, "_bucket") {
+			res = true
+		}
+		return nil
+	})
+	return res
+}
+
 func Walk(expr *promql_parser.Expr, node parser.Expr, fn func(parser.Expr) (parser.Expr, error)) (parser.Expr, error) {
 	var err error
 	iterate := func(ps []*parser.Expr) {
@@ -214,3 +214,59 @@ func TestRangeTooLargeRejected(t *testing.T) {
 		}
 	}
 }
+
+// TestRangeReadsCoarsestRollup guards the choice of the rollup the buckets are
+// read from: the coarsest one fitting the step and the read window, once the
+// rollups were filled for the whole range.
+func TestRangeReadsCoarsestRollup(t *testing.T) {
+	rollupsCtx := func(step time.Duration, filled bool) *shared.PlannerContext {
+		ctx := rangeTestCtx()
+		ctx.To = time.Unix(1700000000, 0).Truncate(time.Hour)
+		ctx.From = ctx.To.Add(-time.Hour * 24)
+		ctx.Step = step
+		ctx.Metrics5mDistTableName = "metrics_5m"
+		ctx.Metrics1hDistTableName = "metrics_1h"
+		if filled {
+			ctx.VersionInfo[shared.MetricsRollupsVersion] = 0
+		}
+		return ctx
+	}
+	for _, c := range []struct {
+		name   string
+		query  string
+		step   time.Duration
+		filled bool
+		want   string
+	}{
+		{"hour step", `sum_over_time(x[1h])`, time.Hour, true, "FROM metrics_1h"},
+		{"minute step", `sum_over_time(x[1h])`, time.Minute, true, "FROM metrics_15s"},
+		{"5m step", `max_over_time(x[10m])`, time.Minute * 10, true, "FROM metrics_5m"},
+		{"unaligned window", `sum_over_time(x[90m])`, time.Hour, true, "FROM metrics_5m"},
+		{"not filled", `sum_over_time(x[1h])`, time.Hour, false, "FROM metrics_15s"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got := transpileRangeCtx(t, c.query, rollupsCtx(c.step, c.filled))
+			if !strings.Contains(got, c.want) {
+				t.Errorf("missing %q in:\n%s", c.want, got)
+			}
+		})
+	}
+}
+
+// TestRangeSkipsExpiredRollup guards the retention of the rollups: a rollup not
+// kept since the start of the read window is not read.
+func TestRangeSkipsExpiredRollup(t *testing.T) {
+	ctx := rangeTestCtx()
+	ctx.To = time.Now().Truncate(time.Hour)
+	ctx.From = ctx.To.Add(-time.Hour * 24 * 30)
+	ctx.Step = time.Hour
+	ctx.Metrics5mDistTableName = "metrics_5m"
+	ctx.Metrics1hDistTableName = "metrics_1h"
+	ctx.Metrics15sTTL = time.Hour * 24 * 7
+	ctx.Metrics5mTTL = time.Hour * 24 * 90
+	ctx.Metrics1hTTL = time.Hour * 24 * 7
+	ctx.VersionInfo[shared.MetricsRollupsVersion] = 0
+	if got := transpileRangeCtx(t, `sum_over_time(x[1h])`, ctx); !strings.Contains(got, "FROM metrics_5m") {
+		t.Errorf("missing %q in:\n%s", "FROM metrics_5m", got)
+	}
+}
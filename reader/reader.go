@@ -13,6 +13,7 @@ import (
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/registry"
 	"github.com/metrico/qryn/v5/reader/router"
+	"github.com/metrico/qryn/v5/reader/service"
 	"github.com/metrico/qryn/v5/reader/utils/logger"
 	"github.com/metrico/qryn/v5/reader/utils/middleware"
 	"github.com/metrico/qryn/v5/reader/watchdog"
@@ -20,6 +21,8 @@ import (
 
 var ownHttpServer bool = false
 
+var deleteService *service.DeleteService
+
 func Init(cnf *clconfig.ClokiConfig, app *mux.Router) {
 	config.Cloki = cnf
 
@@ -48,6 +51,10 @@ func Stop() {
 	logger.Info("Stopping Reader module...")
 	watchdog.Stop()
 	logger.Info("Reader watchdog stopped.")
+	if deleteService != nil {
+		deleteService.Stop()
+		logger.Info("Reader delete worker stopped.")
+	}
 	registry.Stop()
 	logger.Info("Reader registry stopped.")
 	logger.Info("Reader module stopped.")
@@ -100,8 +107,10 @@ func performV1APIRouting(acc *mux.Router) {
 	watchdog.Init(&model.ServiceData{Session: registry.Registry})
 
 	router.RouteQueryRangeApis(acc, registry.Registry)
+	deleteService = router.RouteDeleteApis(acc, registry.Registry)
 	router.RouteSelectLabels(acc, registry.Registry)
 	router.RouteSelectPrometheusLabels(acc, registry.Registry)
+	router.RouteCardinalityApis(acc, registry.Registry)
 	router.RoutePrometheusQueryRange(acc, registry.Registry, config.Cloki.Setting.SYSTEM_SETTINGS.QueryStats)
 	router.RouteTempo(acc, registry.Registry)
 	router.RouteMiscApis(acc)
@@ -0,0 +1,18 @@
+package router
+
+import (
+	"github.com/gorilla/mux"
+	controllerv1 "github.com/metrico/qryn/v5/reader/controller"
+	"github.com/metrico/qryn/v5/reader/model"
+	"github.com/metrico/qryn/v5/reader/service"
+)
+
+// RouteCardinalityApis serves the cardinality of the metrics series and of
+// the log streams.
+func RouteCardinalityApis(app *mux.Router, dataSession model.IDBRegistry) {
+	ctrl := &controllerv1.CardinalityController{
+		CardinalityService: service.NewCardinalityService(&model.ServiceData{Session: dataSession}),
+	}
+	app.HandleFunc("/api/v1/status/tsdb", ctrl.TSDBStatus).Methods("GET", "OPTIONS")
+	app.HandleFunc("/loki/api/v1/status/cardinality", ctrl.StreamsStatus).Methods("GET", "OPTIONS")
+}
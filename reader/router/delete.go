@@ -0,0 +1,29 @@
+package router
+
+import (
+	"github.com/gorilla/mux"
+	controllerv1 "github.com/metrico/qryn/v5/reader/controller"
+	"github.com/metrico/qryn/v5/reader/model"
+	"github.com/metrico/qryn/v5/reader/service"
+)
+
+// RouteDeleteApis serves the Loki delete API and the Prometheus series
+// deletion API and starts the worker running the delete requests. It returns nil if the deletion is disabled.
+func RouteDeleteApis(app *mux.Router, dataSession model.IDBRegistry) *service.DeleteService {
+	cfg := service.DeleteConfigFromEnv()
+	if cfg.Mode == "" {
+		return nil
+	}
+	svc := service.NewDeleteService(&model.ServiceData{Session: dataSession}, cfg)
+	ctrl := &controllerv1.DeleteController{
+		DeleteService: svc,
+	}
+	app.HandleFunc("/loki/api/v1/delete", ctrl.Create).Methods("POST", "PUT", "OPTIONS")
+	app.HandleFunc("/loki/api/v1/delete", ctrl.List).Methods("GET")
+	app.HandleFunc("/loki/api/v1/delete", ctrl.Cancel).Methods("DELETE")
+	app.HandleFunc("/api/v1/admin/tsdb/delete_series", ctrl.DeleteSeries).Methods("POST", "PUT", "OPTIONS")
+	app.HandleFunc("/api/v1/admin/tsdb/delete_series", ctrl.ListSeries).Methods("GET")
+	app.HandleFunc("/api/v1/admin/tsdb/clean_tombstones", ctrl.CleanTombstones).Methods("POST", "PUT", "OPTIONS")
+	go svc.Run()
+	return svc
+}
@@ -23,4 +23,5 @@ func RouteProf(app *mux.Router, dataSession model.IDBRegistry) {
 	app.HandleFunc(prof.QuerierService_AnalyzeQuery_FullMethodName, ctrl.AnalyzeQuery).Methods("POST", "OPTIONS")
 	app.HandleFunc("/pyroscope/render", ctrl.Render).Methods("GET", "OPTIONS")
 	app.HandleFunc("/pyroscope/render-diff", ctrl.RenderDiff).Methods("GET", "OPTIONS")
+	app.HandleFunc("/pyroscope/explain", ctrl.Explain).Methods("GET", "OPTIONS")
 }
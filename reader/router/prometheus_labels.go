@@ -13,14 +13,16 @@ func RouteSelectPrometheusLabels(app *mux.Router, dataSession model.IDBRegistry)
 	}
 	qrService := service.NewQueryLabelsService(sd)
 	metadataService := service.NewMetadataService(sd)
+	exemplarsService := service.NewExemplarsService(sd)
 	qrCtrl := &controllerv1.PromQueryLabelsController{
 		QueryLabelsService: qrService,
 		MetadataService:    metadataService,
+		ExemplarsService:   exemplarsService,
 	}
 	app.HandleFunc("/api/v1/labels", qrCtrl.PromLabels).Methods("GET", "POST", "OPTIONS")
 	app.HandleFunc("/api/v1/label/{name}/values", qrCtrl.LabelValues).Methods("GET", "OPTIONS")
 	app.HandleFunc("/api/v1/metadata", qrCtrl.Metadata).Methods("GET", "OPTIONS")
-	app.HandleFunc("/api/v1/query_exemplars", qrCtrl.Metadata).Methods("GET", "OPTIONS")
+	app.HandleFunc("/api/v1/query_exemplars", qrCtrl.QueryExemplars).Methods("GET", "POST", "OPTIONS")
 	// /api/v1/rules is owned by the ruler module (recording rules), which
 	// registers it when enabled.
 	app.HandleFunc("/api/v1/series", qrCtrl.Series).Methods("GET", "POST", "OPTIONS")
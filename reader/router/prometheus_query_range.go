@@ -11,6 +11,7 @@ import (
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/service"
 	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
 	"github.com/prometheus/prometheus/promql"
 	api_v1 "github.com/prometheus/prometheus/web/api/v1"
 )
@@ -61,7 +62,22 @@ func RoutePrometheusQueryRange(app *mux.Router, dataSession model.IDBRegistry,
 		Api:        &api,
 		Storage:    &svc,
 		Stats:      stats,
+		Cache:      resultscache.FromEnv(),
 	}
 	app.HandleFunc("/api/v1/query_range", ctrl.QueryRange).Methods("GET", "POST", "OPTIONS")
 	app.HandleFunc("/api/v1/query", ctrl.QueryInstant).Methods("GET", "POST", "OPTIONS")
+	app.HandleFunc("/api/v1/explain", ctrl.Explain).Methods("GET", "POST", "OPTIONS")
+
+	readCtrl := &controllerv1.PromRemoteReadController{
+		Storage:         &svc,
+		SampleLimit:     config.Cloki.Setting.SYSTEM_SETTINGS.MetricsMaxSamples,
+		MaxBytesInFrame: controllerv1.RemoteReadMaxBytesInFrameFromEnv(),
+	}
+	app.HandleFunc("/api/v1/read", readCtrl.Read).Methods("POST", "OPTIONS")
+
+	fedCtrl := &controllerv1.PromFederateController{
+		Storage: &svc,
+		Config:  controllerv1.FederateConfigFromEnv(),
+	}
+	app.HandleFunc("/federate", fedCtrl.Federate).Methods("GET", "POST", "OPTIONS")
 }
@@ -6,6 +6,7 @@ import (
 	controllerv1 "github.com/metrico/qryn/v5/reader/controller"
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/service"
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
 )
 
 func RouteQueryRangeApis(app *mux.Router, dataSession model.IDBRegistry) {
@@ -13,6 +14,8 @@ func RouteQueryRangeApis(app *mux.Router, dataSession model.IDBRegistry) {
 		ServiceData: model.ServiceData{
 			Session: dataSession,
 		},
+		Split: service.SplitConfigFromEnv(),
+		Cache: resultscache.FromEnv(),
 	}
 	qrCtrl := &controllerv1.QueryRangeController{
 		QueryRangeService: qrService,
@@ -21,6 +24,7 @@ func RouteQueryRangeApis(app *mux.Router, dataSession model.IDBRegistry) {
 	app.HandleFunc("/loki/api/v1/query", qrCtrl.Query).Methods("GET", "OPTIONS")
 	app.HandleFunc("/loki/api/v1/tail", qrCtrl.Tail).Methods("GET", "OPTIONS")
 	app.HandleFunc("/loki/api/v1/index/stats", qrCtrl.IndexStats).Methods("GET", "OPTIONS")
+	app.HandleFunc("/loki/api/v1/explain", qrCtrl.Explain).Methods("GET", "OPTIONS")
 
 	if config.Cloki.Setting.DRILLDOWN_SETTINGS.LogDrilldown {
 		vCtrl := &controllerv1.VolumeController{
@@ -28,6 +28,8 @@ func RouteTempo(app *mux.Router, dataSession model.IDBRegistry) {
 	app.HandleFunc("/api/v2/search/tags", ctrl.TagsV2).Methods("GET", "OPTIONS")
 	app.HandleFunc("/tempo/api/search", ctrl.Search).Methods("GET", "OPTIONS")
 	app.HandleFunc("/api/search", ctrl.Search).Methods("GET", "OPTIONS")
+	app.HandleFunc("/tempo/api/search/explain", ctrl.Explain).Methods("GET", "OPTIONS")
+	app.HandleFunc("/api/search/explain", ctrl.Explain).Methods("GET", "OPTIONS")
 	app.HandleFunc("/tempo/api/metrics/query_range", ctrl.MetricsQueryRange).Methods("GET", "OPTIONS")
 	app.HandleFunc("/api/metrics/query_range", ctrl.MetricsQueryRange).Methods("GET", "OPTIONS")
 	app.HandleFunc("/tempo/api/metrics/query", ctrl.MetricsQueryInstant).Methods("GET", "OPTIONS")
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/clickhouse_planner"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+	"github.com/metrico/qryn/v5/reader/utils/tables"
+)
+
+// CardinalityService computes the cardinality of the series and the streams
+// from the time_series_gin table. The counts are approximate for the large
+// cardinalities.
+type CardinalityService struct {
+	model.ServiceData
+}
+
+func NewCardinalityService(sd *model.ServiceData) *CardinalityService {
+	return &CardinalityService{
+		ServiceData: *sd,
+	}
+}
+
+// labelCardinality is the cardinality of a label name.
+type labelCardinality struct {
+	name   string
+	values uint64
+	bytes  uint64
+	series uint64
+}
+
+// pairCardinality is the number of series of a label pair.
+type pairCardinality struct {
+	name   string
+	value  string
+	series uint64
+}
+
+// TSDBStatus returns the cardinality of the metrics series between startMs
+// and endMs. The lists are cut to the limit biggest entries, the series are
+// also counted by value of focusLabel if set.
+func (c *CardinalityService) TSDBStatus(ctx context.Context, startMs int64, endMs int64, limit int,
+	focusLabel string) (*model.TSDBStatus, error) {
+	pctx, err := c.plannerContext(ctx, shared.SAMPLES_TYPE_METRICS, startMs, endMs)
+	if err != nil {
+		return nil, err
+	}
+	series, pairs, err := c.totals(pctx)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := c.labels(pctx)
+	if err != nil {
+		return nil, err
+	}
+	topPairs, err := c.topPairs(pctx, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	names, err := c.topPairs(pctx, "__name__", limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &model.TSDBStatus{
+		HeadStats: model.TSDBHeadStats{
+			NumSeries:     series,
+			NumLabelPairs: pairs,
+			MinTime:       startMs,
+			MaxTime:       endMs,
+		},
+		TotalSeries:                  series,
+		TotalLabelValuePairs:         pairs,
+		SeriesCountByMetricName:      pairValues(names),
+		SeriesCountByLabelName:       topLabels(labels, limit, func(l labelCardinality) uint64 { return l.series }),
+		SeriesCountByFocusLabelValue: []model.TSDBStatusMetric{},
+		SeriesCountByLabelValuePair:  make([]model.TSDBStatusMetric, len(topPairs)),
+		LabelValueCountByLabelName:   topLabels(labels, limit, func(l labelCardinality) uint64 { return l.values }),
+		MemoryInBytesByLabelName:     topLabels(labels, limit, func(l labelCardinality) uint64 { return l.bytes }),
+	}
+	for i, p := range topPairs {
+		res.SeriesCountByLabelValuePair[i] = model.TSDBStatusMetric{Name: p.name + "=" + p.value, Value: p.series}
+	}
+	if focusLabel != "" {
+		focus, err := c.topPairs(pctx, focusLabel, limit)
+		if err != nil {
+			return nil, err
+		}
+		res.SeriesCountByFocusLabelValue = pairValues(focus)
+	}
+	return res, nil
+}
+
+// StreamsStatus returns the cardinality of the log streams between startMs
+// and endMs: the selectors of a single label and the labels with the most
+// streams, cut to the limit biggest entries.
+func (c *CardinalityService) StreamsStatus(ctx context.Context, startMs int64, endMs int64,
+	limit int) (*model.StreamsStatus, error) {
+	pctx, err := c.plannerContext(ctx, shared.SAMPLES_TYPE_LOGS, startMs, endMs)
+	if err != nil {
+		return nil, err
+	}
+	streams, pairs, err := c.totals(pctx)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := c.labels(pctx)
+	if err != nil {
+		return nil, err
+	}
+	topPairs, err := c.topPairs(pctx, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &model.StreamsStatus{
+		TotalStreams:               streams,
+		TotalLabelValuePairs:       pairs,
+		StreamsBySelector:          make([]model.TSDBStatusMetric, len(topPairs)),
+		StreamsByLabelName:         topLabels(labels, limit, func(l labelCardinality) uint64 { return l.series }),
+		LabelValueCountByLabelName: topLabels(labels, limit, func(l labelCardinality) uint64 { return l.values }),
+	}
+	for i, p := range topPairs {
+		res.StreamsBySelector[i] = model.TSDBStatusMetric{
+			Name:  "{" + p.name + "=" + strconv.Quote(p.value) + "}",
+			Value: p.series,
+		}
+	}
+	return res, nil
+}
+
+func (c *CardinalityService) plannerContext(ctx context.Context, tp uint8, startMs int64,
+	endMs int64) (*shared.PlannerContext, error) {
+	conn, err := c.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tables.PopulateTableNames(&shared.PlannerContext{
+		Type:      tp,
+		IsCluster: conn.Config.ClusterName != "",
+		From:      time.UnixMilli(startMs),
+		To:        time.UnixMilli(endMs),
+		Ctx:       ctx,
+		CHDb:      conn.Session,
+	}, conn), nil
+}
+
+// ginSelect selects from the rows of the time_series_gin table of the type
+// and the dates of ctx.
+func ginSelect(ctx *shared.PlannerContext) sql.ISelect {
+	return sql.NewSelect().
+		From(sql.NewRawObject(ctx.TimeSeriesGinDistTableName)).
+		AndWhere(
+			clickhouse_planner.GetTypes(ctx),
+			sql.Ge(sql.NewRawObject("date"), sql.NewStringVal(clickhouse_planner.FormatFromDate(ctx.From))),
+			sql.Le(sql.NewRawObject("date"), sql.NewStringVal(ctx.To.UTC().Format("2006-01-02"))),
+		)
+}
+
+// totalsQuery counts the series and the label pairs.
+func totalsQuery(ctx *shared.PlannerContext) sql.ISelect {
+	return ginSelect(ctx).Select(
+		sql.NewSimpleCol("uniq(fingerprint)", "series"),
+		sql.NewSimpleCol("uniq(key, val)", "pairs"),
+	)
+}
+
+// labelsQuery counts the values, the bytes of the values and the series of
+// every label name.
+func labelsQuery(ctx *shared.PlannerContext) sql.ISelect {
+	pairs := sql.NewWith(ginSelect(ctx).Select(
+		sql.NewRawObject("key"),
+		sql.NewRawObject("val"),
+		sql.NewSimpleCol("uniqState(fingerprint)", "fps"),
+	).GroupBy(sql.NewRawObject("key"), sql.NewRawObject("val")), "pairs")
+	return sql.NewSelect().With(pairs).Select(
+		sql.NewRawObject("key"),
+		sql.NewSimpleCol("count()", "values_count"),
+		sql.NewSimpleCol("sum(length(val))", "bytes"),
+		sql.NewSimpleCol("uniqMerge(fps)", "series"),
+	).From(sql.NewWithRef(pairs)).GroupBy(sql.NewRawObject("key"))
+}
+
+// topPairsQuery returns the limit label pairs with the most series, of the
+// label name if not empty.
+func topPairsQuery(ctx *shared.PlannerContext, name string, limit int) sql.ISelect {
+	sel := ginSelect(ctx).Select(
+		sql.NewRawObject("key"),
+		sql.NewRawObject("val"),
+		sql.NewSimpleCol("uniq(fingerprint)", "series"),
+	).GroupBy(sql.NewRawObject("key"), sql.NewRawObject("val")).
+		OrderBy(sql.NewOrderBy(sql.NewRawObject("series"), sql.ORDER_BY_DIRECTION_DESC),
+			sql.NewOrderBy(sql.NewRawObject("key"), sql.ORDER_BY_DIRECTION_ASC),
+			sql.NewOrderBy(sql.NewRawObject("val"), sql.ORDER_BY_DIRECTION_ASC)).
+		Limit(sql.NewIntVal(int64(limit)))
+	if name != "" {
+		sel.AndWhere(sql.Eq(sql.NewRawObject("key"), sql.NewStringVal(name)))
+	}
+	return sel
+}
+
+func (c *CardinalityService) totals(ctx *shared.PlannerContext) (uint64, uint64, error) {
+	query, err := totalsQuery(ctx).String(sql.DefaultCtx())
+	if err != nil {
+		return 0, 0, err
+	}
+	rows, err := ctx.CHDb.QueryCtx(ctx.Ctx, query)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	var series, pairs uint64
+	if rows.Next() {
+		err = rows.Scan(&series, &pairs)
+	}
+	return series, pairs, err
+}
+
+func (c *CardinalityService) labels(ctx *shared.PlannerContext) ([]labelCardinality, error) {
+	query, err := labelsQuery(ctx).String(sql.DefaultCtx())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ctx.CHDb.QueryCtx(ctx.Ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []labelCardinality
+	for rows.Next() {
+		var l labelCardinality
+		if err := rows.Scan(&l.name, &l.values, &l.bytes, &l.series); err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
+
+func (c *CardinalityService) topPairs(ctx *shared.PlannerContext, name string, limit int) ([]pairCardinality, error) {
+	query, err := topPairsQuery(ctx, name, limit).String(sql.DefaultCtx())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ctx.CHDb.QueryCtx(ctx.Ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []pairCardinality
+	for rows.Next() {
+		var p pairCardinality
+		if err := rows.Scan(&p.name, &p.value, &p.series); err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// topLabels returns the limit labels with the biggest value.
+func topLabels(labels []labelCardinality, limit int, value func(l labelCardinality) uint64) []model.TSDBStatusMetric {
+	res := make([]model.TSDBStatusMetric, len(labels))
+	for i, l := range labels {
+		res[i] = model.TSDBStatusMetric{Name: l.name, Value: value(l)}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Value != res[j].Value {
+			return res[i].Value > res[j].Value
+		}
+		return res[i].Name < res[j].Name
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// pairValues returns the series count by value of pairs.
+func pairValues(pairs []pairCardinality) []model.TSDBStatusMetric {
+	res := make([]model.TSDBStatusMetric, len(pairs))
+	for i, p := range pairs {
+		res[i] = model.TSDBStatusMetric{Name: p.value, Value: p.series}
+	}
+	return res
+}
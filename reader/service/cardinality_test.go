@@ -0,0 +1,53 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+func TestCardinalityQueries(t *testing.T) {
+	ctx := &shared.PlannerContext{
+		Type:                       shared.SAMPLES_TYPE_METRICS,
+		TimeSeriesGinDistTableName: "time_series_gin",
+		From:                       time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		To:                         time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC),
+	}
+	where := "WHERE (type IN (2,0)) and ((date) >= ('2024-05-01')) and ((date) <= ('2024-05-02'))"
+	for name, c := range map[string]struct {
+		sel  sql.ISelect
+		want string
+	}{
+		"labels": {labelsQuery(ctx), "WITH pairs as ( SELECT key, val, uniqState(fingerprint) as fps " +
+			"FROM time_series_gin " + where + " GROUP BY key, val) SELECT key, count() as values_count, " +
+			"sum(length(val)) as bytes, uniqMerge(fps) as series FROM pairs GROUP BY key"},
+		"top pairs": {topPairsQuery(ctx, "__name__", 5), " SELECT key, val, uniq(fingerprint) as series " +
+			"FROM time_series_gin " + where + " and ((key) == ('__name__')) GROUP BY key, val " +
+			"ORDER BY series desc , key asc , val asc  LIMIT 5"},
+	} {
+		got, err := c.sel.String(sql.DefaultCtx())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("%s query:\n%s\nwant:\n%s", name, got, c.want)
+		}
+	}
+}
+
+func TestTopLabels(t *testing.T) {
+	labels := []labelCardinality{
+		{name: "job", values: 3, series: 100},
+		{name: "instance", values: 50, series: 100},
+		{name: "__name__", values: 20, series: 120},
+	}
+	got := topLabels(labels, 2, func(l labelCardinality) uint64 { return l.series })
+	want := []model.TSDBStatusMetric{{Name: "__name__", Value: 120}, {Name: "instance", Value: 100}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topLabels() = %v, want %v", got, want)
+	}
+}
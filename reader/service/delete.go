@@ -0,0 +1,733 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/clickhouse_planner"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	dbversion "github.com/metrico/qryn/v5/reader/utils/dbVersion"
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+	"github.com/metrico/qryn/v5/reader/utils/tables"
+	"github.com/metrico/qryn/v5/shared/distconfig"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	DeleteStatusReceived   = "received"
+	DeleteStatusProcessing = "processing"
+	DeleteStatusProcessed  = "processed"
+	DeleteStatusFailed     = "failed"
+	DeleteStatusCancelled  = "cancelled"
+
+	DeleteModeLightweight = "lightweight"
+	DeleteModeMutation    = "mutation"
+
+	defaultDeletePollInterval = time.Minute
+	// deleteBatchSize is the number of fingerprints per DELETE statement
+	deleteBatchSize = 1000
+)
+
+// seriesSamplesTables are the tables the samples of the series are deleted
+// from.
+var seriesSamplesTables = []string{"samples_v3", "metrics_15s", "metrics_5m", "metrics_1h"}
+
+// samplesRollups are the rollups filled from samples_v3 by the materialized
+// views, with the duration of their buckets in nanoseconds.
+var samplesRollups = []struct {
+	table  string
+	bucket int64
+}{
+	{"metrics_15s", int64(15 * time.Second)},
+	{"metrics_5m", int64(5 * time.Minute)},
+	{"metrics_1h", int64(time.Hour)},
+}
+
+// DeleteConfig configures the log deletion API. An empty Mode disables it.
+type DeleteConfig struct {
+	// Mode is DeleteModeLightweight to run DELETE FROM statements or
+	// DeleteModeMutation to run ALTER TABLE ... DELETE mutations
+	Mode string
+	// PollInterval is the period the received requests are looked up at
+	PollInterval time.Duration
+}
+
+// DeleteConfigFromEnv reads the deletion configuration from QRYN_DELETE_MODE
+// and QRYN_DELETE_POLL_INTERVAL.
+func DeleteConfigFromEnv() DeleteConfig {
+	cfg := DeleteConfig{PollInterval: defaultDeletePollInterval}
+	switch mode := os.Getenv("QRYN_DELETE_MODE"); mode {
+	case "", DeleteModeLightweight, DeleteModeMutation:
+		cfg.Mode = mode
+	default:
+		logger.Error("Invalid QRYN_DELETE_MODE value: ", mode)
+	}
+	if v := os.Getenv("QRYN_DELETE_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logger.Error("Invalid QRYN_DELETE_POLL_INTERVAL value: ", v)
+		} else {
+			cfg.PollInterval = d
+		}
+	}
+	return cfg
+}
+
+// DeleteRequest is a request to delete the log lines or the samples of the
+// metrics series matching Query between StartTime and EndTime, in the format
+// of the Loki delete API.
+type DeleteRequest struct {
+	RequestID string  `json:"request_id"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Query     string  `json:"query"`
+	Status    string  `json:"status"`
+	CreatedAt float64 `json:"created_at"`
+	Error     string  `json:"error,omitempty"`
+
+	startNs int64
+	endNs   int64
+	// tp is shared.SAMPLES_TYPE_LOGS or shared.SAMPLES_TYPE_METRICS
+	tp uint8
+}
+
+// DeleteRequestError is an invalid delete request or an invalid operation on
+// a delete request.
+type DeleteRequestError struct {
+	Msg string
+}
+
+func (e *DeleteRequestError) Error() string {
+	return e.Msg
+}
+
+// DeleteService stores the delete requests of the logs and of the metrics
+// series in the delete_requests table and runs them in the background. Every
+// status change inserts a new version of the request.
+type DeleteService struct {
+	model.ServiceData
+	Config DeleteConfig
+	done   chan struct{}
+}
+
+func NewDeleteService(data *model.ServiceData, cfg DeleteConfig) *DeleteService {
+	return &DeleteService{
+		ServiceData: *data,
+		Config:      cfg,
+		done:        make(chan struct{}),
+	}
+}
+
+// Create validates and stores a new delete request. The request is run by the
+// next poll of the worker.
+func (d *DeleteService) Create(ctx context.Context, query string, start, end time.Time) (*DeleteRequest, error) {
+	conds, err := deleteConditions(query)
+	if err != nil {
+		return nil, err
+	}
+	if !start.Before(end) {
+		return nil, &DeleteRequestError{Msg: "start time must be before end time"}
+	}
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRollupsRetention(conds, start.UnixNano(), samplesRetainedFrom(conn, time.Now())); err != nil {
+		return nil, err
+	}
+	return d.create(ctx, conn, query, start, end, shared.SAMPLES_TYPE_LOGS)
+}
+
+// CreateSeries validates and stores a request per selector of matches,
+// deleting the samples of the metrics series it matches.
+func (d *DeleteService) CreateSeries(ctx context.Context, matches []string, start, end time.Time,
+) ([]*DeleteRequest, error) {
+	if len(matches) == 0 {
+		return nil, &DeleteRequestError{Msg: "no match[] parameter provided"}
+	}
+	for _, m := range matches {
+		if _, err := parser.NewParser(parser.Options{}).ParseMetricSelector(m); err != nil {
+			return nil, &DeleteRequestError{Msg: "invalid match[] parameter: " + err.Error()}
+		}
+	}
+	if !start.Before(end) {
+		return nil, &DeleteRequestError{Msg: "start time must be before end time"}
+	}
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*DeleteRequest, len(matches))
+	for i, m := range matches {
+		res[i], err = d.create(ctx, conn, m, start, end, shared.SAMPLES_TYPE_METRICS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (d *DeleteService) create(ctx context.Context, conn *model.DataDatabasesMap, query string, start,
+	end time.Time, tp uint8,
+) (*DeleteRequest, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	req := &DeleteRequest{
+		RequestID: hex.EncodeToString(id),
+		StartTime: float64(start.UnixMilli()) / 1000,
+		EndTime:   float64(end.UnixMilli()) / 1000,
+		Query:     query,
+		Status:    DeleteStatusReceived,
+		CreatedAt: float64(now.UnixMilli()) / 1000,
+		startNs:   start.UnixNano(),
+		endNs:     end.UnixNano(),
+		tp:        tp,
+	}
+	return req, d.setStatus(ctx, conn, req, DeleteStatusReceived, "")
+}
+
+// List returns all the log delete requests, the latest first.
+func (d *DeleteService) List(ctx context.Context) ([]*DeleteRequest, error) {
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.list(ctx, conn, "", shared.SAMPLES_TYPE_LOGS)
+}
+
+// ListSeries returns all the series delete requests, the latest first.
+func (d *DeleteService) ListSeries(ctx context.Context) ([]*DeleteRequest, error) {
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d.list(ctx, conn, "", shared.SAMPLES_TYPE_METRICS)
+}
+
+// Cancel cancels a request which is not processed yet.
+func (d *DeleteService) Cancel(ctx context.Context, requestID string) error {
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return err
+	}
+	reqs, err := d.list(ctx, conn, requestID, shared.SAMPLES_TYPE_BOTH)
+	if err != nil {
+		return err
+	}
+	if len(reqs) == 0 {
+		return &DeleteRequestError{Msg: "could not find delete request with given id"}
+	}
+	if reqs[0].Status != DeleteStatusReceived {
+		return &DeleteRequestError{Msg: "deletion of request which is in process or already processed is not allowed"}
+	}
+	return d.setStatus(ctx, conn, reqs[0], DeleteStatusCancelled, "")
+}
+
+// CleanTombstones applies the masks of the lightweight deletes to the tables
+// of the metrics series, removing the deleted rows from the disk in the
+// background. The mutations remove the rows themselves.
+func (d *DeleteService) CleanTombstones(ctx context.Context) error {
+	if d.Config.Mode != DeleteModeLightweight {
+		return nil
+	}
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range append(seriesSamplesTables, "time_series", "time_series_gin") {
+		table, onCluster := localTable(conn, name)
+		err := conn.Session.ExecCtx(ctx, fmt.Sprintf("ALTER TABLE %s%s APPLY DELETED MASK", table, onCluster))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run polls the received requests and runs them one by one until Stop is
+// called. The first poll also resumes the requests left in process by a
+// restart, the deletes are idempotent.
+func (d *DeleteService) Run() {
+	ticker := time.NewTicker(d.Config.PollInterval)
+	defer ticker.Stop()
+	resume := true
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if err := d.processReceived(resume); err != nil {
+				logger.Error("delete requests: ", err)
+				continue
+			}
+			resume = false
+		}
+	}
+}
+
+func (d *DeleteService) Stop() {
+	close(d.done)
+}
+
+func (d *DeleteService) processReceived(resume bool) error {
+	pending := func(req *DeleteRequest) bool {
+		return req.Status == DeleteStatusReceived || resume && req.Status == DeleteStatusProcessing
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	conn, err := d.Session.GetDB(ctx)
+	if err != nil {
+		return err
+	}
+	reqs, err := d.list(ctx, conn, "", shared.SAMPLES_TYPE_BOTH)
+	if err != nil {
+		return err
+	}
+	// the oldest request first
+	for i := len(reqs) - 1; i >= 0; i-- {
+		if !pending(reqs[i]) {
+			continue
+		}
+		// the request may be cancelled while the previous ones run
+		latest, err := d.list(ctx, conn, reqs[i].RequestID, shared.SAMPLES_TYPE_BOTH)
+		if err != nil {
+			return err
+		}
+		if len(latest) == 0 || !pending(latest[0]) {
+			continue
+		}
+		req := latest[0]
+		if err := d.setStatus(ctx, conn, req, DeleteStatusProcessing, ""); err != nil {
+			return err
+		}
+		status, msg := DeleteStatusProcessed, ""
+		if err := d.process(ctx, conn, req); err != nil {
+			logger.Error("delete request ", req.RequestID, ": ", err)
+			status, msg = DeleteStatusFailed, err.Error()
+		}
+		if err := d.setStatus(ctx, conn, req, status, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process deletes the log lines of a request: it selects the fingerprints of
+// the streams matching the selector, then deletes their lines matching the
+// line filters and recomputes the rollup buckets holding them,
+// deleteBatchSize fingerprints per statement.
+func (d *DeleteService) process(ctx context.Context, conn *model.DataDatabasesMap, req *DeleteRequest) error {
+	if req.tp == shared.SAMPLES_TYPE_METRICS {
+		return d.processSeries(ctx, conn, req)
+	}
+	script, err := logql_parser.Parse(req.Query)
+	if err != nil {
+		return err
+	}
+	conds, err := deleteConditions(req.Query)
+	if err != nil {
+		return err
+	}
+	retainedFrom := samplesRetainedFrom(conn, time.Now())
+	if err := checkRollupsRetention(conds, req.startNs, retainedFrom); err != nil {
+		return err
+	}
+	fpPlanner, err := logql_transpiler.PlanFingerprints(script)
+	if err != nil {
+		return err
+	}
+	fps, err := d.fingerprints(ctx, conn, fpPlanner, req)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fps); i += deleteBatchSize {
+		batch := fps[i:min(i+deleteBatchSize, len(fps))]
+		where := append(samplesConditions(batch, req.startNs, req.endNs), conds...)
+		stmts := append([]string{deleteStatement(d.Config.Mode, conn, "samples_v3", where)},
+			rollupStatements(d.Config.Mode, conn, batch, req.startNs, req.endNs, retainedFrom)...)
+		for _, stmt := range stmts {
+			if err := conn.Session.ExecCtx(ctx, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// samplesRetainedFrom returns the time in nanoseconds samples_v3 keeps the
+// lines since, 0 without retention.
+func samplesRetainedFrom(conn *model.DataDatabasesMap, now time.Time) int64 {
+	if conn.Config.TTLDays <= 0 {
+		return 0
+	}
+	return max(now.Add(-time.Duration(conn.Config.TTLDays)*24*time.Hour).UnixNano(), 0)
+}
+
+// checkRollupsRetention rejects the line filters of a request whose rollup
+// buckets start before retainedFrom: the lines left in them are gone, so the
+// buckets can not be recomputed.
+func checkRollupsRetention(conds []string, startNs, retainedFrom int64) error {
+	bucket := samplesRollups[len(samplesRollups)-1].bucket
+	if len(conds) > 0 && startNs/bucket*bucket < retainedFrom {
+		return &DeleteRequestError{Msg: "line filters are not supported before the retention of the samples: " +
+			"the metrics rollups can not be recomputed"}
+	}
+	return nil
+}
+
+// rollupStatements returns the statements recomputing the rollup buckets
+// holding the lines of the fingerprints fps between startNs and endNs from the
+// lines left in samples_v3. The buckets starting before retainedFrom can not
+// be recomputed, the ones starting within the range are deleted whole. The
+// lines pushed to a bucket while it is recomputed may be counted twice.
+func rollupStatements(mode string, conn *model.DataDatabasesMap, fps []string, startNs, endNs,
+	retainedFrom int64,
+) []string {
+	var res []string
+	for _, r := range samplesRollups {
+		to := endNs / r.bucket * r.bucket
+		rebuildFrom := max(startNs/r.bucket*r.bucket, (retainedFrom+r.bucket-1)/r.bucket*r.bucket)
+		deleteFrom := min(rebuildFrom, (startNs+r.bucket-1)/r.bucket*r.bucket)
+		if deleteFrom > to {
+			continue
+		}
+		res = append(res, deleteStatement(mode, conn, r.table, samplesConditions(fps, deleteFrom, to)))
+		if rebuildFrom > to {
+			continue
+		}
+		res = append(res, fmt.Sprintf("INSERT INTO %s (fingerprint, timestamp_ns, last, max, min, count, sum, "+
+			"bytes, type) SELECT fingerprint, intDiv(timestamp_ns, %d) * %d AS bucket_ns, "+
+			"argMaxState(value, timestamp_ns), maxSimpleState(value), minSimpleState(value), countState(), "+
+			"sumSimpleState(value), sumSimpleState(length(string)), type FROM %s WHERE %s "+
+			"GROUP BY fingerprint, bucket_ns, type",
+			distTable(conn, r.table), r.bucket, r.bucket, distTable(conn, "samples_v3"),
+			strings.Join(samplesConditions(fps, rebuildFrom, to+r.bucket-1), " AND ")))
+	}
+	return res
+}
+
+// processSeries deletes the samples and the rollups of the metrics series
+// matching the selector of a request, then their index on the past days fully
+// covered by the request. The rollup buckets starting within the request are
+// deleted whole.
+func (d *DeleteService) processSeries(ctx context.Context, conn *model.DataDatabasesMap, req *DeleteRequest) error {
+	matchers, err := parser.NewParser(parser.Options{}).ParseMetricSelector(req.Query)
+	if err != nil {
+		return err
+	}
+	fpPlanner := &clickhouse_planner.StreamSelectPlanner{}
+	for _, m := range matchers {
+		fpPlanner.LabelNames = append(fpPlanner.LabelNames, m.Name)
+		fpPlanner.Ops = append(fpPlanner.Ops, m.Type.String())
+		fpPlanner.Values = append(fpPlanner.Values, m.Value)
+	}
+	fps, err := d.fingerprints(ctx, conn, fpPlanner, req)
+	if err != nil {
+		return err
+	}
+	from, to, wholeDays := coveredDates(req.startNs, req.endNs, time.Now().UnixNano())
+	for i := 0; i < len(fps); i += deleteBatchSize {
+		batch := fps[i:min(i+deleteBatchSize, len(fps))]
+		where := samplesConditions(batch, req.startNs, req.endNs)
+		var stmts []string
+		for _, table := range seriesSamplesTables {
+			stmts = append(stmts, deleteStatement(d.Config.Mode, conn, table, where))
+		}
+		if wholeDays {
+			where := []string{
+				fmt.Sprintf("fingerprint IN (%s)", strings.Join(batch, ",")),
+				fmt.Sprintf("date >= '%s'", from.Format(time.DateOnly)),
+				fmt.Sprintf("date <= '%s'", to.Format(time.DateOnly)),
+			}
+			stmts = append(stmts, deleteStatement(d.Config.Mode, conn, "time_series", where),
+				deleteStatement(d.Config.Mode, conn, "time_series_gin", where))
+		}
+		for _, stmt := range stmts {
+			if err := conn.Session.ExecCtx(ctx, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// coveredDates returns the first and the last date fully covered by the
+// range between startNs and endNs, ok is false if there is none. The current
+// day is never covered: the writers keep on ingesting its series without
+// indexing them again while they are in their fingerprints cache.
+func coveredDates(startNs, endNs, nowNs int64) (from time.Time, to time.Time, ok bool) {
+	const day = int64(24 * time.Hour)
+	endNs = min(endNs, nowNs/day*day-1)
+	fromDay := startNs / day
+	if startNs > fromDay*day {
+		fromDay++
+	}
+	toDay := (endNs+1)/day - 1
+	from, to = time.Unix(0, fromDay*day).UTC(), time.Unix(0, toDay*day).UTC()
+	return from, to, startNs >= 0 && fromDay <= toDay
+}
+
+// fingerprints returns the fingerprints of the series selected by fpPlanner.
+// The whole index is looked up on a cluster, the deletes run on every shard.
+func (d *DeleteService) fingerprints(ctx context.Context, conn *model.DataDatabasesMap,
+	fpPlanner shared.SQLRequestPlanner, req *DeleteRequest,
+) ([]string, error) {
+	versionInfo, err := dbversion.GetVersionInfo(ctx, conn.Config.ClusterName != "", conn.Session)
+	if err != nil {
+		return nil, err
+	}
+	plannerCtx := tables.PopulateTableNames(&shared.PlannerContext{
+		Type:      req.tp,
+		IsCluster: conn.Config.ClusterName != "",
+		From:      time.Unix(0, req.startNs),
+		To:        time.Unix(0, req.endNs),
+		Ctx:       ctx,
+		CHDb:      conn.Session,
+		CHSqlCtx: &sql.Ctx{
+			Params: map[string]sql.SQLObject{},
+			Result: map[string]sql.SQLObject{},
+		},
+		VersionInfo: versionInfo,
+	}, conn)
+	plannerCtx.TimeSeriesTableName = plannerCtx.TimeSeriesDistTableName
+	plannerCtx.TimeSeriesGinTableName = plannerCtx.TimeSeriesGinDistTableName
+	fpSelect, err := fpPlanner.Process(plannerCtx)
+	if err != nil {
+		return nil, err
+	}
+	var opts []int
+	if plannerCtx.IsCluster {
+		opts = append(opts, sql.STRING_OPT_INLINE_WITH)
+	}
+	strSelect, err := fpSelect.String(plannerCtx.CHSqlCtx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Session.QueryCtx(ctx, strSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var fp uint64
+		if err := rows.Scan(&fp); err != nil {
+			return nil, err
+		}
+		res = append(res, strconv.FormatUint(fp, 10))
+	}
+	return res, rows.Err()
+}
+
+// list returns the latest version of the requests of the type tp, of any
+// type if it is shared.SAMPLES_TYPE_BOTH, or of the request id if it is not
+// empty, the latest created first.
+func (d *DeleteService) list(ctx context.Context, conn *model.DataDatabasesMap, id string, tp uint8,
+) ([]*DeleteRequest, error) {
+	query := fmt.Sprintf("SELECT request_id, query, start_ns, end_ns, status, error, "+
+		"toUnixTimestamp64Milli(created_at), type FROM %s FINAL", deleteRequestsTable(conn))
+	var (
+		where []string
+		args  []any
+	)
+	if id != "" {
+		where = append(where, "request_id = ?")
+		args = append(args, id)
+	}
+	if tp != shared.SAMPLES_TYPE_BOTH {
+		where = append(where, "type = ?")
+		args = append(args, tp)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC"
+	rows, err := conn.Session.QueryCtx(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []*DeleteRequest
+	for rows.Next() {
+		var (
+			req       DeleteRequest
+			createdAt int64
+		)
+		err := rows.Scan(&req.RequestID, &req.Query, &req.startNs, &req.endNs, &req.Status, &req.Error, &createdAt,
+			&req.tp)
+		if err != nil {
+			return nil, err
+		}
+		req.StartTime = float64(req.startNs/int64(time.Millisecond)) / 1000
+		req.EndTime = float64(req.endNs/int64(time.Millisecond)) / 1000
+		req.CreatedAt = float64(createdAt) / 1000
+		res = append(res, &req)
+	}
+	return res, rows.Err()
+}
+
+func (d *DeleteService) setStatus(ctx context.Context, conn *model.DataDatabasesMap, req *DeleteRequest,
+	status string, msg string,
+) error {
+	err := conn.Session.ExecCtx(ctx, fmt.Sprintf("INSERT INTO %s "+
+		"(request_id, query, start_ns, end_ns, status, error, created_at, updated_at, type) "+
+		"VALUES (?, ?, ?, ?, ?, ?, fromUnixTimestamp64Milli(?), fromUnixTimestamp64Nano(?), ?)",
+		deleteRequestsTable(conn)),
+		req.RequestID, req.Query, req.startNs, req.endNs, status, msg, int64(req.CreatedAt*1000),
+		time.Now().UnixNano(), req.tp)
+	if err != nil {
+		return err
+	}
+	req.Status, req.Error = status, msg
+	return nil
+}
+
+func deleteRequestsTable(conn *model.DataDatabasesMap) string {
+	return distTable(conn, "delete_requests")
+}
+
+// distTable returns the table of name the statements reading or inserting
+// the rows of every shard run on.
+func distTable(conn *model.DataDatabasesMap, name string) string {
+	table := tables.GetTableName(name)
+	if conn.Config.ClusterName != "" {
+		return fmt.Sprintf("`%s`.%s%s", conn.Config.Name, table, distconfig.Suffix())
+	}
+	return table
+}
+
+// localTable returns the local table of name and the ON CLUSTER
+// clause of the statements changing it on every shard.
+func localTable(conn *model.DataDatabasesMap, name string) (string, string) {
+	table := tables.GetTableName(name)
+	if conn.Config.ClusterName == "" {
+		return table, ""
+	}
+	return fmt.Sprintf("`%s`.%s", conn.Config.Name, table), fmt.Sprintf(" ON CLUSTER `%s`", conn.Config.ClusterName)
+}
+
+// samplesConditions returns the conditions of the samples of the fingerprints
+// fps between startNs and endNs.
+func samplesConditions(fps []string, startNs, endNs int64) []string {
+	return []string{
+		fmt.Sprintf("fingerprint IN (%s)", strings.Join(fps, ",")),
+		fmt.Sprintf("timestamp_ns >= %d", startNs),
+		fmt.Sprintf("timestamp_ns <= %d", endNs),
+	}
+}
+
+// deleteStatement returns the statement deleting the rows of the table
+// matching all the conditions of where. The rows are deleted from the local
+// tables of every shard.
+func deleteStatement(mode string, conn *model.DataDatabasesMap, name string, where []string) string {
+	table, onCluster := localTable(conn, name)
+	if mode == DeleteModeMutation {
+		// mutations_sync waits for the mutation on all the replicas, so the
+		// request is processed once the rows are gone
+		return fmt.Sprintf("ALTER TABLE %s%s DELETE WHERE %s SETTINGS mutations_sync = 2", table, onCluster,
+			strings.Join(where, " AND "))
+	}
+	return fmt.Sprintf("DELETE FROM %s%s WHERE %s", table, onCluster, strings.Join(where, " AND "))
+}
+
+// deleteConditions validates the query of a delete request: a stream selector
+// followed by line filters. It returns the SQL conditions of the line
+// filters.
+func deleteConditions(query string) ([]string, error) {
+	script, err := logql_parser.Parse(query)
+	if err != nil {
+		return nil, &DeleteRequestError{Msg: "invalid query: " + err.Error()}
+	}
+	if script.IsBinary() || script.Head.StrSelector == nil || len(script.Head.StrSelector.StrSelCmds) == 0 {
+		return nil, &DeleteRequestError{Msg: "invalid query: a stream selector with line filters is expected"}
+	}
+	var res []string
+	for _, p := range script.Head.StrSelector.Pipelines {
+		if p.LineFilter == nil {
+			return nil, &DeleteRequestError{Msg: "invalid query: only line filters are supported in delete requests"}
+		}
+		cond, err := deleteLineFilter(p.LineFilter.Fn, &p.LineFilter.Exp)
+		if err != nil {
+			return nil, err
+		}
+		if p.LineFilter.Fn == "!=" || p.LineFilter.Fn == "!~" {
+			cond = "NOT (" + cond + ")"
+		}
+		res = append(res, cond)
+	}
+	return res, nil
+}
+
+// deleteLineFilter returns the condition of the lines matching the values of
+// a line filter, the negative filters match the lines matching none of them.
+func deleteLineFilter(fn string, exp *logql_parser.LineFilterExp) (string, error) {
+	var (
+		head string
+		err  error
+	)
+	if exp.Head.Complex != nil {
+		head, err = deleteLineFilter(fn, exp.Head.Complex)
+	} else {
+		head, err = deleteLineMatch(fn, exp.Head.Simple)
+	}
+	if err != nil || exp.Op == "" {
+		return head, err
+	}
+	tail, err := deleteLineFilter(fn, exp.Tail)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s %s %s)", head, strings.ToUpper(exp.Op), tail), nil
+}
+
+func deleteLineMatch(fn string, s *logql_parser.LineFilterSimple) (string, error) {
+	if s.IP != nil {
+		return "", &DeleteRequestError{Msg: "invalid query: ip() filters are not supported in delete requests"}
+	}
+	val, err := s.Val.Unquote()
+	if err != nil {
+		return "", &DeleteRequestError{Msg: "invalid query: " + err.Error()}
+	}
+	strVal, err := sql.NewStringVal(val).String(&sql.Ctx{})
+	if err != nil {
+		return "", err
+	}
+	switch fn {
+	case "|=", "!=":
+		return fmt.Sprintf("position(string, %s) > 0", strVal), nil
+	case "|~", "!~":
+		if _, err := regexp.Compile(val); err != nil {
+			return "", &DeleteRequestError{Msg: "invalid query: " + err.Error()}
+		}
+		return fmt.Sprintf("match(string, %s)", strVal), nil
+	}
+	return "", &DeleteRequestError{Msg: fmt.Sprintf("invalid query: %s filters are not supported in delete requests", fn)}
+}
+
+// IsDeleteRequestError reports if err is caused by an invalid delete request.
+func IsDeleteRequestError(err error) bool {
+	var reqErr *DeleteRequestError
+	return errors.As(err, &reqErr)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/metrico/cloki-config/config"
+	"github.com/metrico/qryn/v5/reader/model"
+)
+
+func TestDeleteConditions(t *testing.T) {
+	for query, want := range map[string][]string{
+		`{app="a"}`:                        nil,
+		`{app="a"} |= "token"`:             {`position(string, 'token') > 0`},
+		`{app="a"} != "it's"`:              {`NOT (position(string, 'it\'s') > 0)`},
+		`{app="a"} |~ "tok.n" |= "secret"`: {`match(string, 'tok.n')`, `position(string, 'secret') > 0`},
+		`{app="a"} != "a" or "b"`:          {`NOT ((position(string, 'a') > 0 OR position(string, 'b') > 0))`},
+	} {
+		got, err := deleteConditions(query)
+		if err != nil {
+			t.Errorf("deleteConditions(%s): %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("deleteConditions(%s) = %q, want %q", query, got, want)
+		}
+	}
+
+	for _, query := range []string{
+		`rate({app="a"}[1m])`,
+		`{app="a"} | json`,
+		`{app="a"} |= ip("10.0.0.1")`,
+		`{app="a"} |~ "("`,
+		`{app="a"} or {app="b"}`,
+		`{app=`,
+	} {
+		_, err := deleteConditions(query)
+		if !IsDeleteRequestError(err) {
+			t.Errorf("deleteConditions(%s) = %v, want a DeleteRequestError", query, err)
+		}
+	}
+}
+
+func TestDeleteStatement(t *testing.T) {
+	single := &model.DataDatabasesMap{Config: &cfg.ClokiBaseDataBase{Name: "qryn"}}
+	got := deleteStatement(DeleteModeLightweight, single, "samples_v3",
+		append(samplesConditions([]string{"1", "2"}, 10, 20), "match(string, 'x')"))
+	want := "DELETE FROM samples_v3 WHERE fingerprint IN (1,2) AND timestamp_ns >= 10 AND timestamp_ns <= 20 " +
+		"AND match(string, 'x')"
+	if got != want {
+		t.Errorf("deleteStatement() = %s, want %s", got, want)
+	}
+
+	cluster := &model.DataDatabasesMap{Config: &cfg.ClokiBaseDataBase{Name: "qryn", ClusterName: "c1"}}
+	got = deleteStatement(DeleteModeMutation, cluster, "samples_v3", samplesConditions([]string{"1"}, 10, 20))
+	want = "ALTER TABLE `qryn`.samples_v3 ON CLUSTER `c1` DELETE WHERE fingerprint IN (1) AND timestamp_ns >= 10 " +
+		"AND timestamp_ns <= 20 SETTINGS mutations_sync = 2"
+	if got != want {
+		t.Errorf("deleteStatement() = %s, want %s", got, want)
+	}
+}
+
+func TestCoveredDates(t *testing.T) {
+	day := int64(24 * time.Hour)
+	now := 10*day + day/2
+	for _, c := range []struct {
+		startNs, endNs int64
+		from, to       string
+		ok             bool
+	}{
+		{0, day - 1, "1970-01-01", "1970-01-01", true},
+		{0, day - 2, "", "", false},
+		{1, 3*day - 1, "1970-01-02", "1970-01-03", true},
+		{day, 3 * day, "1970-01-02", "1970-01-03", true},
+		{day + 1, 2 * day, "", "", false},
+		// the end of a request defaults to now, the current day is kept
+		{8 * day, now, "1970-01-09", "1970-01-10", true},
+		{9 * day, 12 * day, "1970-01-10", "1970-01-10", true},
+		{10 * day, now, "", "", false},
+	} {
+		from, to, ok := coveredDates(c.startNs, c.endNs, now)
+		if ok != c.ok || ok && (from.Format(time.DateOnly) != c.from || to.Format(time.DateOnly) != c.to) {
+			t.Errorf("coveredDates(%d, %d) = %v, %v, %v, want %s, %s, %v", c.startNs, c.endNs, from, to, ok,
+				c.from, c.to, c.ok)
+		}
+	}
+}
+
+func TestCreateSeriesValidation(t *testing.T) {
+	d := &DeleteService{}
+	start, end := time.Unix(0, 0), time.Unix(10, 0)
+	for name, matches := range map[string][]string{
+		"no matches":       nil,
+		"invalid selector": {`up{job=`},
+		"not a selector":   {`rate(up[1m])`},
+	} {
+		_, err := d.CreateSeries(context.Background(), matches, start, end)
+		if !IsDeleteRequestError(err) {
+			t.Errorf("%s: got %v, want a DeleteRequestError", name, err)
+		}
+	}
+	_, err := d.CreateSeries(context.Background(), []string{`up`}, end, start)
+	if !IsDeleteRequestError(err) {
+		t.Errorf("end before start: got %v, want a DeleteRequestError", err)
+	}
+}
+
+func TestRollupStatements(t *testing.T) {
+	single := &model.DataDatabasesMap{Config: &cfg.ClokiBaseDataBase{Name: "qryn"}}
+	minute := int64(time.Minute)
+	stmts := rollupStatements(DeleteModeLightweight, single, []string{"1"}, 10*minute+1, 11*minute, 0)
+	want := []string{
+		"DELETE FROM metrics_15s WHERE fingerprint IN (1) AND timestamp_ns >= 600000000000 " +
+			"AND timestamp_ns <= 660000000000",
+		"INSERT INTO metrics_15s (fingerprint, timestamp_ns, last, max, min, count, sum, bytes, type) " +
+			"SELECT fingerprint, intDiv(timestamp_ns, 15000000000) * 15000000000 AS bucket_ns, " +
+			"argMaxState(value, timestamp_ns), maxSimpleState(value), minSimpleState(value), countState(), " +
+			"sumSimpleState(value), sumSimpleState(length(string)), type FROM samples_v3 " +
+			"WHERE fingerprint IN (1) AND timestamp_ns >= 600000000000 AND timestamp_ns <= 674999999999 " +
+			"GROUP BY fingerprint, bucket_ns, type",
+	}
+	if len(stmts) != 6 || !reflect.DeepEqual(stmts[:2], want) {
+		t.Fatalf("rollupStatements() = %q", stmts)
+	}
+	for _, part := range []string{
+		"DELETE FROM metrics_1h WHERE fingerprint IN (1) AND timestamp_ns >= 0 AND timestamp_ns <= 0",
+		"FROM samples_v3 WHERE fingerprint IN (1) AND timestamp_ns >= 0 AND timestamp_ns <= 3599999999999",
+	} {
+		if !strings.Contains(strings.Join(stmts, "\n"), part) {
+			t.Errorf("expected %s in %q", part, stmts)
+		}
+	}
+
+	// the buckets before the retention of the samples are deleted whole
+	stmts = rollupStatements(DeleteModeLightweight, single, []string{"1"}, 10*minute+1, 11*minute, 10*minute+30)
+	if len(stmts) != 2 || stmts[0] != "DELETE FROM metrics_15s WHERE fingerprint IN (1) "+
+		"AND timestamp_ns >= 615000000000 AND timestamp_ns <= 660000000000" || !strings.HasPrefix(stmts[1], "INSERT INTO metrics_15s") ||
+		!strings.Contains(stmts[1], "timestamp_ns >= 615000000000 AND timestamp_ns <= 674999999999") {
+		t.Errorf("rollupStatements() = %q", stmts)
+	}
+
+	if err := checkRollupsRetention(nil, 0, 10*minute); err != nil {
+		t.Errorf("a request without line filters must be accepted: %v", err)
+	}
+	if err := checkRollupsRetention([]string{"match(string, 'x')"}, 10*minute, 60*minute); !IsDeleteRequestError(err) {
+		t.Errorf("line filters before the retention: got %v, want a DeleteRequestError", err)
+	}
+	if err := checkRollupsRetention([]string{"match(string, 'x')"}, 60*minute, 60*minute); err != nil {
+		t.Errorf("line filters within the retention: %v", err)
+	}
+}
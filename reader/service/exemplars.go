@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	"github.com/metrico/qryn/v5/reader/promql/promql_parser"
+	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler"
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+	"github.com/metrico/qryn/v5/reader/utils/tables"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type ExemplarsService struct {
+	model.ServiceData
+}
+
+func NewExemplarsService(sd *model.ServiceData) *ExemplarsService {
+	return &ExemplarsService{
+		ServiceData: *sd,
+	}
+}
+
+// QueryExemplars returns the exemplars of every series selected by the PromQL
+// expression in the format of the prometheus /api/v1/query_exemplars endpoint.
+// A failure to read the rows is sent as the Err of the last output.
+func (e *ExemplarsService) QueryExemplars(ctx context.Context, expr *promql_parser.Expr, startMs int64,
+	endMs int64) (chan model.QueryRangeOutput, error) {
+	selectors := parser.ExtractSelectors(expr.Expr)
+	res := make(chan model.QueryRangeOutput)
+	if len(selectors) == 0 {
+		go func() {
+			defer close(res)
+			res <- model.QueryRangeOutput{Str: `{"status":"success","data":[]}`}
+		}()
+		return res, nil
+	}
+	conn, err := e.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plannerCtx := shared.PlannerContext{
+		IsCluster: conn.Config.ClusterName != "",
+		From:      time.UnixMilli(startMs),
+		To:        time.UnixMilli(endMs),
+		Ctx:       ctx,
+		CHDb:      conn.Session,
+		Type:      2,
+	}
+	tables.PopulateTableNames(&plannerCtx, conn)
+	req, err := promql_transpiler.TranspileExemplars(&plannerCtx, selectors)
+	if err != nil {
+		return nil, err
+	}
+	strQuery, err := req.String(&sql.Ctx{
+		Params: map[string]sql.SQLObject{},
+		Result: map[string]sql.SQLObject{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Session.QueryCtx(ctx, strQuery)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer rows.Close()
+		defer close(res)
+		var (
+			fp, lastFp     uint64
+			seriesLabels   string
+			timestampMs    int64
+			value          float64
+			exemplarLabels string
+		)
+		i := 0
+		send := func(str string) {
+			res <- model.QueryRangeOutput{Str: str}
+		}
+		send(`{"status":"success","data":[`)
+		for rows.Next() {
+			err := rows.Scan(&fp, &seriesLabels, &timestampMs, &value, &exemplarLabels)
+			if err != nil {
+				logger.Error(err)
+				res <- model.QueryRangeOutput{Err: err}
+				return
+			}
+			if i == 0 || fp != lastFp {
+				if i != 0 {
+					send("]},")
+				}
+				send(`{"seriesLabels":` + jsonObjectOrEmpty(seriesLabels) + `,"exemplars":[`)
+			} else {
+				send(",")
+			}
+			strValue, _ := json.Marshal(strconv.FormatFloat(value, 'f', -1, 64))
+			send(`{"labels":` + jsonObjectOrEmpty(exemplarLabels) +
+				`,"value":` + string(strValue) +
+				`,"timestamp":` + strconv.FormatFloat(float64(timestampMs)/1000, 'f', -1, 64) + `}`)
+			lastFp = fp
+			i++
+		}
+		if err := rows.Err(); err != nil {
+			logger.Error(err)
+			res <- model.QueryRangeOutput{Err: err}
+			return
+		}
+		if i != 0 {
+			send("]}")
+		}
+		send("]}")
+	}()
+	return res, nil
+}
+
+func jsonObjectOrEmpty(obj string) string {
+	if obj == "" {
+		return "{}"
+	}
+	return obj
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	"github.com/metrico/qryn/v5/reader/prof"
+	prof_shared "github.com/metrico/qryn/v5/reader/prof/shared"
+	traceql_parser "github.com/metrico/qryn/v5/reader/traceql/traceql_parser"
+	traceql_transpiler "github.com/metrico/qryn/v5/reader/traceql/traceql_transpiler"
+	"github.com/metrico/qryn/v5/reader/utils/dbVersion"
+	"github.com/metrico/qryn/v5/reader/utils/tables"
+)
+
+// Explain returns the planner chain of a LogQL query and the SQL requests it
+// runs. The in-memory part of the chain is run on empty results, only the
+// optional EXPLAIN requests reach ClickHouse.
+func (q *QueryRangeService) Explain(ctx context.Context, query string, fromNs int64, toNs int64, stepMs int64,
+	limit int64, indexes bool,
+) (*model.ExplainResult, error) {
+	conn, err := q.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := logql_transpiler.Transpile(query)
+	if err != nil {
+		return nil, err
+	}
+	plannerCtx, err := q.plannerContext(ctx, conn, fromNs, toNs, stepMs, limit, false)
+	if err != nil {
+		return nil, err
+	}
+	defer plannerCtx.CancelCtx()
+	plannerCtx.Explain = &shared.Explain{}
+
+	out, err := chain[0].Process(plannerCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for entries := range out {
+		for _, e := range entries {
+			if e.Err != nil && e.Err != io.EOF {
+				return nil, e.Err
+			}
+		}
+	}
+
+	res := &model.ExplainResult{
+		Query: query,
+		Plan:  shared.DescribePlanner(chain),
+		Steps: plannerCtx.Explain.Steps(),
+	}
+	if indexes {
+		err = ExplainIndexes(ctx, conn, res.Steps)
+	}
+	return res, err
+}
+
+// ExplainTraceQL returns the planner chain of a TraceQL search and the SQL
+// requests it runs without running them.
+func (t *TempoService) ExplainTraceQL(ctx context.Context, q string, limit int, from time.Time, to time.Time,
+	indexes bool,
+) (*model.ExplainResult, error) {
+	conn, err := t.Session.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	script, err := traceql_parser.Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	versionInfo, err := dbversion.GetVersionInfo(ctx, conn.Config.ClusterName != "", conn.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCtx := &shared.PlannerContext{
+		IsCluster:   conn.Config.ClusterName != "",
+		From:        from,
+		To:          to,
+		Limit:       int64(limit),
+		Ctx:         ctx,
+		CHDb:        conn.Session,
+		VersionInfo: versionInfo,
+		Explain:     &shared.Explain{},
+	}
+	tables.PopulateTableNames(sqlCtx, conn)
+
+	plan, err := traceql_transpiler.Explain(script, sqlCtx)
+	if err != nil {
+		return nil, err
+	}
+	res := &model.ExplainResult{
+		Query: q,
+		Plan:  plan,
+		Steps: sqlCtx.Explain.Steps(),
+	}
+	if indexes {
+		err = ExplainIndexes(ctx, conn, res.Steps)
+	}
+	return res, err
+}
+
+// ExplainRender returns the planner chain of the flame graph request of a
+// `<type id>{selector}` profile query and its SQL without running it.
+func (ps *ProfService) ExplainRender(ctx context.Context, strQuery string, from, to time.Time,
+	indexes bool,
+) (*model.ExplainResult, error) {
+	db, err := ps.DataSession.GetDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	strTypeId, strScript, err := ps.detachTypeId(strQuery)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := ps.parseScripts([]string{strScript})
+	if err != nil {
+		return nil, err
+	}
+	typeId, err := prof_shared.ParseTypeId(strTypeId)
+	if err != nil {
+		return nil, err
+	}
+
+	explain := &shared.Explain{}
+	plan, err := prof.ExplainMergeTraces(ctx, scripts[0], &typeId, from, to, db, explain)
+	if err != nil {
+		return nil, err
+	}
+	res := &model.ExplainResult{
+		Query: strQuery,
+		Plan:  plan,
+		Steps: explain.Steps(),
+	}
+	if indexes {
+		err = ExplainIndexes(ctx, db, res.Steps)
+	}
+	return res, err
+}
+
+// ExplainIndexes fills the Indexes of the steps with the output of ClickHouse
+// `EXPLAIN indexes = 1`, which analyses a request without running it.
+func ExplainIndexes(ctx context.Context, db *model.DataDatabasesMap, steps []model.ExplainStep) error {
+	for i := range steps {
+		rows, err := db.Session.QueryCtx(ctx, "EXPLAIN indexes = 1 "+steps[i].SQL)
+		if err != nil {
+			return err
+		}
+		var lines []string
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				rows.Close()
+				return err
+			}
+			lines = append(lines, line)
+		}
+		rows.Close()
+		steps[i].Indexes = strings.Join(lines, "\n")
+	}
+	return nil
+}
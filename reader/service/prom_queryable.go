@@ -13,8 +13,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
@@ -26,62 +24,26 @@ import (
 	"github.com/metrico/qryn/v5/reader/utils/tables"
 
 	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler"
+	"github.com/metrico/qryn/v5/reader/promql/promql_transpiler/planner"
 	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
 	"github.com/prometheus/prometheus/storage"
 )
 
-type StatsStore struct {
-	Starts  map[string]time.Time
-	Ends    map[string]time.Time
-	Counter int32
-	Mtx     sync.Mutex
-}
-
-func NewStatsStore() *StatsStore {
-	return &StatsStore{
-		Starts:  make(map[string]time.Time),
-		Ends:    make(map[string]time.Time),
-		Mtx:     sync.Mutex{},
-		Counter: 1,
-	}
-}
-
-func (s *StatsStore) StartTiming(key string) {
-	s.Mtx.Lock()
-	defer s.Mtx.Unlock()
-	s.Starts[key] = time.Now()
-}
-
-func (s *StatsStore) EndTiming(key string) {
-	s.Mtx.Lock()
-	defer s.Mtx.Unlock()
-	s.Ends[key] = time.Now()
-}
-
-func (s *StatsStore) Id() int32 {
-	return atomic.AddInt32(&s.Counter, 1)
-}
-
-func (s *StatsStore) AsMap() map[string]float64 {
-	res := make(map[string]float64)
-	for k, start := range s.Starts {
-		end := time.Now()
-		if _, ok := s.Ends[k]; ok {
-			end = s.Ends[k]
-		}
-		dist := end.Sub(start)
-		res[k] = dist.Seconds()
-	}
-	return res
-}
-
 type CLokiQueriable struct {
 	model.ServiceData
 	random *rand.Rand
 	Ctx    context.Context
-	Stats  *StatsStore
 	Expr   *promql_parser.Expr
+	// Explain is set to record the SQL requests of the selectors instead of
+	// running them.
+	Explain *shared.Explain
+	// Raw is set to select the stored samples as they are, between the start
+	// and the end of the hints, instead of the samples prepared for the PromQL
+	// engine.
+	Raw bool
 }
 
 func (c *CLokiQueriable) Querier(mint, maxt int64) (storage.Querier, error) {
@@ -93,12 +55,23 @@ func (c *CLokiQueriable) Querier(mint, maxt int64) (storage.Querier, error) {
 		return nil, err
 	}
 	return &CLokiQuerier{
-		db:   db,
-		ctx:  c.Ctx,
-		expr: c.Expr,
+		db:      db,
+		ctx:     c.Ctx,
+		expr:    c.Expr,
+		explain: c.Explain,
+		raw:     c.Raw,
 	}, nil
 }
 
+// ChunkQuerier returns a querier of the selected series encoded as chunks.
+func (c *CLokiQueriable) ChunkQuerier(mint, maxt int64) (storage.ChunkQuerier, error) {
+	querier, err := c.Querier(mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	return &cLokiChunkQuerier{Querier: querier}, nil
+}
+
 func (c *CLokiQueriable) SetOidAndDB(ctx context.Context, expr *promql_parser.Expr) *CLokiQueriable {
 	return &CLokiQueriable{
 		ServiceData: c.ServiceData,
@@ -109,9 +82,20 @@ func (c *CLokiQueriable) SetOidAndDB(ctx context.Context, expr *promql_parser.Ex
 }
 
 type CLokiQuerier struct {
-	db   *model.DataDatabasesMap
-	ctx  context.Context
-	expr *promql_parser.Expr
+	db      *model.DataDatabasesMap
+	ctx     context.Context
+	expr    *promql_parser.Expr
+	explain *shared.Explain
+	raw     bool
+}
+
+type cLokiChunkQuerier struct {
+	storage.Querier
+}
+
+func (c *cLokiChunkQuerier) Select(ctx context.Context, sortSeries bool, hints *storage.SelectHints,
+	matchers ...*labels.Matcher) storage.ChunkSeriesSet {
+	return storage.NewSeriesSetToChunkSet(c.Querier.Select(ctx, sortSeries, hints, matchers...))
 }
 
 var supportedFunctions = map[string]bool{
@@ -146,10 +130,12 @@ func (c *CLokiQuerier) transpileLabelMatchers(hints *storage.SelectHints,
 	matchers []*labels.Matcher, versionInfo dbversion.VersionInfo) (*promql_transpiler.TranspileResponse, error) {
 	isSupported, ok := supportedFunctions[hints.Func]
 
-	c.adjustHintsForRate(hints)
+	if !c.raw {
+		c.adjustHintsForRate(hints)
 
-	if !config.Cloki.Setting.ClokiReader.Compat_4_0_19 {
-		hints.Start = hints.Start / 15000 * 15000
+		if !config.Cloki.Setting.ClokiReader.Compat_4_0_19 {
+			hints.Start = hints.Start / 15000 * 15000
+		}
 	}
 
 	useRawData := hints.Start%15000 != 0 ||
@@ -158,6 +144,10 @@ func (c *CLokiQuerier) transpileLabelMatchers(hints *storage.SelectHints,
 		!(isSupported || !ok)
 
 	start := hints.Start - hints.Range
+	if c.raw {
+		// the samples are selected after the start, the raw ones include it
+		start = hints.Start - 1
+	}
 
 	ctx := shared.PlannerContext{
 		IsCluster:   c.db.Config.ClusterName != "",
@@ -177,20 +167,58 @@ func (c *CLokiQuerier) transpileLabelMatchers(hints *storage.SelectHints,
 			continue
 		}
 		if _, ok := c.expr.Substitutes[m.Value]; ok {
-			q, err := c.expr.Substitutes[m.Value].Request.Process(&ctx)
+			req := c.expr.Substitutes[m.Value].Request
+			if c.explain == nil {
+				err := c.checkNativeHistograms(&ctx, c.expr.Substitutes[m.Value])
+				if err != nil {
+					return nil, err
+				}
+			}
+			q, err := req.Process(&ctx)
 			if err != nil {
 				return nil, err
 			}
-			return &promql_transpiler.TranspileResponse{Query: q}, nil
+			return &promql_transpiler.TranspileResponse{Query: q, Planner: req}, nil
 		}
 	}
 
+	if c.raw {
+		return promql_transpiler.TranspileRawLabelMatchers(&ctx, matchers...)
+	}
 	if useRawData {
 		return promql_transpiler.TranspileLabelMatchers(hints, &ctx, matchers...)
 	}
 	return promql_transpiler.TranspileLabelMatchersDownsample(hints, &ctx, matchers...)
 }
 
+// checkNativeHistograms fails the substituted request when its series have
+// native histograms: it is computed from the float samples only and would
+// return partial data.
+func (c *CLokiQuerier) checkNativeHistograms(ctx *shared.PlannerContext, s *promql_parser.Substitute) error {
+	q, err := (&planner.NativeHistogramsPlanner{Main: s.Request}).Process(ctx)
+	if err != nil {
+		return err
+	}
+	var opts []int
+	if c.db.Config.ClusterName != "" {
+		opts = []int{sql.STRING_OPT_INLINE_WITH}
+	}
+	str, err := q.String(&sql.Ctx{Params: map[string]sql.SQLObject{}}, opts...)
+	if err != nil {
+		return err
+	}
+	rows, err := c.db.Session.QueryCtx(c.ctx, str)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return fmt.Errorf("%s reads native histograms, which are only supported "+
+			"as arguments of the histogram_* functions", s.Node)
+	}
+	return rows.Err()
+}
+
 var rateFunctions = []string{"deriv", "rate", "delta"}
 
 func (c *CLokiQuerier) adjustHintsForRate(hints *storage.SelectHints) {
@@ -202,6 +230,9 @@ func (c *CLokiQuerier) adjustHintsForRate(hints *storage.SelectHints) {
 }
 
 func (c *CLokiQuerier) isProlong(hints *storage.SelectHints, matchers []*labels.Matcher) bool {
+	if c.raw {
+		return false
+	}
 	for _, m := range matchers {
 		if m.Name == "__name__" && m.Type == labels.MatchEqual && c.expr.Substitutes[m.Value] != nil {
 			return false
@@ -243,6 +274,10 @@ func (c *CLokiQuerier) Select(ctx context.Context, sortSeries bool, hints *stora
 		return &model.SeriesSet{Error: err}
 	}
 	logger.Debug("[ PromQuerier ] ", str)
+	if c.explain != nil {
+		c.explain.AddStep(q.Planner, str)
+		return &model.SeriesSet{}
+	}
 	rows, err := c.db.Session.QueryCtx(c.ctx, str)
 	if err != nil {
 		fmt.Println(str)
@@ -265,6 +300,7 @@ func (c *CLokiQuerier) Select(ctx context.Context, sortSeries bool, hints *stora
 	cntSeries := 0
 	lblsGetter := newLabelsGetter(time.UnixMilli(hints.Start), time.UnixMilli(hints.End), c.db, c.ctx)
 	isProlong := c.isProlong(hints, matchers)
+	hists := map[uint64][]model.HistogramSample{}
 	for rows.Next() {
 		err = rows.Scan(&tp, &fp, &ts, &val, &lbls)
 		if err != nil {
@@ -283,6 +319,14 @@ func (c *CLokiQuerier) Select(ctx context.Context, sortSeries bool, hints *stora
 			lblsGetter.Save(fp, arrLbls)
 			continue
 		}
+		if tp == 3 {
+			h, err := decodeHistogram(lbls)
+			if err != nil {
+				return &model.SeriesSet{Error: err}
+			}
+			hists[fp] = append(hists[fp], model.HistogramSample{TimestampMs: ts, H: h})
+			continue
+		}
 
 		if len(res.Series) == 0 || fp != lastLabels {
 			lblsGetter.Plan(fp)
@@ -306,6 +350,7 @@ func (c *CLokiQuerier) Select(ctx context.Context, sortSeries bool, hints *stora
 	if len(res.Series) > 0 && q.MapResult != nil {
 		res.Series[len(res.Series)-1].Samples = q.MapResult(res.Series[len(res.Series)-1].Samples)
 	}
+	res.Series = c.addHistograms(res.Series, hists, lblsGetter)
 	err = lblsGetter.Fetch()
 	if err != nil {
 		return &model.SeriesSet{Error: err}
@@ -329,6 +374,38 @@ func (c *CLokiQuerier) Select(ctx context.Context, sortSeries bool, hints *stora
 	return &res
 }
 
+// addHistograms attaches native histogram samples to their series, adding
+// histogram-only series as needed.
+func (c *CLokiQuerier) addHistograms(series []*model.SeriesV2, hists map[uint64][]model.HistogramSample,
+	lblsGetter *labelsGetter) []*model.SeriesV2 {
+	if len(hists) == 0 {
+		return series
+	}
+	for _, s := range series {
+		if h, ok := hists[s.Fp]; ok {
+			s.Histograms = h
+			delete(hists, s.Fp)
+		}
+	}
+	for fp, h := range hists {
+		lblsGetter.Plan(fp)
+		series = append(series, &model.SeriesV2{
+			LabelsGetter: lblsGetter,
+			Fp:           fp,
+			Histograms:   h,
+		})
+	}
+	return series
+}
+
+func decodeHistogram(encoded string) (*histogram.FloatHistogram, error) {
+	var h writev2.Histogram
+	if err := h.Unmarshal([]byte(encoded)); err != nil {
+		return nil, fmt.Errorf("invalid native histogram: %w", err)
+	}
+	return h.ToFloatHistogram(), nil
+}
+
 func (c *CLokiQuerier) ReshuffleSeries(series []*model.SeriesV2) {
 	seriesMap := make(map[uint64]*model.SeriesV2, len(series)*2)
 	for _, ent := range series {
@@ -346,6 +423,10 @@ func (c *CLokiQuerier) ReshuffleSeries(series []*model.SeriesV2) {
 			sort.Slice(chunk.Samples, func(i, j int) bool {
 				return chunk.Samples[i].TimestampMs < chunk.Samples[j].TimestampMs
 			})
+			chunk.Histograms = append(chunk.Histograms, ent.Histograms...)
+			sort.Slice(chunk.Histograms, func(i, j int) bool {
+				return chunk.Histograms[i].TimestampMs < chunk.Histograms[j].TimestampMs
+			})
 
 		} else {
 			seriesMap[_fp] = ent
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+// cachedMatrix runs a range metric query through the results cache. The
+// cache keeps the samples per series, the fingerprints of the returned series
+// are their positions in the response.
+func (q *QueryRangeService) cachedMatrix(ctx *shared.PlannerContext, query string) (chan []shared.LogEntry, error) {
+	script, err := logql_parser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	series, err := q.Cache.Query(ctx.Ctx, "loki", script.String(), ctx.From.UnixMilli(), ctx.To.UnixMilli(),
+		ctx.Step.Milliseconds(), func(_ context.Context, start, end int64) ([]resultscache.Series, error) {
+			matrix, err := q.runRange(ctx, query, time.UnixMilli(start), time.UnixMilli(end))
+			if err != nil {
+				return nil, err
+			}
+			res := make([]resultscache.Series, len(matrix))
+			for i, entries := range matrix {
+				res[i] = resultscache.Series{
+					Labels:  entries[0].Labels,
+					Samples: make([]resultscache.Sample, len(entries)),
+				}
+				for j, e := range entries {
+					res[i].Samples[j] = resultscache.Sample{T: e.TimestampNS / int64(time.Millisecond), V: e.Value}
+				}
+			}
+			return res, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	res := make(chan []shared.LogEntry, len(series)+1)
+	for i, s := range series {
+		entries := make([]shared.LogEntry, len(s.Samples))
+		for j, sample := range s.Samples {
+			entries[j] = shared.LogEntry{
+				TimestampNS: sample.T * int64(time.Millisecond),
+				Fingerprint: uint64(i + 1),
+				Labels:      s.Labels,
+				Value:       sample.V,
+			}
+		}
+		res <- entries
+	}
+	res <- []shared.LogEntry{{Err: io.EOF}}
+	close(res)
+	return res, nil
+}
+
+// runRange runs a range metric query over the steps from..to and returns its
+// series. The range is split if it is long enough.
+func (q *QueryRangeService) runRange(ctx *shared.PlannerContext, query string, from, to time.Time,
+) ([][]shared.LogEntry, error) {
+	_ctx := *ctx
+	_ctx.From, _ctx.To = from, to
+	_ctx.CHSqlCtx = &sql.Ctx{
+		Params: map[string]sql.SQLObject{},
+		Result: map[string]sql.SQLObject{},
+	}
+	plan := func() (shared.RequestProcessorChain, error) {
+		return logql_transpiler.Transpile(query)
+	}
+	var out chan []shared.LogEntry
+	if q.Split.shouldSplit(query, from, to, ctx.Step) {
+		var err error
+		if out, err = splitQuery(&_ctx, q.Split, plan); err != nil {
+			return nil, err
+		}
+	} else {
+		chain, err := plan()
+		if err != nil {
+			return nil, err
+		}
+		if out, err = chain[0].Process(&_ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+	return shared.DrainSeries(out)
+}
@@ -5,6 +5,7 @@ import (
 	databaseSql "database/sql"
 	"fmt"
 	"io"
+	"maps"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,6 +19,8 @@ import (
 	"github.com/metrico/qryn/v5/reader/plugins"
 	dbversion "github.com/metrico/qryn/v5/reader/utils/dbVersion"
 	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/metrico/qryn/v5/reader/utils/querystats"
+	"github.com/metrico/qryn/v5/reader/utils/resultscache"
 	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
 	"github.com/metrico/qryn/v5/reader/utils/tables"
 )
@@ -31,6 +34,10 @@ const (
 type QueryRangeService struct {
 	model.ServiceData
 	plugin plugins.QueryRangeServicePlugin
+	// Split configures the time split of the range metric queries
+	Split SplitConfig
+	// Cache is the results cache of the range metric queries, nil if disabled
+	Cache *resultscache.Cache
 }
 
 func NewQueryRangeService(data *model.ServiceData) *QueryRangeService {
@@ -53,8 +60,11 @@ func onErr(err error, res chan model.QueryRangeOutput) {
 	}
 }
 
+// exportStreamsValue writes the log lines as a Loki streams result. With
+// categorizeLabels the structured metadata of every line is returned next to
+// it instead of being part of the stream labels.
 func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
-	res chan model.QueryRangeOutput,
+	res chan model.QueryRangeOutput, categorizeLabels bool, stats *querystats.Stats,
 ) {
 	defer close(res)
 
@@ -72,6 +82,13 @@ func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
 	stream.WriteObjectField("resultType")
 	stream.WriteString("streams")
 	stream.WriteMore()
+	if categorizeLabels {
+		stream.WriteObjectField("encodingFlags")
+		stream.WriteArrayStart()
+		stream.WriteString(CategorizeLabelsFlag)
+		stream.WriteArrayEnd()
+		stream.WriteMore()
+	}
 	stream.WriteObjectField("result")
 	stream.WriteArrayStart()
 
@@ -79,8 +96,10 @@ func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
 	stream.Reset(nil)
 
 	var lastFp uint64
+	var lastLabels map[string]string
 	i := 0
 	j := 0
+	streams, entriesReturned := 0, 0
 
 	for entries := range out {
 		for _, e := range entries {
@@ -91,7 +110,13 @@ func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
 				onErr(e.Err, res)
 				return
 			}
-			if lastFp != e.Fingerprint {
+			labels, structuredMetadata := e.Labels, map[string]string(nil)
+			if categorizeLabels {
+				labels, structuredMetadata = splitStructuredMetadata(&e)
+			}
+			// Lines of one stream with different structured metadata have
+			// different labels when it is merged into them
+			if lastFp != e.Fingerprint || (!categorizeLabels && !maps.Equal(lastLabels, labels)) {
 				if i > 0 {
 					// Close previous stream entry
 					stream.WriteArrayEnd()
@@ -101,13 +126,15 @@ func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
 					stream.Reset(nil)
 				}
 				lastFp = e.Fingerprint
+				lastLabels = labels
 				i = 1
 				j = 0
+				streams++
 
 				// Write new stream entry
 				stream.WriteObjectStart()
 				stream.WriteObjectField("stream")
-				writeMap(stream, e.Labels)
+				writeMap(stream, labels)
 				stream.WriteMore()
 				stream.WriteObjectField("values")
 				stream.WriteArrayStart()
@@ -122,7 +149,15 @@ func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
 			stream.WriteString(fmt.Sprintf("%d", e.TimestampNS))
 			stream.WriteMore()
 			stream.WriteString(e.Message)
+			if len(structuredMetadata) > 0 {
+				stream.WriteMore()
+				stream.WriteObjectStart()
+				stream.WriteObjectField("structuredMetadata")
+				writeMap(stream, structuredMetadata)
+				stream.WriteObjectEnd()
+			}
 			stream.WriteArrayEnd()
+			entriesReturned++
 
 			res <- model.QueryRangeOutput{Str: string(stream.Buffer())}
 			stream.Reset(nil)
@@ -137,6 +172,7 @@ func (q *QueryRangeService) exportStreamsValue(out chan []shared.LogEntry,
 
 	// Close result array and response object
 	stream.WriteArrayEnd()
+	writeStats(stream, stats, streams, entriesReturned)
 	stream.WriteObjectEnd()
 	stream.WriteObjectEnd()
 
@@ -175,7 +211,7 @@ func (q *QueryRangeService) QueryVolume(ctx context.Context, query string, fromN
 	}
 	req := fmt.Sprintf("sum(bytes_over_time(%s [%dms])) by (%s)", query, stepMs,
 		strings.Join(aggregateByLabels, ","))
-	c, _, err := q.prepareOutput(ctx, req, fromNs, toNs, stepMs, 1000, true)
+	c, _, err := q.prepareOutput(ctx, req, fromNs, toNs, stepMs, 1000, true, false)
 	if err != nil {
 		return nil, err
 	}
@@ -222,24 +258,76 @@ type QueryDetectedLabelsResult struct {
 func (q *QueryRangeService) QueryDetectedLabels(ctx context.Context, query string, fromNs int64,
 	toNs int64,
 ) ([]QueryDetectedLabelsResult, error) {
-	conn, err := q.Session.GetDB(ctx)
+	var (
+		script *logql_parser.LogQLScript
+		err    error
+	)
+	if query != "" {
+		script, err = logql_parser.Parse(query)
+		if err != nil {
+			return nil, err
+		}
+	}
+	sqlReq, err := logql_transpiler.PlanDetectLabels(script)
 	if err != nil {
 		return nil, err
 	}
-	versionInfo, err := dbversion.GetVersionInfo(ctx, conn.Config.ClusterName != "", conn.Session)
+	var res []QueryDetectedLabelsResult
+	err = q.queryKeysCardinality(ctx, sqlReq, fromNs, toNs, func(key string, cardinality int64) {
+		res = append(res, QueryDetectedLabelsResult{
+			Label:       key,
+			Cardinality: cardinality,
+		})
+	})
+	return res, err
+}
+
+type QueryDetectedFieldsResult struct {
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Cardinality int64    `json:"cardinality"`
+	Parsers     []string `json:"parsers"`
+}
+
+// QueryDetectedFields returns the structured metadata keys of the latest
+// lineLimit log lines matching the query.
+func (q *QueryRangeService) QueryDetectedFields(ctx context.Context, query string, fromNs int64,
+	toNs int64, lineLimit int64,
+) ([]QueryDetectedFieldsResult, error) {
+	script, err := logql_parser.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	sqlReq, err := logql_transpiler.PlanDetectFields(script, lineLimit)
 	if err != nil {
 		return nil, err
 	}
+	res := []QueryDetectedFieldsResult{}
+	err = q.queryKeysCardinality(ctx, sqlReq, fromNs, toNs, func(key string, cardinality int64) {
+		res = append(res, QueryDetectedFieldsResult{
+			Label:       key,
+			Type:        "string",
+			Cardinality: cardinality,
+		})
+	})
+	return res, err
+}
 
-	var script *logql_parser.LogQLScript
-	if query != "" {
-		script, err = logql_parser.Parse(query)
-		if err != nil {
-			return nil, err
-		}
+// queryKeysCardinality runs a planner returning (key, cardinality) rows.
+func (q *QueryRangeService) queryKeysCardinality(ctx context.Context, sqlReq shared.SQLRequestPlanner,
+	fromNs int64, toNs int64, onRow func(key string, cardinality int64),
+) error {
+	conn, err := q.Session.GetDB(ctx)
+	if err != nil {
+		return err
+	}
+	versionInfo, err := dbversion.GetVersionInfo(ctx, conn.Config.ClusterName != "", conn.Session)
+	if err != nil {
+		return err
 	}
 
 	_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	plannerCtx := tables.PopulateTableNames(&shared.PlannerContext{
 		IsCluster:  conn.Config.ClusterName != "",
 		From:       time.Unix(fromNs/1000000000, 0),
@@ -255,13 +343,9 @@ func (q *QueryRangeService) QueryDetectedLabels(ctx context.Context, query strin
 		VersionInfo: versionInfo,
 	}, conn)
 
-	sqlReq, err := logql_transpiler.PlanDetectLabels(script)
-	if err != nil {
-		return nil, err
-	}
 	objReq, err := sqlReq.Process(plannerCtx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	var opts []int
 	if plannerCtx.IsCluster {
@@ -269,26 +353,23 @@ func (q *QueryRangeService) QueryDetectedLabels(ctx context.Context, query strin
 	}
 	strReq, err := objReq.String(plannerCtx.CHSqlCtx, opts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	rows, err := conn.Session.QueryCtx(_ctx, strReq)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var res []QueryDetectedLabelsResult
+	defer rows.Close()
 	for rows.Next() {
-		var label string
+		var key string
 		var cardinality int64
-		err = rows.Scan(&label, &cardinality)
+		err = rows.Scan(&key, &cardinality)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		res = append(res, QueryDetectedLabelsResult{
-			Label:       label,
-			Cardinality: cardinality,
-		})
+		onRow(key, cardinality)
 	}
-	return res, nil
+	return rows.Err()
 }
 
 type PatternsResult struct {
@@ -413,9 +494,9 @@ func (q *QueryRangeService) scan(rows *databaseSql.Rows) (PatternsResult, error)
 }
 
 func (q *QueryRangeService) QueryRange(ctx context.Context, query string, fromNs int64, toNs int64, stepMs int64,
-	limit int64, forward bool,
+	limit int64, forward bool, categorizeLabels bool,
 ) (chan model.QueryRangeOutput, error) {
-	out, isMatrix, err := q.prepareOutput(ctx, query, fromNs, toNs, stepMs, limit, forward)
+	out, isMatrix, err := q.prepareOutput(ctx, query, fromNs, toNs, stepMs, limit, forward, true)
 	if err != nil {
 		return nil, err
 	}
@@ -423,7 +504,7 @@ func (q *QueryRangeService) QueryRange(ctx context.Context, query string, fromNs
 
 	if !isMatrix {
 		go func() {
-			q.exportStreamsValue(out, res)
+			q.exportStreamsValue(out, res, categorizeLabels, querystats.FromContext(ctx))
 		}()
 		return res, nil
 	}
@@ -453,6 +534,7 @@ func (q *QueryRangeService) QueryRange(ctx context.Context, query string, fromNs
 		var lastFp uint64
 		i := 0
 		j := 0
+		series := 0
 
 		for entries := range out {
 			for _, e := range entries {
@@ -477,6 +559,7 @@ func (q *QueryRangeService) QueryRange(ctx context.Context, query string, fromNs
 					lastFp = e.Fingerprint
 					i = 1
 					j = 0
+					series++
 
 					// Write new metric entry
 					stream.WriteObjectStart()
@@ -519,6 +602,7 @@ func (q *QueryRangeService) QueryRange(ctx context.Context, query string, fromNs
 
 		// Close result array and response object
 		stream.WriteArrayEnd()
+		writeStats(stream, querystats.FromContext(ctx), series, series)
 		stream.WriteObjectEnd()
 		stream.WriteObjectEnd()
 
@@ -527,8 +611,10 @@ func (q *QueryRangeService) QueryRange(ctx context.Context, query string, fromNs
 	return res, nil
 }
 
+// prepareOutput runs query and returns its entries and if they are a matrix.
+// The matrices go through the results cache if useCache is set.
 func (q *QueryRangeService) prepareOutput(ctx context.Context, query string, fromNs int64, toNs int64, stepMs int64,
-	limit int64, forward bool,
+	limit int64, forward bool, useCache bool,
 ) (chan []shared.LogEntry, bool, error) {
 	conn, err := q.Session.GetDB(ctx)
 	if err != nil {
@@ -538,14 +624,35 @@ func (q *QueryRangeService) prepareOutput(ctx context.Context, query string, fro
 	if err != nil {
 		return nil, false, err
 	}
-	versionInfo, err := dbversion.GetVersionInfo(ctx, conn.Config.ClusterName != "", conn.Session)
+	plannerCtx, err := q.plannerContext(ctx, conn, fromNs, toNs, stepMs, limit, forward)
 	if err != nil {
 		return nil, false, err
 	}
+	if chain[0].IsMatrix() && useCache && q.Cache != nil && !sortsSeries(query) {
+		res, err := q.cachedMatrix(plannerCtx, query)
+		return res, true, err
+	}
+	if chain[0].IsMatrix() && q.Split.shouldSplit(query, plannerCtx.From, plannerCtx.To, plannerCtx.Step) {
+		res, err := splitQuery(plannerCtx, q.Split, func() (shared.RequestProcessorChain, error) {
+			return logql_transpiler.Transpile(query)
+		})
+		return res, true, err
+	}
+	res, err := chain[0].Process(plannerCtx, nil)
+	return res, chain[0].IsMatrix(), err
+}
+
+func (q *QueryRangeService) plannerContext(ctx context.Context, conn *model.DataDatabasesMap, fromNs int64,
+	toNs int64, stepMs int64, limit int64, forward bool,
+) (*shared.PlannerContext, error) {
+	versionInfo, err := dbversion.GetVersionInfo(ctx, conn.Config.ClusterName != "", conn.Session)
+	if err != nil {
+		return nil, err
+	}
 
 	_ctx, cancel := context.WithCancel(ctx)
 
-	plannerCtx := tables.PopulateTableNames(&shared.PlannerContext{
+	return tables.PopulateTableNames(&shared.PlannerContext{
 		IsCluster:  conn.Config.ClusterName != "",
 		From:       time.Unix(fromNs/1000000000, 0),
 		To:         time.Unix(toNs/1000000000, 0),
@@ -561,22 +668,20 @@ func (q *QueryRangeService) prepareOutput(ctx context.Context, query string, fro
 			Result: map[string]sql.SQLObject{},
 		},
 		VersionInfo: versionInfo,
-	}, conn)
-	res, err := chain[0].Process(plannerCtx, nil)
-	return res, chain[0].IsMatrix(), err
+	}, conn), nil
 }
 
 func (q *QueryRangeService) QueryInstant(ctx context.Context, query string, timeNs int64, stepMs int64,
-	limit int64,
+	limit int64, categorizeLabels bool,
 ) (chan model.QueryRangeOutput, error) {
-	out, isMatrix, err := q.prepareOutput(ctx, query, timeNs-300000000000, timeNs, stepMs, limit, false)
+	out, isMatrix, err := q.prepareOutput(ctx, query, timeNs-300000000000, timeNs, stepMs, limit, false, false)
 	if err != nil {
 		return nil, err
 	}
 	res := make(chan model.QueryRangeOutput)
 	if !isMatrix {
 		go func() {
-			q.exportStreamsValue(out, res)
+			q.exportStreamsValue(out, res, categorizeLabels, querystats.FromContext(ctx))
 		}()
 		return res, nil
 	}
@@ -603,6 +708,8 @@ func (q *QueryRangeService) QueryInstant(ctx context.Context, query string, time
 		stream.Reset(nil)
 		i := 0
 		lastValues := make(map[uint64]shared.LogEntry)
+		// the series keep the order of the planner, e.g. for sort()
+		var order []uint64
 		for entries := range out {
 			for _, e := range entries {
 				if e.Err != nil && e.Err != io.EOF {
@@ -614,6 +721,7 @@ func (q *QueryRangeService) QueryInstant(ctx context.Context, query string, time
 				}
 				if _, ok := lastValues[e.Fingerprint]; !ok {
 					lastValues[e.Fingerprint] = e
+					order = append(order, e.Fingerprint)
 					continue
 				}
 				if lastValues[e.Fingerprint].TimestampNS < e.TimestampNS {
@@ -622,7 +730,8 @@ func (q *QueryRangeService) QueryInstant(ctx context.Context, query string, time
 				}
 			}
 		}
-		for _, e := range lastValues {
+		for _, fp := range order {
+			e := lastValues[fp]
 			if i > 0 {
 				stream.WriteMore()
 			}
@@ -659,6 +768,7 @@ func (q *QueryRangeService) QueryInstant(ctx context.Context, query string, time
 			i++
 		}
 		stream.WriteArrayEnd()
+		writeStats(stream, querystats.FromContext(ctx), i, i)
 		stream.WriteObjectEnd()
 		stream.WriteObjectEnd()
 		res <- model.QueryRangeOutput{Str: string(stream.Buffer())}
@@ -920,6 +1030,74 @@ func (w *Watcher) Close() {
 	w.closeOnce.Do(w.cancel)
 }
 
+// CategorizeLabelsFlag is the Loki response encoding flag requesting the
+// structured metadata to be returned apart from the stream labels.
+const CategorizeLabelsFlag = "categorize-labels"
+
+// lokiStatsSummary is the summary of the Loki query statistics. The lines are
+// the rows ClickHouse reads.
+type lokiStatsSummary struct {
+	BytesProcessedPerSecond int64   `json:"bytesProcessedPerSecond"`
+	LinesProcessedPerSecond int64   `json:"linesProcessedPerSecond"`
+	TotalBytesProcessed     uint64  `json:"totalBytesProcessed"`
+	TotalLinesProcessed     uint64  `json:"totalLinesProcessed"`
+	ExecTime                float64 `json:"execTime"`
+	QueueTime               float64 `json:"queueTime"`
+	Subqueries              int64   `json:"subqueries"`
+	TotalEntriesReturned    int     `json:"totalEntriesReturned"`
+	Splits                  int     `json:"splits"`
+	Shards                  int     `json:"shards"`
+}
+
+// writeStats writes the Loki stats summary of the query into the data object
+// of the response if the statistics are collected. It ends the collection:
+// everything the query reads from ClickHouse is read by now.
+func writeStats(stream *jsoniter.Stream, stats *querystats.Stats, series int, entriesReturned int) {
+	if stats == nil {
+		return
+	}
+	stats.AddSeries(series)
+	sum := stats.Finish("loki")
+	perSecond := func(v uint64) int64 {
+		if sum.TotalTime == 0 {
+			return 0
+		}
+		return int64(float64(v) / sum.TotalTime)
+	}
+	stream.WriteMore()
+	stream.WriteObjectField("stats")
+	stream.WriteObjectStart()
+	stream.WriteObjectField("summary")
+	stream.WriteVal(lokiStatsSummary{
+		BytesProcessedPerSecond: perSecond(sum.BytesRead),
+		LinesProcessedPerSecond: perSecond(sum.RowsRead),
+		TotalBytesProcessed:     sum.BytesRead,
+		TotalLinesProcessed:     sum.RowsRead,
+		ExecTime:                sum.TotalTime,
+		Subqueries:              sum.Subqueries,
+		TotalEntriesReturned:    entriesReturned,
+	})
+	stream.WriteObjectEnd()
+}
+
+// splitStructuredMetadata separates the structured metadata of a log line from
+// its labels. Metadata dropped or overwritten by the pipeline stays a label.
+func splitStructuredMetadata(e *shared.LogEntry) (map[string]string, map[string]string) {
+	if len(e.StructuredMetadata) == 0 {
+		return e.Labels, nil
+	}
+	labels := make(map[string]string, len(e.Labels))
+	structuredMetadata := make(map[string]string, len(e.StructuredMetadata))
+	for k, v := range e.Labels {
+		if mv, ok := e.StructuredMetadata[k]; ok && mv == v {
+			structuredMetadata[k] = v
+			continue
+		}
+		labels[k] = v
+	}
+	return labels, structuredMetadata
+}
+
 func writeMap(stream *jsoniter.Stream, m map[string]string) {
 	i := 0
 	stream.WriteObjectStart()
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/model"
+	"github.com/metrico/qryn/v5/reader/utils/querystats"
+)
+
+func exportStreams(categorizeLabels bool, entries ...shared.LogEntry) string {
+	return exportStreamsStats(categorizeLabels, nil, entries...)
+}
+
+func exportStreamsStats(categorizeLabels bool, stats *querystats.Stats, entries ...shared.LogEntry) string {
+	out := make(chan []shared.LogEntry, 1)
+	out <- append(entries, shared.LogEntry{Err: io.EOF})
+	close(out)
+	res := make(chan model.QueryRangeOutput)
+	go (&QueryRangeService{}).exportStreamsValue(out, res, categorizeLabels, stats)
+	var str strings.Builder
+	for r := range res {
+		str.WriteString(r.Str)
+	}
+	return str.String()
+}
+
+func TestExportStreamsCategorizeLabels(t *testing.T) {
+	entry := shared.LogEntry{
+		TimestampNS:        1000,
+		Fingerprint:        1,
+		Labels:             map[string]string{"trace_id": "4bf92f35"},
+		Message:            "GET /",
+		StructuredMetadata: map[string]string{"trace_id": "4bf92f35"},
+	}
+	str := exportStreams(true, entry)
+	for _, part := range []string{
+		`"encodingFlags":["categorize-labels"]`,
+		`"stream":{}`,
+		`["1000","GET /",{"structuredMetadata":{"trace_id":"4bf92f35"}}]`,
+	} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %s in %s", part, str)
+		}
+	}
+
+	str = exportStreams(false, entry)
+	if strings.Contains(str, "encodingFlags") || strings.Contains(str, "structuredMetadata") ||
+		!strings.Contains(str, `"stream":{"trace_id":"4bf92f35"}`) ||
+		!strings.Contains(str, `"values":[["1000","GET /"]]`) {
+		t.Errorf("structured metadata must be part of the stream labels: %s", str)
+	}
+}
+
+func TestExportStreamsKeepsStreamsWithStructuredMetadata(t *testing.T) {
+	entry := func(ts int64, traceID string) shared.LogEntry {
+		return shared.LogEntry{
+			TimestampNS:        ts,
+			Fingerprint:        1,
+			Labels:             map[string]string{"app": "api", "trace_id": traceID},
+			Message:            "GET /",
+			StructuredMetadata: map[string]string{"trace_id": traceID},
+		}
+	}
+	str := exportStreams(true, entry(2000, "b"), entry(1000, "a"))
+	if n := strings.Count(str, `"stream":`); n != 1 {
+		t.Errorf("got %d streams, want 1: %s", n, str)
+	}
+	for _, part := range []string{
+		`"stream":{"app":"api"}`,
+		`["2000","GET /",{"structuredMetadata":{"trace_id":"b"}}]`,
+		`["1000","GET /",{"structuredMetadata":{"trace_id":"a"}}]`,
+	} {
+		if !strings.Contains(str, part) {
+			t.Errorf("expected %s in %s", part, str)
+		}
+	}
+}
+
+func TestExportStreamsMergesStructuredMetadata(t *testing.T) {
+	entry := func(ts int64, traceID string) shared.LogEntry {
+		return shared.LogEntry{
+			TimestampNS:        ts,
+			Fingerprint:        1,
+			Labels:             map[string]string{"trace_id": traceID},
+			Message:            "GET /",
+			StructuredMetadata: map[string]string{"trace_id": traceID},
+		}
+	}
+	str := exportStreams(false, entry(3000, "b"), entry(2000, "b"), entry(1000, "a"))
+	var res struct {
+		Data struct {
+			Result []struct {
+				Stream map[string]string
+				Values [][]string
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		t.Fatalf("%v: %s", err, str)
+	}
+	if len(res.Data.Result) != 2 {
+		t.Fatalf("got %d streams, want 2: %s", len(res.Data.Result), str)
+	}
+	for i, want := range []struct {
+		traceID string
+		values  int
+	}{{"b", 2}, {"a", 1}} {
+		r := res.Data.Result[i]
+		if r.Stream["trace_id"] != want.traceID || len(r.Values) != want.values {
+			t.Errorf("stream %d = %v %v", i, r.Stream, r.Values)
+		}
+		for _, v := range r.Values {
+			if len(v) != 2 {
+				t.Errorf("values must be [ts, line] pairs: %s", str)
+			}
+		}
+	}
+}
+
+func TestSplitStructuredMetadataKeepsOverwrittenLabels(t *testing.T) {
+	labels, structuredMetadata := splitStructuredMetadata(&shared.LogEntry{
+		Labels:             map[string]string{"app": "api", "user": "alice", "trace_id": "4bf92f35"},
+		StructuredMetadata: map[string]string{"user": "bob", "trace_id": "4bf92f35", "span_id": "00f067aa"},
+	})
+	if len(labels) != 2 || labels["app"] != "api" || labels["user"] != "alice" {
+		t.Errorf("labels = %v", labels)
+	}
+	if len(structuredMetadata) != 1 || structuredMetadata["trace_id"] != "4bf92f35" {
+		t.Errorf("structured metadata = %v", structuredMetadata)
+	}
+}
+
+func TestExportStreamsStats(t *testing.T) {
+	_, stats := querystats.NewContext(context.Background())
+	str := exportStreamsStats(false, stats,
+		shared.LogEntry{TimestampNS: 2000, Fingerprint: 1, Labels: map[string]string{"app": "a"}, Message: "b"},
+		shared.LogEntry{TimestampNS: 1000, Fingerprint: 1, Labels: map[string]string{"app": "a"}, Message: "a"},
+		shared.LogEntry{TimestampNS: 1000, Fingerprint: 2, Labels: map[string]string{"app": "b"}, Message: "c"},
+	)
+	var res struct {
+		Data struct {
+			Result []any
+			Stats  struct {
+				Summary map[string]float64
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(str), &res); err != nil {
+		t.Fatalf("%v: %s", err, str)
+	}
+	if len(res.Data.Result) != 2 || res.Data.Stats.Summary["totalEntriesReturned"] != 3 {
+		t.Errorf("unexpected response %s", str)
+	}
+	if _, ok := res.Data.Stats.Summary["execTime"]; !ok {
+		t.Errorf("no execTime in %s", str)
+	}
+	if sum := stats.Summary(); sum.Series != 2 {
+		t.Errorf("series = %d, want 2", sum.Series)
+	}
+
+	if str := exportStreams(false); strings.Contains(str, "stats") {
+		t.Errorf("stats written without collection: %s", str)
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_parser"
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+	sql "github.com/metrico/qryn/v5/reader/utils/sql_select"
+)
+
+const defaultSplitParallelism = 4
+
+// SplitConfig configures the time split of the LogQL range metric queries. A
+// zero Interval disables it.
+type SplitConfig struct {
+	// Interval is the length of the sub-queries. Their bounds are aligned to
+	// the multiples of Interval, snapped to the steps of the query.
+	Interval time.Duration
+	// Parallelism is the maximum number of sub-queries of a query running at
+	// once.
+	Parallelism int
+	// Timeout bounds every sub-query, ClickHouse gets it as
+	// max_execution_time. Zero means no bound.
+	Timeout time.Duration
+}
+
+// SplitConfigFromEnv reads the split configuration from
+// QRYN_QUERY_SPLIT_INTERVAL, QRYN_QUERY_SPLIT_PARALLELISM and
+// QRYN_QUERY_SPLIT_TIMEOUT.
+func SplitConfigFromEnv() SplitConfig {
+	cfg := SplitConfig{Parallelism: defaultSplitParallelism}
+	for name, dst := range map[string]*time.Duration{
+		"QRYN_QUERY_SPLIT_INTERVAL": &cfg.Interval,
+		"QRYN_QUERY_SPLIT_TIMEOUT":  &cfg.Timeout,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			logger.Error("Invalid ", name, " value: ", v)
+			continue
+		}
+		*dst = d
+	}
+	if v := os.Getenv("QRYN_QUERY_SPLIT_PARALLELISM"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p <= 0 {
+			logger.Error("Invalid QRYN_QUERY_SPLIT_PARALLELISM value: ", v)
+		} else {
+			cfg.Parallelism = p
+		}
+	}
+	return cfg
+}
+
+// splitInterval is the range of the steps of a sub-query, both ends included.
+type splitInterval struct {
+	From time.Time
+	To   time.Time
+}
+
+// splitIntervals splits the steps from..to into intervals bounded by the
+// multiples of interval. Every bound is moved forward to the next step, so
+// every step belongs to exactly one interval and keeps its timestamp.
+func splitIntervals(from, to time.Time, step, interval time.Duration) []splitInterval {
+	if step <= 0 || interval <= 0 || !to.After(from) {
+		return []splitInterval{{from, to}}
+	}
+	var res []splitInterval
+	start := from
+	for bound := from.Truncate(interval).Add(interval); !bound.After(to); bound = bound.Add(interval) {
+		steps := (bound.Sub(from) + step - 1) / step
+		next := from.Add(steps * step)
+		if !next.After(start) {
+			continue
+		}
+		if next.After(to) {
+			break
+		}
+		res = append(res, splitInterval{start, next.Add(-step)})
+		start = next
+	}
+	return append(res, splitInterval{start, to})
+}
+
+// shouldSplit reports if the range of a metric query is worth splitting.
+func (c SplitConfig) shouldSplit(query string, from, to time.Time, step time.Duration) bool {
+	if c.Interval <= 0 || step <= 0 || to.Sub(from) <= c.Interval {
+		return false
+	}
+	return !sortsSeries(query)
+}
+
+// sortsSeries reports if the series of a metric query are ordered by sort()
+// or sort_desc(). They are ordered by their latest sample, which only a query
+// over the whole range knows. Unparsable queries are reported as sorted.
+func sortsSeries(query string) bool {
+	script, err := logql_parser.Parse(query)
+	return err != nil || !script.IsBinary() && script.Head.Sort != nil
+}
+
+// splitQuery runs a range metric query as sub-queries over consecutive time
+// intervals, at most cfg.Parallelism at once. Every sub-query is planned anew
+// by plan, the planners keep per request state. The series of an interval are
+// sent as soon as it and all the earlier intervals are done, so the samples
+// come in time order and a series spanning several intervals is sent once per
+// interval.
+//
+// The steps of the sub-queries do not overlap and every step computes its
+// range aggregation over its own lookback window, so the range aggregations
+// crossing the bound of two intervals read the data they need from both and
+// the samples of the intervals only need to be concatenated.
+func splitQuery(ctx *shared.PlannerContext, cfg SplitConfig,
+	plan func() (shared.RequestProcessorChain, error),
+) (chan []shared.LogEntry, error) {
+	intervals := splitIntervals(ctx.From, ctx.To, ctx.Step, cfg.Interval)
+	chains := make([]shared.RequestProcessorChain, len(intervals))
+	for i := range intervals {
+		var err error
+		if chains[i], err = plan(); err != nil {
+			return nil, err
+		}
+	}
+
+	parallelism := cfg.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultSplitParallelism
+	}
+	subCtx, cancel := context.WithCancel(ctx.Ctx)
+	results := make([][][]shared.LogEntry, len(intervals))
+	errs := make([]error, len(intervals))
+	done := make([]chan struct{}, len(intervals))
+	sem := make(chan struct{}, parallelism)
+	for i := range intervals {
+		done[i] = make(chan struct{})
+		go func(i int) {
+			defer close(done[i])
+			select {
+			case sem <- struct{}{}:
+			case <-subCtx.Done():
+				errs[i] = subCtx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			results[i], errs[i] = runInterval(subCtx, ctx, cfg, intervals[i], chains[i])
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+
+	res := make(chan []shared.LogEntry)
+	go func() {
+		defer close(res)
+		defer cancel()
+		defer func() { shared.TamePanic(res) }()
+		for i := range intervals {
+			<-done[i]
+			if errs[i] != nil {
+				res <- []shared.LogEntry{{Err: firstSplitError(errs, done)}}
+				return
+			}
+			for _, series := range results[i] {
+				res <- series
+			}
+			results[i] = nil
+		}
+		res <- []shared.LogEntry{{Err: io.EOF}}
+	}()
+	return res, nil
+}
+
+// firstSplitError waits for the sub-queries and returns the error failing the
+// query. The sub-queries cancelled after the first error report the
+// cancellation.
+func firstSplitError(errs []error, done []chan struct{}) error {
+	var err error
+	for i := range errs {
+		<-done[i]
+		if e := errs[i]; e != nil && (err == nil || errors.Is(err, context.Canceled)) {
+			err = e
+		}
+	}
+	return err
+}
+
+// runInterval runs the sub-query of an interval and returns its series.
+func runInterval(ctx context.Context, parent *shared.PlannerContext, cfg SplitConfig, interval splitInterval,
+	chain shared.RequestProcessorChain,
+) ([][]shared.LogEntry, error) {
+	var cancel context.CancelFunc
+	if cfg.Timeout > 0 {
+		// the driver sends the deadline to ClickHouse as max_execution_time
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	_ctx := *parent
+	_ctx.From, _ctx.To = interval.From, interval.To
+	_ctx.Ctx, _ctx.CancelCtx = ctx, cancel
+	_ctx.CHSqlCtx = &sql.Ctx{
+		Params: map[string]sql.SQLObject{},
+		Result: map[string]sql.SQLObject{},
+	}
+	out, err := chain[0].Process(&_ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return shared.DrainSeries(out)
+}
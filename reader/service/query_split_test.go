@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
+)
+
+// stepsProcessor returns two series with a sample at every step of the
+// requested range, the value of a sample is its timestamp in seconds.
+type stepsProcessor struct {
+	running  *int32
+	peak     *int32
+	err      error
+	deadline *atomic.Bool
+}
+
+func (s *stepsProcessor) IsMatrix() bool { return true }
+
+func (s *stepsProcessor) Process(ctx *shared.PlannerContext, _ chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	if s.running != nil {
+		n := atomic.AddInt32(s.running, 1)
+		defer atomic.AddInt32(s.running, -1)
+		for p := atomic.LoadInt32(s.peak); n > p && !atomic.CompareAndSwapInt32(s.peak, p, n); {
+			p = atomic.LoadInt32(s.peak)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := ctx.Ctx.Deadline(); ok && s.deadline != nil {
+		s.deadline.Store(true)
+	}
+	out := make(chan []shared.LogEntry, 3)
+	if s.err != nil {
+		out <- []shared.LogEntry{{Err: s.err}}
+		close(out)
+		return out, nil
+	}
+	for fp := uint64(1); fp <= 2; fp++ {
+		var entries []shared.LogEntry
+		for ts := ctx.From; !ts.After(ctx.To); ts = ts.Add(ctx.Step) {
+			entries = append(entries, shared.LogEntry{
+				TimestampNS: ts.UnixNano(),
+				Fingerprint: fp,
+				Labels:      map[string]string{"fp": string(rune('0' + fp))},
+				Value:       float64(ts.Unix()),
+			})
+		}
+		out <- entries
+	}
+	out <- []shared.LogEntry{{Err: io.EOF}}
+	close(out)
+	return out, nil
+}
+
+func TestSplitIntervals(t *testing.T) {
+	from := time.Unix(3600*10+7, 0)
+	to := from.Add(72 * time.Hour)
+	step := 13 * time.Second
+	intervals := splitIntervals(from, to, step, 24*time.Hour)
+	if len(intervals) != 4 {
+		t.Fatalf("got %d intervals: %v", len(intervals), intervals)
+	}
+	next := from
+	for i, interval := range intervals {
+		if !interval.From.Equal(next) || interval.To.Before(interval.From) {
+			t.Fatalf("interval %d = %v, want to start at %v", i, interval, next)
+		}
+		last := i == len(intervals)-1
+		if interval.From.Sub(from)%step != 0 || !last && interval.To.Sub(from)%step != 0 {
+			t.Errorf("interval %d = %v is not aligned to the steps", i, interval)
+		}
+		if i > 0 && interval.From.Add(-step).Truncate(24*time.Hour) == interval.From.Truncate(24*time.Hour) {
+			t.Errorf("interval %d = %v does not start at the first step of a day", i, interval)
+		}
+		next = interval.To.Add(step)
+	}
+	if !intervals[len(intervals)-1].To.Equal(to) {
+		t.Errorf("last interval ends at %v, want %v", intervals[len(intervals)-1].To, to)
+	}
+
+	// steps longer than the interval
+	intervals = splitIntervals(from, from.Add(time.Hour), 25*time.Minute, 10*time.Minute)
+	want := []splitInterval{
+		{from, from},
+		{from.Add(25 * time.Minute), from.Add(25 * time.Minute)},
+		{from.Add(50 * time.Minute), from.Add(time.Hour)},
+	}
+	if !reflect.DeepEqual(intervals, want) {
+		t.Errorf("splitIntervals() = %v, want %v", intervals, want)
+	}
+}
+
+func TestSplitQuery(t *testing.T) {
+	ctx := &shared.PlannerContext{
+		Ctx:  context.Background(),
+		From: time.Unix(3600*5, 0),
+		To:   time.Unix(3600*5+10*24*3600, 0),
+		Step: 7 * time.Minute,
+	}
+	unsplit, err := (&stepsProcessor{}).Process(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := shared.DrainSeries(unsplit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var running, peak int32
+	deadline := &atomic.Bool{}
+	cfg := SplitConfig{Interval: 24 * time.Hour, Parallelism: 3, Timeout: time.Minute}
+	out, err := splitQuery(ctx, cfg, func() (shared.RequestProcessorChain, error) {
+		return shared.RequestProcessorChain{&stepsProcessor{running: &running, peak: &peak, deadline: deadline}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := shared.DrainSeries(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("the split query returned other samples than the unsplit one")
+	}
+	if peak > 3 || peak < 2 {
+		t.Errorf("%d sub-queries ran at once, want up to 3", peak)
+	}
+	if !deadline.Load() {
+		t.Error("the sub-queries have no deadline")
+	}
+
+	errTest := errors.New("test")
+	out, err = splitQuery(ctx, cfg, func() (shared.RequestProcessorChain, error) {
+		return shared.RequestProcessorChain{&stepsProcessor{err: errTest}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shared.DrainSeries(out); !errors.Is(err, errTest) {
+		t.Errorf("got error %v, want %v", err, errTest)
+	}
+}
+
+// blockingProcessor holds the sub-query of the interval ending at last until
+// release is closed.
+type blockingProcessor struct {
+	stepsProcessor
+	last    time.Time
+	release chan struct{}
+}
+
+func (b *blockingProcessor) Process(ctx *shared.PlannerContext, in chan []shared.LogEntry) (chan []shared.LogEntry, error) {
+	if ctx.To.Equal(b.last) {
+		<-b.release
+	}
+	return b.stepsProcessor.Process(ctx, in)
+}
+
+func TestSplitQueryStreamsIntervals(t *testing.T) {
+	ctx := &shared.PlannerContext{
+		Ctx:  context.Background(),
+		From: time.Unix(0, 0),
+		To:   time.Unix(3*24*3600, 0),
+		Step: time.Hour,
+	}
+	release := make(chan struct{})
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+	out, err := splitQuery(ctx, SplitConfig{Interval: 24 * time.Hour}, func() (shared.RequestProcessorChain, error) {
+		return shared.RequestProcessorChain{&blockingProcessor{last: ctx.To, release: release}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case entries := <-out:
+		if entries[0].Err != nil || entries[0].TimestampNS != ctx.From.UnixNano() {
+			t.Fatalf("the first interval must come first, got %+v", entries[0])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first interval is held until the last one is done")
+	}
+	close(release)
+
+	var last int64
+	for entries := range out {
+		for _, e := range entries {
+			if e.Err != nil {
+				if !errors.Is(e.Err, io.EOF) {
+					t.Fatal(e.Err)
+				}
+				continue
+			}
+			if e.Fingerprint == 1 && e.TimestampNS <= last {
+				t.Fatalf("sample at %d sent after %d", e.TimestampNS, last)
+			}
+			if e.Fingerprint == 1 {
+				last = e.TimestampNS
+			}
+		}
+	}
+	if last != ctx.To.UnixNano() {
+		t.Errorf("the last sample is at %d, want %d", last, ctx.To.UnixNano())
+	}
+}
+
+func TestShouldSplit(t *testing.T) {
+	cfg := SplitConfig{Interval: 24 * time.Hour}
+	from := time.Unix(0, 0)
+	for query, want := range map[string]bool{
+		`sum by (level) (count_over_time({app="x"}[1m]))`:              true,
+		`sort(sum by (level) (count_over_time({app="x"}[1m])))`:        false,
+		`sort(rate({app="x"}[1m])) / rate({app="y"}[1m])`:              true,
+		`sum by (level) (count_over_time({app="x"}[1m])) or vector(0)`: true,
+	} {
+		if got := cfg.shouldSplit(query, from, from.Add(7*24*time.Hour), time.Minute); got != want {
+			t.Errorf("shouldSplit(%s) = %v, want %v", query, got, want)
+		}
+	}
+	if cfg.shouldSplit(`rate({app="x"}[1m])`, from, from.Add(time.Hour), time.Minute) {
+		t.Error("a range shorter than the interval must not be split")
+	}
+	if (SplitConfig{}).shouldSplit(`rate({app="x"}[1m])`, from, from.Add(7*24*time.Hour), time.Minute) {
+		t.Error("the split is disabled by default")
+	}
+}
+
+func TestSplitConfigFromEnv(t *testing.T) {
+	t.Setenv("QRYN_QUERY_SPLIT_INTERVAL", "24h")
+	t.Setenv("QRYN_QUERY_SPLIT_PARALLELISM", "8")
+	t.Setenv("QRYN_QUERY_SPLIT_TIMEOUT", "bad")
+	want := SplitConfig{Interval: 24 * time.Hour, Parallelism: 8}
+	if got := SplitConfigFromEnv(); got != want {
+		t.Errorf("SplitConfigFromEnv() = %+v, want %+v", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/traceql/traceql_parser"
 	"github.com/metrico/qryn/v5/reader/traceql/traceql_transpiler/clickhouse_transpiler"
+	"github.com/metrico/qryn/v5/reader/utils/sql_select"
 )
 
 func Plan(script *traceql_parser.TraceQLScript) (shared.TraceRequestProcessor, error) {
@@ -26,6 +27,36 @@ func Plan(script *traceql_parser.TraceQLScript) (shared.TraceRequestProcessor, e
 	}, nil
 }
 
+// Explain records in ctx.Explain the SQL requests of a TraceQL search without
+// running them: the complexity evaluation and the search. Searches above
+// COMPLEXITY_THRESHOLD run the search request once per portion of the traces.
+// It returns the planner chain of the search.
+func Explain(script *traceql_parser.TraceQLScript, ctx *shared.PlannerContext) (string, error) {
+	sqlPlanner, err := clickhouse_transpiler.Plan(script)
+	if err != nil {
+		return "", err
+	}
+	complexityPlanner, err := clickhouse_transpiler.PlanEval(script)
+	if err != nil {
+		return "", err
+	}
+	for _, planner := range []shared.SQLRequestPlanner{complexityPlanner, sqlPlanner} {
+		req, err := planner.Process(ctx)
+		if err != nil {
+			return "", err
+		}
+		strReq, err := req.String(&sql_select.Ctx{
+			Params: map[string]sql_select.SQLObject{},
+			Result: map[string]sql_select.SQLObject{},
+		})
+		if err != nil {
+			return "", err
+		}
+		ctx.Explain.AddStep(planner, strReq)
+	}
+	return shared.DescribePlanner([]shared.SQLRequestPlanner{complexityPlanner, sqlPlanner}), nil
+}
+
 func PlanTagsV2(script *traceql_parser.TraceQLScript) (shared.GenericTraceRequestProcessor[string], error) {
 	if script == nil {
 		return &allTagsV2RequestProcessor{}, nil
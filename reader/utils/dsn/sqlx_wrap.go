@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/metrico/qryn/v5/reader/utils/querystats"
 )
 
 type StableSqlxDBWrapper struct {
@@ -34,6 +35,7 @@ func (s *StableSqlxDBWrapper) Query(query string, args ...any) (*sql.Rows, error
 }
 
 func (s *StableSqlxDBWrapper) QueryCtx(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx = querystats.ClickhouseContext(ctx)
 	res, err := func() (*sql.Rows, error) {
 		s.mtx.RLock()
 		defer s.mtx.RUnlock()
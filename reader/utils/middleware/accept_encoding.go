@@ -31,6 +31,9 @@ type gzipResponseWriter struct {
 	codeSet   bool
 	written   int
 	preBuffer bytes.Buffer
+	// encoded is set if the handler encoded the response itself, it is then
+	// sent as it is
+	encoded bool
 }
 
 func newGzipResponseWriter(w http.ResponseWriter) *gzipResponseWriter {
@@ -57,8 +60,9 @@ func (gzw *gzipResponseWriter) WriteHeader(code int) {
 	}
 	gzw.codeSet = true
 	gzw.code = code
+	gzw.encoded = gzw.Header().Get("Content-Encoding") != ""
 	ensureSafeContentType(gzw.Header())
-	if gzw.code/100 == 2 {
+	if gzw.code/100 == 2 && !gzw.encoded {
 		gzw.Header().Set("Content-Encoding", "gzip")
 	} else {
 		gzw.ResponseWriter.WriteHeader(code)
@@ -67,8 +71,11 @@ func (gzw *gzipResponseWriter) WriteHeader(code int) {
 }
 
 func (gzw *gzipResponseWriter) Write(b []byte) (int, error) {
-	gzw.codeSet = true
-	if gzw.code/100 == 2 {
+	if !gzw.codeSet {
+		gzw.codeSet = true
+		gzw.encoded = gzw.Header().Get("Content-Encoding") != ""
+	}
+	if gzw.code/100 == 2 && !gzw.encoded {
 		gzw.Header().Set("Content-Encoding", "gzip")
 		gzw.written += len(b)
 		return gzw.Writer.Write(b)
@@ -76,11 +83,22 @@ func (gzw *gzipResponseWriter) Write(b []byte) (int, error) {
 	return gzw.ResponseWriter.Write(b)
 }
 
+// Flush sends the data written so far of the responses sent as they are, the
+// compressed responses are sent on Close.
+func (gzw *gzipResponseWriter) Flush() {
+	if !gzw.encoded {
+		return
+	}
+	if f, ok := gzw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (gzw *gzipResponseWriter) Close() {
 	if gzw.written > 0 {
 		gzw.Writer.Close()
 	}
-	if gzw.code/100 != 2 {
+	if gzw.code/100 != 2 || gzw.encoded {
 		return
 	}
 	// Covers the implicit-200 path where the handler wrote a body without ever
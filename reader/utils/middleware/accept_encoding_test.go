@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptEncodingMiddleware_Encoded(t *testing.T) {
+	h := AcceptEncodingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "snappy")
+		w.Write([]byte("frame"))
+		w.(http.Flusher).Flush()
+	}))
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(rec, r)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "snappy" {
+		t.Errorf("Content-Encoding = %q, want snappy", got)
+	}
+	if rec.Body.String() != "frame" {
+		t.Errorf("body = %q, want the response as it is", rec.Body.String())
+	}
+	if !rec.Flushed {
+		t.Error("the response is not flushed")
+	}
+}
@@ -56,6 +56,12 @@ func (w *responseWriterWithCode) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return h.Hijack()
 }
 
+func (w *responseWriterWithCode) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func (w *responseWriterWithCode) WriteHeader(code int) {
 	ensureSafeContentType(w.Header())
 	w.statusCode = code
@@ -0,0 +1,47 @@
+package querystats
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "query_duration_seconds",
+		Help:    "The duration of the queries",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"api"})
+	QueryRowsRead = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "query_rows_read",
+		Help:    "The number of rows read by ClickHouse per query",
+		Buckets: prometheus.ExponentialBuckets(1000, 10, 7),
+	}, []string{"api"})
+	QueryBytesRead = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "query_bytes_read",
+		Help:    "The number of bytes read by ClickHouse per query",
+		Buckets: prometheus.ExponentialBuckets(64*1024, 8, 7),
+	}, []string{"api"})
+	QuerySubqueries = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "query_subqueries",
+		Help:    "The number of ClickHouse requests per query",
+		Buckets: []float64{1, 2, 4, 8, 16, 32},
+	}, []string{"api"})
+	QuerySeries = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "query_series",
+		Help:    "The number of series or streams returned per query",
+		Buckets: prometheus.ExponentialBuckets(1, 10, 6),
+	}, []string{"api"})
+)
+
+// Finish stops the "total" timing, exports the statistics of the query to the
+// histograms labelled by api and returns them.
+func (s *Stats) Finish(api string) Summary {
+	s.EndTiming("total")
+	res := s.Summary()
+	QueryDuration.WithLabelValues(api).Observe(res.TotalTime)
+	QueryRowsRead.WithLabelValues(api).Observe(float64(res.RowsRead))
+	QueryBytesRead.WithLabelValues(api).Observe(float64(res.BytesRead))
+	QuerySubqueries.WithLabelValues(api).Observe(float64(res.Subqueries))
+	QuerySeries.WithLabelValues(api).Observe(float64(res.Series))
+	return res
+}
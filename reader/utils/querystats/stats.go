@@ -0,0 +1,140 @@
+package querystats
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+type contextKey struct{}
+
+// Stats collects the statistics of a single query: the timings of its stages
+// and the progress ClickHouse reports for the requests it runs. A Stats is
+// carried by the context of the request, every ClickHouse request run with
+// that context is accounted in it.
+type Stats struct {
+	Starts  map[string]time.Time
+	Ends    map[string]time.Time
+	Counter int32
+	Mtx     sync.Mutex
+
+	subqueries int64
+	rowsRead   uint64
+	bytesRead  uint64
+	resultRows uint64
+	execTime   int64
+	series     int64
+}
+
+// Summary is the snapshot of Stats returned to the clients.
+type Summary struct {
+	// Subqueries is the number of ClickHouse requests
+	Subqueries int64 `json:"subqueries"`
+	// RowsRead and BytesRead are read by ClickHouse, over all the requests
+	RowsRead  uint64 `json:"rowsRead"`
+	BytesRead uint64 `json:"bytesRead"`
+	// ResultRows is the number of rows returned by ClickHouse
+	ResultRows uint64 `json:"resultRows"`
+	// Series is the number of series or streams in the response
+	Series int64 `json:"series"`
+	// ExecTime is the time in seconds ClickHouse spent running the requests,
+	// only reported over the native protocol
+	ExecTime float64 `json:"execTime"`
+	// TotalTime is the time in seconds from the start of the query
+	TotalTime float64 `json:"totalTime"`
+}
+
+func New() *Stats {
+	return &Stats{
+		Starts:  make(map[string]time.Time),
+		Ends:    make(map[string]time.Time),
+		Mtx:     sync.Mutex{},
+		Counter: 1,
+	}
+}
+
+// NewContext returns a context carrying a new Stats which starts the "total"
+// timing.
+func NewContext(ctx context.Context) (context.Context, *Stats) {
+	s := New()
+	s.StartTiming("total")
+	return context.WithValue(ctx, contextKey{}, s), s
+}
+
+// FromContext returns the Stats of ctx or nil.
+func FromContext(ctx context.Context) *Stats {
+	s, _ := ctx.Value(contextKey{}).(*Stats)
+	return s
+}
+
+// ClickhouseContext returns ctx with the ClickHouse callbacks filling s. If
+// ctx carries no Stats it is returned as is.
+func ClickhouseContext(ctx context.Context) context.Context {
+	s := FromContext(ctx)
+	if s == nil {
+		return ctx
+	}
+	atomic.AddInt64(&s.subqueries, 1)
+	return clickhouse.Context(ctx,
+		clickhouse.WithProgress(func(p *clickhouse.Progress) {
+			// the progress packets carry the increments since the previous one
+			atomic.AddUint64(&s.rowsRead, p.Rows)
+			atomic.AddUint64(&s.bytesRead, p.Bytes)
+			atomic.AddInt64(&s.execTime, int64(p.Elapsed))
+		}),
+		clickhouse.WithProfileInfo(func(p *clickhouse.ProfileInfo) {
+			atomic.AddUint64(&s.resultRows, p.Rows)
+		}))
+}
+
+func (s *Stats) StartTiming(key string) {
+	s.Mtx.Lock()
+	defer s.Mtx.Unlock()
+	s.Starts[key] = time.Now()
+}
+
+func (s *Stats) EndTiming(key string) {
+	s.Mtx.Lock()
+	defer s.Mtx.Unlock()
+	s.Ends[key] = time.Now()
+}
+
+func (s *Stats) Id() int32 {
+	return atomic.AddInt32(&s.Counter, 1)
+}
+
+func (s *Stats) AsMap() map[string]float64 {
+	s.Mtx.Lock()
+	defer s.Mtx.Unlock()
+	res := make(map[string]float64)
+	for k, start := range s.Starts {
+		end := time.Now()
+		if _, ok := s.Ends[k]; ok {
+			end = s.Ends[k]
+		}
+		dist := end.Sub(start)
+		res[k] = dist.Seconds()
+	}
+	return res
+}
+
+// AddSeries accounts n series or streams of the response.
+func (s *Stats) AddSeries(n int) {
+	atomic.AddInt64(&s.series, int64(n))
+}
+
+// Summary returns the statistics collected so far.
+func (s *Stats) Summary() Summary {
+	return Summary{
+		Subqueries: atomic.LoadInt64(&s.subqueries),
+		RowsRead:   atomic.LoadUint64(&s.rowsRead),
+		BytesRead:  atomic.LoadUint64(&s.bytesRead),
+		ResultRows: atomic.LoadUint64(&s.resultRows),
+		Series:     atomic.LoadInt64(&s.series),
+		ExecTime:   time.Duration(atomic.LoadInt64(&s.execTime)).Seconds(),
+		TotalTime:  s.AsMap()["total"],
+	}
+}
@@ -0,0 +1,170 @@
+package resultscache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testBackend(t *testing.T, b Backend) {
+	ctx := context.Background()
+	if _, ok, err := b.Get(ctx, "k1"); ok || err != nil {
+		t.Fatalf("Get() of a missing key = %v, %v", ok, err)
+	}
+	value := []byte("value\r\nEND\r\n")
+	if err := b.Set(ctx, "k1", value, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		res, ok, err := b.Get(ctx, "k1")
+		if err != nil || !ok || string(res) != string(value) {
+			t.Fatalf("Get() = %q, %v, %v", res, ok, err)
+		}
+	}
+}
+
+func TestLRU(t *testing.T) {
+	testBackend(t, NewLRU(1024))
+
+	l := NewLRU(10)
+	ctx := context.Background()
+	l.Set(ctx, "a", []byte("1234"), time.Minute)
+	l.Set(ctx, "b", []byte("1234"), time.Minute)
+	l.Get(ctx, "a")
+	l.Set(ctx, "c", []byte("1234"), time.Minute)
+	if _, ok, _ := l.Get(ctx, "b"); ok {
+		t.Error("the least recently used entry is not evicted")
+	}
+	if _, ok, _ := l.Get(ctx, "a"); !ok {
+		t.Error("a recently used entry is evicted")
+	}
+	l.Set(ctx, "d", []byte("1234"), -time.Second)
+	if _, ok, _ := l.Get(ctx, "d"); ok {
+		t.Error("an expired entry is returned")
+	}
+}
+
+// fakeServer serves the connections with handle, storing the values in
+// store.
+type fakeServer struct {
+	mtx   sync.Mutex
+	store map[string]string
+	ln    net.Listener
+}
+
+func newFakeServer(t *testing.T, handle func(s *fakeServer, r *bufio.Reader, w *bufio.Writer) error) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	s := &fakeServer{store: map[string]string{}, ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r, w := bufio.NewReader(c), bufio.NewWriter(c)
+				for handle(s, r, w) == nil && w.Flush() == nil {
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+func memcachedHandler(s *fakeServer, r *bufio.Reader, w *bufio.Writer) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	switch fields[0] {
+	case "get":
+		if v, ok := s.store[fields[1]]; ok {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+		}
+		w.WriteString("END\r\n")
+	case "set":
+		size, _ := strconv.Atoi(fields[4])
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		s.store[fields[1]] = string(buf[:size])
+		w.WriteString("STORED\r\n")
+	}
+	return nil
+}
+
+func redisHandler(s *fakeServer, r *bufio.Reader, w *bufio.Writer) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		args[i] = string(buf[:size])
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	switch args[0] {
+	case "AUTH":
+		if args[1] != "secret" {
+			w.WriteString("-ERR invalid password\r\n")
+			return nil
+		}
+		w.WriteString("+OK\r\n")
+	case "GET":
+		v, ok := s.store[args[1]]
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		if len(args) != 5 || args[3] != "PX" {
+			w.WriteString("-ERR syntax error\r\n")
+			return nil
+		}
+		s.store[args[1]] = args[2]
+		w.WriteString("+OK\r\n")
+	}
+	return nil
+}
+
+func TestMemcached(t *testing.T) {
+	s := newFakeServer(t, memcachedHandler)
+	testBackend(t, NewMemcached(s.ln.Addr().String()))
+}
+
+func TestRedis(t *testing.T) {
+	s := newFakeServer(t, redisHandler)
+	testBackend(t, NewRedis(s.ln.Addr().String(), "secret"))
+
+	if err := NewRedis(s.ln.Addr().String(), "wrong").Set(context.Background(), "k", nil, time.Minute); err == nil {
+		t.Error("a wrong password is accepted")
+	}
+}
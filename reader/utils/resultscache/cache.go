@@ -0,0 +1,137 @@
+package resultscache
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+)
+
+const (
+	defaultMaxSizeMB    = 256
+	defaultTTL          = 24 * time.Hour
+	defaultInterval     = 24 * time.Hour
+	defaultMaxFreshness = 10 * time.Minute
+)
+
+// Backend stores the encoded extents of the cache keys. A failing backend
+// only makes the cache miss, its errors never fail a query.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Config configures the results cache. An empty Backend disables it.
+type Config struct {
+	// Backend is "lru", "memcached" or "redis"
+	Backend string
+	// Address is the host:port of the memcached or redis server
+	Address string
+	// Password authenticates the redis connections
+	Password string
+	// MaxSizeMB caps the memory of the lru backend
+	MaxSizeMB int
+	// TTL is the expiration of the cached extents
+	TTL time.Duration
+	// Interval is the time range covered by a cache key
+	Interval time.Duration
+	// MaxFreshness is the age below which the results are never cached, the
+	// latest samples may still be missing
+	MaxFreshness time.Duration
+}
+
+// ConfigFromEnv reads the results cache configuration from the
+// QRYN_RESULTS_CACHE* environment variables.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:      os.Getenv("QRYN_RESULTS_CACHE"),
+		Address:      os.Getenv("QRYN_RESULTS_CACHE_ADDRESS"),
+		Password:     os.Getenv("QRYN_RESULTS_CACHE_PASSWORD"),
+		MaxSizeMB:    defaultMaxSizeMB,
+		TTL:          defaultTTL,
+		Interval:     defaultInterval,
+		MaxFreshness: defaultMaxFreshness,
+	}
+	for name, dst := range map[string]*time.Duration{
+		"QRYN_RESULTS_CACHE_TTL":           &cfg.TTL,
+		"QRYN_RESULTS_CACHE_INTERVAL":      &cfg.Interval,
+		"QRYN_RESULTS_CACHE_MAX_FRESHNESS": &cfg.MaxFreshness,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			logger.Error("Invalid ", name, " value: ", v)
+			continue
+		}
+		*dst = d
+	}
+	if v := os.Getenv("QRYN_RESULTS_CACHE_MAX_SIZE_MB"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			logger.Error("Invalid QRYN_RESULTS_CACHE_MAX_SIZE_MB value: ", v)
+		} else {
+			cfg.MaxSizeMB = size
+		}
+	}
+	return cfg
+}
+
+// Cache is a step aligned cache of the results of the range queries. It
+// returns nil if the cache is disabled, a nil Cache runs every query as is.
+type Cache struct {
+	cfg     Config
+	backend Backend
+	now     func() time.Time
+}
+
+// New creates the Cache configured by cfg. It returns nil if the cache is
+// disabled or misconfigured.
+func New(cfg Config) *Cache {
+	var backend Backend
+	switch cfg.Backend {
+	case "":
+		return nil
+	case "lru":
+		backend = NewLRU(int64(cfg.MaxSizeMB) * 1024 * 1024)
+	case "memcached":
+		backend = NewMemcached(cfg.Address)
+	case "redis":
+		backend = NewRedis(cfg.Address, cfg.Password)
+	default:
+		logger.Error("Invalid QRYN_RESULTS_CACHE value: ", cfg.Backend)
+		return nil
+	}
+	if cfg.Backend != "lru" && cfg.Address == "" {
+		logger.Error("QRYN_RESULTS_CACHE_ADDRESS is required by the ", cfg.Backend, " results cache")
+		return nil
+	}
+	return NewWithBackend(cfg, backend)
+}
+
+// NewWithBackend creates a Cache storing its extents in backend.
+func NewWithBackend(cfg Config, backend Backend) *Cache {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	return &Cache{cfg: cfg, backend: backend, now: time.Now}
+}
+
+var (
+	shared     *Cache
+	sharedOnce sync.Once
+)
+
+// FromEnv returns the Cache configured by the environment. The Cache is
+// created once and shared by the Loki and Prometheus APIs.
+func FromEnv() *Cache {
+	sharedOnce.Do(func() {
+		shared = New(ConfigFromEnv())
+	})
+	return shared
+}
@@ -0,0 +1,85 @@
+package resultscache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"time"
+)
+
+const (
+	maxIdleConns   = 16
+	defaultTimeout = time.Second
+)
+
+// conn is a connection to a memcached or redis server.
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// connPool keeps the idle connections to a server. onDial runs once on every
+// new connection, e.g. to authenticate it.
+type connPool struct {
+	address string
+	idle    chan *conn
+	onDial  func(c *conn) error
+}
+
+func newConnPool(address string, onDial func(c *conn) error) *connPool {
+	return &connPool{
+		address: address,
+		idle:    make(chan *conn, maxIdleConns),
+		onDial:  onDial,
+	}
+}
+
+// get returns an idle connection or dials a new one. The deadline of the
+// connection is the one of ctx or defaultTimeout.
+func (p *connPool) get(ctx context.Context) (*conn, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	var c *conn
+	select {
+	case c = <-p.idle:
+	default:
+		dialer := net.Dialer{Deadline: deadline}
+		netConn, err := dialer.DialContext(ctx, "tcp", p.address)
+		if err != nil {
+			return nil, err
+		}
+		c = &conn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+		if p.onDial != nil {
+			if err := c.SetDeadline(deadline); err != nil {
+				c.Close()
+				return nil, err
+			}
+			if err := p.onDial(c); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// put returns c to the pool. A connection which failed is closed: the state
+// of the protocol is unknown.
+func (p *connPool) put(c *conn, err error) {
+	if err != nil {
+		c.Close()
+		return
+	}
+	select {
+	case p.idle <- c:
+	default:
+		c.Close()
+	}
+}
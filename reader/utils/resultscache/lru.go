@@ -0,0 +1,73 @@
+package resultscache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is the in-process Backend. It evicts the least recently used entries
+// once their size exceeds maxBytes.
+type LRU struct {
+	maxBytes int64
+	size     int64
+	mtx      sync.Mutex
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+var _ Backend = &LRU{}
+
+func NewLRU(maxBytes int64) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+func (l *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		l.remove(el)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (l *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+	if int64(len(value)) > l.maxBytes {
+		return nil
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value, expires: time.Now().Add(ttl)})
+	l.size += int64(len(value))
+	for l.size > l.maxBytes {
+		l.remove(l.order.Back())
+	}
+	return nil
+}
+
+func (l *LRU) remove(el *list.Element) {
+	entry := l.order.Remove(el).(*lruEntry)
+	delete(l.items, entry.key)
+	l.size -= int64(len(entry.value))
+}
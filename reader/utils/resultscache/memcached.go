@@ -0,0 +1,108 @@
+package resultscache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRelativeExpiration is the longest expiration memcached reads as a number
+// of seconds, longer ones are read as unix timestamps.
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// Memcached is a Backend speaking the memcached text protocol.
+type Memcached struct {
+	pool *connPool
+}
+
+var _ Backend = &Memcached{}
+
+func NewMemcached(address string) *Memcached {
+	return &Memcached{pool: newConnPool(address, nil)}
+}
+
+func (m *Memcached) Get(ctx context.Context, key string) (res []byte, found bool, err error) {
+	c, err := m.pool.get(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { m.pool.put(c, err) }()
+	if _, err = fmt.Fprintf(c.w, "get %s\r\n", key); err != nil {
+		return nil, false, err
+	}
+	if err = c.w.Flush(); err != nil {
+		return nil, false, err
+	}
+	line, err := readLine(c)
+	if err != nil {
+		return nil, false, err
+	}
+	if line == "END" {
+		return nil, false, nil
+	}
+	// VALUE <key> <flags> <bytes>
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "VALUE" {
+		return nil, false, fmt.Errorf("memcached: unexpected response %q", line)
+	}
+	size, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, false, fmt.Errorf("memcached: unexpected response %q", line)
+	}
+	res = make([]byte, size+2)
+	if _, err = io.ReadFull(c.r, res); err != nil {
+		return nil, false, err
+	}
+	if line, err = readLine(c); err != nil {
+		return nil, false, err
+	}
+	if line != "END" {
+		return nil, false, fmt.Errorf("memcached: unexpected response %q", line)
+	}
+	return res[:size], true, nil
+}
+
+func (m *Memcached) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	c, err := m.pool.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { m.pool.put(c, err) }()
+	exp := int64(ttl / time.Second)
+	if ttl > maxRelativeExpiration {
+		exp = time.Now().Add(ttl).Unix()
+	}
+	if _, err = fmt.Fprintf(c.w, "set %s 0 %d %d\r\n", key, exp, len(value)); err != nil {
+		return err
+	}
+	if _, err = c.w.Write(value); err != nil {
+		return err
+	}
+	if _, err = c.w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	if err = c.w.Flush(); err != nil {
+		return err
+	}
+	line, err := readLine(c)
+	if err != nil {
+		return err
+	}
+	if line != "STORED" {
+		// e.g. SERVER_ERROR object too large for cache
+		return fmt.Errorf("memcached: %s", line)
+	}
+	return nil
+}
+
+// readLine reads a line of the response without its CRLF.
+func readLine(c *conn) (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,21 @@
+package resultscache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	CacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "query_results_cache_hits_total",
+		Help: "The number of cache keys whose extents covered the requested range",
+	}, []string{"api"})
+	CacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "query_results_cache_misses_total",
+		Help: "The number of cache keys missing a part of the requested range",
+	}, []string{"api"})
+	CacheErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "query_results_cache_errors_total",
+		Help: "The number of failed reads and writes of the cache backend",
+	}, []string{"api"})
+)
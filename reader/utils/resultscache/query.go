@@ -0,0 +1,290 @@
+package resultscache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/metrico/qryn/v5/reader/utils/logger"
+	"github.com/prometheus/prometheus/model/histogram"
+)
+
+// Sample is a sample of a series, T is a timestamp in milliseconds. H is set
+// for a native histogram sample, V is unused then.
+type Sample struct {
+	T int64
+	V float64
+	H *histogram.FloatHistogram
+}
+
+type Series struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// Fetch runs a query over the steps start, start+step, ..., end, in
+// milliseconds.
+type Fetch func(ctx context.Context, start, end int64) ([]Series, error)
+
+// extent is a cached result over the steps Start..End, both included.
+type extent struct {
+	Start  int64
+	End    int64
+	Series []Series
+}
+
+// Query returns the series of query over the steps start, start+step, ...,
+// end, in milliseconds. The range is split by the multiples of the Interval,
+// every interval is a cache key holding the extents already computed. Only
+// the missing parts of the range are run by fetch, contiguous missing parts
+// are run at once. The steps more recent than MaxFreshness are always run and
+// never cached.
+//
+// The result of a step must not depend on the range of the query, api and
+// query identify the results in the cache. The requests whose start is not a
+// multiple of step bypass the cache: their steps are not shared with other
+// requests. The series are returned ordered by their labels.
+func (c *Cache) Query(ctx context.Context, api, query string, start, end, step int64,
+	fetch Fetch,
+) ([]Series, error) {
+	if c == nil || step <= 0 || start%step != 0 || end < start {
+		return fetch(ctx, start, end)
+	}
+	end = start + (end-start)/step*step
+	cachedEnd := min(end, floorStep(c.now().Add(-c.cfg.MaxFreshness).UnixMilli(), step))
+	if cachedEnd < start {
+		return fetch(ctx, start, end)
+	}
+
+	type bucket struct {
+		key     string
+		extents []extent
+		gaps    []extent
+	}
+	var (
+		buckets []*bucket
+		gaps    []extent
+		parts   [][]Series
+	)
+	interval := c.cfg.Interval.Milliseconds()
+	for b := start / interval; b*interval <= cachedEnd; b++ {
+		from := max(start, ceilStep(b*interval, step))
+		to := min(cachedEnd, ceilStep((b+1)*interval, step)-step)
+		if from > to {
+			// the interval has no step
+			continue
+		}
+		bk := &bucket{key: cacheKey(api, query, step, interval, b)}
+		bk.extents = c.load(ctx, api, bk.key)
+		for _, e := range bk.extents {
+			parts = append(parts, sliceSeries(e.Series, from, to))
+		}
+		bk.gaps = missingRanges(bk.extents, from, to, step)
+		if len(bk.gaps) == 0 {
+			CacheHits.WithLabelValues(api).Inc()
+			continue
+		}
+		CacheMisses.WithLabelValues(api).Inc()
+		gaps = append(gaps, bk.gaps...)
+		buckets = append(buckets, bk)
+	}
+	if end > cachedEnd {
+		gaps = append(gaps, extent{Start: cachedEnd + step, End: end})
+	}
+
+	var fetched []Series
+	for _, r := range mergeRanges(gaps, step) {
+		series, err := fetch(ctx, r.Start, r.End)
+		if err != nil {
+			return nil, err
+		}
+		fetched = append(fetched, series...)
+	}
+	parts = append(parts, fetched)
+
+	for _, bk := range buckets {
+		for _, g := range bk.gaps {
+			g.Series = sliceSeries(fetched, g.Start, g.End)
+			bk.extents = append(bk.extents, g)
+		}
+		c.store(ctx, api, bk.key, mergeExtents(bk.extents, step))
+	}
+	return mergeSeries(parts), nil
+}
+
+func (c *Cache) load(ctx context.Context, api, key string) []extent {
+	data, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		CacheErrors.WithLabelValues(api).Inc()
+		logger.Error("results cache: ", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	var res []extent
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&res); err != nil {
+		CacheErrors.WithLabelValues(api).Inc()
+		logger.Error("results cache: ", err)
+		return nil
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+	return res
+}
+
+func (c *Cache) store(ctx context.Context, api, key string, extents []extent) {
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(extents); err != nil {
+		CacheErrors.WithLabelValues(api).Inc()
+		logger.Error("results cache: ", err)
+		return
+	}
+	if err := c.backend.Set(ctx, key, buf.Bytes(), c.cfg.TTL); err != nil {
+		CacheErrors.WithLabelValues(api).Inc()
+		logger.Error("results cache: ", err)
+	}
+}
+
+// cacheKey hashes the parts of the key: the memcached keys are limited to 250
+// printable characters.
+func cacheKey(api, query string, step, interval, bucket int64) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%d", api, query, step, interval, bucket)))
+	return "qryn_results:" + hex.EncodeToString(h[:])
+}
+
+func floorStep(t, step int64) int64 {
+	return t / step * step
+}
+
+func ceilStep(t, step int64) int64 {
+	return (t + step - 1) / step * step
+}
+
+// missingRanges returns the steps of from..to not covered by the sorted
+// extents.
+func missingRanges(extents []extent, from, to, step int64) []extent {
+	var res []extent
+	cur := from
+	for _, e := range extents {
+		if e.End < cur || e.Start > to {
+			continue
+		}
+		if e.Start > cur {
+			res = append(res, extent{Start: cur, End: e.Start - step})
+		}
+		cur = max(cur, e.End+step)
+	}
+	if cur <= to {
+		res = append(res, extent{Start: cur, End: to})
+	}
+	return res
+}
+
+// mergeRanges sorts the ranges and joins the adjacent ones.
+func mergeRanges(ranges []extent, step int64) []extent {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	var res []extent
+	for _, r := range ranges {
+		if len(res) > 0 && r.Start <= res[len(res)-1].End+step {
+			res[len(res)-1].End = max(res[len(res)-1].End, r.End)
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// mergeExtents sorts the extents and joins the overlapping and adjacent ones.
+func mergeExtents(extents []extent, step int64) []extent {
+	sort.Slice(extents, func(i, j int) bool { return extents[i].Start < extents[j].Start })
+	var res []extent
+	for _, e := range extents {
+		if len(res) == 0 || e.Start > res[len(res)-1].End+step {
+			res = append(res, e)
+			continue
+		}
+		last := &res[len(res)-1]
+		if e.End > last.End {
+			last.Series = mergeSeries([][]Series{last.Series, sliceSeries(e.Series, last.End+step, e.End)})
+			last.End = e.End
+		}
+	}
+	return res
+}
+
+// sliceSeries returns the samples of the series between from and to, both
+// included. The series without samples in the range are dropped.
+func sliceSeries(series []Series, from, to int64) []Series {
+	var res []Series
+	for _, s := range series {
+		i := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].T >= from })
+		j := sort.Search(len(s.Samples), func(i int) bool { return s.Samples[i].T > to })
+		if i < j {
+			res = append(res, Series{Labels: s.Labels, Samples: s.Samples[i:j]})
+		}
+	}
+	return res
+}
+
+// mergeSeries joins the samples of the series having the same labels, ordered
+// by timestamp. The series are ordered by their labels.
+func mergeSeries(parts [][]Series) []Series {
+	idx := map[string]int{}
+	var (
+		keys []string
+		res  []Series
+	)
+	for _, series := range parts {
+		for _, s := range series {
+			key := labelsKey(s.Labels)
+			i, ok := idx[key]
+			if !ok {
+				i = len(res)
+				idx[key] = i
+				keys = append(keys, key)
+				res = append(res, Series{Labels: s.Labels})
+			}
+			res[i].Samples = append(res[i].Samples, s.Samples...)
+		}
+	}
+	for i := range res {
+		samples := res[i].Samples
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].T < samples[j].T })
+	}
+	sort.Sort(byKey{keys, res})
+	return res
+}
+
+type byKey struct {
+	keys   []string
+	series []Series
+}
+
+func (b byKey) Len() int           { return len(b.keys) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.series[i], b.series[j] = b.series[j], b.series[i]
+}
+
+// labelsKey is the identity of a label set, ordered by label name.
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb := strings.Builder{}
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteByte(0xff)
+		sb.WriteString(labels[name])
+		sb.WriteByte(0xff)
+	}
+	return sb.String()
+}
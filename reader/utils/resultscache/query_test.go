@@ -0,0 +1,157 @@
+package resultscache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	minute = int64(time.Minute / time.Millisecond)
+	hour   = 60 * minute
+)
+
+// fetchRecorder returns two series with a sample at every step, the value of
+// a sample is its timestamp, and records the fetched ranges.
+type fetchRecorder struct {
+	step   int64
+	ranges [][2]int64
+	err    error
+}
+
+func (f *fetchRecorder) fetch(_ context.Context, start, end int64) ([]Series, error) {
+	f.ranges = append(f.ranges, [2]int64{start, end})
+	if f.err != nil {
+		return nil, f.err
+	}
+	var res []Series
+	for _, name := range []string{"b", "a"} {
+		s := Series{Labels: map[string]string{"name": name}}
+		for t := start; t <= end; t += f.step {
+			s.Samples = append(s.Samples, Sample{T: t, V: float64(t)})
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func newTestCache(now int64) *Cache {
+	c := NewWithBackend(Config{TTL: time.Hour, Interval: time.Hour, MaxFreshness: 10 * time.Minute}, NewLRU(1<<20))
+	c.now = func() time.Time { return time.UnixMilli(now) }
+	return c
+}
+
+func TestQuery(t *testing.T) {
+	step := minute
+	c := newTestCache(100 * hour)
+	f := &fetchRecorder{step: step}
+	query := func(start, end int64) []Series {
+		t.Helper()
+		f.ranges = nil
+		res, err := c.Query(context.Background(), "test", "q", start, end, step, f.fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := (&fetchRecorder{step: step}).fetch(context.Background(), start, start+(end-start)/step*step)
+		want[0], want[1] = want[1], want[0]
+		if !reflect.DeepEqual(res, want) {
+			t.Fatalf("Query(%d, %d) returned other samples than the query", start, end)
+		}
+		return res
+	}
+
+	// a cold cache runs the whole range at once
+	query(10*hour, 13*hour+30*minute)
+	if want := [][2]int64{{10 * hour, 13*hour + 30*minute}}; !reflect.DeepEqual(f.ranges, want) {
+		t.Errorf("fetched %v, want %v", f.ranges, want)
+	}
+
+	// only the missing ends are run, the end is not aligned to the steps
+	query(9*hour, 15*hour+30)
+	if want := [][2]int64{{9 * hour, 10*hour - step}, {13*hour + 31*minute, 15 * hour}}; !reflect.DeepEqual(f.ranges, want) {
+		t.Errorf("fetched %v, want %v", f.ranges, want)
+	}
+
+	query(9*hour+5*minute, 15*hour)
+	if len(f.ranges) != 0 {
+		t.Errorf("fetched %v, want the cached extents", f.ranges)
+	}
+
+	// the fresh steps are never cached
+	query(99*hour, 100*hour)
+	query(99*hour, 100*hour)
+	if want := [][2]int64{{100*hour - 9*minute, 100 * hour}}; !reflect.DeepEqual(f.ranges, want) {
+		t.Errorf("fetched %v, want %v", f.ranges, want)
+	}
+
+	// the unaligned requests bypass the cache
+	res, err := c.Query(context.Background(), "test", "q", 10*hour+1, 11*hour, step, f.fetch)
+	if err != nil || len(res) != 2 || res[0].Samples[0].T != 10*hour+1 {
+		t.Errorf("unaligned query returned %v, %v", res, err)
+	}
+
+	// other queries and steps have other keys
+	f.ranges = nil
+	if _, err := c.Query(context.Background(), "test", "q", 10*hour, 11*hour, 2*step, f.fetch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query(context.Background(), "test", "other", 10*hour, 11*hour, step, f.fetch); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.ranges) != 2 {
+		t.Errorf("fetched %v, want 2 ranges", f.ranges)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	c := newTestCache(100 * hour)
+	errTest := errors.New("test")
+	f := &fetchRecorder{step: minute, err: errTest}
+	if _, err := c.Query(context.Background(), "test", "q", 10*hour, 12*hour, minute, f.fetch); !errors.Is(err, errTest) {
+		t.Fatalf("got error %v, want %v", err, errTest)
+	}
+	f.err = nil
+	f.ranges = nil
+	if _, err := c.Query(context.Background(), "test", "q", 10*hour, 12*hour, minute, f.fetch); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.ranges) != 1 {
+		t.Errorf("fetched %v, a failed query must not be cached", f.ranges)
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	f := &fetchRecorder{step: minute}
+	if _, err := c.Query(context.Background(), "test", "q", 10*hour, 12*hour, minute, f.fetch); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][2]int64{{10 * hour, 12 * hour}}; !reflect.DeepEqual(f.ranges, want) {
+		t.Errorf("fetched %v, want %v", f.ranges, want)
+	}
+}
+
+func TestMergeExtents(t *testing.T) {
+	series := func(ts ...int64) []Series {
+		s := Series{Labels: map[string]string{"a": "1"}}
+		for _, t := range ts {
+			s.Samples = append(s.Samples, Sample{T: t, V: float64(t)})
+		}
+		return []Series{s}
+	}
+	got := mergeExtents([]extent{
+		{Start: 40, End: 50, Series: series(40, 50)},
+		{Start: 0, End: 20, Series: series(0, 10, 20)},
+		{Start: 10, End: 30, Series: series(10, 20, 30)},
+		{Start: 70, End: 70, Series: series(70)},
+	}, 10)
+	want := []extent{
+		{Start: 0, End: 50, Series: series(0, 10, 20, 30, 40, 50)},
+		{Start: 70, End: 70, Series: series(70)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeExtents() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,90 @@
+package resultscache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Redis is a Backend speaking the RESP protocol of redis and of the
+// compatible servers.
+type Redis struct {
+	pool *connPool
+}
+
+var _ Backend = &Redis{}
+
+func NewRedis(address string, password string) *Redis {
+	var auth func(c *conn) error
+	if password != "" {
+		auth = func(c *conn) error {
+			_, err := redisDo(c, "AUTH", []byte(password))
+			return err
+		}
+	}
+	return &Redis{pool: newConnPool(address, auth)}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) (res []byte, found bool, err error) {
+	c, err := r.pool.get(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { r.pool.put(c, err) }()
+	res, err = redisDo(c, "GET", []byte(key))
+	return res, res != nil, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	c, err := r.pool.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { r.pool.put(c, err) }()
+	_, err = redisDo(c, "SET", []byte(key), value, []byte("PX"),
+		[]byte(strconv.FormatInt(ttl.Milliseconds(), 10)))
+	return err
+}
+
+// redisDo sends a command and reads its reply. It returns the content of a
+// bulk string reply, nil for a null or a simple string reply.
+func redisDo(c *conn, cmd string, args ...[]byte) ([]byte, error) {
+	fmt.Fprintf(c.w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n", len(arg))
+		c.w.Write(arg)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	line, err := readLine(c)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return nil, nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: unexpected reply %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		res := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, res); err != nil {
+			return nil, err
+		}
+		return res[:size], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -3,11 +3,13 @@ package tables
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/metrico/qryn/v5/reader/logql/logql_transpiler/shared"
 	"github.com/metrico/qryn/v5/reader/model"
 	"github.com/metrico/qryn/v5/reader/plugins"
 	"github.com/metrico/qryn/v5/shared/distconfig"
+	"github.com/metrico/qryn/v5/shared/retention"
 )
 
 var tableNames = func() map[string]string {
@@ -32,12 +34,19 @@ func init() {
 	tableNames["samples_v3"] = "samples_v3"
 	tableNames["samples_v3_dist"] = "samples_v3_dist"
 	tableNames["metrics_15s"] = "metrics_15s"
+	tableNames["metrics_5m"] = "metrics_5m"
+	tableNames["metrics_1h"] = "metrics_1h"
 	tableNames["profiles_series"] = "profiles_series"
 	tableNames["profiles_series_gin"] = "profiles_series_gin"
 	tableNames["profiles"] = "profiles"
 	tableNames["tempo_traces_attrs_gin"] = "tempo_traces_attrs_gin"
 	tableNames["tempo_traces_attrs_gin_dist"] = "tempo_traces_attrs_gin_dist"
 	tableNames["patterns"] = "patterns"
+	tableNames["native_histograms"] = "native_histograms"
+	tableNames["native_histograms_dist"] = "native_histograms_dist"
+	tableNames["exemplars"] = "exemplars"
+	tableNames["exemplars_dist"] = "exemplars_dist"
+	tableNames["delete_requests"] = "delete_requests"
 }
 
 // InitDistTableNames re-registers dist table names using the configured suffix.
@@ -53,6 +62,8 @@ func InitDistTableNames() {
 	tableNames["time_series_gin_dist"] = "time_series_gin" + suffix
 	tableNames["samples_v3_dist"] = "samples_v3" + suffix
 	tableNames["tempo_traces_attrs_gin_dist"] = "tempo_traces_attrs_gin" + suffix
+	tableNames["native_histograms_dist"] = "native_histograms" + suffix
+	tableNames["exemplars_dist"] = "exemplars" + suffix
 }
 
 func GetTableName(name string) string {
@@ -78,6 +89,17 @@ func PopulateTableNames(ctx *shared.PlannerContext, db *model.DataDatabasesMap)
 	ctx.TimeSeriesGinDistTableName = GetTableName("time_series_gin")
 	ctx.Metrics15sTableName = GetTableName("metrics_15s")
 	ctx.Metrics15sDistTableName = GetTableName("metrics_15s")
+	ctx.Metrics5mTableName = GetTableName("metrics_5m")
+	ctx.Metrics5mDistTableName = GetTableName("metrics_5m")
+	ctx.Metrics1hTableName = GetTableName("metrics_1h")
+	ctx.Metrics1hDistTableName = GetTableName("metrics_1h")
+	ctx.Metrics15sTTL = daysTTL(db.Config.TTLDays)
+	ctx.Metrics5mTTL = rollupTTL("METRICS_5M_DAYS", db.Config.TTLDays)
+	ctx.Metrics1hTTL = rollupTTL("METRICS_1H_DAYS", db.Config.TTLDays)
+	ctx.HistogramsTableName = GetTableName("native_histograms")
+	ctx.HistogramsDistTableName = GetTableName("native_histograms")
+	ctx.ExemplarsTableName = GetTableName("exemplars")
+	ctx.ExemplarsDistTableName = GetTableName("exemplars")
 
 	ctx.ProfilesSeriesGinTable = GetTableName("profiles_series_gin")
 	ctx.ProfilesSeriesGinDistTable = GetTableName("profiles_series_gin")
@@ -102,6 +124,10 @@ func PopulateTableNames(ctx *shared.PlannerContext, db *model.DataDatabasesMap)
 		ctx.TimeSeriesDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.TimeSeriesTableName, suffix)
 		ctx.TimeSeriesGinDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.TimeSeriesGinTableName, suffix)
 		ctx.Metrics15sDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.Metrics15sTableName, suffix)
+		ctx.Metrics5mDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.Metrics5mTableName, suffix)
+		ctx.Metrics1hDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.Metrics1hTableName, suffix)
+		ctx.HistogramsDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.HistogramsTableName, suffix)
+		ctx.ExemplarsDistTableName = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.ExemplarsTableName, suffix)
 
 		ctx.ProfilesSeriesGinDistTable = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.ProfilesSeriesGinTable, suffix)
 		ctx.ProfilesDistTable = fmt.Sprintf("`%s`.%s%s", db.Config.Name, ctx.ProfilesTable, suffix)
@@ -115,3 +141,15 @@ func PopulateTableNames(ctx *shared.PlannerContext, db *model.DataDatabasesMap)
 	}
 	return ctx
 }
+
+// rollupTTL returns the retention of a rollup of the samples set by the name
+// environment variable, the retention of the samples by default. The
+// maintenance reports the invalid values.
+func rollupTTL(name string, ttlDays int) time.Duration {
+	days, _ := retention.RollupDays(name, ttlDays)
+	return daysTTL(days)
+}
+
+func daysTTL(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -54,7 +54,7 @@ func (e *LogQLEvaluator) Evaluate(ctx context.Context, query string, t time.Time
 		return promql.Vector{{Metric: labels.EmptyLabels(), T: t.UnixMilli(), F: val}}, nil
 	}
 
-	outputChan, err := e.queryRangeService.QueryInstant(ctx, query, t.UnixNano(), 1000, 1000)
+	outputChan, err := e.queryRangeService.QueryInstant(ctx, query, t.UnixNano(), 1000, 1000, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute LogQL query: %w", err)
 	}
@@ -0,0 +1,22 @@
+package retention
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// RollupDays reads the retention in days of a rollup of the samples from the
+// name environment variable, ttlDays, the retention of the samples, if it is
+// not set. An invalid value is reported along with ttlDays.
+func RollupDays(name string, ttlDays int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return ttlDays, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days <= 0 {
+		return ttlDays, fmt.Errorf("invalid %s value: %s", name, v)
+	}
+	return days, nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	retry "github.com/avast/retry-go"
 	"github.com/metrico/qryn/v5/writer/config"
+	"github.com/metrico/qryn/v5/writer/limits"
 	"github.com/metrico/qryn/v5/writer/model"
 	"github.com/metrico/qryn/v5/writer/pattern/controller"
 	"github.com/metrico/qryn/v5/writer/service"
@@ -74,6 +77,13 @@ func (pusherCtx *PusherCtx) Do(w http.ResponseWriter, r *http.Request) error {
 }
 
 func ErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if e, ok := customErrors.Unwrap[*customErrors.LimitError](err); ok {
+		if e.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		}
+		writeErrorResponse(w, e.GetCode(), e.Error())
+		return
+	}
 	if e, ok := customErrors.Unwrap[*customErrors.UnMarshalError](err); ok {
 		stat.AddSentMetrics("json_parse_errors", 1)
 		writeErrorResponse(w, e.GetCode(), e.Error())
@@ -142,8 +152,7 @@ func Build(options ...BuildOption) func(w http.ResponseWriter, r *http.Request)
 
 }
 
-func getService(r *http.Request, name utils.ContextKey) service.IInsertServiceV2 {
-	ctx := r.Context()
+func getService(ctx context.Context, name utils.ContextKey) service.IInsertServiceV2 {
 	svc := ctx.Value(name)
 	if svc == nil {
 		return nil
@@ -199,41 +208,67 @@ func doLogsPattern(s *model.TimeSamplesData) {
 }
 
 func doParse(r *http.Request, parser Parser) error {
-	reader := getBodyStream(r)
-	tsService := getService(r, utils.ContextKeyTsService)
-	splService := getService(r, utils.ContextKeySplService)
-	spanAttrsService := getService(r, utils.ContextKeySpanAttrsService)
-	spansService := getService(r, utils.ContextKeySpansService)
-	profileService := getService(r, utils.ContextKeyProfileService)
-	node := r.Context().Value(utils.ContextKeyNode).(string)
+	return doParseCtx(r.Context(), getBodyStream(r), parser)
+}
+
+// doParseCtx runs the parser over the body and pushes the results to the insert
+// services stored in ctx. It is shared by the HTTP handlers and the gRPC receiver.
+func doParseCtx(ctx context.Context, reader io.Reader, parser Parser) error {
+	tsService := getService(ctx, utils.ContextKeyTsService)
+	splService := getService(ctx, utils.ContextKeySplService)
+	spanAttrsService := getService(ctx, utils.ContextKeySpanAttrsService)
+	spansService := getService(ctx, utils.ContextKeySpansService)
+	profileService := getService(ctx, utils.ContextKeyProfileService)
+	histogramsService := getService(ctx, utils.ContextKeyHistogramsService)
+	exemplarsService := getService(ctx, utils.ContextKeyExemplarsService)
+	node := ctx.Value(utils.ContextKeyNode).(string)
 
 	//var promises []chan error
 	var promises []*promise.Promise[uint32]
 	var err error = nil
-	res := parser(r.Context(), reader, FPCache.DB(node))
-	for response := range res {
-		if response.Error != nil {
-			go func() {
-				for range res {
-				}
-			}()
-			return response.Error
-		}
-
+	// With ingestion limits, nothing is inserted before the whole request passed them
+	requestLimits, _ := ctx.Value(utils.ContextKeyLimits).(*limits.Request)
+	var pending []*model.ParserResponse
+	push := func(response *model.ParserResponse) {
 		promises = append(promises,
 			doPush(response.TimeSeriesRequest, service.INSERT_MODE_SYNC, tsService),
 			doPush(response.SamplesRequest, service.INSERT_MODE_SYNC, splService),
 			doPush(response.SpansAttrsRequest, service.INSERT_MODE_SYNC, spanAttrsService),
 			doPush(response.SpansRequest, service.INSERT_MODE_SYNC, spansService),
 			doPush(response.ProfileRequest, service.INSERT_MODE_SYNC, profileService),
+			doPush(response.HistogramsRequest, service.INSERT_MODE_SYNC, histogramsService),
+			doPush(response.ExemplarsRequest, service.INSERT_MODE_SYNC, exemplarsService),
 		)
 		if response.SamplesRequest != nil {
 			doLogsPattern(response.SamplesRequest.(*model.TimeSamplesData))
 		}
 	}
+	// The series of a request which is not stored are indexed by its retry
+	fpCache := numbercache.NewRequestCache(FPCache.DB(node))
+	res := parser(ctx, reader, fpCache)
+	for response := range res {
+		if response.Error != nil {
+			go func() {
+				for range res {
+				}
+			}()
+			requestLimits.Cancel()
+			fpCache.Rollback()
+			return response.Error
+		}
+		if requestLimits != nil {
+			pending = append(pending, response)
+			continue
+		}
+		push(response)
+	}
+	for _, response := range pending {
+		push(response)
+	}
 	for _, p := range promises {
 		_, err = p.Get()
 		if err != nil {
+			fpCache.Rollback()
 			return err
 		}
 	}
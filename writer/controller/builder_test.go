@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	clconfig "github.com/metrico/cloki-config"
+	"github.com/metrico/qryn/v5/writer/config"
+	"github.com/metrico/qryn/v5/writer/limits"
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/service"
+	"github.com/metrico/qryn/v5/writer/utils"
+	"github.com/metrico/qryn/v5/writer/utils/helpers"
+	"github.com/metrico/qryn/v5/writer/utils/numbercache"
+	"github.com/metrico/qryn/v5/writer/utils/promise"
+	"github.com/metrico/qryn/v5/writer/utils/unmarshal"
+)
+
+// recordingService accepts every request and records the time_series rows.
+type recordingService struct {
+	service.IInsertServiceV2
+	mtx          sync.Mutex
+	requests     int
+	fingerprints []uint64
+}
+
+func (s *recordingService) Request(req helpers.SizeGetter, _ int) *promise.Promise[uint32] {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.requests++
+	if ts, ok := req.(*model.TimeSeriesData); ok {
+		s.fingerprints = append(s.fingerprints, ts.MFingerprint...)
+	}
+	return promise.Fulfilled[uint32](nil, 0)
+}
+
+func (s *recordingService) reset() (int, []uint64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	requests, fingerprints := s.requests, s.fingerprints
+	s.requests, s.fingerprints = 0, nil
+	return requests, fingerprints
+}
+
+func TestRejectedRequestSeriesIndexedOnRetry(t *testing.T) {
+	if config.Cloki == nil {
+		config.Cloki = clconfig.New(clconfig.CLOKI_WRITER, nil, "", "")
+	}
+	fpCache, limiter := FPCache, IngestLimiter
+	defer func() { FPCache, IngestLimiter = fpCache, limiter }()
+	cache := numbercache.NewCache(time.Minute, func(val uint64) []byte {
+		return unsafe.Slice((*byte)(unsafe.Pointer(&val)), 8)
+	}, map[string]*model.DataDatabasesMap{"node": {}})
+	defer cache.Stop()
+	FPCache = cache
+	IngestLimiter = limits.New(limits.Config{GlobalLinesPerSec: 4})
+
+	ts, spl := &recordingService{}, &recordingService{}
+	ctx := context.WithValue(context.Background(), utils.ContextKeyNode, "node")
+	ctx = context.WithValue(ctx, utils.ContextKeyTsService, service.IInsertServiceV2(ts))
+	ctx = context.WithValue(ctx, utils.ContextKeySplService, service.IInsertServiceV2(spl))
+	push := func(lines map[string]int) error {
+		var streams []string
+		for app, n := range lines {
+			values := make([]string, n)
+			for i := range values {
+				values[i] = fmt.Sprintf(`["%d", "line %d"]`, time.Now().UnixNano(), i)
+			}
+			streams = append(streams, fmt.Sprintf(`{"stream":{"app":"%s"},"values":[%s]}`,
+				app, strings.Join(values, ",")))
+		}
+		body := `{"streams":[` + strings.Join(streams, ",") + `]}`
+		return doParseCtx(withIngestLimitsCtx(ctx), strings.NewReader(body),
+			Parser(unmarshal.DecodePushRequestStringV2))
+	}
+
+	// leave one token of the four: the first stream of the request is
+	// accepted and indexed, the second one is rejected
+	if err := push(map[string]int{"other": 3}); err != nil {
+		t.Fatal(err)
+	}
+	ts.reset()
+	spl.reset()
+	request := map[string]int{"a": 1, "b": 1}
+	if err := push(request); err == nil {
+		t.Fatal("the request must be rejected")
+	}
+	if requests, _ := ts.reset(); requests != 0 {
+		t.Errorf("a rejected request inserted %d time_series batches", requests)
+	}
+	if requests, _ := spl.reset(); requests != 0 {
+		t.Errorf("a rejected request inserted %d samples batches", requests)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if err := push(request); err != nil {
+		t.Fatal("the retry must be accepted: ", err)
+	}
+	if _, fps := ts.reset(); len(fps) != 2 {
+		t.Errorf("the series of the retried request must be indexed, time_series rows = %v", fps)
+	}
+	if requests, _ := spl.reset(); requests == 0 {
+		t.Error("the samples of the retried request must be inserted")
+	}
+}
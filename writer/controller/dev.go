@@ -2,7 +2,9 @@ package controller
 
 var WithExtraMiddlewareDefault = []BuildOption{
 	WithOverallContextMiddleware,
+	WithIngestLimits,
 }
 var WithExtraMiddlewareTempo = []BuildOption{
 	WithOverallContextMiddleware,
+	WithIngestLimits,
 }
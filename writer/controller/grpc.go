@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/metrico/qryn/v5/writer/service"
+	"github.com/metrico/qryn/v5/writer/utils/unmarshal"
+)
+
+// IngestSettings are the per-request settings the HTTP handlers read from the
+// X-CH-DSN, X-Scope-Meta, X-Ttl-Days and X-Async-Insert headers.
+type IngestSettings struct {
+	DSN     string
+	Meta    string
+	TTLDays uint16
+	Async   int
+}
+
+// DefaultIngestSettings matches an HTTP request sent without any of the headers.
+func DefaultIngestSettings() IngestSettings {
+	return IngestSettings{Async: service.INSERT_MODE_DEFAULT}
+}
+
+// PushOTLPLogs ingests a protobuf-encoded OTLP ExportLogsServiceRequest through
+// the same decoder and insert services as POST /v1/logs.
+func PushOTLPLogs(ctx context.Context, settings IngestSettings, body []byte) error {
+	return pushInProcess(ctx, settings, body, withTSAndSampleServiceCtx, Parser(unmarshal.UnmarshalOTLPLogsV2))
+}
+
+// PushOTLPMetrics ingests a protobuf-encoded OTLP ExportMetricsServiceRequest
+// through the same decoder and insert services as POST /v1/metrics.
+func PushOTLPMetrics(ctx context.Context, settings IngestSettings, body []byte) error {
+	return pushInProcess(ctx, settings, body, withTSAndSampleServiceCtx, Parser(unmarshal.UnmarshalOTLPMetricsV2))
+}
+
+// PushOTLPTraces ingests a protobuf-encoded OTLP ExportTraceServiceRequest
+// through the same decoder and insert services as POST /v1/traces.
+func PushOTLPTraces(ctx context.Context, settings IngestSettings, body []byte) error {
+	return pushInProcess(ctx, settings, body, withTracesServiceCtx, Parser(unmarshal.UnmarshalOTLPV2))
+}
+
+// PushJaegerSpans ingests a protobuf-encoded Jaeger api_v2 PostSpansRequest
+// through the same insert services as POST /api/traces.
+func PushJaegerSpans(ctx context.Context, settings IngestSettings, body []byte) error {
+	return pushInProcess(ctx, settings, body, withTracesServiceCtx, Parser(unmarshal.UnmarshalJaegerProtoV2))
+}
+
+// PushOTLPProfiles ingests a protobuf-encoded OTLP ExportProfilesServiceRequest
+// through the same decoder and insert services as POST /v1development/profiles.
+func PushOTLPProfiles(ctx context.Context, settings IngestSettings, body []byte) error {
+	return pushInProcess(ctx, settings, body, withTSAndSampleServiceCtx, Parser(unmarshal.UnmarshalOTLPProfilesProtoV2))
+}
+
+// PushSyslog ingests a batch of octet-counted syslog messages as log lines.
+func PushSyslog(ctx context.Context, settings IngestSettings, body []byte) error {
+	return pushInProcess(ctx, settings, body, withTSAndSampleServiceCtx, Parser(unmarshal.UnmarshalSyslogV2))
+}
+
+func pushInProcess(ctx context.Context, settings IngestSettings, body []byte,
+	withServices func(context.Context) (context.Context, error), parser Parser) error {
+	ctx = withIngestSettings(ctx, settings.DSN, settings.Meta, settings.TTLDays, settings.Async)
+	ctx = withIngestLimitsCtx(ctx)
+	ctx, err := withServices(ctx)
+	if err != nil {
+		return err
+	}
+	return doParseCtx(ctx, bytes.NewReader(body), parser)
+}
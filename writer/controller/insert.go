@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	helputils "github.com/metrico/qryn/v5/writer/utils"
@@ -152,6 +153,26 @@ func OTLPLogsV2(cfg MiddlewareConfig) func(w http.ResponseWriter, r *http.Reques
 			}))...)
 }
 
+func OTLPMetricsV2(cfg MiddlewareConfig) func(w http.ResponseWriter, r *http.Request) {
+	return Build(
+		append(cfg.ExtraMiddleware,
+			withTSAndSampleService,
+			withSimpleParser("application/json", Parser(unmarshal.UnmarshalOTLPMetricsJSONV2)),
+			withSimpleParser("*", Parser(unmarshal.UnmarshalOTLPMetricsV2)),
+			withPostRequest(func(w http.ResponseWriter, r *http.Request) error {
+				// An empty ExportMetricsServiceResponse for either encoding
+				if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write([]byte("{}"))
+					return nil
+				}
+				w.Header().Set("Content-Type", "application/x-protobuf")
+				w.WriteHeader(http.StatusOK)
+				return nil
+			}))...)
+}
+
 //var OTLPLogsV2 = Build(
 //	append(WithExtraMiddlewareDefault,
 //		withTSAndSampleService,
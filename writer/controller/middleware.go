@@ -13,6 +13,7 @@ import (
 
 	"github.com/golang/snappy"
 	"github.com/metrico/qryn/v5/writer/chwrapper"
+	"github.com/metrico/qryn/v5/writer/limits"
 	"github.com/metrico/qryn/v5/writer/service"
 	"github.com/metrico/qryn/v5/writer/utils"
 	"github.com/metrico/qryn/v5/writer/utils/errors"
@@ -199,69 +200,115 @@ var WithOverallContextMiddleware = WithPreRequest(func(w http.ResponseWriter, r
 	default:
 		return errors.New400Error(fmt.Sprintf("%s encoding not supported", r.Header.Get("Content-Encoding")))
 	}
-	ctx := r.Context()
-	// Modify context as needed
+	*r = *r.WithContext(withIngestSettings(r.Context(), dsn, meta, TTLDays, async))
+	return nil
+})
+
+// withIngestSettings stores the per-request ingestion settings (normally taken
+// from the X-CH-DSN, X-Scope-Meta, X-Ttl-Days and X-Async-Insert headers).
+func withIngestSettings(ctx context.Context, dsn string, meta string, TTLDays uint16, async int) context.Context {
 	ctx = context.WithValue(ctx, utils.ContextKeyDSN, dsn)
 	//ctx = context.WithValue(ctx, "oid", oid)
 	ctx = context.WithValue(ctx, utils.ContextKeyMeta, meta)
 	ctx = context.WithValue(ctx, utils.ContextKeyTTLDays, TTLDays)
 	ctx = context.WithValue(ctx, utils.ContextKeyAsync, async)
 	//ctx = context.WithValue(ctx, "shard", shard)
-	*r = *r.WithContext(ctx)
+	return ctx
+}
+
+// IngestLimiter enforces the ingestion limits. It is nil when no limit is set.
+var IngestLimiter *limits.Limiter
+
+// WithIngestLimits attaches the limits of the request tenant to the context. It
+// must run after WithOverallContextMiddleware.
+var WithIngestLimits = WithPreRequest(func(w http.ResponseWriter, r *http.Request) error {
+	*r = *r.WithContext(withIngestLimitsCtx(r.Context()))
 	return nil
 })
 
+func withIngestLimitsCtx(ctx context.Context) context.Context {
+	if IngestLimiter == nil {
+		return ctx
+	}
+	dsn, _ := ctx.Value(utils.ContextKeyDSN).(string)
+	return context.WithValue(ctx, utils.ContextKeyLimits, IngestLimiter.Tenant(dsn).NewRequest())
+}
+
 var withTSAndSampleService = WithPreRequest(func(w http.ResponseWriter, r *http.Request) error {
+	ctx, err := withTSAndSampleServiceCtx(r.Context())
+	if err != nil {
+		return err
+	}
+	*r = *r.WithContext(ctx)
+	return nil
+})
 
-	ctx := r.Context()
+func withTSAndSampleServiceCtx(ctx context.Context) (context.Context, error) {
 	dsn := ctx.Value(utils.ContextKeyDSN)
 	//// Assuming Registry functions are available and compatible with net/http
 	svc, err := Registry.GetSamplesService(dsn.(string))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	ctx = context.WithValue(r.Context(), utils.ContextKeySplService, svc)
+	ctx = context.WithValue(ctx, utils.ContextKeySplService, svc)
 
 	svc, err = Registry.GetTimeSeriesService(dsn.(string))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ctx = context.WithValue(ctx, utils.ContextKeyTsService, svc)
 
 	svc, err = Registry.GetProfileInsertService(dsn.(string))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ctx = context.WithValue(ctx, utils.ContextKeyProfileService, svc)
 
+	svc, err = Registry.GetHistogramsService(dsn.(string))
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, utils.ContextKeyHistogramsService, svc)
+
+	svc, err = Registry.GetExemplarsService(dsn.(string))
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, utils.ContextKeyExemplarsService, svc)
+
 	nodeName := svc.GetNodeName()
 	ctx = context.WithValue(ctx, utils.ContextKeyNode, nodeName)
+	return ctx, nil
+}
+
+var withTracesService = WithPreRequest(func(w http.ResponseWriter, r *http.Request) error {
+	ctx, err := withTracesServiceCtx(r.Context())
+	if err != nil {
+		return err
+	}
+	// Update request context
 	*r = *r.WithContext(ctx)
 	return nil
 })
 
-var withTracesService = WithPreRequest(func(w http.ResponseWriter, r *http.Request) error {
-	dsn := r.Context().Value(utils.ContextKeyDSN)
+func withTracesServiceCtx(ctx context.Context) (context.Context, error) {
+	dsn := ctx.Value(utils.ContextKeyDSN)
 
 	// Get spans attributes service
 	spanAttrsSvc, err := Registry.GetSpansSeriesService(dsn.(string))
 	if err != nil {
-		return fmt.Errorf("failed to get spans attributes service: %v", err)
+		return nil, fmt.Errorf("failed to get spans attributes service: %v", err)
 	}
 
 	// Get spans service
 	spansSvc, err := Registry.GetSpansService(dsn.(string))
 	if err != nil {
-		return fmt.Errorf("failed to get spans service: %v", err)
+		return nil, fmt.Errorf("failed to get spans service: %v", err)
 	}
 
 	// Update context with both services
-	ctx := r.Context()
 	ctx = context.WithValue(ctx, utils.ContextKeySpanAttrsService, spanAttrsSvc)
 	ctx = context.WithValue(ctx, utils.ContextKeySpansService, spansSvc)
 	ctx = context.WithValue(ctx, utils.ContextKeyNode, spansSvc.GetNodeName())
-
-	// Update request context
-	*r = *r.WithContext(ctx)
-	return nil
-})
+	return ctx, nil
+}
@@ -1,8 +1,17 @@
 package controller
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
 
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/utils"
+	"github.com/metrico/qryn/v5/writer/utils/errors"
+	"github.com/metrico/qryn/v5/writer/utils/numbercache"
 	"github.com/metrico/qryn/v5/writer/utils/unmarshal"
 )
 
@@ -41,9 +50,54 @@ func WriteStreamV2(cfg MiddlewareConfig) func(w http.ResponseWriter, r *http.Req
 	return Build(
 		append(cfg.ExtraMiddleware,
 			withTSAndSampleService,
+			withRemoteWriteVersion,
 			withUnsnappyRequest,
-			withSimpleParser("*", Parser(unmarshal.UnmarshallMetricsWriteProtoV2)),
-			withOkStatusAndBody(204, nil))...)
+			withSimpleParser("*", remoteWriteParser),
+			withPostRequest(remoteWriteResponse))...)
+}
+
+const (
+	remoteWriteProtoV1 = "prometheus.WriteRequest"
+	remoteWriteProtoV2 = "io.prometheus.write.v2.Request"
+)
+
+// withRemoteWriteVersion negotiates the remote write protocol from the
+// Content-Type proto parameter. Requests without it (or with a Content-Type we
+// can't parse, which 1.0 senders were never rejected for) are treated as 1.0.
+var withRemoteWriteVersion = withParserContext(func(w http.ResponseWriter, r *http.Request, ctx context.Context) (context.Context, error) {
+	proto := remoteWriteProtoV1
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && params["proto"] != "" {
+		proto = params["proto"]
+	}
+	switch proto {
+	case remoteWriteProtoV1:
+		return ctx, nil
+	case remoteWriteProtoV2:
+		return context.WithValue(ctx, utils.ContextKeyWriteStats, &model.WriteStats{}), nil
+	}
+	return nil, &errors.QrynError{
+		Code:    http.StatusUnsupportedMediaType,
+		Message: fmt.Sprintf("unsupported remote write protobuf message %q", proto),
+	}
+})
+
+func remoteWriteParser(ctx context.Context, body io.Reader, fpCache numbercache.ICache[uint64]) chan *model.ParserResponse {
+	if _, ok := ctx.Value(utils.ContextKeyWriteStats).(*model.WriteStats); ok {
+		return unmarshal.UnmarshallMetricsWrite2ProtoV2(ctx, body, fpCache)
+	}
+	return unmarshal.UnmarshallMetricsWriteProtoV2(ctx, body, fpCache)
+}
+
+// remoteWriteResponse answers 204; for 2.0 requests it also reports what was
+// stored, as the spec requires.
+func remoteWriteResponse(w http.ResponseWriter, r *http.Request) error {
+	if stats, ok := r.Context().Value(utils.ContextKeyWriteStats).(*model.WriteStats); ok {
+		w.Header().Set("X-Prometheus-Remote-Write-Samples-Written", strconv.FormatInt(stats.Samples.Load(), 10))
+		w.Header().Set("X-Prometheus-Remote-Write-Histograms-Written", strconv.FormatInt(stats.Histograms.Load(), 10))
+		w.Header().Set("X-Prometheus-Remote-Write-Exemplars-Written", strconv.FormatInt(stats.Exemplars.Load(), 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
 
 func WriteStreamProbeV2(w http.ResponseWriter, r *http.Request) {
@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/metrico/qryn/v5/writer/service"
+	"github.com/metrico/qryn/v5/writer/utils/numbercache"
 	"github.com/metrico/qryn/v5/writer/utils/promise"
 	"github.com/metrico/qryn/v5/writer/utils/proto/prompb"
 	"github.com/metrico/qryn/v5/writer/utils/unmarshal"
@@ -37,7 +38,8 @@ func PushPromWriteRequest(ctx context.Context, wr *prompb.WriteRequest) error {
 	}
 	node := tsSvc.GetNodeName()
 
-	res := unmarshal.UnmarshallMetricsWriteProtoV2(ctx, bytes.NewReader(data), FPCache.DB(node))
+	fpCache := numbercache.NewRequestCache(FPCache.DB(node))
+	res := unmarshal.UnmarshallMetricsWriteProtoV2(ctx, bytes.NewReader(data), fpCache)
 
 	var promises []*promise.Promise[uint32]
 	for response := range res {
@@ -47,6 +49,7 @@ func PushPromWriteRequest(ctx context.Context, wr *prompb.WriteRequest) error {
 				for range res {
 				}
 			}()
+			fpCache.Rollback()
 			return response.Error
 		}
 		promises = append(promises,
@@ -56,6 +59,7 @@ func PushPromWriteRequest(ctx context.Context, wr *prompb.WriteRequest) error {
 	}
 	for _, p := range promises {
 		if _, err := p.Get(); err != nil {
+			fpCache.Rollback()
 			return err
 		}
 	}
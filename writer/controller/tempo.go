@@ -25,6 +25,15 @@ func PushV2(cfg MiddlewareConfig) func(w http.ResponseWriter, r *http.Request) {
 
 var ClickhousePushV2 = PushV2
 
+// JaegerPushV2 handles the Jaeger collector Thrift over HTTP endpoint.
+func JaegerPushV2(cfg MiddlewareConfig) func(w http.ResponseWriter, r *http.Request) {
+	return Build(
+		append(cfg.ExtraMiddleware,
+			withTracesService,
+			withSimpleParser("*", Parser(unmarshal.UnmarshalJaegerThriftV2)),
+			withOkStatusAndBody(202, nil))...)
+}
+
 //var PushV2 = Build(
 //	append(WithExtraMiddlewareTempo,
 //		withTracesService,
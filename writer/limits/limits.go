@@ -0,0 +1,421 @@
+// Package limits implements the writer ingestion limits: per stream and per
+// tenant log line rates, label count and length, line size and the number of
+// active series per metric name. A tenant is the ClickHouse DSN the request is
+// written to (the X-CH-DSN header).
+package limits
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/metric"
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+	"github.com/metrico/qryn/v5/writer/utils/logger"
+	"golang.org/x/time/rate"
+)
+
+// Rejection reasons, used as the reason label of metric.IngestLimitRejections.
+const (
+	ReasonStreamBytesRate  = "stream_bytes_rate"
+	ReasonStreamLinesRate  = "stream_lines_rate"
+	ReasonGlobalBytesRate  = "global_bytes_rate"
+	ReasonGlobalLinesRate  = "global_lines_rate"
+	ReasonMaxLabels        = "max_labels"
+	ReasonLabelNameLength  = "label_name_length"
+	ReasonLabelValueLength = "label_value_length"
+	ReasonLineSize         = "line_size"
+	ReasonSeriesPerMetric  = "series_per_metric"
+)
+
+// seriesActiveWindow is how long a series counts as active after its last sample.
+const seriesActiveWindow = time.Hour
+
+// streamIdleTimeout is how long the rate limiters of an idle stream are kept.
+const streamIdleTimeout = 10 * time.Minute
+
+// cleanupInterval is the minimal delay between two purges of the idle state.
+const cleanupInterval = time.Minute
+
+// retryAfterPermanent is the Retry-After sent for limits that are not rates.
+const retryAfterPermanent = time.Minute
+
+// defaultBurstSeconds is the number of seconds of the rates a request may use
+// at once by default.
+const defaultBurstSeconds = 5
+
+// Config holds the ingestion limits. A zero value disables the limit.
+type Config struct {
+	StreamBytesPerSec   float64
+	StreamLinesPerSec   float64
+	GlobalBytesPerSec   float64
+	GlobalLinesPerSec   float64
+	MaxLabels           int
+	MaxLabelNameLength  int
+	MaxLabelValueLength int
+	MaxLineSize         int
+	MaxSeriesPerMetric  int
+	// BurstSeconds is the number of seconds of the rates a request may use at
+	// once, one if zero
+	BurstSeconds float64
+}
+
+// Enabled reports if any of the limits is set.
+func (c Config) Enabled() bool {
+	c.BurstSeconds = 0
+	return c != Config{}
+}
+
+// ConfigFromEnv reads the limits from the QRYN_LIMITS_* environment variables.
+func ConfigFromEnv() Config {
+	burstSeconds := envFloat("QRYN_LIMITS_BURST_SECONDS")
+	if burstSeconds == 0 {
+		burstSeconds = defaultBurstSeconds
+	}
+	return Config{
+		StreamBytesPerSec:   envFloat("QRYN_LIMITS_STREAM_BYTES_PER_SEC"),
+		StreamLinesPerSec:   envFloat("QRYN_LIMITS_STREAM_LINES_PER_SEC"),
+		GlobalBytesPerSec:   envFloat("QRYN_LIMITS_GLOBAL_BYTES_PER_SEC"),
+		GlobalLinesPerSec:   envFloat("QRYN_LIMITS_GLOBAL_LINES_PER_SEC"),
+		MaxLabels:           int(envFloat("QRYN_LIMITS_MAX_LABELS")),
+		MaxLabelNameLength:  int(envFloat("QRYN_LIMITS_MAX_LABEL_NAME_LENGTH")),
+		MaxLabelValueLength: int(envFloat("QRYN_LIMITS_MAX_LABEL_VALUE_LENGTH")),
+		MaxLineSize:         int(envFloat("QRYN_LIMITS_MAX_LINE_SIZE")),
+		MaxSeriesPerMetric:  int(envFloat("QRYN_LIMITS_MAX_SERIES_PER_METRIC")),
+		BurstSeconds:        burstSeconds,
+	}
+}
+
+func envFloat(name string) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		logger.Error("Invalid ", name, " value: ", v)
+		return 0
+	}
+	return f
+}
+
+// Limiter keeps the limits state of every tenant.
+type Limiter struct {
+	cfg     Config
+	mtx     sync.Mutex
+	tenants map[string]*Tenant
+}
+
+// New creates a Limiter. It returns nil if no limit is configured.
+func New(cfg Config) *Limiter {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Limiter{cfg: cfg, tenants: map[string]*Tenant{}}
+}
+
+// Tenant returns the limits state of a tenant. It is safe to call on a nil
+// Limiter and returns nil then.
+func (l *Limiter) Tenant(name string) *Tenant {
+	if l == nil {
+		return nil
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	t, ok := l.tenants[name]
+	if !ok {
+		t = &Tenant{
+			cfg:         l.cfg,
+			bytes:       newLimiter(l.cfg.GlobalBytesPerSec, l.cfg.BurstSeconds),
+			lines:       newLimiter(l.cfg.GlobalLinesPerSec, l.cfg.BurstSeconds),
+			streams:     map[uint64]*stream{},
+			series:      map[string]map[uint64]time.Time{},
+			lastCleanup: time.Now(),
+		}
+		l.tenants[name] = t
+	}
+	return t
+}
+
+type stream struct {
+	bytes    *rate.Limiter
+	lines    *rate.Limiter
+	lastSeen time.Time
+}
+
+// Tenant enforces the limits of a single tenant. All the methods are safe to
+// call on a nil Tenant and accept everything then.
+type Tenant struct {
+	cfg         Config
+	mtx         sync.Mutex
+	bytes       *rate.Limiter
+	lines       *rate.Limiter
+	streams     map[uint64]*stream
+	series      map[string]map[uint64]time.Time
+	lastCleanup time.Time
+}
+
+// CheckLabels validates the label count and the label name and value lengths
+// of a series. For metrics (the __name__ label is set) it also registers fp as
+// an active series of the metric.
+func (t *Tenant) CheckLabels(labels [][]string, fp uint64) error {
+	_, err := t.checkLabels(labels, fp)
+	return err
+}
+
+// checkLabels is CheckLabels returning the name of the metric fp was
+// registered as a new active series of.
+func (t *Tenant) checkLabels(labels [][]string, fp uint64) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	if t.cfg.MaxLabels > 0 && len(labels) > t.cfg.MaxLabels {
+		return "", reject(ReasonMaxLabels, retryAfterPermanent,
+			"series has %d labels, the limit is %d", len(labels), t.cfg.MaxLabels)
+	}
+	metricName := ""
+	for _, l := range labels {
+		if t.cfg.MaxLabelNameLength > 0 && len(l[0]) > t.cfg.MaxLabelNameLength {
+			return "", reject(ReasonLabelNameLength, retryAfterPermanent,
+				"label name %q is longer than %d bytes", truncate(l[0]), t.cfg.MaxLabelNameLength)
+		}
+		if t.cfg.MaxLabelValueLength > 0 && len(l[1]) > t.cfg.MaxLabelValueLength {
+			return "", reject(ReasonLabelValueLength, retryAfterPermanent,
+				"value of label %q is longer than %d bytes", truncate(l[0]), t.cfg.MaxLabelValueLength)
+		}
+		if l[0] == "__name__" {
+			metricName = l[1]
+		}
+	}
+	if metricName == "" || t.cfg.MaxSeriesPerMetric <= 0 {
+		return "", nil
+	}
+
+	now := time.Now()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.maybeCleanup(now)
+	series := t.series[metricName]
+	if series == nil {
+		series = map[uint64]time.Time{}
+		t.series[metricName] = series
+	}
+	if _, ok := series[fp]; ok {
+		series[fp] = now
+		return "", nil
+	}
+	if len(series) >= t.cfg.MaxSeriesPerMetric {
+		return "", reject(ReasonSeriesPerMetric, retryAfterPermanent,
+			"metric %q has reached the limit of %d active series", truncate(metricName), t.cfg.MaxSeriesPerMetric)
+	}
+	series[fp] = now
+	return metricName, nil
+}
+
+// CheckLines validates the size of the log lines of the stream fp and takes
+// their count and size from the stream and the tenant rate limits.
+func (t *Tenant) CheckLines(fp uint64, lines []string) error {
+	_, err := t.checkLines(fp, lines)
+	return err
+}
+
+// checkLines is CheckLines returning the buckets the tokens were taken from.
+func (t *Tenant) checkLines(fp uint64, lines []string) ([]bucket, error) {
+	if t == nil || len(lines) == 0 {
+		return nil, nil
+	}
+	size := 0
+	for _, line := range lines {
+		if t.cfg.MaxLineSize > 0 && len(line) > t.cfg.MaxLineSize {
+			return nil, reject(ReasonLineSize, retryAfterPermanent,
+				"log line of %d bytes is larger than %d bytes", len(line), t.cfg.MaxLineSize)
+		}
+		size += len(line)
+	}
+
+	now := time.Now()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.maybeCleanup(now)
+	s, ok := t.streams[fp]
+	if !ok {
+		s = &stream{
+			bytes: newLimiter(t.cfg.StreamBytesPerSec, t.cfg.BurstSeconds),
+			lines: newLimiter(t.cfg.StreamLinesPerSec, t.cfg.BurstSeconds),
+		}
+		t.streams[fp] = s
+	}
+	s.lastSeen = now
+	return takeAll(now, []bucket{
+		{s.bytes, size, ReasonStreamBytesRate},
+		{s.lines, len(lines), ReasonStreamLinesRate},
+		{t.bytes, size, ReasonGlobalBytesRate},
+		{t.lines, len(lines), ReasonGlobalLinesRate},
+	})
+}
+
+// release gives back the tokens and the active series of a rejected request.
+func (t *Tenant) release(taken []bucket, series []activeSeries) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	giveBack(time.Now(), taken)
+	for _, s := range series {
+		delete(t.series[s.metricName], s.fp)
+	}
+}
+
+type activeSeries struct {
+	metricName string
+	fp         uint64
+}
+
+// Request enforces the limits of a tenant for a single push request. The rate
+// tokens and the active series taken by a request are given back by Cancel, so
+// a rejected request does not count. All the methods are safe to call on a nil
+// Request and accept everything then.
+type Request struct {
+	t      *Tenant
+	mtx    sync.Mutex
+	taken  []bucket
+	series []activeSeries
+}
+
+// NewRequest starts a push request of the tenant. It returns nil for a nil
+// Tenant.
+func (t *Tenant) NewRequest() *Request {
+	if t == nil {
+		return nil
+	}
+	return &Request{t: t}
+}
+
+// CheckLabels is Tenant.CheckLabels within the request.
+func (r *Request) CheckLabels(labels [][]string, fp uint64) error {
+	if r == nil {
+		return nil
+	}
+	metricName, err := r.t.checkLabels(labels, fp)
+	if err != nil || metricName == "" {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.series = append(r.series, activeSeries{metricName, fp})
+	return nil
+}
+
+// CheckLines is Tenant.CheckLines within the request.
+func (r *Request) CheckLines(fp uint64, lines []string) error {
+	if r == nil {
+		return nil
+	}
+	taken, err := r.t.checkLines(fp, lines)
+	if err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.taken = append(r.taken, taken...)
+	return nil
+}
+
+// Cancel gives back the rate tokens and the active series taken by the
+// request.
+func (r *Request) Cancel() {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.t.release(r.taken, r.series)
+	r.taken, r.series = nil, nil
+}
+
+// maybeCleanup forgets the idle streams and the inactive series.
+func (t *Tenant) maybeCleanup(now time.Time) {
+	if now.Sub(t.lastCleanup) < cleanupInterval {
+		return
+	}
+	t.lastCleanup = now
+	for fp, s := range t.streams {
+		if now.Sub(s.lastSeen) > streamIdleTimeout {
+			delete(t.streams, fp)
+		}
+	}
+	for name, series := range t.series {
+		for fp, lastSeen := range series {
+			if now.Sub(lastSeen) > seriesActiveWindow {
+				delete(series, fp)
+			}
+		}
+		if len(series) == 0 {
+			delete(t.series, name)
+		}
+	}
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	n       int
+	reason  string
+}
+
+// takeAll takes n tokens from every bucket or none of them and returns the
+// buckets the tokens were taken from.
+func takeAll(now time.Time, buckets []bucket) ([]bucket, error) {
+	taken := make([]bucket, 0, len(buckets))
+	for _, b := range buckets {
+		if b.limiter == nil {
+			continue
+		}
+		r := b.limiter.ReserveN(now, b.n)
+		if !r.OK() {
+			// more than the burst never fits, a retry would be rejected again
+			giveBack(now, taken)
+			metric.IngestLimitRejections.WithLabelValues(b.reason).Inc()
+			return nil, customErrors.NewTooLargeError(b.reason, fmt.Sprintf(
+				"%d exceeds the %s burst of %d", b.n, b.reason, b.limiter.Burst()))
+		}
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			giveBack(now, taken)
+			return nil, reject(b.reason, delay,
+				"%s limit of %v per second exceeded", b.reason, b.limiter.Limit())
+		}
+		taken = append(taken, b)
+	}
+	return taken, nil
+}
+
+// giveBack returns the tokens taken from the buckets. A reservation acting
+// immediately cannot be canceled, so the tokens are put back by a negative
+// reservation; the limiter caps them to its burst.
+func giveBack(now time.Time, taken []bucket) {
+	for _, b := range taken {
+		b.limiter.ReserveN(now, -b.n)
+	}
+}
+
+// newLimiter creates a token bucket holding burstSeconds of the rate, at least
+// one second. It returns nil for a disabled limit.
+func newLimiter(perSec float64, burstSeconds float64) *rate.Limiter {
+	if perSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(perSec), int(math.Max(math.Ceil(perSec*math.Max(burstSeconds, 1)), 1)))
+}
+
+func reject(reason string, retryAfter time.Duration, format string, args ...any) error {
+	metric.IngestLimitRejections.WithLabelValues(reason).Inc()
+	return customErrors.NewLimitError(reason, fmt.Sprintf(format, args...), retryAfter)
+}
+
+func truncate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
@@ -0,0 +1,165 @@
+package limits
+
+import (
+	"testing"
+
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+)
+
+func limitReason(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	e, ok := customErrors.Unwrap[*customErrors.LimitError](err)
+	if !ok {
+		t.Fatalf("unexpected error type: %v", err)
+	}
+	if e.GetCode() != 429 || e.RetryAfter <= 0 {
+		t.Errorf("code = %d, retry after = %v", e.GetCode(), e.RetryAfter)
+	}
+	return e.Reason
+}
+
+func TestDisabledLimiter(t *testing.T) {
+	l := New(Config{})
+	if l != nil {
+		t.Fatal("limiter must be nil without limits")
+	}
+	tenant := l.Tenant("")
+	if err := tenant.CheckLines(1, []string{"line"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenant.CheckLabels([][]string{{"a", "b"}}, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+	tenant := New(Config{MaxLabels: 2, MaxLabelNameLength: 8, MaxLabelValueLength: 4}).Tenant("")
+	for _, c := range []struct {
+		labels [][]string
+		reason string
+	}{
+		{[][]string{{"app", "api"}}, ""},
+		{[][]string{{"app", "api"}, {"env", "dev"}, {"pod", "p1"}}, ReasonMaxLabels},
+		{[][]string{{"very_long_name", "api"}}, ReasonLabelNameLength},
+		{[][]string{{"app", "a-long-value"}}, ReasonLabelValueLength},
+	} {
+		if reason := limitReason(t, tenant.CheckLabels(c.labels, 1)); reason != c.reason {
+			t.Errorf("%v: reason = %q, want %q", c.labels, reason, c.reason)
+		}
+	}
+}
+
+func TestCheckSeriesPerMetric(t *testing.T) {
+	tenant := New(Config{MaxSeriesPerMetric: 2}).Tenant("")
+	up := func(instance string) [][]string {
+		return [][]string{{"__name__", "up"}, {"instance", instance}}
+	}
+	for fp := uint64(1); fp <= 2; fp++ {
+		if err := tenant.CheckLabels(up("i"), fp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tenant.CheckLabels(up("i"), 1); err != nil {
+		t.Fatal("known series must be accepted: ", err)
+	}
+	if reason := limitReason(t, tenant.CheckLabels(up("i"), 3)); reason != ReasonSeriesPerMetric {
+		t.Errorf("reason = %q", reason)
+	}
+	other := [][]string{{"__name__", "down"}}
+	if err := tenant.CheckLabels(other, 3); err != nil {
+		t.Fatal("the limit is per metric name: ", err)
+	}
+}
+
+func TestCheckLines(t *testing.T) {
+	l := New(Config{MaxLineSize: 10, StreamLinesPerSec: 2, GlobalBytesPerSec: 12})
+	tenant := l.Tenant("")
+	if reason := limitReason(t, tenant.CheckLines(1, []string{"a line that is too long"})); reason != ReasonLineSize {
+		t.Errorf("reason = %q", reason)
+	}
+	if err := tenant.CheckLines(1, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if reason := limitReason(t, tenant.CheckLines(1, []string{"c"})); reason != ReasonStreamLinesRate {
+		t.Errorf("reason = %q", reason)
+	}
+	if err := tenant.CheckLines(2, []string{"0123456789"}); err != nil {
+		t.Fatal("a rejected request must not take tokens: ", err)
+	}
+	if reason := limitReason(t, tenant.CheckLines(3, []string{"d"})); reason != ReasonGlobalBytesRate {
+		t.Errorf("reason = %q", reason)
+	}
+	if err := l.Tenant("other").CheckLines(3, []string{"d"}); err != nil {
+		t.Fatal("the global limits are per tenant: ", err)
+	}
+}
+
+func TestRequestCancel(t *testing.T) {
+	tenant := New(Config{StreamLinesPerSec: 2, MaxSeriesPerMetric: 1}).Tenant("")
+	req := tenant.NewRequest()
+	if err := req.CheckLabels([][]string{{"__name__", "up"}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := req.CheckLines(1, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if reason := limitReason(t, req.CheckLines(1, []string{"c"})); reason != ReasonStreamLinesRate {
+		t.Fatalf("reason = %q", reason)
+	}
+	req.Cancel()
+
+	req = tenant.NewRequest()
+	if err := req.CheckLines(1, []string{"a", "b"}); err != nil {
+		t.Error("a canceled request must give its tokens back: ", err)
+	}
+	if err := req.CheckLabels([][]string{{"__name__", "up"}}, 2); err != nil {
+		t.Error("a canceled request must free its series: ", err)
+	}
+
+	var disabled *Request
+	if err := disabled.CheckLines(1, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	disabled.Cancel()
+}
+
+func TestRejectedLinesTakeNoTokens(t *testing.T) {
+	tenant := New(Config{StreamLinesPerSec: 2, GlobalLinesPerSec: 2}).Tenant("")
+	if err := tenant.CheckLines(1, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if reason := limitReason(t, tenant.CheckLines(2, []string{"b", "c"})); reason != ReasonGlobalLinesRate {
+		t.Fatalf("reason = %q", reason)
+	}
+	if err := tenant.CheckLines(2, []string{"b"}); err != nil {
+		t.Error("the stream tokens of rejected lines must be given back: ", err)
+	}
+}
+
+func TestBurst(t *testing.T) {
+	t.Setenv("QRYN_LIMITS_STREAM_LINES_PER_SEC", "2")
+	cfg := ConfigFromEnv()
+	if cfg.BurstSeconds != defaultBurstSeconds {
+		t.Fatalf("burst seconds = %v, want %v", cfg.BurstSeconds, defaultBurstSeconds)
+	}
+	tenant := New(cfg).Tenant("")
+	lines := make([]string, 2*defaultBurstSeconds)
+	if err := tenant.CheckLines(1, lines); err != nil {
+		t.Fatal("a request within the burst must be accepted: ", err)
+	}
+	if reason := limitReason(t, tenant.CheckLines(1, []string{"a"})); reason != ReasonStreamLinesRate {
+		t.Errorf("reason = %q", reason)
+	}
+
+	err := tenant.CheckLines(2, make([]string, 2*defaultBurstSeconds+1))
+	e, ok := customErrors.Unwrap[*customErrors.LimitError](err)
+	if !ok || e.GetCode() != 413 || e.RetryAfter != 0 || e.Reason != ReasonStreamLinesRate {
+		t.Errorf("a request larger than the burst must not be retried: %v", err)
+	}
+	if err := tenant.CheckLines(2, lines); err != nil {
+		t.Error("a request larger than the burst must not take tokens: ", err)
+	}
+}
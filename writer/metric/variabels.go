@@ -22,6 +22,30 @@ var (
 		Name: "sent_bytes",
 		Help: "The total number of bytes sent",
 	}, []string{"service"})
+	IngestLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingest_limit_rejections_count",
+		Help: "The total number of requests rejected by the ingestion limits",
+	}, []string{"reason"})
+	SpoolDepthRecords = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "spool_depth_records",
+		Help: "The number of spooled batches waiting to be inserted",
+	}, []string{"node", "service"})
+	SpoolDepthBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "spool_depth_bytes",
+		Help: "The size of the spooled batches waiting to be inserted",
+	}, []string{"node", "service"})
+	SpoolAgeSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "spool_age_seconds",
+		Help: "The age of the oldest spooled batch waiting to be inserted",
+	}, []string{"node", "service"})
+	SpoolDroppedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spool_dropped_records",
+		Help: "The total number of spooled batches dropped by the spool size cap",
+	}, []string{"node", "service"})
+	SpoolDroppedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "spool_dropped_bytes",
+		Help: "The total size of spooled batches dropped by the spool size cap",
+	}, []string{"node", "service"})
 	TxCloseTime = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name: "tx_close_time_ms",
 		Help: "Transaction close time in milliseconds",
@@ -170,17 +170,51 @@ func (t *TimeSeriesData) GetSize() int64 {
 	return int64(t.Size)
 }
 
+// TimeSamplesData is a batch of samples. MStructuredMetadata holds the Loki
+// structured metadata of every log line encoded as a JSON object. It may be
+// shorter than the other columns, missing rows carry no metadata.
 type TimeSamplesData struct {
+	MFingerprint        []uint64
+	MTimestampNS        []int64
+	MMessage            []string
+	MValue              []float64
+	MTTLDays            []uint16
+	Size                int
+	MType               []uint8
+	MStructuredMetadata []string
+}
+
+func (t *TimeSamplesData) GetSize() int64 {
+	return int64(t.Size)
+}
+
+// HistogramsData is a batch of native histogram samples. MHistogram holds
+// the protobuf-encoded remote write 2.0 histogram of every sample.
+type HistogramsData struct {
+	MFingerprint []uint64
+	MTimestampNS []int64
+	MCount       []float64
+	MSum         []float64
+	MHistogram   [][]byte
+	Size         int
+}
+
+func (t *HistogramsData) GetSize() int64 {
+	return int64(t.Size)
+}
+
+// ExemplarsData is a batch of exemplars. MLabels holds the exemplar labels
+// encoded as a JSON object.
+type ExemplarsData struct {
 	MFingerprint []uint64
 	MTimestampNS []int64
-	MMessage     []string
 	MValue       []float64
-	MTTLDays     []uint16
+	MTraceID     []string
+	MLabels      []string
 	Size         int
-	MType        []uint8
 }
 
-func (t *TimeSamplesData) GetSize() int64 {
+func (t *ExemplarsData) GetSize() int64 {
 	return int64(t.Size)
 }
 
@@ -9,4 +9,6 @@ type ParserResponse struct {
 	SpansAttrsRequest helpers.SizeGetter
 	SpansRequest      helpers.SizeGetter
 	ProfileRequest    helpers.SizeGetter
+	HistogramsRequest helpers.SizeGetter
+	ExemplarsRequest  helpers.SizeGetter
 }
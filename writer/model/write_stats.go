@@ -0,0 +1,11 @@
+package model
+
+import "sync/atomic"
+
+// WriteStats counts what a decoder handed over for storage. The remote write
+// 2.0 handler reports it back in the X-Prometheus-Remote-Write-*-Written headers.
+type WriteStats struct {
+	Samples    atomic.Int64
+	Histograms atomic.Int64
+	Exemplars  atomic.Int64
+}
@@ -0,0 +1,83 @@
+package otlpgrpc
+
+import (
+	"context"
+
+	controllerv1 "github.com/metrico/qryn/v5/writer/controller"
+	"google.golang.org/grpc"
+)
+
+// postSpansRequest keeps the raw jaeger.api_v2.PostSpansRequest: the protobuf
+// codec hands it over through the legacy Unmarshal method, and the decoding is
+// done by the same parser as the other trace formats.
+type postSpansRequest struct {
+	body []byte
+}
+
+func (r *postSpansRequest) Reset()         { r.body = nil }
+func (r *postSpansRequest) String() string { return "jaeger.api_v2.PostSpansRequest" }
+func (r *postSpansRequest) ProtoMessage()  {}
+
+func (r *postSpansRequest) Unmarshal(buf []byte) error {
+	r.body = append([]byte(nil), buf...)
+	return nil
+}
+
+func (r *postSpansRequest) Marshal() ([]byte, error) {
+	return r.body, nil
+}
+
+// postSpansResponse is the empty jaeger.api_v2.PostSpansResponse.
+type postSpansResponse struct{}
+
+func (r *postSpansResponse) Reset()         {}
+func (r *postSpansResponse) String() string { return "jaeger.api_v2.PostSpansResponse" }
+func (r *postSpansResponse) ProtoMessage()  {}
+
+func (r *postSpansResponse) Unmarshal([]byte) error {
+	return nil
+}
+
+func (r *postSpansResponse) Marshal() ([]byte, error) {
+	return []byte{}, nil
+}
+
+type jaegerCollectorServer interface {
+	PostSpans(ctx context.Context, req *postSpansRequest) (*postSpansResponse, error)
+}
+
+type jaegerServer struct{}
+
+func (s *jaegerServer) PostSpans(ctx context.Context, req *postSpansRequest) (*postSpansResponse, error) {
+	return &postSpansResponse{}, toStatus(controllerv1.PushJaegerSpans(ctx, ingestSettings(ctx), req.body))
+}
+
+func postSpansHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := &postSpansRequest{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(jaegerCollectorServer).PostSpans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/jaeger.api_v2.CollectorService/PostSpans",
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(jaegerCollectorServer).PostSpans(ctx, req.(*postSpansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// jaegerCollectorServiceDesc describes jaeger.api_v2.CollectorService, the
+// gRPC API of the Jaeger collector.
+var jaegerCollectorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "jaeger.api_v2.CollectorService",
+	HandlerType: (*jaegerCollectorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "PostSpans", Handler: postSpansHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "collector.proto",
+}
@@ -0,0 +1,221 @@
+// Package otlpgrpc implements an optional OTLP/gRPC receiver for logs, traces,
+// metrics and profiles, and the Jaeger collector gRPC API. Requests are
+// re-encoded to protobuf and fed through the same decoders and insert pipeline
+// as the HTTP endpoints.
+package otlpgrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	clconfig "github.com/metrico/cloki-config"
+	controllerv1 "github.com/metrico/qryn/v5/writer/controller"
+	"github.com/metrico/qryn/v5/writer/service"
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+	"github.com/metrico/qryn/v5/writer/utils/logger"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the gzip compressor
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxRecvMsgSize caps a single Export request; the gRPC default of 4MiB is too
+// small for batched collector exports.
+const maxRecvMsgSize = 64 * 1024 * 1024
+
+var server *grpc.Server
+
+// Port returns the listen port from QRYN_OTLP_GRPC_PORT, or 0 when the receiver
+// is disabled.
+func Port() int {
+	if v := os.Getenv("QRYN_OTLP_GRPC_PORT"); v != "" {
+		if p, err := strconv.Atoi(v); err == nil && p > 0 && p < 65536 {
+			return p
+		}
+		logger.Error("Invalid QRYN_OTLP_GRPC_PORT value: ", v)
+	}
+	return 0
+}
+
+// Init starts the OTLP/gRPC receiver on QRYN_OTLP_GRPC_PORT. It is a no-op when
+// the port is not set. It must be called after the writer registry is ready.
+func Init(cfg *clconfig.ClokiConfig) {
+	port := Port()
+	if port == 0 {
+		return
+	}
+	addr := fmt.Sprintf("%s:%d", cfg.Setting.HTTP_SETTINGS.Host, port)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("OTLP/gRPC receiver not started: ", err)
+		return
+	}
+	server = NewServer(cfg.Setting.AUTH_SETTINGS.BASIC.Username, cfg.Setting.AUTH_SETTINGS.BASIC.Password)
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			logger.Error("OTLP/gRPC receiver stopped: ", err)
+		}
+	}()
+	logger.Info("OTLP/gRPC receiver is listening on ", addr)
+}
+
+// Stop drains in-flight Export calls and stops the receiver.
+func Stop() {
+	if server == nil {
+		return
+	}
+	server.GracefulStop()
+	server = nil
+}
+
+// NewServer builds a gRPC server with all four OTLP services and the Jaeger
+// CollectorService registered. Basic auth is enforced when both login and
+// password are set, as for HTTP.
+func NewServer(login, password string) *grpc.Server {
+	var opts = []grpc.ServerOption{grpc.MaxRecvMsgSize(maxRecvMsgSize)}
+	if login != "" && password != "" {
+		opts = append(opts, grpc.UnaryInterceptor(basicAuthInterceptor(login, password)))
+	}
+	s := grpc.NewServer(opts...)
+	plogotlp.RegisterGRPCServer(s, &logsServer{})
+	ptraceotlp.RegisterGRPCServer(s, &tracesServer{})
+	pmetricotlp.RegisterGRPCServer(s, &metricsServer{})
+	pprofileotlp.RegisterGRPCServer(s, &profilesServer{})
+	s.RegisterService(&jaegerCollectorServiceDesc, &jaegerServer{})
+	return s
+}
+
+type logsServer struct {
+	plogotlp.UnimplementedGRPCServer
+}
+
+func (s *logsServer) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return plogotlp.NewExportResponse(), status.Error(codes.InvalidArgument, err.Error())
+	}
+	return plogotlp.NewExportResponse(), toStatus(controllerv1.PushOTLPLogs(ctx, ingestSettings(ctx), body))
+}
+
+type tracesServer struct {
+	ptraceotlp.UnimplementedGRPCServer
+}
+
+func (s *tracesServer) Export(ctx context.Context, req ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return ptraceotlp.NewExportResponse(), status.Error(codes.InvalidArgument, err.Error())
+	}
+	return ptraceotlp.NewExportResponse(), toStatus(controllerv1.PushOTLPTraces(ctx, ingestSettings(ctx), body))
+}
+
+type metricsServer struct {
+	pmetricotlp.UnimplementedGRPCServer
+}
+
+func (s *metricsServer) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return pmetricotlp.NewExportResponse(), status.Error(codes.InvalidArgument, err.Error())
+	}
+	return pmetricotlp.NewExportResponse(), toStatus(controllerv1.PushOTLPMetrics(ctx, ingestSettings(ctx), body))
+}
+
+type profilesServer struct {
+	pprofileotlp.UnimplementedGRPCServer
+}
+
+func (s *profilesServer) Export(ctx context.Context, req pprofileotlp.ExportRequest) (pprofileotlp.ExportResponse, error) {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return pprofileotlp.NewExportResponse(), status.Error(codes.InvalidArgument, err.Error())
+	}
+	return pprofileotlp.NewExportResponse(), toStatus(controllerv1.PushOTLPProfiles(ctx, ingestSettings(ctx), body))
+}
+
+// ingestSettings reads the gRPC equivalents of the HTTP ingestion headers.
+func ingestSettings(ctx context.Context) controllerv1.IngestSettings {
+	res := controllerv1.DefaultIngestSettings()
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return res
+	}
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return strings.Clone(v[0])
+		}
+		return ""
+	}
+	res.DSN = get("x-ch-dsn")
+	res.Meta = get("x-scope-meta")
+	if v := get("x-ttl-days"); v != "" {
+		if ttl, err := strconv.ParseUint(v, 10, 16); err == nil {
+			res.TTLDays = uint16(ttl)
+		}
+	}
+	switch get("x-async-insert") {
+	case "0":
+		res.Async = service.INSERT_MODE_SYNC
+	case "1":
+		res.Async = service.INSERT_MODE_ASYNC
+	}
+	return res
+}
+
+// toStatus maps ingestion errors to gRPC codes. Client errors are permanent
+// (InvalidArgument); everything else is reported as Unavailable so OTLP
+// exporters retry, as the spec requires for transient failures.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := customErrors.Unwrap[customErrors.IQrynError](err); ok {
+		switch {
+		case e.GetCode() == 401:
+			return status.Error(codes.Unauthenticated, e.Error())
+		case e.GetCode() == 429:
+			return status.Error(codes.ResourceExhausted, e.Error())
+		case e.GetCode() >= 400 && e.GetCode() < 500:
+			return status.Error(codes.InvalidArgument, e.Error())
+		}
+	}
+	logger.Error(err)
+	return status.Error(codes.Unavailable, "internal server error")
+}
+
+func basicAuthInterceptor(login, password string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkBasicAuth(ctx, login, password); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func checkBasicAuth(ctx context.Context, login, password string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := md.Get("authorization")
+	if len(auth) == 0 {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	authParts := strings.SplitN(auth[0], " ", 2)
+	if len(authParts) != 2 || authParts[0] != "Basic" {
+		return status.Error(codes.Unauthenticated, "Invalid authorization header")
+	}
+	payload, _ := base64.StdEncoding.DecodeString(authParts[1])
+	pair := strings.SplitN(string(payload), ":", 2)
+	if len(pair) != 2 || pair[0] != login || pair[1] != password {
+		return status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package otlpgrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/metrico/qryn/v5/writer/service"
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestBasicAuthRejectsGzipExport(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := NewServer("user", "secret")
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logs := plog.NewLogs()
+	logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("hello")
+	client := plogotlp.NewGRPCClient(conn)
+
+	for name, auth := range map[string]string{
+		"missing": "",
+		"wrong":   "Basic " + base64.StdEncoding.EncodeToString([]byte("user:nope")),
+		"scheme":  "Bearer token",
+	} {
+		ctx := context.Background()
+		if auth != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+		}
+		_, err := client.Export(ctx, plogotlp.NewExportRequestFromLogs(logs))
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("%s auth: expected Unauthenticated, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckBasicAuth(t *testing.T) {
+	good := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", good))
+	if err := checkBasicAuth(ctx, "user", "secret"); err != nil {
+		t.Errorf("expected valid credentials to pass, got %v", err)
+	}
+}
+
+func TestIngestSettings(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-ch-dsn", "clickhouse://other",
+		"x-scope-meta", "org=1",
+		"x-ttl-days", "7",
+		"x-async-insert", "1"))
+	s := ingestSettings(ctx)
+	if s.DSN != "clickhouse://other" || s.Meta != "org=1" || s.TTLDays != 7 || s.Async != service.INSERT_MODE_ASYNC {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+	s = ingestSettings(context.Background())
+	if s.DSN != "" || s.TTLDays != 0 || s.Async != service.INSERT_MODE_DEFAULT {
+		t.Errorf("unexpected default settings: %+v", s)
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{nil, codes.OK},
+		{customErrors.New400Error("bad"), codes.InvalidArgument},
+		{customErrors.NewUnmarshalError(errors.New("bad proto")), codes.InvalidArgument},
+		{customErrors.New429Error("slow down"), codes.ResourceExhausted},
+		{errors.New("clickhouse is down"), codes.Unavailable},
+	}
+	for _, c := range cases {
+		if got := status.Code(toStatus(c.err)); got != c.code {
+			t.Errorf("toStatus(%v) = %v, want %v", c.err, got, c.code)
+		}
+	}
+}
+
+func TestJaegerPostSpansRequiresAuth(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+	s := NewServer("user", "secret")
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// An empty PostSpansRequest is decoded before the auth check.
+	err = conn.Invoke(context.Background(), "/jaeger.api_v2.CollectorService/PostSpans",
+		&postSpansRequest{}, &postSpansResponse{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+}
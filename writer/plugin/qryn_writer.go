@@ -47,6 +47,8 @@ var (
 	TempoTagsSvcs     = make(service.InsertSvcMap)
 	ProfileInsertSvcs = make(service.InsertSvcMap)
 	PatternInsertSvcs = make(service.InsertSvcMap)
+	HistogramsSvcs    = make(service.InsertSvcMap)
+	ExemplarsSvcs     = make(service.InsertSvcMap)
 )
 
 // var servicesObject ServicesObject
@@ -154,7 +156,8 @@ func (p *QrynWriterPlugin) Stop() error {
 
 	allServices := []service.InsertSvcMap{
 		TsSvcs, SplSvcs, MtrSvcs, TempoSamplesSvcs,
-		TempoTagsSvcs, ProfileInsertSvcs, PatternInsertSvcs,
+		TempoTagsSvcs, ProfileInsertSvcs, PatternInsertSvcs, HistogramsSvcs,
+		ExemplarsSvcs,
 	}
 	for _, svcMap := range allServices {
 		for _, svc := range svcMap {
@@ -188,6 +191,8 @@ func (p *QrynWriterPlugin) Stop() error {
 	TempoTagsSvcs = make(service.InsertSvcMap)
 	ProfileInsertSvcs = make(service.InsertSvcMap)
 	PatternInsertSvcs = make(service.InsertSvcMap)
+	HistogramsSvcs = make(service.InsertSvcMap)
+	ExemplarsSvcs = make(service.InsertSvcMap)
 	ServiceRegistry.Stop()
 	ServiceRegistry = nil
 	GoCache.Stop()
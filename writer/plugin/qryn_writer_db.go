@@ -15,6 +15,8 @@ import (
 	"github.com/metrico/qryn/v5/writer/service"
 	"github.com/metrico/qryn/v5/writer/service/insert"
 	"github.com/metrico/qryn/v5/writer/service/registry"
+	"github.com/metrico/qryn/v5/writer/spool"
+	"github.com/metrico/qryn/v5/writer/utils/helpers"
 	"github.com/metrico/qryn/v5/writer/utils/logger"
 	"github.com/metrico/qryn/v5/writer/utils/numbercache"
 	"github.com/metrico/qryn/v5/writer/watchdog"
@@ -114,6 +116,7 @@ func healthCheck(conn chwrapper.IChClient, isDistributed bool) {
 
 func (p *QrynWriterPlugin) CreateStaticServiceRegistry(config config.ClokiBaseSettingServer) {
 	databasesNodeHashMap := make(map[string]*model.DataDatabasesMap)
+	spools := spool.New(spool.ConfigFromEnv())
 	for _, node := range p.ServicesObject.DatabaseNodeMap {
 		databasesNodeHashMap[node.Node] = &node
 	}
@@ -151,6 +154,26 @@ func (p *QrynWriterPlugin) CreateStaticServiceRegistry(config config.ClokiBaseSe
 			OnBeforeInsert: func() { tsSvc.PlanFlush() },
 		})
 
+		histogramsSvc := insert.NewHistogramsInsertService(model.InsertServiceOpts{
+			Session:        p.ServicesObject.Dbv3Map[i],
+			Node:           &node,
+			Interval:       time.Millisecond * time.Duration(config.SYSTEM_SETTINGS.DBTimer*1000),
+			ParallelNum:    config.SYSTEM_SETTINGS.ChannelsSample,
+			AsyncInsert:    node.AsyncInsert,
+			MaxQueueSize:   int64(config.SYSTEM_SETTINGS.DBBulk),
+			OnBeforeInsert: func() { tsSvc.PlanFlush() },
+		})
+
+		exemplarsSvc := insert.NewExemplarsInsertService(model.InsertServiceOpts{
+			Session:        p.ServicesObject.Dbv3Map[i],
+			Node:           &node,
+			Interval:       time.Millisecond * time.Duration(config.SYSTEM_SETTINGS.DBTimer*1000),
+			ParallelNum:    config.SYSTEM_SETTINGS.ChannelsSample,
+			AsyncInsert:    node.AsyncInsert,
+			MaxQueueSize:   int64(config.SYSTEM_SETTINGS.DBBulk),
+			OnBeforeInsert: func() { tsSvc.PlanFlush() },
+		})
+
 		var tempoTagsSvc service.IInsertServiceV2
 
 		tempoSamplesSvc := insert.NewTempoSamplesInsertService(model.InsertServiceOpts{
@@ -190,11 +213,40 @@ func (p *QrynWriterPlugin) CreateStaticServiceRegistry(config config.ClokiBaseSe
 			MaxQueueSize: int64(config.SYSTEM_SETTINGS.DBBulk),
 		})
 
+		// Put all the insert services behind the disk spool, if enabled, so the
+		// watchdog does not stop the writer while ClickHouse is unreachable.
+		tsSvc = spools.Wrap(tsSvc, node.Node, "time_series",
+			func() helpers.SizeGetter { return &model.TimeSeriesData{} })
+		splSvc = spools.Wrap(splSvc, node.Node, "samples",
+			func() helpers.SizeGetter { return &model.TimeSamplesData{} })
+		mtrSvc = spools.Wrap(mtrSvc, node.Node, "metrics",
+			func() helpers.SizeGetter { return &model.TimeSamplesData{} })
+		histogramsSvc = spools.Wrap(histogramsSvc, node.Node, "histograms",
+			func() helpers.SizeGetter { return &model.HistogramsData{} })
+		exemplarsSvc = spools.Wrap(exemplarsSvc, node.Node, "exemplars",
+			func() helpers.SizeGetter { return &model.ExemplarsData{} })
+		tempoSamplesSvc = spools.Wrap(tempoSamplesSvc, node.Node, "tempo_traces",
+			func() helpers.SizeGetter { return &model.TempoSamples{} })
+		tempoTagsSvc = spools.Wrap(tempoTagsSvc, node.Node, "tempo_traces_attrs",
+			func() helpers.SizeGetter { return &model.TempoTag{} })
+		profileInsertSvc = spools.Wrap(profileInsertSvc, node.Node, "profiles",
+			func() helpers.SizeGetter { return &model.ProfileData{} })
+		patternInsertSvc = spools.Wrap(patternInsertSvc, node.Node, "patterns",
+			func() helpers.SizeGetter { return &model.PatternsData{} })
+
 		// Initialize and run services
 		MtrSvcs[node.Node] = mtrSvc
 		MtrSvcs[node.Node].Init()
 		go MtrSvcs[node.Node].Run()
 
+		HistogramsSvcs[node.Node] = histogramsSvc
+		HistogramsSvcs[node.Node].Init()
+		go HistogramsSvcs[node.Node].Run()
+
+		ExemplarsSvcs[node.Node] = exemplarsSvc
+		ExemplarsSvcs[node.Node].Init()
+		go ExemplarsSvcs[node.Node].Run()
+
 		TempoTagsSvcs[node.Node] = tempoTagsSvc
 		TempoTagsSvcs[node.Node].Init()
 		go TempoTagsSvcs[node.Node].Run()
@@ -229,6 +281,8 @@ func (p *QrynWriterPlugin) CreateStaticServiceRegistry(config config.ClokiBaseSe
 		TempoTagsSvcs:     TempoTagsSvcs,
 		ProfileInsertSvcs: ProfileInsertSvcs,
 		PatternInsertSvcs: PatternInsertSvcs,
+		HistogramsSvcs:    HistogramsSvcs,
+		ExemplarsSvcs:     ExemplarsSvcs,
 	})
 
 	GoCache = numbercache.NewCache(time.Minute*30, func(val uint64) []byte {
@@ -243,6 +297,8 @@ func (p *QrynWriterPlugin) CreateStaticServiceRegistry(config config.ClokiBaseSe
 		TempoTagsSvcs,
 		ProfileInsertSvcs,
 		PatternInsertSvcs,
+		HistogramsSvcs,
+		ExemplarsSvcs,
 	})
 
 	if config2.Cloki.Setting.DRILLDOWN_SETTINGS.LogDrilldown {
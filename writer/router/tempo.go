@@ -10,4 +10,5 @@ func RouteInsertTempoApis(router *mux.Router, cfg controllerv1.MiddlewareConfig)
 	router.HandleFunc("/tempo/api/push", controllerv1.ClickhousePushV2(cfg)).Methods("POST")
 	router.HandleFunc("/api/v2/spans", controllerv1.PushV2(cfg)).Methods("POST")
 	router.HandleFunc("/v1/traces", controllerv1.OTLPPushV2(cfg)).Methods("POST")
+	router.HandleFunc("/api/traces", controllerv1.JaegerPushV2(cfg)).Methods("POST")
 }
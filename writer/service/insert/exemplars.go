@@ -0,0 +1,88 @@
+package insert
+
+import (
+	"fmt"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/service"
+)
+
+type exemplarsAcquirer struct {
+	Fingerprint *service.PooledColumn[proto.ColUInt64]
+	TimestampNS *service.PooledColumn[proto.ColInt64]
+	Value       *service.PooledColumn[proto.ColFloat64]
+	TraceID     *service.PooledColumn[*proto.ColStr]
+	Labels      *service.PooledColumn[*proto.ColStr]
+}
+
+func (a *exemplarsAcquirer) acq() *exemplarsAcquirer {
+	service.StartAcq()
+	defer service.FinishAcq()
+	a.Fingerprint = service.UInt64Pool.Acquire("fingerprint")
+	a.TimestampNS = service.Int64Pool.Acquire("timestamp_ns")
+	a.Value = service.Float64Pool.Acquire("value")
+	a.TraceID = service.StrPool.Acquire("trace_id")
+	a.Labels = service.StrPool.Acquire("labels")
+	return a
+}
+
+func (a *exemplarsAcquirer) serialize() []service.IColPoolRes {
+	return []service.IColPoolRes{a.Fingerprint, a.TimestampNS, a.Value, a.TraceID, a.Labels}
+}
+
+func (a *exemplarsAcquirer) deserialize(res []service.IColPoolRes) *exemplarsAcquirer {
+	a.Fingerprint, a.TimestampNS, a.Value, a.TraceID, a.Labels =
+		res[0].(*service.PooledColumn[proto.ColUInt64]),
+		res[1].(*service.PooledColumn[proto.ColInt64]),
+		res[2].(*service.PooledColumn[proto.ColFloat64]),
+		res[3].(*service.PooledColumn[*proto.ColStr]),
+		res[4].(*service.PooledColumn[*proto.ColStr])
+	return a
+}
+
+func NewExemplarsInsertService(opts model.InsertServiceOpts) service.IInsertServiceV2 {
+	if opts.ParallelNum <= 0 {
+		opts.ParallelNum = 1
+	}
+	tableName := "exemplars"
+	if opts.Node.ClusterName != "" {
+		tableName += "_dist"
+	}
+	insertReq := fmt.Sprintf("INSERT INTO %s (fingerprint, timestamp_ns, value, trace_id, labels)",
+		tableName)
+
+	return &service.InsertServiceV2Multimodal{
+		ServiceData:    service.ServiceData{},
+		V3Session:      opts.Session,
+		DatabaseNode:   opts.Node,
+		PushInterval:   opts.Interval,
+		SvcNum:         opts.ParallelNum,
+		AsyncInsert:    opts.AsyncInsert,
+		InsertRequest:  insertReq,
+		ServiceType:    "exemplars",
+		MaxQueueSize:   opts.MaxQueueSize,
+		OnBeforeInsert: opts.OnBeforeInsert,
+		AcquireColumns: func() []service.IColPoolRes {
+			return (&exemplarsAcquirer{}).acq().serialize()
+		},
+		ProcessRequest: func(v2 any, res []service.IColPoolRes) (int, []service.IColPoolRes, error) {
+			exmData, ok := v2.(*model.ExemplarsData)
+			if !ok {
+				return 0, nil, fmt.Errorf("invalid request exemplars")
+			}
+			exms := (&exemplarsAcquirer{}).deserialize(res)
+			_len := len(exms.Fingerprint.Data)
+			exms.Fingerprint.Data = append(exms.Fingerprint.Data, exmData.MFingerprint...)
+			exms.TimestampNS.Data = append(exms.TimestampNS.Data, exmData.MTimestampNS...)
+			exms.Value.Data = append(exms.Value.Data, exmData.MValue...)
+			for _, t := range exmData.MTraceID {
+				exms.TraceID.Data.Append(t)
+			}
+			for _, l := range exmData.MLabels {
+				exms.Labels.Data.Append(l)
+			}
+			return len(exms.Fingerprint.Data) - _len, exms.serialize(), nil
+		},
+	}
+}
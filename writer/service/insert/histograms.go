@@ -0,0 +1,86 @@
+package insert
+
+import (
+	"fmt"
+
+	"github.com/ClickHouse/ch-go/proto"
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/service"
+)
+
+type histogramsAcquirer struct {
+	Fingerprint *service.PooledColumn[proto.ColUInt64]
+	TimestampNS *service.PooledColumn[proto.ColInt64]
+	Count       *service.PooledColumn[proto.ColFloat64]
+	Sum         *service.PooledColumn[proto.ColFloat64]
+	Histogram   *service.PooledColumn[*proto.ColStr]
+}
+
+func (a *histogramsAcquirer) acq() *histogramsAcquirer {
+	service.StartAcq()
+	defer service.FinishAcq()
+	a.Fingerprint = service.UInt64Pool.Acquire("fingerprint")
+	a.TimestampNS = service.Int64Pool.Acquire("timestamp_ns")
+	a.Count = service.Float64Pool.Acquire("count")
+	a.Sum = service.Float64Pool.Acquire("sum")
+	a.Histogram = service.StrPool.Acquire("histogram")
+	return a
+}
+
+func (a *histogramsAcquirer) serialize() []service.IColPoolRes {
+	return []service.IColPoolRes{a.Fingerprint, a.TimestampNS, a.Count, a.Sum, a.Histogram}
+}
+
+func (a *histogramsAcquirer) deserialize(res []service.IColPoolRes) *histogramsAcquirer {
+	a.Fingerprint, a.TimestampNS, a.Count, a.Sum, a.Histogram =
+		res[0].(*service.PooledColumn[proto.ColUInt64]),
+		res[1].(*service.PooledColumn[proto.ColInt64]),
+		res[2].(*service.PooledColumn[proto.ColFloat64]),
+		res[3].(*service.PooledColumn[proto.ColFloat64]),
+		res[4].(*service.PooledColumn[*proto.ColStr])
+	return a
+}
+
+func NewHistogramsInsertService(opts model.InsertServiceOpts) service.IInsertServiceV2 {
+	if opts.ParallelNum <= 0 {
+		opts.ParallelNum = 1
+	}
+	tableName := "native_histograms"
+	if opts.Node.ClusterName != "" {
+		tableName += "_dist"
+	}
+	insertReq := fmt.Sprintf("INSERT INTO %s (fingerprint, timestamp_ns, count, sum, histogram)",
+		tableName)
+
+	return &service.InsertServiceV2Multimodal{
+		ServiceData:    service.ServiceData{},
+		V3Session:      opts.Session,
+		DatabaseNode:   opts.Node,
+		PushInterval:   opts.Interval,
+		SvcNum:         opts.ParallelNum,
+		AsyncInsert:    opts.AsyncInsert,
+		InsertRequest:  insertReq,
+		ServiceType:    "histograms",
+		MaxQueueSize:   opts.MaxQueueSize,
+		OnBeforeInsert: opts.OnBeforeInsert,
+		AcquireColumns: func() []service.IColPoolRes {
+			return (&histogramsAcquirer{}).acq().serialize()
+		},
+		ProcessRequest: func(v2 any, res []service.IColPoolRes) (int, []service.IColPoolRes, error) {
+			histData, ok := v2.(*model.HistogramsData)
+			if !ok {
+				return 0, nil, fmt.Errorf("invalid request histograms")
+			}
+			hists := (&histogramsAcquirer{}).deserialize(res)
+			_len := len(hists.Fingerprint.Data)
+			hists.Fingerprint.Data = append(hists.Fingerprint.Data, histData.MFingerprint...)
+			hists.TimestampNS.Data = append(hists.TimestampNS.Data, histData.MTimestampNS...)
+			hists.Count.Data = append(hists.Count.Data, histData.MCount...)
+			hists.Sum.Data = append(hists.Sum.Data, histData.MSum...)
+			for _, h := range histData.MHistogram {
+				hists.Histogram.Data.AppendBytes(h)
+			}
+			return len(hists.Fingerprint.Data) - _len, hists.serialize(), nil
+		},
+	}
+}
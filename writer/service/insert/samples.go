@@ -11,11 +11,12 @@ import (
 )
 
 type SamplesAcquirer struct {
-	Type        *service.PooledColumn[proto.ColUInt8]
-	Fingerprint *service.PooledColumn[proto.ColUInt64]
-	TimestampNS *service.PooledColumn[proto.ColInt64]
-	String      *service.PooledColumn[*proto.ColStr]
-	Value       *service.PooledColumn[proto.ColFloat64]
+	Type               *service.PooledColumn[proto.ColUInt8]
+	Fingerprint        *service.PooledColumn[proto.ColUInt64]
+	TimestampNS        *service.PooledColumn[proto.ColInt64]
+	String             *service.PooledColumn[*proto.ColStr]
+	Value              *service.PooledColumn[proto.ColFloat64]
+	StructuredMetadata *service.PooledColumn[*proto.ColStr]
 }
 
 func (a *SamplesAcquirer) acq() *SamplesAcquirer {
@@ -26,21 +27,23 @@ func (a *SamplesAcquirer) acq() *SamplesAcquirer {
 	a.TimestampNS = service.Int64Pool.Acquire("timestamp_ns")
 	a.String = service.StrPool.Acquire("string")
 	a.Value = service.Float64Pool.Acquire("value")
+	a.StructuredMetadata = service.StrPool.Acquire("structured_metadata")
 	return a
 }
 
 func (a *SamplesAcquirer) serialize() []service.IColPoolRes {
-	return []service.IColPoolRes{a.Type, a.Fingerprint, a.TimestampNS, a.String, a.Value}
+	return []service.IColPoolRes{a.Type, a.Fingerprint, a.TimestampNS, a.String, a.Value, a.StructuredMetadata}
 }
 
 func (a *SamplesAcquirer) deserialize(res []service.IColPoolRes) *SamplesAcquirer {
-	a.Type, a.Fingerprint, a.TimestampNS, a.String, a.Value =
+	a.Type, a.Fingerprint, a.TimestampNS, a.String, a.Value, a.StructuredMetadata =
 
 		res[0].(*service.PooledColumn[proto.ColUInt8]),
 		res[1].(*service.PooledColumn[proto.ColUInt64]),
 		res[2].(*service.PooledColumn[proto.ColInt64]),
 		res[3].(*service.PooledColumn[*proto.ColStr]),
-		res[4].(*service.PooledColumn[proto.ColFloat64])
+		res[4].(*service.PooledColumn[proto.ColFloat64]),
+		res[5].(*service.PooledColumn[*proto.ColStr])
 	return a
 }
 
@@ -57,7 +60,7 @@ func NewSamplesInsertService(opts model.InsertServiceOpts) service.IInsertServic
 	if opts.Node.ClusterName != "" {
 		table += "_dist"
 	}
-	insertReq := fmt.Sprintf("INSERT INTO %s (type,fingerprint, timestamp_ns, string, value)",
+	insertReq := fmt.Sprintf("INSERT INTO %s (type,fingerprint, timestamp_ns, string, value, structured_metadata)",
 		table)
 	return &service.InsertServiceV2Multimodal{
 		ServiceData:    service.ServiceData{},
@@ -99,6 +102,13 @@ func NewSamplesInsertService(opts model.InsertServiceOpts) service.IInsertServic
 			for _, mMessage := range timeSeriesData.MMessage {
 				samples.String.Data.Append(mMessage)
 			}
+			for i := range timeSeriesData.MTimestampNS {
+				if i < len(timeSeriesData.MStructuredMetadata) {
+					samples.StructuredMetadata.Data.Append(timeSeriesData.MStructuredMetadata[i])
+					continue
+				}
+				samples.StructuredMetadata.Data.Append("")
+			}
 			return len(samples.Fingerprint.Data) - _len, samples.serialize(), nil
 		},
 	}
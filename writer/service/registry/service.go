@@ -10,6 +10,8 @@ type ServiceRegistry interface {
 	GetSpansSeriesService(id string) (service.IInsertServiceV2, error)
 	GetProfileInsertService(id string) (service.IInsertServiceV2, error)
 	GetPatternInsertService(id string) (service.IInsertServiceV2, error)
+	GetHistogramsService(id string) (service.IInsertServiceV2, error)
+	GetExemplarsService(id string) (service.IInsertServiceV2, error)
 	Run()
 	Stop()
 }
@@ -16,6 +16,8 @@ type staticServiceRegistry struct {
 	TempoTagsSvcs     []service.IInsertServiceV2
 	ProfileInsertSvcs []service.IInsertServiceV2
 	PatternInsertSvcs []service.IInsertServiceV2
+	HistogramsSvcs    []service.IInsertServiceV2
+	ExemplarsSvcs     []service.IInsertServiceV2
 	rand              *rand.Rand
 	mtx               sync.Mutex
 }
@@ -28,6 +30,8 @@ type StaticServiceRegistryOpts struct {
 	TempoTagsSvcs     map[string]service.IInsertServiceV2
 	ProfileInsertSvcs map[string]service.IInsertServiceV2
 	PatternInsertSvcs map[string]service.IInsertServiceV2
+	HistogramsSvcs    map[string]service.IInsertServiceV2
+	ExemplarsSvcs     map[string]service.IInsertServiceV2
 }
 
 func mapToSlice(m map[string]service.IInsertServiceV2) []service.IInsertServiceV2 {
@@ -49,6 +53,8 @@ func NewStaticServiceRegistry(opts StaticServiceRegistryOpts) ServiceRegistry {
 	res.TempoTagsSvcs = mapToSlice(opts.TempoTagsSvcs)
 	res.ProfileInsertSvcs = mapToSlice(opts.ProfileInsertSvcs)
 	res.PatternInsertSvcs = mapToSlice(opts.PatternInsertSvcs)
+	res.HistogramsSvcs = mapToSlice(opts.HistogramsSvcs)
+	res.ExemplarsSvcs = mapToSlice(opts.ExemplarsSvcs)
 	return &res
 }
 
@@ -102,6 +108,14 @@ func (r *staticServiceRegistry) GetPatternInsertService(id string) (service.IIns
 	return r.getService(id, r.PatternInsertSvcs)
 }
 
+func (r *staticServiceRegistry) GetHistogramsService(id string) (service.IInsertServiceV2, error) {
+	return r.getService(id, r.HistogramsSvcs)
+}
+
+func (r *staticServiceRegistry) GetExemplarsService(id string) (service.IInsertServiceV2, error) {
+	return r.getService(id, r.ExemplarsSvcs)
+}
+
 func (r *staticServiceRegistry) Run() {}
 
 func (r *staticServiceRegistry) Stop() {}
@@ -0,0 +1,441 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/metric"
+	"github.com/metrico/qryn/v5/writer/utils/logger"
+)
+
+// recordHeaderSize is the size of the record header: payload length (uint32),
+// CRC32 of the rest of the record (uint32), write time in ns (int64) and the
+// insert mode (uint8).
+const recordHeaderSize = 17
+
+const (
+	segmentExt   = ".wal"
+	positionFile = "position"
+)
+
+type record struct {
+	ts      int64
+	mode    uint8
+	payload []byte
+	seq     uint64
+	next    int64
+}
+
+type segment struct {
+	seq     uint64
+	size    int64
+	records int64
+	firstTS int64
+}
+
+// queue is an append-only sequence of segment files and the replay position.
+// Replayed segments are deleted.
+type queue struct {
+	mgr  *Manager
+	dir  string
+	node string
+	name string
+
+	mtx      sync.Mutex
+	segments []*segment
+	active   *os.File
+	readSeq  uint64
+	readOff  int64
+	readIdx  int64
+	depth    int64
+	headTS   int64
+	notify   chan struct{}
+}
+
+func openQueue(mgr *Manager, dir string, node string, name string) (*queue, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	q := &queue{
+		mgr:    mgr,
+		dir:    dir,
+		node:   node,
+		name:   name,
+		notify: make(chan struct{}, 1),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), segmentExt), 10, 64)
+		if e.IsDir() || !strings.HasSuffix(e.Name(), segmentExt) || err != nil {
+			continue
+		}
+		q.segments = append(q.segments, &segment{seq: seq})
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].seq < q.segments[j].seq })
+
+	q.readPosition()
+	for len(q.segments) > 0 && q.segments[0].seq < q.readSeq {
+		os.Remove(q.segmentPath(q.segments[0].seq))
+		q.segments = q.segments[1:]
+	}
+	if len(q.segments) == 0 || q.segments[0].seq > q.readSeq {
+		q.readOff, q.readIdx = 0, 0
+	}
+	for _, s := range q.segments {
+		err = q.recoverSegment(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(q.segments) > 0 {
+		q.readSeq = q.segments[0].seq
+	} else {
+		q.readSeq = max(q.readSeq, 1)
+		q.segments = []*segment{{seq: q.readSeq}}
+	}
+	if q.readOff > q.segments[0].size || q.readIdx > q.segments[0].records {
+		q.readOff, q.readIdx = 0, 0
+	}
+	for _, s := range q.segments {
+		q.depth += s.records
+	}
+	q.depth -= q.readIdx
+	last := q.segments[len(q.segments)-1]
+	q.active, err = os.OpenFile(q.segmentPath(last.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	q.updateMetrics(time.Now())
+	return q, nil
+}
+
+func (q *queue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// readPosition loads the replay position persisted by writePosition.
+func (q *queue) readPosition() {
+	q.readSeq = 1
+	data, err := os.ReadFile(filepath.Join(q.dir, positionFile))
+	if err != nil {
+		return
+	}
+	_, err = fmt.Sscanf(string(data), "%d %d %d", &q.readSeq, &q.readOff, &q.readIdx)
+	if err != nil {
+		logger.Error("spool ", q.dir, ": invalid replay position: ", err)
+		q.readSeq, q.readOff, q.readIdx = 1, 0, 0
+	}
+}
+
+func (q *queue) writePosition() {
+	tmp := filepath.Join(q.dir, positionFile+".tmp")
+	err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d %d", q.readSeq, q.readOff, q.readIdx)), 0o644)
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(q.dir, positionFile))
+	}
+	if err != nil {
+		logger.Error("spool ", q.dir, ": unable to save the replay position: ", err)
+	}
+}
+
+// recoverSegment counts the valid records of a segment and truncates the torn
+// record a crash may leave at its end.
+func (q *queue) recoverSegment(s *segment) error {
+	f, err := os.OpenFile(q.segmentPath(s.seq), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var off int64
+	for {
+		rec, err := readRecord(r, s.seq, off)
+		if err != nil {
+			if err != io.EOF {
+				logger.Error("spool ", q.dir, ": truncating segment ", s.seq, " at ", off, ": ", err)
+				if err := f.Truncate(off); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if s.records == 0 {
+			s.firstTS = rec.ts
+		}
+		s.records++
+		off = rec.next
+	}
+	s.size = off
+	return nil
+}
+
+func readRecord(r io.Reader, seq uint64, off int64) (record, error) {
+	var hdr [recordHeaderSize]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("torn record header")
+		}
+		return record{}, err
+	}
+	rec := record{
+		ts:      int64(binary.LittleEndian.Uint64(hdr[8:16])),
+		mode:    hdr[16],
+		payload: make([]byte, binary.LittleEndian.Uint32(hdr[0:4])),
+		seq:     seq,
+	}
+	_, err = io.ReadFull(r, rec.payload)
+	if err != nil {
+		return record{}, fmt.Errorf("torn record: %w", err)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[8:])
+	crc.Write(rec.payload)
+	if crc.Sum32() != binary.LittleEndian.Uint32(hdr[4:8]) {
+		return record{}, fmt.Errorf("record checksum mismatch")
+	}
+	rec.next = off + recordHeaderSize + int64(len(rec.payload))
+	return rec, nil
+}
+
+// append writes a record and syncs it to disk.
+func (q *queue) append(ts int64, mode uint8, payload []byte) error {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(ts))
+	buf[16] = mode
+	copy(buf[recordHeaderSize:], payload)
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(buf[8:]))
+
+	err := func() error {
+		q.mtx.Lock()
+		defer q.mtx.Unlock()
+		if q.active == nil {
+			return fmt.Errorf("spool is closed")
+		}
+		last := q.segments[len(q.segments)-1]
+		if _, err := q.active.Write(buf); err != nil {
+			// Drop the partial record, the next append must start at a record boundary.
+			q.active.Truncate(last.size)
+			return err
+		}
+		if err := q.active.Sync(); err != nil {
+			return err
+		}
+		if last.records == 0 {
+			last.firstTS = ts
+		}
+		last.size += int64(len(buf))
+		last.records++
+		q.depth++
+		if last.size >= q.mgr.segmentBytes {
+			if err := q.rotate(); err != nil {
+				// The record is stored, keep appending to the current segment.
+				logger.Error("spool ", q.dir, ": unable to start a new segment: ", err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	q.mgr.add(int64(len(buf)))
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	q.mgr.enforce()
+	return nil
+}
+
+// rotate starts a new segment. It must be called with mtx held.
+func (q *queue) rotate() error {
+	seq := q.segments[len(q.segments)-1].seq + 1
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	q.active.Close()
+	q.active = f
+	q.segments = append(q.segments, &segment{seq: seq})
+	return nil
+}
+
+// readBatch reads up to maxRecords records or maxBytes bytes from the replay
+// position without moving it.
+func (q *queue) readBatch(maxRecords int, maxBytes int64) ([]record, error) {
+	var freed int64
+	q.mtx.Lock()
+	// The replayed segment may only be deleted once a new one is started.
+	for q.readOff >= q.segments[0].size && len(q.segments) > 1 {
+		freed += q.segments[0].size
+		q.removeFirst()
+		q.writePosition()
+	}
+	seq, off, size := q.readSeq, q.readOff, q.segments[0].size
+	q.mtx.Unlock()
+	q.mgr.add(-freed)
+	if off >= size {
+		return nil, nil
+	}
+
+	f, err := os.Open(q.segmentPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, err = f.Seek(off, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(io.LimitReader(f, size-off))
+	var res []record
+	var bytes int64
+	for off < size && len(res) < maxRecords && bytes < maxBytes {
+		rec, err := readRecord(r, seq, off)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, rec)
+		bytes += rec.next - off
+		off = rec.next
+	}
+	return res, nil
+}
+
+// commit moves the replay position after the batch and deletes the segment
+// once it is fully replayed. Batches of dropped segments are ignored.
+func (q *queue) commit(batch []record) {
+	if len(batch) == 0 {
+		return
+	}
+	var freed int64
+	func() {
+		q.mtx.Lock()
+		defer q.mtx.Unlock()
+		last := batch[len(batch)-1]
+		if last.seq != q.readSeq || last.next <= q.readOff {
+			return
+		}
+		q.readOff = last.next
+		q.readIdx += int64(len(batch))
+		q.depth -= int64(len(batch))
+		q.headTS = 0
+		if q.readOff >= q.segments[0].size && len(q.segments) > 1 {
+			freed = q.segments[0].size
+			q.removeFirst()
+		}
+		q.writePosition()
+	}()
+	q.mgr.add(-freed)
+}
+
+// removeFirst deletes the first segment and moves the replay position to the
+// next one. It must be called with mtx held.
+func (q *queue) removeFirst() {
+	err := os.Remove(q.segmentPath(q.segments[0].seq))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("spool ", q.dir, ": ", err)
+	}
+	q.segments = q.segments[1:]
+	q.readSeq, q.readOff, q.readIdx = q.segments[0].seq, 0, 0
+}
+
+// oldestDroppable returns the write time of the first record of the oldest
+// segment if it may be dropped.
+func (q *queue) oldestDroppable() (int64, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.segments) < 2 {
+		return 0, false
+	}
+	return q.segments[0].firstTS, true
+}
+
+// dropOldest deletes the oldest segment with its pending records and returns
+// its size.
+func (q *queue) dropOldest() int64 {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.segments) < 2 {
+		return 0
+	}
+	s := q.segments[0]
+	records := s.records - q.readIdx
+	metric.SpoolDroppedRecords.WithLabelValues(q.node, q.name).Add(float64(records))
+	metric.SpoolDroppedBytes.WithLabelValues(q.node, q.name).Add(float64(s.size - q.readOff))
+	logger.Error(fmt.Sprintf("spool %s is full: dropped %d records", q.dir, records))
+	q.depth -= records
+	q.headTS = 0
+	q.removeFirst()
+	q.writePosition()
+	return s.size
+}
+
+// dropped reports if the segment of the batch was dropped by the size cap.
+func (q *queue) dropped(batch []record) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return batch[0].seq != q.readSeq
+}
+
+func (q *queue) setHeadTS(ts int64) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.headTS = ts
+}
+
+func (q *queue) sizeBytes() int64 {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	var size int64
+	for _, s := range q.segments {
+		size += s.size
+	}
+	return size
+}
+
+// updateMetrics exposes the number and size of the pending records and the
+// age of the oldest one.
+func (q *queue) updateMetrics(now time.Time) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	var size int64
+	for _, s := range q.segments {
+		size += s.size
+	}
+	metric.SpoolDepthRecords.WithLabelValues(q.node, q.name).Set(float64(q.depth))
+	metric.SpoolDepthBytes.WithLabelValues(q.node, q.name).Set(float64(size - q.readOff))
+	age := 0.0
+	if q.depth > 0 {
+		headTS := q.headTS
+		if headTS == 0 {
+			headTS = q.segments[0].firstTS
+		}
+		age = now.Sub(time.Unix(0, headTS)).Seconds()
+	}
+	metric.SpoolAgeSeconds.WithLabelValues(q.node, q.name).Set(max(age, 0))
+}
+
+func (q *queue) close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.active != nil {
+		q.active.Close()
+		q.active = nil
+	}
+}
@@ -0,0 +1,187 @@
+package spool
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/service"
+	"github.com/metrico/qryn/v5/writer/utils/helpers"
+	"github.com/metrico/qryn/v5/writer/utils/logger"
+	"github.com/metrico/qryn/v5/writer/utils/promise"
+)
+
+const (
+	replayBatchRecords = 256
+	replayBatchBytes   = 16 * 1024 * 1024
+	replayMinBackoff   = time.Second
+	replayMaxBackoff   = 10 * time.Second
+	stopTimeout        = 5 * time.Second
+)
+
+// Service is an IInsertServiceV2 storing the requests in a spool queue before
+// replaying them to the wrapped service. A request is complete once it is
+// synced to disk. Delivery to ClickHouse is at least once: the batches being
+// replayed while the writer stops are sent again on the next start.
+type Service struct {
+	svc        service.IInsertServiceV2
+	q          *queue
+	newRequest func() helpers.SizeGetter
+	// failing is set while the requests can not be spooled and go to the
+	// wrapped service directly
+	failing atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newService(svc service.IInsertServiceV2, q *queue, newRequest func() helpers.SizeGetter) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		svc:        svc,
+		q:          q,
+		newRequest: newRequest,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+}
+
+func (s *Service) Init() {
+	s.svc.Init()
+}
+
+// Run starts the replay and runs the wrapped service.
+func (s *Service) Run() {
+	go s.replay()
+	s.svc.Run()
+}
+
+func (s *Service) Stop() {
+	s.cancel()
+	s.svc.Stop()
+	select {
+	case <-s.done:
+	case <-time.After(stopTimeout):
+		logger.Error("spool ", s.q.dir, ": replay did not stop in time")
+	}
+	s.q.close()
+	s.q.mgr.remove(s.q)
+}
+
+// Request appends req to the spool. If the spool can not be written the
+// request is sent to the wrapped service directly.
+func (s *Service) Request(req helpers.SizeGetter, insertMode int) *promise.Promise[uint32] {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(req)
+	if err == nil {
+		err = s.q.append(time.Now().UnixNano(), uint8(insertMode), buf.Bytes())
+	}
+	s.failing.Store(err != nil)
+	if err != nil {
+		logger.Error("spool ", s.q.dir, ": ", err)
+		return s.svc.Request(req, insertMode)
+	}
+	return promise.Fulfilled[uint32](nil, 0)
+}
+
+// Ping reports the wrapped service only while the spool can not be written.
+// Otherwise the spool keeps the data while ClickHouse is unreachable and the
+// outage is only logged.
+func (s *Service) Ping() (time.Time, error) {
+	t, err := s.svc.Ping()
+	if err == nil || s.failing.Load() {
+		return t, err
+	}
+	logger.Error("spool ", s.q.dir, ": spooling while the insert service is unavailable: ", err)
+	return time.Now(), nil
+}
+
+func (s *Service) GetState(insertMode int) int {
+	return s.svc.GetState(insertMode)
+}
+
+func (s *Service) GetNodeName() string {
+	return s.svc.GetNodeName()
+}
+
+func (s *Service) PlanFlush() {
+	s.svc.PlanFlush()
+}
+
+// replay sends the spooled batches to the wrapped service in order. The records
+// of a batch which are not inserted are retried with a backoff until they are
+// or the batch is dropped by the size cap.
+func (s *Service) replay() {
+	defer close(s.done)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		batch, err := s.q.readBatch(replayBatchRecords, replayBatchBytes)
+		if err != nil {
+			logger.Error("spool ", s.q.dir, ": ", err)
+		}
+		s.q.updateMetrics(time.Now())
+		if len(batch) == 0 {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.q.notify:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		s.q.setHeadTS(batch[0].ts)
+		backoff := replayMinBackoff
+		pending := batch
+		for !s.q.dropped(batch) {
+			pending, err = s.push(pending)
+			if err == nil {
+				break
+			}
+			logger.Error(fmt.Sprintf("spool %s: replay failed, retrying in %v: %v", s.q.dir, backoff, err))
+			s.q.updateMetrics(time.Now())
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, replayMaxBackoff)
+		}
+		s.q.commit(batch)
+	}
+}
+
+// push sends all the records of the batch and waits for their insertion. It
+// returns the records which are not inserted and the first error.
+func (s *Service) push(batch []record) ([]record, error) {
+	pushed := make([]record, 0, len(batch))
+	promises := make([]*promise.Promise[uint32], 0, len(batch))
+	for _, rec := range batch {
+		req := s.newRequest()
+		err := gob.NewDecoder(bytes.NewReader(rec.payload)).Decode(req)
+		if err != nil {
+			logger.Error("spool ", s.q.dir, ": skipping undecodable record: ", err)
+			continue
+		}
+		pushed = append(pushed, rec)
+		promises = append(promises, s.svc.Request(req, int(rec.mode)))
+	}
+	var failed []record
+	var res error
+	for i, p := range promises {
+		_, err := p.GetCtx(s.ctx)
+		if err != nil {
+			failed = append(failed, pushed[i])
+			if res == nil {
+				res = err
+			}
+		}
+	}
+	return failed, res
+}
@@ -0,0 +1,130 @@
+// Package spool implements an optional on-disk write-ahead spool in front of
+// the ClickHouse insert services. Accepted batches are appended to segment
+// files and replayed in order to the wrapped service, so the writer keeps
+// accepting data while ClickHouse is unreachable.
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/metrico/qryn/v5/writer/service"
+	"github.com/metrico/qryn/v5/writer/utils/helpers"
+	"github.com/metrico/qryn/v5/writer/utils/logger"
+)
+
+// defaultMaxBytes caps the spool when QRYN_SPOOL_MAX_BYTES is not set.
+const defaultMaxBytes = 1024 * 1024 * 1024
+
+// Config of the spool. An empty Dir disables the spool.
+type Config struct {
+	Dir string
+	// MaxBytes caps the size of all the spooled segments. The oldest segments
+	// are dropped once it is exceeded.
+	MaxBytes int64
+}
+
+// ConfigFromEnv reads the spool configuration from QRYN_SPOOL_DIR and
+// QRYN_SPOOL_MAX_BYTES.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Dir:      os.Getenv("QRYN_SPOOL_DIR"),
+		MaxBytes: defaultMaxBytes,
+	}
+	if v := os.Getenv("QRYN_SPOOL_MAX_BYTES"); v != "" {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			logger.Error("Invalid QRYN_SPOOL_MAX_BYTES value: ", v)
+		} else {
+			cfg.MaxBytes = maxBytes
+		}
+	}
+	return cfg
+}
+
+// Manager owns the spool queues of all the insert services and enforces the
+// common size cap.
+type Manager struct {
+	cfg          Config
+	segmentBytes int64
+	total        atomic.Int64
+	mtx          sync.Mutex
+	queues       []*queue
+}
+
+// New creates a Manager. It returns nil if the spool is disabled.
+func New(cfg Config) *Manager {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &Manager{
+		cfg:          cfg,
+		segmentBytes: min(max(cfg.MaxBytes/16, 1024*1024), 64*1024*1024),
+	}
+}
+
+// Wrap puts svc behind a spool queue stored in <Dir>/<node>/<name>. newRequest
+// returns an empty request of the type svc accepts and is used to decode the
+// spooled batches. Wrap returns svc unchanged if the spool is disabled or the
+// queue can not be opened.
+func (m *Manager) Wrap(svc service.IInsertServiceV2, node string, name string,
+	newRequest func() helpers.SizeGetter,
+) service.IInsertServiceV2 {
+	if m == nil {
+		return svc
+	}
+	q, err := openQueue(m, filepath.Join(m.cfg.Dir, node, name), node, name)
+	if err != nil {
+		logger.Error("spool for ", node, "/", name, " is disabled: ", err)
+		return svc
+	}
+	m.mtx.Lock()
+	m.queues = append(m.queues, q)
+	m.mtx.Unlock()
+	m.total.Add(q.sizeBytes())
+	m.enforce()
+	return newService(svc, q, newRequest)
+}
+
+func (m *Manager) add(size int64) {
+	m.total.Add(size)
+}
+
+// enforce drops the oldest segments until the spool fits into MaxBytes. The
+// segments being written are never dropped.
+func (m *Manager) enforce() {
+	if m.total.Load() <= m.cfg.MaxBytes {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for m.total.Load() > m.cfg.MaxBytes {
+		var victim *queue
+		var victimTS int64
+		for _, q := range m.queues {
+			ts, ok := q.oldestDroppable()
+			if ok && (victim == nil || ts < victimTS) {
+				victim, victimTS = q, ts
+			}
+		}
+		if victim == nil {
+			return
+		}
+		m.total.Add(-victim.dropOldest())
+	}
+}
+
+func (m *Manager) remove(q *queue) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for i, _q := range m.queues {
+		if _q == q {
+			m.queues = append(m.queues[:i], m.queues[i+1:]...)
+			m.total.Add(-q.sizeBytes())
+			return
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package spool
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/service"
+	"github.com/metrico/qryn/v5/writer/utils/helpers"
+	"github.com/metrico/qryn/v5/writer/utils/promise"
+	"github.com/metrico/qryn/v5/writer/watchdog"
+)
+
+type fakeInsertService struct {
+	mtx      sync.Mutex
+	down     bool
+	messages []string
+	// failures is the number of times the request of a message fails
+	failures map[string]int
+}
+
+func (f *fakeInsertService) Run()                        {}
+func (f *fakeInsertService) Stop()                       {}
+func (f *fakeInsertService) Init()                       {}
+func (f *fakeInsertService) PlanFlush()                  {}
+func (f *fakeInsertService) GetNodeName() string         { return "node" }
+func (f *fakeInsertService) GetState(insertMode int) int { return 0 }
+
+func (f *fakeInsertService) Request(req helpers.SizeGetter, insertMode int) *promise.Promise[uint32] {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.down {
+		return promise.Fulfilled[uint32](fmt.Errorf("connection refused"), 0)
+	}
+	messages := req.(*model.TimeSamplesData).MMessage
+	if n := f.failures[messages[0]]; n > 0 {
+		f.failures[messages[0]] = n - 1
+		return promise.Fulfilled[uint32](fmt.Errorf("too many parts"), 0)
+	}
+	f.messages = append(f.messages, messages...)
+	return promise.Fulfilled[uint32](nil, 0)
+}
+
+func (f *fakeInsertService) Ping() (time.Time, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.down {
+		return time.Time{}, fmt.Errorf("connection refused")
+	}
+	return time.Now(), nil
+}
+
+func (f *fakeInsertService) setDown(down bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.down = down
+}
+
+func (f *fakeInsertService) received() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return append([]string{}, f.messages...)
+}
+
+func newSamples(message string) *model.TimeSamplesData {
+	return &model.TimeSamplesData{
+		MFingerprint: []uint64{1},
+		MTimestampNS: []int64{1},
+		MMessage:     []string{message},
+		MValue:       []float64{0},
+		MTTLDays:     []uint16{0},
+		MType:        []uint8{model.SAMPLE_TYPE_LOG},
+		Size:         len(message),
+	}
+}
+
+func wrap(mgr *Manager, svc *fakeInsertService) *Service {
+	res := mgr.Wrap(svc, "node", "samples", func() helpers.SizeGetter { return &model.TimeSamplesData{} })
+	s, ok := res.(*Service)
+	if !ok {
+		panic("spool is not enabled")
+	}
+	go s.Run()
+	return s
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSpoolReplaysInOrderAfterOutage(t *testing.T) {
+	dir := t.TempDir()
+	svc := &fakeInsertService{down: true}
+	s := wrap(New(Config{Dir: dir, MaxBytes: 1 << 30}), svc)
+	for i := 0; i < 5; i++ {
+		_, err := s.Request(newSamples(fmt.Sprint(i)), 2).Get()
+		if err != nil {
+			t.Fatal("requests must be accepted while the database is down: ", err)
+		}
+	}
+	waitFor(t, func() bool {
+		s.q.mtx.Lock()
+		defer s.q.mtx.Unlock()
+		return s.q.headTS != 0
+	})
+	svc.setDown(false)
+	waitFor(t, func() bool { return len(svc.received()) == 5 })
+	for i, m := range svc.received() {
+		if m != fmt.Sprint(i) {
+			t.Fatalf("unexpected order: %v", svc.received())
+		}
+	}
+	s.Stop()
+}
+
+func TestSpoolRetriesOnlyFailedRecords(t *testing.T) {
+	svc := &fakeInsertService{down: true, failures: map[string]int{"2": 1}}
+	s := wrap(New(Config{Dir: t.TempDir(), MaxBytes: 1 << 30}), svc)
+	defer s.Stop()
+	for i := 0; i < 5; i++ {
+		s.Request(newSamples(fmt.Sprint(i)), 2)
+	}
+	waitFor(t, func() bool {
+		s.q.mtx.Lock()
+		defer s.q.mtx.Unlock()
+		return s.q.headTS != 0
+	})
+	svc.setDown(false)
+	waitFor(t, func() bool {
+		s.q.mtx.Lock()
+		defer s.q.mtx.Unlock()
+		return s.q.depth == 0
+	})
+	received := map[string]int{}
+	for _, m := range svc.received() {
+		received[m]++
+	}
+	for i := 0; i < 5; i++ {
+		if received[fmt.Sprint(i)] != 1 {
+			t.Fatalf("every record must be inserted once: %v", svc.received())
+		}
+	}
+}
+
+func TestSpoolKeepsWatchdogRunningDuringOutage(t *testing.T) {
+	svc := &fakeInsertService{down: true}
+	watchdog.Init([]service.InsertSvcMap{{"node": svc}})
+	err := watchdog.Check()
+	watchdog.Stop()
+	if err == nil {
+		t.Fatal("the watchdog must report the service without a spool")
+	}
+
+	s := wrap(New(Config{Dir: t.TempDir(), MaxBytes: 1 << 30}), svc)
+	defer s.Stop()
+	watchdog.Init([]service.InsertSvcMap{{"node": s}})
+	defer watchdog.Stop()
+	s.Request(newSamples("0"), 2)
+	if err := watchdog.Check(); err != nil {
+		t.Fatal("the writer must keep running while the data is spooled: ", err)
+	}
+
+	// Once the spool can not be written the outage is fatal again.
+	s.q.close()
+	s.Request(newSamples("1"), 2)
+	if err := watchdog.Check(); err == nil {
+		t.Fatal("the watchdog must report the outage when the spool can not be written")
+	}
+}
+
+func TestSpoolSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	down := &fakeInsertService{down: true}
+	s := wrap(New(Config{Dir: dir, MaxBytes: 1 << 30}), down)
+	for i := 0; i < 3; i++ {
+		s.Request(newSamples(fmt.Sprint(i)), 2)
+	}
+	s.Stop()
+	if len(down.received()) != 0 {
+		t.Fatal("nothing must be inserted while the database is down")
+	}
+
+	up := &fakeInsertService{}
+	s = wrap(New(Config{Dir: dir, MaxBytes: 1 << 30}), up)
+	waitFor(t, func() bool { return len(up.received()) == 3 })
+	s.Stop()
+
+	again := &fakeInsertService{}
+	s = wrap(New(Config{Dir: dir, MaxBytes: 1 << 30}), again)
+	time.Sleep(100 * time.Millisecond)
+	s.Stop()
+	if len(again.received()) != 0 {
+		t.Fatalf("replayed batches are sent again: %v", again.received())
+	}
+}
+
+func TestSpoolDropsOldest(t *testing.T) {
+	dir := t.TempDir()
+	mgr := New(Config{Dir: dir, MaxBytes: 4 << 20})
+	svc := &fakeInsertService{down: true}
+	s := wrap(mgr, svc)
+	payload := make([]byte, 256*1024)
+	for i := 0; i < 40; i++ {
+		s.Request(newSamples(fmt.Sprintf("%03d%s", i, payload)), 2)
+	}
+	if total := mgr.total.Load(); total > mgr.cfg.MaxBytes+mgr.segmentBytes {
+		t.Fatalf("spool size %d exceeds the cap", total)
+	}
+	svc.setDown(false)
+	waitFor(t, func() bool {
+		s.q.mtx.Lock()
+		defer s.q.mtx.Unlock()
+		return s.q.depth == 0
+	})
+	received := svc.received()
+	if len(received) == 0 || len(received) >= 40 {
+		t.Fatalf("received %d batches", len(received))
+	}
+	if received[len(received)-1][:3] != "039" || received[0][:3] == "000" {
+		t.Errorf("the oldest batches must be dropped: first %s, last %s", received[0][:3], received[len(received)-1][:3])
+	}
+	s.Stop()
+}
+
+func TestSpoolTruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	mgr := New(Config{Dir: dir, MaxBytes: 1 << 30})
+	q, err := openQueue(mgr, dir, "node", "samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.append(1, 2, []byte("first"))
+	q.append(2, 2, []byte("second"))
+	// Simulate a crash in the middle of the second record.
+	q.active.Truncate(q.segments[0].size - 3)
+	q.close()
+
+	q, err = openQueue(mgr, dir, "node", "samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := q.readBatch(10, 1<<20)
+	if err != nil || len(batch) != 1 || string(batch[0].payload) != "first" {
+		t.Fatalf("batch = %v, err = %v", batch, err)
+	}
+	q.append(3, 2, []byte("third"))
+	batch, err = q.readBatch(10, 1<<20)
+	if err != nil || len(batch) != 2 || string(batch[1].payload) != "third" {
+		t.Fatalf("batch = %v, err = %v", batch, err)
+	}
+	q.close()
+}
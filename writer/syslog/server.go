@@ -0,0 +1,301 @@
+// Package syslog implements an optional syslog receiver for RFC 5424 and
+// RFC 3164 messages over TCP, UDP and TLS. The messages are batched and fed
+// through the same decoder and insert pipeline as the push endpoints.
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	clconfig "github.com/metrico/cloki-config"
+	controllerv1 "github.com/metrico/qryn/v5/writer/controller"
+	"github.com/metrico/qryn/v5/writer/utils/logger"
+	"github.com/metrico/qryn/v5/writer/utils/unmarshal"
+)
+
+const (
+	maxBatchMessages = 1000
+	maxBatchBytes    = 4 * 1024 * 1024
+	flushInterval    = 100 * time.Millisecond
+)
+
+// Config holds the listen ports of the receiver. A zero port disables the
+// listener.
+type Config struct {
+	Host    string
+	TCPPort int
+	UDPPort int
+	TLSPort int
+	TLSCert string
+	TLSKey  string
+}
+
+// ConfigFromEnv reads the QRYN_SYSLOG_* environment variables.
+func ConfigFromEnv(host string) Config {
+	return Config{
+		Host:    host,
+		TCPPort: envPort("QRYN_SYSLOG_TCP_PORT"),
+		UDPPort: envPort("QRYN_SYSLOG_UDP_PORT"),
+		TLSPort: envPort("QRYN_SYSLOG_TLS_PORT"),
+		TLSCert: os.Getenv("QRYN_SYSLOG_TLS_CERT"),
+		TLSKey:  os.Getenv("QRYN_SYSLOG_TLS_KEY"),
+	}
+}
+
+func envPort(name string) int {
+	if v := os.Getenv(name); v != "" {
+		if p, err := strconv.Atoi(v); err == nil && p > 0 && p < 65536 {
+			return p
+		}
+		logger.Error("Invalid ", name, " value: ", v)
+	}
+	return 0
+}
+
+var server *Server
+
+// Init starts the syslog listeners configured by QRYN_SYSLOG_*. It is a no-op
+// when no port is set. It must be called after the writer registry is ready.
+func Init(cfg *clconfig.ClokiConfig) {
+	conf := ConfigFromEnv(cfg.Setting.HTTP_SETTINGS.Host)
+	if conf.TCPPort == 0 && conf.UDPPort == 0 && conf.TLSPort == 0 {
+		return
+	}
+	s := NewServer(func(ctx context.Context, body []byte) error {
+		return controllerv1.PushSyslog(ctx, controllerv1.DefaultIngestSettings(), body)
+	})
+	if err := s.Start(conf); err != nil {
+		logger.Error("syslog receiver not started: ", err)
+		s.Stop()
+		return
+	}
+	server = s
+}
+
+// Stop closes the listeners and flushes the pending messages.
+func Stop() {
+	if server == nil {
+		return
+	}
+	server.Stop()
+	server = nil
+}
+
+// Server accepts syslog messages and pushes them in batches of octet-counted
+// frames.
+type Server struct {
+	push func(ctx context.Context, body []byte) error
+
+	mtx       sync.Mutex
+	listeners []net.Listener
+	packets   []net.PacketConn
+	conns     map[net.Conn]struct{}
+	stopped   bool
+
+	messages chan []byte
+	readers  sync.WaitGroup
+	done     chan struct{}
+}
+
+// NewServer creates a server pushing the batches with push.
+func NewServer(push func(ctx context.Context, body []byte) error) *Server {
+	s := &Server{
+		push:     push,
+		conns:    map[net.Conn]struct{}{},
+		messages: make(chan []byte, maxBatchMessages),
+		done:     make(chan struct{}),
+	}
+	go s.batch()
+	return s
+}
+
+// Start opens the listeners of conf.
+func (s *Server) Start(conf Config) error {
+	if conf.TCPPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", conf.Host, conf.TCPPort))
+		if err != nil {
+			return err
+		}
+		s.serveStream(lis, "TCP")
+	}
+	if conf.TLSPort != 0 {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return fmt.Errorf("QRYN_SYSLOG_TLS_CERT / QRYN_SYSLOG_TLS_KEY: %w", err)
+		}
+		lis, err := tls.Listen("tcp", fmt.Sprintf("%s:%d", conf.Host, conf.TLSPort),
+			&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+		if err != nil {
+			return err
+		}
+		s.serveStream(lis, "TLS")
+	}
+	if conf.UDPPort != 0 {
+		conn, err := net.ListenPacket("udp", fmt.Sprintf("%s:%d", conf.Host, conf.UDPPort))
+		if err != nil {
+			return err
+		}
+		s.servePackets(conn)
+	}
+	return nil
+}
+
+func (s *Server) serveStream(lis net.Listener, proto string) {
+	s.mtx.Lock()
+	s.listeners = append(s.listeners, lis)
+	s.mtx.Unlock()
+	logger.Info("syslog ", proto, " receiver is listening on ", lis.Addr())
+	s.readers.Add(1)
+	go func() {
+		defer s.readers.Done()
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Error("syslog ", proto, " receiver stopped: ", err)
+				}
+				return
+			}
+			if !s.track(conn) {
+				conn.Close()
+				return
+			}
+			s.readers.Add(1)
+			go s.readStream(conn)
+		}
+	}()
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.stopped {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) readStream(conn net.Conn) {
+	defer s.readers.Done()
+	defer func() {
+		s.mtx.Lock()
+		delete(s.conns, conn)
+		s.mtx.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReaderSize(conn, unmarshal.SyslogMaxMessageSize)
+	for {
+		msg, err := unmarshal.ReadSyslogFrame(r)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				logger.Error("syslog connection from ", conn.RemoteAddr(), ": ", err)
+			}
+			return
+		}
+		if len(msg) > 0 {
+			s.messages <- msg
+		}
+	}
+}
+
+func (s *Server) servePackets(conn net.PacketConn) {
+	s.mtx.Lock()
+	s.packets = append(s.packets, conn)
+	s.mtx.Unlock()
+	logger.Info("syslog UDP receiver is listening on ", conn.LocalAddr())
+	s.readers.Add(1)
+	go func() {
+		defer s.readers.Done()
+		buf := make([]byte, unmarshal.SyslogMaxMessageSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Error("syslog UDP receiver stopped: ", err)
+				}
+				return
+			}
+			// A datagram holds exactly one message.
+			if msg := trimNewline(buf[:n]); len(msg) > 0 {
+				s.messages <- append([]byte(nil), msg...)
+			}
+		}
+	}()
+}
+
+func trimNewline(msg []byte) []byte {
+	for len(msg) > 0 && (msg[len(msg)-1] == '\n' || msg[len(msg)-1] == '\r' || msg[len(msg)-1] == 0) {
+		msg = msg[:len(msg)-1]
+	}
+	return msg
+}
+
+// batch collects the messages and pushes them every flushInterval or once a
+// batch is full. Pushing blocks the readers, which slows the TCP senders down.
+func (s *Server) batch() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var body []byte
+	count := 0
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		if err := s.push(context.Background(), body); err != nil {
+			logger.Error("syslog: dropped ", count, " messages: ", err)
+		}
+		body = nil
+		count = 0
+	}
+	for {
+		select {
+		case msg, ok := <-s.messages:
+			if !ok {
+				flush()
+				return
+			}
+			body = unmarshal.AppendSyslogFrame(body, msg)
+			count++
+			if count >= maxBatchMessages || len(body) >= maxBatchBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Stop closes the listeners and the open connections and pushes the pending
+// messages.
+func (s *Server) Stop() {
+	s.mtx.Lock()
+	if s.stopped {
+		s.mtx.Unlock()
+		return
+	}
+	s.stopped = true
+	for _, lis := range s.listeners {
+		lis.Close()
+	}
+	for _, conn := range s.packets {
+		conn.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mtx.Unlock()
+	s.readers.Wait()
+	close(s.messages)
+	<-s.done
+}
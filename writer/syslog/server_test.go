@@ -0,0 +1,80 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/utils/unmarshal"
+)
+
+type pushRecorder struct {
+	mtx      sync.Mutex
+	messages []string
+}
+
+func (p *pushRecorder) push(ctx context.Context, body []byte) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	r := bufio.NewReader(bytes.NewReader(body))
+	for {
+		frame, err := unmarshal.ReadSyslogFrame(r)
+		if err != nil {
+			return nil
+		}
+		p.messages = append(p.messages, string(frame))
+	}
+}
+
+func (p *pushRecorder) received() []string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	res := append([]string{}, p.messages...)
+	sort.Strings(res)
+	return res
+}
+
+func TestServerTCPAndUDP(t *testing.T) {
+	rec := &pushRecorder{}
+	s := NewServer(rec.push)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.serveStream(lis, "TCP")
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.servePackets(udp)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(unmarshal.AppendSyslogFrame(nil, []byte("<13>a octet")))
+	conn.Write([]byte("<13>b newline\n"))
+	conn.Close()
+
+	uconn, err := net.Dial("udp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	uconn.Write([]byte("<13>c datagram\n"))
+	uconn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Stop()
+	got := rec.received()
+	if len(got) != 3 || got[0] != "<13>a octet" || got[1] != "<13>b newline" || got[2] != "<13>c datagram" {
+		t.Errorf("received %q", got)
+	}
+}
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"errors"
+	"time"
 )
 
 // Define base error values for comparison
@@ -64,6 +65,32 @@ func New429Error(msg string) IQrynError {
 	return &QrynError{Code: 429, Message: msg}
 }
 
+// LimitError is a 429 error returned when a request exceeds an ingestion limit.
+// RetryAfter is the delay after which the request may succeed. It is a 413
+// error without RetryAfter if the request can never succeed.
+type LimitError struct {
+	QrynError
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func NewLimitError(reason string, msg string, retryAfter time.Duration) *LimitError {
+	return &LimitError{
+		QrynError:  QrynError{Code: 429, Message: msg},
+		Reason:     reason,
+		RetryAfter: retryAfter,
+	}
+}
+
+// NewTooLargeError creates the 413 LimitError of a request exceeding a limit
+// whatever the delay.
+func NewTooLargeError(reason string, msg string) *LimitError {
+	return &LimitError{
+		QrynError: QrynError{Code: 413, Message: msg},
+		Reason:    reason,
+	}
+}
+
 // NewUnmarshalError creates a new instance of UnmarshalError.
 func NewUnmarshalError(err error) IQrynError {
 	var target IQrynError
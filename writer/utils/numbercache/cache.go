@@ -11,6 +11,7 @@ import (
 
 type ICache[T any] interface {
 	CheckAndSet(key T) bool
+	Delete(key T)
 	DB(db string) ICache[T]
 	Stop()
 }
@@ -40,6 +41,12 @@ func (c *Cache[T]) CheckAndSet(key T) bool {
 	return false
 }
 
+func (c *Cache[T]) Delete(key T) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sets.Del(append(c.db, c.serializer(key)...))
+}
+
 func (c *Cache[T]) Stop() {
 	c.cancel()
 }
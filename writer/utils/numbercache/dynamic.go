@@ -30,6 +30,12 @@ func (c *DynamicCache[T]) CheckAndSet(key T) bool {
 	return false
 }
 
+func (c *DynamicCache[T]) Delete(key T) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.sets.Del(append(c.db, c.serializer(key)...))
+}
+
 func (c *DynamicCache[T]) Stop() {
 	c.cleanup.Stop()
 }
@@ -0,0 +1,47 @@
+package numbercache
+
+import "sync"
+
+// RequestCache is the view of a cache for a single push request. It records
+// the keys the request set, Rollback removes them if the rows of the request
+// are not stored, so a retry of the request stores them again.
+type RequestCache[T any] struct {
+	ICache[T]
+	mtx      sync.Mutex
+	keys     []T
+	rollback []func()
+}
+
+func NewRequestCache[T any](cache ICache[T]) *RequestCache[T] {
+	return &RequestCache[T]{ICache: cache}
+}
+
+func (c *RequestCache[T]) CheckAndSet(key T) bool {
+	if c.ICache.CheckAndSet(key) {
+		return true
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.keys = append(c.keys, key)
+	return false
+}
+
+// OnRollback registers fn to undo what the request recorded in other caches.
+func (c *RequestCache[T]) OnRollback(fn func()) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.rollback = append(c.rollback, fn)
+}
+
+// Rollback removes the keys set by the request.
+func (c *RequestCache[T]) Rollback() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, key := range c.keys {
+		c.ICache.Delete(key)
+	}
+	for _, fn := range c.rollback {
+		fn()
+	}
+	c.keys, c.rollback = nil, nil
+}
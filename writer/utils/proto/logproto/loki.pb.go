@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.25.0-devel
+// 	protoc-gen-go v1.36.12
 // 	protoc        v3.14.0
 // source: loki.proto
 
@@ -11,6 +11,7 @@ import (
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
 	sync "sync"
+	unsafe "unsafe"
 )
 
 const (
@@ -21,10 +22,7 @@ const (
 )
 
 type Timestamp struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
-	unknownFields protoimpl.UnknownFields
-
+	state protoimpl.MessageState `protogen:"open.v1"`
 	// Represents seconds of UTC time since Unix epoch
 	// 1970-01-01T00:00:00Z. Must be from 0001-01-01T00:00:00Z to
 	// 9999-12-31T23:59:59Z inclusive.
@@ -33,16 +31,16 @@ type Timestamp struct {
 	// second values with fractions must still have non-negative nanos values
 	// that count forward in time. Must be from 0 to 999,999,999
 	// inclusive.
-	Nanos int32 `protobuf:"varint,2,opt,name=nanos,proto3" json:"nanos,omitempty"`
+	Nanos         int32 `protobuf:"varint,2,opt,name=nanos,proto3" json:"nanos,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Timestamp) Reset() {
 	*x = Timestamp{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_loki_proto_msgTypes[0]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_loki_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *Timestamp) String() string {
@@ -53,7 +51,7 @@ func (*Timestamp) ProtoMessage() {}
 
 func (x *Timestamp) ProtoReflect() protoreflect.Message {
 	mi := &file_loki_proto_msgTypes[0]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -83,20 +81,17 @@ func (x *Timestamp) GetNanos() int32 {
 }
 
 type PushRequest struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Streams       []*StreamAdapter       `protobuf:"bytes,1,rep,name=streams,proto3" json:"streams,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Streams []*StreamAdapter `protobuf:"bytes,1,rep,name=streams,proto3" json:"streams,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PushRequest) Reset() {
 	*x = PushRequest{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_loki_proto_msgTypes[1]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_loki_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PushRequest) String() string {
@@ -107,7 +102,7 @@ func (*PushRequest) ProtoMessage() {}
 
 func (x *PushRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_loki_proto_msgTypes[1]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -130,18 +125,16 @@ func (x *PushRequest) GetStreams() []*StreamAdapter {
 }
 
 type PushResponse struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *PushResponse) Reset() {
 	*x = PushResponse{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_loki_proto_msgTypes[2]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_loki_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *PushResponse) String() string {
@@ -152,7 +145,7 @@ func (*PushResponse) ProtoMessage() {}
 
 func (x *PushResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_loki_proto_msgTypes[2]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -168,21 +161,18 @@ func (*PushResponse) Descriptor() ([]byte, []int) {
 }
 
 type StreamAdapter struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Labels        string                 `protobuf:"bytes,1,opt,name=labels,proto3" json:"labels,omitempty"`
+	Entries       []*EntryAdapter        `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`
 	unknownFields protoimpl.UnknownFields
-
-	Labels  string          `protobuf:"bytes,1,opt,name=labels,proto3" json:"labels,omitempty"`
-	Entries []*EntryAdapter `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *StreamAdapter) Reset() {
 	*x = StreamAdapter{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_loki_proto_msgTypes[3]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_loki_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *StreamAdapter) String() string {
@@ -193,7 +183,7 @@ func (*StreamAdapter) ProtoMessage() {}
 
 func (x *StreamAdapter) ProtoReflect() protoreflect.Message {
 	mi := &file_loki_proto_msgTypes[3]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -223,21 +213,19 @@ func (x *StreamAdapter) GetEntries() []*EntryAdapter {
 }
 
 type EntryAdapter struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
-	unknownFields protoimpl.UnknownFields
-
-	Timestamp *Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	Line      string     `protobuf:"bytes,2,opt,name=line,proto3" json:"line,omitempty"`
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp          *Timestamp             `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Line               string                 `protobuf:"bytes,2,opt,name=line,proto3" json:"line,omitempty"`
+	StructuredMetadata []*LabelPairAdapter    `protobuf:"bytes,3,rep,name=structuredMetadata,proto3" json:"structuredMetadata,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *EntryAdapter) Reset() {
 	*x = EntryAdapter{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_loki_proto_msgTypes[4]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
-	}
+	mi := &file_loki_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *EntryAdapter) String() string {
@@ -248,7 +236,7 @@ func (*EntryAdapter) ProtoMessage() {}
 
 func (x *EntryAdapter) ProtoReflect() protoreflect.Message {
 	mi := &file_loki_proto_msgTypes[4]
-	if protoimpl.UnsafeEnabled && x != nil {
+	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
@@ -277,63 +265,120 @@ func (x *EntryAdapter) GetLine() string {
 	return ""
 }
 
-var File_loki_proto protoreflect.FileDescriptor
+func (x *EntryAdapter) GetStructuredMetadata() []*LabelPairAdapter {
+	if x != nil {
+		return x.StructuredMetadata
+	}
+	return nil
+}
+
+type LabelPairAdapter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LabelPairAdapter) Reset() {
+	*x = LabelPairAdapter{}
+	mi := &file_loki_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LabelPairAdapter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LabelPairAdapter) ProtoMessage() {}
+
+func (x *LabelPairAdapter) ProtoReflect() protoreflect.Message {
+	mi := &file_loki_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LabelPairAdapter.ProtoReflect.Descriptor instead.
+func (*LabelPairAdapter) Descriptor() ([]byte, []int) {
+	return file_loki_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *LabelPairAdapter) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
 
-var file_loki_proto_rawDesc = []byte{
-	0x0a, 0x0a, 0x6c, 0x6f, 0x6b, 0x69, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x6c, 0x6f,
-	0x67, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x3b, 0x0a, 0x09, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
-	0x61, 0x6d, 0x70, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x14, 0x0a,
-	0x05, 0x6e, 0x61, 0x6e, 0x6f, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x6e, 0x61,
-	0x6e, 0x6f, 0x73, 0x22, 0x40, 0x0a, 0x0b, 0x50, 0x75, 0x73, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x12, 0x31, 0x0a, 0x07, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x73, 0x18, 0x01, 0x20,
-	0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6c, 0x6f, 0x67, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53,
-	0x74, 0x72, 0x65, 0x61, 0x6d, 0x41, 0x64, 0x61, 0x70, 0x74, 0x65, 0x72, 0x52, 0x07, 0x73, 0x74,
-	0x72, 0x65, 0x61, 0x6d, 0x73, 0x22, 0x0e, 0x0a, 0x0c, 0x50, 0x75, 0x73, 0x68, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x59, 0x0a, 0x0d, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x41,
-	0x64, 0x61, 0x70, 0x74, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x12, 0x30,
-	0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32,
-	0x16, 0x2e, 0x6c, 0x6f, 0x67, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x74, 0x72, 0x79,
-	0x41, 0x64, 0x61, 0x70, 0x74, 0x65, 0x72, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73,
-	0x22, 0x55, 0x0a, 0x0c, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x41, 0x64, 0x61, 0x70, 0x74, 0x65, 0x72,
-	0x12, 0x31, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x6c, 0x6f, 0x67, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x54,
-	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
-	0x61, 0x6d, 0x70, 0x12, 0x12, 0x0a, 0x04, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x6c, 0x69, 0x6e, 0x65, 0x42, 0x0a, 0x5a, 0x08, 0x6c, 0x6f, 0x67, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+func (x *LabelPairAdapter) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
 }
 
+var File_loki_proto protoreflect.FileDescriptor
+
+const file_loki_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"loki.proto\x12\blogproto\";\n" +
+	"\tTimestamp\x12\x18\n" +
+	"\aseconds\x18\x01 \x01(\x03R\aseconds\x12\x14\n" +
+	"\x05nanos\x18\x02 \x01(\x05R\x05nanos\"@\n" +
+	"\vPushRequest\x121\n" +
+	"\astreams\x18\x01 \x03(\v2\x17.logproto.StreamAdapterR\astreams\"\x0e\n" +
+	"\fPushResponse\"Y\n" +
+	"\rStreamAdapter\x12\x16\n" +
+	"\x06labels\x18\x01 \x01(\tR\x06labels\x120\n" +
+	"\aentries\x18\x02 \x03(\v2\x16.logproto.EntryAdapterR\aentries\"\xa1\x01\n" +
+	"\fEntryAdapter\x121\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x13.logproto.TimestampR\ttimestamp\x12\x12\n" +
+	"\x04line\x18\x02 \x01(\tR\x04line\x12J\n" +
+	"\x12structuredMetadata\x18\x03 \x03(\v2\x1a.logproto.LabelPairAdapterR\x12structuredMetadata\"<\n" +
+	"\x10LabelPairAdapter\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05valueB\n" +
+	"Z\blogprotob\x06proto3"
+
 var (
 	file_loki_proto_rawDescOnce sync.Once
-	file_loki_proto_rawDescData = file_loki_proto_rawDesc
+	file_loki_proto_rawDescData []byte
 )
 
 func file_loki_proto_rawDescGZIP() []byte {
 	file_loki_proto_rawDescOnce.Do(func() {
-		file_loki_proto_rawDescData = protoimpl.X.CompressGZIP(file_loki_proto_rawDescData)
+		file_loki_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_loki_proto_rawDesc), len(file_loki_proto_rawDesc)))
 	})
 	return file_loki_proto_rawDescData
 }
 
-var file_loki_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
-var file_loki_proto_goTypes = []interface{}{
-	(*Timestamp)(nil),     // 0: logproto.Timestamp
-	(*PushRequest)(nil),   // 1: logproto.PushRequest
-	(*PushResponse)(nil),  // 2: logproto.PushResponse
-	(*StreamAdapter)(nil), // 3: logproto.StreamAdapter
-	(*EntryAdapter)(nil),  // 4: logproto.EntryAdapter
+var file_loki_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_loki_proto_goTypes = []any{
+	(*Timestamp)(nil),        // 0: logproto.Timestamp
+	(*PushRequest)(nil),      // 1: logproto.PushRequest
+	(*PushResponse)(nil),     // 2: logproto.PushResponse
+	(*StreamAdapter)(nil),    // 3: logproto.StreamAdapter
+	(*EntryAdapter)(nil),     // 4: logproto.EntryAdapter
+	(*LabelPairAdapter)(nil), // 5: logproto.LabelPairAdapter
 }
 var file_loki_proto_depIdxs = []int32{
 	3, // 0: logproto.PushRequest.streams:type_name -> logproto.StreamAdapter
 	4, // 1: logproto.StreamAdapter.entries:type_name -> logproto.EntryAdapter
 	0, // 2: logproto.EntryAdapter.timestamp:type_name -> logproto.Timestamp
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	5, // 3: logproto.EntryAdapter.structuredMetadata:type_name -> logproto.LabelPairAdapter
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_loki_proto_init() }
@@ -341,75 +386,13 @@ func file_loki_proto_init() {
 	if File_loki_proto != nil {
 		return
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_loki_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Timestamp); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_loki_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PushRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_loki_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PushResponse); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_loki_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StreamAdapter); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_loki_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EntryAdapter); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: file_loki_proto_rawDesc,
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_loki_proto_rawDesc), len(file_loki_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -418,7 +401,6 @@ func file_loki_proto_init() {
 		MessageInfos:      file_loki_proto_msgTypes,
 	}.Build()
 	File_loki_proto = out.File
-	file_loki_proto_rawDesc = nil
 	file_loki_proto_goTypes = nil
 	file_loki_proto_depIdxs = nil
 }
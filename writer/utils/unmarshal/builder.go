@@ -10,6 +10,7 @@ import (
 	"unsafe"
 
 	"github.com/go-faster/city"
+	"github.com/metrico/qryn/v5/writer/limits"
 	"github.com/metrico/qryn/v5/writer/model"
 	"github.com/metrico/qryn/v5/writer/utils"
 	"github.com/metrico/qryn/v5/writer/utils/logger"
@@ -31,6 +32,15 @@ type OrgCheckerFactory interface {
 type onEntriesHandler func(labels [][]string, timestampsNS []int64,
 	message []string, value []float64, types []uint8) error
 
+type onHistogramsHandler func(labels [][]string, timestampsNS []int64,
+	count []float64, sum []float64, histograms [][]byte) error
+
+type onExemplarsHandler func(labels [][]string, timestampsNS []int64,
+	value []float64, traceIDs []string, exemplarLabels []string) error
+
+type onStructuredMetadataHandler func(labels [][]string, timestampsNS []int64,
+	message []string, value []float64, types []uint8, structuredMetadata []string) error
+
 type onProfileHandler func(timestampNs uint64,
 	Type string,
 	serviceName string,
@@ -62,6 +72,23 @@ type iLogsParser interface {
 	SetOnEntries(h onEntriesHandler)
 }
 
+// iHistogramsParser is implemented by logs parsers that also emit native
+// histogram samples.
+type iHistogramsParser interface {
+	SetOnHistograms(h onHistogramsHandler)
+}
+
+// iExemplarsParser is implemented by logs parsers that also emit exemplars.
+type iExemplarsParser interface {
+	SetOnExemplars(h onExemplarsHandler)
+}
+
+// iStructuredMetadataParser is implemented by logs parsers that receive
+// per-line Loki structured metadata.
+type iStructuredMetadataParser interface {
+	SetOnStructuredMetadata(h onStructuredMetadataHandler)
+}
+
 type iProfilesParser interface {
 	Decode() error
 	SetOnProfile(h onProfileHandler)
@@ -86,6 +113,7 @@ type parserDoer struct {
 	ProfileParser iProfilesParser
 	ctx           *ParserCtx
 	ttlDays       uint16
+	limits        *limits.Request
 
 	res         chan *model.ParserResponse
 	tsSpl       *timeSeriesAndSamples
@@ -154,9 +182,20 @@ func (p *parserDoer) doParseLogs() {
 		p.ttlDays = ttlDays.(uint16)
 	}
 
+	p.limits, _ = p.ctx.ctx.Value(utils.ContextKeyLimits).(*limits.Request)
+
 	p.tsSpl = newTimeSeriesAndSamples(p.res, meta)
 
 	parser.SetOnEntries(p.onEntries)
+	if hp, ok := parser.(iHistogramsParser); ok {
+		hp.SetOnHistograms(p.onHistograms)
+	}
+	if ep, ok := parser.(iExemplarsParser); ok {
+		ep.SetOnExemplars(p.onExemplars)
+	}
+	if sp, ok := parser.(iStructuredMetadataParser); ok {
+		sp.SetOnStructuredMetadata(p.onStructuredMetadata)
+	}
 	p.tsSpl.reset()
 
 	go func() {
@@ -304,6 +343,139 @@ func (p *parserDoer) discoverServiceName(labels *[][]string) {
 func (p *parserDoer) onEntries(labels [][]string, timestampsNS []int64,
 	message []string, value []float64, types []uint8,
 ) error {
+	fp, ttlDays, err := p.registerSeries(labels, timestampsNS, message, types)
+	if err != nil {
+		return err
+	}
+	p.appendSamples(fp, ttlDays, timestampsNS, message, value, types)
+
+	p.maybeFlush()
+	return nil
+}
+
+// onStructuredMetadata stores the samples of a single stream together with
+// their structured metadata encoded as JSON objects. The metadata is kept per
+// sample and does not take part in the stream fingerprint.
+func (p *parserDoer) onStructuredMetadata(labels [][]string, timestampsNS []int64,
+	message []string, value []float64, types []uint8, structuredMetadata []string,
+) error {
+	fp, ttlDays, err := p.registerSeries(labels, timestampsNS, message, types)
+	if err != nil {
+		return err
+	}
+	p.appendStructuredMetadata(structuredMetadata)
+	p.appendSamples(fp, ttlDays, timestampsNS, message, value, types)
+
+	p.maybeFlush()
+	return nil
+}
+
+// checkLimits applies the tenant ingestion limits to a series and the log lines
+// of its samples. It runs before the series is cached so a rejected series is
+// registered again on retry.
+func (p *parserDoer) checkLimits(labels [][]string, fp uint64, message []string, types []uint8) error {
+	if p.limits == nil {
+		return nil
+	}
+	if err := p.limits.CheckLabels(labels, fp); err != nil {
+		return err
+	}
+	if message == nil {
+		return nil
+	}
+	lines := make([]string, 0, len(message))
+	for i, t := range types {
+		if t == model.SAMPLE_TYPE_LOG {
+			lines = append(lines, message[i])
+		}
+	}
+	return p.limits.CheckLines(fp, lines)
+}
+
+// appendStructuredMetadata pads the structured metadata column with empty
+// values for the samples added before the first line with metadata.
+func (p *parserDoer) appendStructuredMetadata(structuredMetadata []string) {
+	spl := p.tsSpl.spl
+	if pad := len(spl.MTimestampNS) - len(spl.MStructuredMetadata); pad > 0 {
+		spl.MStructuredMetadata = append(spl.MStructuredMetadata, make([]string, pad)...)
+	}
+	spl.MStructuredMetadata = append(spl.MStructuredMetadata, structuredMetadata...)
+	for _, m := range structuredMetadata {
+		spl.Size += len(m)
+	}
+}
+
+func (p *parserDoer) appendSamples(fp uint64, ttlDays uint16, timestampsNS []int64,
+	message []string, value []float64, types []uint8,
+) {
+	p.tsSpl.spl.MMessage = append(p.tsSpl.spl.MMessage, message...)
+	p.tsSpl.spl.MValue = append(p.tsSpl.spl.MValue, value...)
+	p.tsSpl.spl.MTimestampNS = append(p.tsSpl.spl.MTimestampNS, timestampsNS...)
+	p.tsSpl.spl.MFingerprint = append(p.tsSpl.spl.MFingerprint, fastFillArray(len(timestampsNS), fp)...)
+	p.tsSpl.spl.MTTLDays = append(p.tsSpl.spl.MTTLDays, fastFillArray(len(timestampsNS), ttlDays)...)
+	p.tsSpl.spl.MType = append(p.tsSpl.spl.MType, types...)
+
+	for i := range timestampsNS {
+		p.tsSpl.spl.Size += len(message[i]) + 26
+	}
+}
+
+// onHistograms stores native histogram samples of a single metric series.
+// histograms holds the encoded remote write 2.0 histogram of every sample.
+func (p *parserDoer) onHistograms(labels [][]string, timestampsNS []int64,
+	count []float64, sum []float64, histograms [][]byte,
+) error {
+	fp, _, err := p.registerSeries(labels, timestampsNS, nil,
+		fastFillArray[uint8](len(timestampsNS), model.SAMPLE_TYPE_METRIC))
+	if err != nil {
+		return err
+	}
+
+	hist := p.tsSpl.hist
+	hist.MFingerprint = append(hist.MFingerprint, fastFillArray(len(timestampsNS), fp)...)
+	hist.MTimestampNS = append(hist.MTimestampNS, timestampsNS...)
+	hist.MCount = append(hist.MCount, count...)
+	hist.MSum = append(hist.MSum, sum...)
+	hist.MHistogram = append(hist.MHistogram, histograms...)
+	for _, h := range histograms {
+		hist.Size += len(h) + 32
+	}
+
+	p.maybeFlush()
+	return nil
+}
+
+// onExemplars stores exemplars of a single metric series. exemplarLabels
+// holds the labels of every exemplar encoded as a JSON object.
+func (p *parserDoer) onExemplars(labels [][]string, timestampsNS []int64,
+	value []float64, traceIDs []string, exemplarLabels []string,
+) error {
+	fp, _, err := p.registerSeries(labels, timestampsNS, nil,
+		fastFillArray[uint8](len(timestampsNS), model.SAMPLE_TYPE_METRIC))
+	if err != nil {
+		return err
+	}
+
+	exm := p.tsSpl.exm
+	exm.MFingerprint = append(exm.MFingerprint, fastFillArray(len(timestampsNS), fp)...)
+	exm.MTimestampNS = append(exm.MTimestampNS, timestampsNS...)
+	exm.MValue = append(exm.MValue, value...)
+	exm.MTraceID = append(exm.MTraceID, traceIDs...)
+	exm.MLabels = append(exm.MLabels, exemplarLabels...)
+	for i := range timestampsNS {
+		exm.Size += len(traceIDs[i]) + len(exemplarLabels[i]) + 24
+	}
+
+	p.maybeFlush()
+	return nil
+}
+
+// registerSeries checks the ingestion limits, adds the time_series rows of a new
+// series and returns its fingerprint and TTL override. message holds the lines
+// of the samples, it is nil for histograms and exemplars.
+func (p *parserDoer) registerSeries(labels [][]string, timestampsNS []int64, message []string,
+	types []uint8,
+) (uint64, uint16, error) {
 	ttlDays := p.ttlDays
 
 	// Extract metadata from labels
@@ -335,28 +507,23 @@ func (p *parserDoer) onEntries(labels [][]string, timestampsNS []int64,
 
 	dates := map[time.Time]bool{}
 	fp := fingerprintLabels(filtered)
-
-	p.tsSpl.spl.MMessage = append(p.tsSpl.spl.MMessage, message...)
-	p.tsSpl.spl.MValue = append(p.tsSpl.spl.MValue, value...)
-	p.tsSpl.spl.MTimestampNS = append(p.tsSpl.spl.MTimestampNS, timestampsNS...)
-	p.tsSpl.spl.MFingerprint = append(p.tsSpl.spl.MFingerprint, fastFillArray(len(timestampsNS), fp)...)
-	p.tsSpl.spl.MTTLDays = append(p.tsSpl.spl.MTTLDays, fastFillArray(len(timestampsNS), ttlDays)...)
-	p.tsSpl.spl.MType = append(p.tsSpl.spl.MType, types...)
+	if err := p.checkLimits(filtered, fp, message, types); err != nil {
+		return 0, 0, err
+	}
 
 	var tps [3]bool
 	for _, t := range types {
 		tps[t] = true
 	}
 
-	for i, tsns := range timestampsNS {
+	for _, tsns := range timestampsNS {
 		dates[time.Unix(tsns/1000000000, 0).Truncate(time.Hour*24)] = true
-		p.tsSpl.spl.Size += len(message[i]) + 26
 	}
 
 	// Convert metadata to JSON if present
 	metadataJSON, err := metricMetadata.ToJSON()
 	if err != nil {
-		return fmt.Errorf("failed to convert metadata to JSON: %w", err)
+		return 0, 0, fmt.Errorf("failed to convert metadata to JSON: %w", err)
 	}
 
 	for d := range dates {
@@ -377,13 +544,14 @@ func (p *parserDoer) onEntries(labels [][]string, timestampsNS []int64,
 			}
 		}
 	}
+	return fp, ttlDays, nil
+}
 
-	if p.tsSpl.spl.Size+p.tsSpl.ts.Size > 1*1024*1024 {
+func (p *parserDoer) maybeFlush() {
+	if p.tsSpl.spl.Size+p.tsSpl.ts.Size+p.tsSpl.hist.Size+p.tsSpl.exm.Size > 1*1024*1024 {
 		p.tsSpl.flush()
 		p.tsSpl.reset()
 	}
-
-	return nil
 }
 
 func (p *parserDoer) onSpan(traceId []byte, spanId []byte, timestampNs int64, durationNs int64,
@@ -514,6 +682,22 @@ func withParsedBody(fn func() proto.Message) buildOption {
 	}
 }
 
+// withDecodedBody sets the body object from a custom decoder of the buffered body,
+// for payloads that are not plain protobuf (e.g. OTLP/JSON).
+func withDecodedBody(fn func(buf []byte) (any, error)) buildOption {
+	return func(builder *parserBuilder) *parserBuilder {
+		builder.PreParse = append(builder.PreParse, func(ctx *ParserCtx) error {
+			obj, err := fn(ctx.bodyBuffer)
+			if err != nil {
+				return err
+			}
+			ctx.bodyObject = obj
+			return nil
+		})
+		return builder
+	}
+}
+
 func withPayloadType(tp int8) buildOption {
 	return func(builder *parserBuilder) *parserBuilder {
 		builder.payloadType = tp
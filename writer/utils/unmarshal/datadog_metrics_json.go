@@ -140,6 +140,9 @@ func (d *datadogMetricsRequestDec) WrapError(err error) error {
 	if err == nil {
 		return nil
 	}
+	if _, ok := errors.Unwrap[*errors.LimitError](err); ok {
+		return err
+	}
 	if strings.HasPrefix(err.Error(), "json error") {
 		return errors.NewUnmarshalError(err)
 		//return err
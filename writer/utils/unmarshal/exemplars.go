@@ -0,0 +1,41 @@
+package unmarshal
+
+// exemplarTraceIDLabels are the exemplar label names carrying the trace ID,
+// in order of preference.
+var exemplarTraceIDLabels = []string{"trace_id", "traceID", "traceId"}
+
+// exemplarsBatch collects the exemplars of a single series before they are
+// passed to an onExemplarsHandler.
+type exemplarsBatch struct {
+	tsns     []int64
+	value    []float64
+	traceIDs []string
+	labels   []string
+}
+
+func (b *exemplarsBatch) add(timestampNs int64, value float64, lbls [][]string) {
+	b.tsns = append(b.tsns, timestampNs)
+	b.value = append(b.value, value)
+	b.traceIDs = append(b.traceIDs, exemplarTraceID(lbls))
+	b.labels = append(b.labels, encodeLabels(lbls))
+}
+
+func (b *exemplarsBatch) flush(series [][]string, h onExemplarsHandler) error {
+	if len(b.tsns) == 0 || h == nil {
+		return nil
+	}
+	err := h(series, b.tsns, b.value, b.traceIDs, b.labels)
+	b.tsns, b.value, b.traceIDs, b.labels = nil, nil, nil, nil
+	return err
+}
+
+func exemplarTraceID(lbls [][]string) string {
+	for _, name := range exemplarTraceIDLabels {
+		for _, l := range lbls {
+			if l[0] == name {
+				return l[1]
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,189 @@
+package unmarshal
+
+import (
+	"encoding/binary"
+
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// jaegerBatch is the protocol independent form of a Jaeger Thrift or
+// api_v2 protobuf batch.
+type jaegerBatch struct {
+	process *jaegerProcess
+	spans   []*jaegerSpan
+}
+
+type jaegerProcess struct {
+	serviceName string
+	tags        []*commonv1.KeyValue
+}
+
+type jaegerSpan struct {
+	traceID       []byte
+	spanID        []byte
+	parentSpanID  []byte
+	operationName string
+	references    []jaegerSpanRef
+	startTimeNS   int64
+	durationNS    int64
+	tags          []*commonv1.KeyValue
+	logs          []jaegerLog
+	// process overrides the process of the batch (api_v2 only).
+	process *jaegerProcess
+}
+
+type jaegerSpanRef struct {
+	traceID  []byte
+	spanID   []byte
+	followed bool
+}
+
+type jaegerLog struct {
+	timestampNS int64
+	fields      []*commonv1.KeyValue
+}
+
+// jaegerTraceID builds the 16 byte trace id from its Thrift high and low parts.
+func jaegerTraceID(high, low int64) []byte {
+	res := make([]byte, 16)
+	binary.BigEndian.PutUint64(res, uint64(high))
+	binary.BigEndian.PutUint64(res[8:], uint64(low))
+	return res
+}
+
+func jaegerSpanID(id int64) []byte {
+	res := make([]byte, 8)
+	binary.BigEndian.PutUint64(res, uint64(id))
+	return res
+}
+
+func jaegerStringValue(key, val string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: val}}}
+}
+
+// toOTLP converts the batch to OTLP the way the OpenTelemetry collector Jaeger
+// receiver does: the process becomes the resource, the first CHILD_OF reference
+// the parent and the other references links.
+func (b *jaegerBatch) toOTLP() *tracev1.TracesData {
+	res := &tracev1.TracesData{}
+	resources := map[*jaegerProcess]*tracev1.ScopeSpans{}
+	for _, span := range b.spans {
+		process := span.process
+		if process == nil {
+			process = b.process
+		}
+		scope, ok := resources[process]
+		if !ok {
+			scope = &tracev1.ScopeSpans{}
+			res.ResourceSpans = append(res.ResourceSpans, &tracev1.ResourceSpans{
+				Resource:   process.toOTLP(),
+				ScopeSpans: []*tracev1.ScopeSpans{scope},
+			})
+			resources[process] = scope
+		}
+		scope.Spans = append(scope.Spans, span.toOTLP())
+	}
+	return res
+}
+
+func (p *jaegerProcess) toOTLP() *resourcev1.Resource {
+	res := &resourcev1.Resource{}
+	if p == nil {
+		return res
+	}
+	if p.serviceName != "" {
+		res.Attributes = append(res.Attributes, jaegerStringValue("service.name", p.serviceName))
+	}
+	res.Attributes = append(res.Attributes, p.tags...)
+	return res
+}
+
+func (s *jaegerSpan) toOTLP() *tracev1.Span {
+	res := &tracev1.Span{
+		TraceId:           s.traceID,
+		SpanId:            s.spanID,
+		ParentSpanId:      s.parentSpanID,
+		Name:              s.operationName,
+		StartTimeUnixNano: uint64(s.startTimeNS),
+		EndTimeUnixNano:   uint64(s.startTimeNS + s.durationNS),
+		Status:            &tracev1.Status{},
+	}
+	for _, ref := range s.references {
+		if len(res.ParentSpanId) == 0 && !ref.followed && string(ref.traceID) == string(s.traceID) {
+			res.ParentSpanId = ref.spanID
+			continue
+		}
+		if string(ref.spanID) == string(res.ParentSpanId) && string(ref.traceID) == string(s.traceID) {
+			continue
+		}
+		res.Links = append(res.Links, &tracev1.Span_Link{TraceId: ref.traceID, SpanId: ref.spanID})
+	}
+
+	for _, tag := range s.tags {
+		switch tag.Key {
+		case "span.kind":
+			res.Kind = jaegerSpanKind(tag.Value.GetStringValue())
+		case "otel.status_code":
+			switch tag.Value.GetStringValue() {
+			case "ERROR":
+				res.Status.Code = tracev1.Status_STATUS_CODE_ERROR
+			case "OK":
+				res.Status.Code = tracev1.Status_STATUS_CODE_OK
+			}
+		case "otel.status_description":
+			res.Status.Message = tag.Value.GetStringValue()
+		default:
+			if tag.Key == "error" && res.Status.Code == tracev1.Status_STATUS_CODE_UNSET &&
+				(tag.Value.GetBoolValue() || tag.Value.GetStringValue() == "true") {
+				res.Status.Code = tracev1.Status_STATUS_CODE_ERROR
+			}
+			res.Attributes = append(res.Attributes, tag)
+		}
+	}
+
+	for _, log := range s.logs {
+		event := &tracev1.Span_Event{TimeUnixNano: uint64(log.timestampNS), Name: "event"}
+		for _, field := range log.fields {
+			if field.Key == "event" && field.Value.GetStringValue() != "" {
+				event.Name = field.Value.GetStringValue()
+				continue
+			}
+			event.Attributes = append(event.Attributes, field)
+		}
+		res.Events = append(res.Events, event)
+	}
+	return res
+}
+
+func jaegerSpanKind(kind string) tracev1.Span_SpanKind {
+	switch kind {
+	case "server":
+		return tracev1.Span_SPAN_KIND_SERVER
+	case "client":
+		return tracev1.Span_SPAN_KIND_CLIENT
+	case "producer":
+		return tracev1.Span_SPAN_KIND_PRODUCER
+	case "consumer":
+		return tracev1.Span_SPAN_KIND_CONSUMER
+	case "internal":
+		return tracev1.Span_SPAN_KIND_INTERNAL
+	}
+	return tracev1.Span_SPAN_KIND_UNSPECIFIED
+}
+
+// UnmarshalJaegerThriftV2 parses a Jaeger Thrift Batch sent to the collector
+// /api/traces endpoint.
+var UnmarshalJaegerThriftV2 = Build(
+	withPayloadType(2),
+	withBufferedBody,
+	withDecodedBody(decodeJaegerThrift),
+	withSpansParser(func(ctx *ParserCtx) iSpansParser { return &OTLPDecoder{ctx: ctx} }))
+
+// UnmarshalJaegerProtoV2 parses a Jaeger api_v2 PostSpansRequest.
+var UnmarshalJaegerProtoV2 = Build(
+	withPayloadType(2),
+	withBufferedBody,
+	withDecodedBody(decodeJaegerProto),
+	withSpansParser(func(ctx *ParserCtx) iSpansParser { return &OTLPDecoder{ctx: ctx} }))
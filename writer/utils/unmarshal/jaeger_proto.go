@@ -0,0 +1,300 @@
+package unmarshal
+
+import (
+	"math"
+
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoFields calls onField for every field of a protobuf message. onField
+// returns the number of bytes consumed or a negative protowire error code.
+func protoFields(buf []byte, onField func(num protowire.Number, tp protowire.Type, buf []byte) int) error {
+	for len(buf) > 0 {
+		num, tp, n := protowire.ConsumeTag(buf)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+		n = onField(num, tp, buf)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, tp, buf)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// protoMessage calls fn with the content of a length delimited field.
+func protoMessage(buf []byte, fn func([]byte) error) (int, error) {
+	msg, n := protowire.ConsumeBytes(buf)
+	if n < 0 {
+		return n, protowire.ParseError(n)
+	}
+	return n, fn(msg)
+}
+
+// decodeJaegerProto decodes a jaeger.api_v2 PostSpansRequest to OTLP.
+func decodeJaegerProto(buf []byte) (any, error) {
+	batch := &jaegerBatch{}
+	d := &jaegerProtoDecoder{}
+	err := d.fields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		if num != 1 || tp != protowire.BytesType {
+			return 0
+		}
+		return d.message(buf, batch.decodeProto)
+	})
+	if err != nil {
+		return nil, customErrors.NewUnmarshalError(err)
+	}
+	return batch.toOTLP(), nil
+}
+
+// jaegerProtoDecoder wraps the decoding of a nested message into the callback
+// form protoFields expects, keeping the first error.
+type jaegerProtoDecoder struct {
+	err error
+}
+
+func (d *jaegerProtoDecoder) message(buf []byte, fn func([]byte) error) int {
+	n, err := protoMessage(buf, fn)
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	if err != nil && n >= 0 {
+		return -1
+	}
+	return n
+}
+
+func (d *jaegerProtoDecoder) fields(buf []byte, onField func(num protowire.Number, tp protowire.Type, buf []byte) int) error {
+	err := protoFields(buf, onField)
+	if d.err != nil {
+		return d.err
+	}
+	return err
+}
+
+func (b *jaegerBatch) decodeProto(buf []byte) error {
+	d := &jaegerProtoDecoder{}
+	return d.fields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		if tp != protowire.BytesType {
+			return 0
+		}
+		switch num {
+		case 1:
+			span := &jaegerSpan{}
+			b.spans = append(b.spans, span)
+			return d.message(buf, span.decodeProto)
+		case 2:
+			b.process = &jaegerProcess{}
+			return d.message(buf, b.process.decodeProto)
+		}
+		return 0
+	})
+}
+
+func (p *jaegerProcess) decodeProto(buf []byte) error {
+	d := &jaegerProtoDecoder{}
+	return d.fields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		if tp != protowire.BytesType {
+			return 0
+		}
+		switch num {
+		case 1:
+			val, n := protowire.ConsumeString(buf)
+			p.serviceName = val
+			return n
+		case 2:
+			return d.message(buf, func(buf []byte) error {
+				kv, err := decodeJaegerKeyValue(buf)
+				p.tags = append(p.tags, kv)
+				return err
+			})
+		}
+		return 0
+	})
+}
+
+func (s *jaegerSpan) decodeProto(buf []byte) error {
+	d := &jaegerProtoDecoder{}
+	return d.fields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		if tp != protowire.BytesType {
+			return 0
+		}
+		switch num {
+		case 1:
+			val, n := protowire.ConsumeBytes(buf)
+			s.traceID = append([]byte(nil), val...)
+			return n
+		case 2:
+			val, n := protowire.ConsumeBytes(buf)
+			s.spanID = append([]byte(nil), val...)
+			return n
+		case 3:
+			val, n := protowire.ConsumeString(buf)
+			s.operationName = val
+			return n
+		case 4:
+			return d.message(buf, func(buf []byte) error {
+				ref, err := decodeJaegerSpanRef(buf)
+				s.references = append(s.references, ref)
+				return err
+			})
+		case 6:
+			return d.message(buf, func(buf []byte) error {
+				var err error
+				s.startTimeNS, err = decodeProtoTimestamp(buf)
+				return err
+			})
+		case 7:
+			return d.message(buf, func(buf []byte) error {
+				var err error
+				s.durationNS, err = decodeProtoTimestamp(buf)
+				return err
+			})
+		case 8:
+			return d.message(buf, func(buf []byte) error {
+				kv, err := decodeJaegerKeyValue(buf)
+				s.tags = append(s.tags, kv)
+				return err
+			})
+		case 9:
+			return d.message(buf, func(buf []byte) error {
+				log, err := decodeJaegerLog(buf)
+				s.logs = append(s.logs, log)
+				return err
+			})
+		case 10:
+			s.process = &jaegerProcess{}
+			return d.message(buf, s.process.decodeProto)
+		}
+		return 0
+	})
+}
+
+func decodeJaegerSpanRef(buf []byte) (jaegerSpanRef, error) {
+	var res jaegerSpanRef
+	err := protoFields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		switch {
+		case num == 1 && tp == protowire.BytesType:
+			val, n := protowire.ConsumeBytes(buf)
+			res.traceID = append([]byte(nil), val...)
+			return n
+		case num == 2 && tp == protowire.BytesType:
+			val, n := protowire.ConsumeBytes(buf)
+			res.spanID = append([]byte(nil), val...)
+			return n
+		case num == 3 && tp == protowire.VarintType:
+			val, n := protowire.ConsumeVarint(buf)
+			res.followed = val == 1 // FOLLOWS_FROM
+			return n
+		}
+		return 0
+	})
+	return res, err
+}
+
+func decodeJaegerLog(buf []byte) (jaegerLog, error) {
+	var res jaegerLog
+	d := &jaegerProtoDecoder{}
+	err := d.fields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		if tp != protowire.BytesType {
+			return 0
+		}
+		switch num {
+		case 1:
+			return d.message(buf, func(buf []byte) error {
+				var err error
+				res.timestampNS, err = decodeProtoTimestamp(buf)
+				return err
+			})
+		case 2:
+			return d.message(buf, func(buf []byte) error {
+				kv, err := decodeJaegerKeyValue(buf)
+				res.fields = append(res.fields, kv)
+				return err
+			})
+		}
+		return 0
+	})
+	return res, err
+}
+
+// decodeProtoTimestamp decodes a google.protobuf.Timestamp or Duration to
+// nanoseconds.
+func decodeProtoTimestamp(buf []byte) (int64, error) {
+	var seconds, nanos int64
+	err := protoFields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		if tp != protowire.VarintType || (num != 1 && num != 2) {
+			return 0
+		}
+		val, n := protowire.ConsumeVarint(buf)
+		if num == 1 {
+			seconds = int64(val)
+		} else {
+			nanos = int64(int32(val))
+		}
+		return n
+	})
+	return seconds*1e9 + nanos, err
+}
+
+func decodeJaegerKeyValue(buf []byte) (*commonv1.KeyValue, error) {
+	var key, vStr string
+	var vType, vInt uint64
+	var vBool bool
+	var vFloat float64
+	var vBinary []byte
+	err := protoFields(buf, func(num protowire.Number, tp protowire.Type, buf []byte) int {
+		switch {
+		case num == 1 && tp == protowire.BytesType:
+			val, n := protowire.ConsumeString(buf)
+			key = val
+			return n
+		case num == 2 && tp == protowire.VarintType:
+			val, n := protowire.ConsumeVarint(buf)
+			vType = val
+			return n
+		case num == 3 && tp == protowire.BytesType:
+			val, n := protowire.ConsumeString(buf)
+			vStr = val
+			return n
+		case num == 4 && tp == protowire.VarintType:
+			val, n := protowire.ConsumeVarint(buf)
+			vBool = val != 0
+			return n
+		case num == 5 && tp == protowire.VarintType:
+			val, n := protowire.ConsumeVarint(buf)
+			vInt = val
+			return n
+		case num == 6 && tp == protowire.Fixed64Type:
+			val, n := protowire.ConsumeFixed64(buf)
+			vFloat = math.Float64frombits(val)
+			return n
+		case num == 7 && tp == protowire.BytesType:
+			val, n := protowire.ConsumeBytes(buf)
+			vBinary = append([]byte(nil), val...)
+			return n
+		}
+		return 0
+	})
+	val := &commonv1.AnyValue{}
+	switch vType {
+	case 1: // BOOL
+		val.Value = &commonv1.AnyValue_BoolValue{BoolValue: vBool}
+	case 2: // INT64
+		val.Value = &commonv1.AnyValue_IntValue{IntValue: int64(vInt)}
+	case 3: // FLOAT64
+		val.Value = &commonv1.AnyValue_DoubleValue{DoubleValue: vFloat}
+	case 4: // BINARY
+		val.Value = &commonv1.AnyValue_BytesValue{BytesValue: vBinary}
+	default: // STRING
+		val.Value = &commonv1.AnyValue_StringValue{StringValue: vStr}
+	}
+	return &commonv1.KeyValue{Key: key, Value: val}, err
+}
@@ -0,0 +1,227 @@
+package unmarshal
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// thriftWriter encodes the subset of TBinaryProtocol the tests need.
+type thriftWriter struct {
+	buf []byte
+}
+
+func (w *thriftWriter) field(tp byte, id int16) *thriftWriter {
+	w.buf = append(w.buf, tp)
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(id))
+	return w
+}
+
+func (w *thriftWriter) byte(v byte) *thriftWriter {
+	w.buf = append(w.buf, v)
+	return w
+}
+
+func (w *thriftWriter) i32(v int32) *thriftWriter {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+	return w
+}
+
+func (w *thriftWriter) i64(v int64) *thriftWriter {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v))
+	return w
+}
+
+func (w *thriftWriter) str(v string) *thriftWriter {
+	w.i32(int32(len(v)))
+	w.buf = append(w.buf, v...)
+	return w
+}
+
+func (w *thriftWriter) list(tp byte, size int) *thriftWriter {
+	w.buf = append(w.buf, tp)
+	return w.i32(int32(size))
+}
+
+func (w *thriftWriter) stop() *thriftWriter {
+	w.buf = append(w.buf, thriftStop)
+	return w
+}
+
+func (w *thriftWriter) stringTag(key, val string) *thriftWriter {
+	return w.field(thriftString, 1).str(key).field(thriftI32, 2).i32(0).field(thriftString, 3).str(val).stop()
+}
+
+func TestDecodeJaegerThrift(t *testing.T) {
+	w := &thriftWriter{}
+	// Batch.process
+	w.field(thriftStruct, 1).
+		field(thriftString, 1).str("frontend").
+		field(thriftList, 2).list(thriftStruct, 1).stringTag("hostname", "host1").
+		stop()
+	// Batch.spans
+	w.field(thriftList, 2).list(thriftStruct, 1).
+		field(thriftI64, 1).i64(2).
+		field(thriftI64, 2).i64(1).
+		field(thriftI64, 3).i64(3).
+		field(thriftString, 5).str("GET /").
+		field(thriftList, 6).list(thriftStruct, 2).
+		field(thriftI32, 1).i32(0).field(thriftI64, 2).i64(2).field(thriftI64, 3).i64(1).field(thriftI64, 4).i64(4).stop().
+		field(thriftI32, 1).i32(1).field(thriftI64, 2).i64(7).field(thriftI64, 3).i64(0).field(thriftI64, 4).i64(8).stop().
+		field(thriftI64, 8).i64(1000).
+		field(thriftI64, 9).i64(50).
+		field(thriftList, 10).list(thriftStruct, 3).
+		stringTag("span.kind", "server").
+		field(thriftString, 1).str("error").field(thriftI32, 2).i32(2).field(thriftBool, 5).byte(1).stop().
+		field(thriftString, 1).str("http.status_code").field(thriftI32, 2).i32(3).field(thriftI64, 6).i64(500).stop().
+		field(thriftList, 11).list(thriftStruct, 1).
+		field(thriftI64, 1).i64(1010).field(thriftList, 2).list(thriftStruct, 1).stringTag("event", "retry").stop().
+		stop()
+	w.stop()
+
+	obj, err := decodeJaegerThrift(w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJaegerSpan(t, obj.(*tracev1.TracesData))
+}
+
+func checkJaegerSpan(t *testing.T, data *tracev1.TracesData) {
+	t.Helper()
+	if len(data.ResourceSpans) != 1 {
+		t.Fatalf("resource spans = %d", len(data.ResourceSpans))
+	}
+	attrs := map[string]string{}
+	for _, kv := range data.ResourceSpans[0].Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	if attrs["service.name"] != "frontend" || attrs["hostname"] != "host1" {
+		t.Errorf("resource attributes = %v", attrs)
+	}
+	span := data.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	expectedTraceID := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	if string(span.TraceId) != string(expectedTraceID) || span.SpanId[7] != 3 {
+		t.Errorf("ids = %x %x", span.TraceId, span.SpanId)
+	}
+	if len(span.ParentSpanId) != 8 || span.ParentSpanId[7] != 4 {
+		t.Errorf("parent = %x", span.ParentSpanId)
+	}
+	if len(span.Links) != 1 || span.Links[0].SpanId[7] != 8 || span.Links[0].TraceId[15] != 7 {
+		t.Errorf("links = %v", span.Links)
+	}
+	if span.Name != "GET /" || span.StartTimeUnixNano != 1000000 || span.EndTimeUnixNano != 1050000 {
+		t.Errorf("span = %s %d %d", span.Name, span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+	if span.Kind != tracev1.Span_SPAN_KIND_SERVER || span.Status.Code != tracev1.Status_STATUS_CODE_ERROR {
+		t.Errorf("kind = %v, status = %v", span.Kind, span.Status)
+	}
+	if len(span.Attributes) != 2 || span.Attributes[1].Value.GetIntValue() != 500 {
+		t.Errorf("attributes = %v", span.Attributes)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "retry" || span.Events[0].TimeUnixNano != 1010000 {
+		t.Errorf("events = %v", span.Events)
+	}
+}
+
+func TestDecodeJaegerThriftTruncated(t *testing.T) {
+	w := &thriftWriter{}
+	w.field(thriftList, 2).list(thriftStruct, 1).field(thriftString, 5).i32(100)
+	if _, err := decodeJaegerThrift(w.buf); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func protoKV(key string, tp uint64, appendValue func(b []byte) []byte) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, key)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, tp)
+	return appendValue(b)
+}
+
+func protoStringKV(key, val string) []byte {
+	return protoKV(key, 0, func(b []byte) []byte {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		return protowire.AppendString(b, val)
+	})
+}
+
+func protoMsg(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func protoTime(nanos int64) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(nanos/1e9))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(nanos%1e9))
+}
+
+func protoRef(traceID, spanID []byte, refType uint64) []byte {
+	b := protoMsg(nil, 1, traceID)
+	b = protoMsg(b, 2, spanID)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	return protowire.AppendVarint(b, refType)
+}
+
+func TestDecodeJaegerProto(t *testing.T) {
+	traceID := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	otherTraceID := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7}
+
+	var span []byte
+	span = protoMsg(span, 1, traceID)
+	span = protoMsg(span, 2, jaegerSpanID(3))
+	span = protoMsg(span, 3, []byte("GET /"))
+	span = protoMsg(span, 4, protoRef(traceID, jaegerSpanID(4), 0))
+	span = protoMsg(span, 4, protoRef(otherTraceID, jaegerSpanID(8), 1))
+	span = protoMsg(span, 6, protoTime(1000000))
+	span = protoMsg(span, 7, protoTime(50000))
+	span = protoMsg(span, 8, protoStringKV("span.kind", "server"))
+	span = protoMsg(span, 8, protoKV("error", 1, func(b []byte) []byte {
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		return protowire.AppendVarint(b, 1)
+	}))
+	span = protoMsg(span, 8, protoKV("http.status_code", 2, func(b []byte) []byte {
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		return protowire.AppendVarint(b, 500)
+	}))
+	span = protoMsg(span, 8, protoKV("ratio", 3, func(b []byte) []byte {
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(0.5))
+	}))
+	var log []byte
+	log = protoMsg(log, 1, protoTime(1010000))
+	log = protoMsg(log, 2, protoStringKV("event", "retry"))
+	span = protoMsg(span, 9, log)
+
+	var process []byte
+	process = protoMsg(process, 1, []byte("frontend"))
+	process = protoMsg(process, 2, protoStringKV("hostname", "host1"))
+
+	var batch []byte
+	batch = protoMsg(batch, 1, span)
+	batch = protoMsg(batch, 2, process)
+	req := protoMsg(nil, 1, batch)
+
+	obj, err := decodeJaegerProto(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := obj.(*tracev1.TracesData)
+	ratio := data.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes[2]
+	if ratio.Key != "ratio" || ratio.Value.GetDoubleValue() != 0.5 {
+		t.Errorf("ratio = %v", ratio)
+	}
+	data.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes = data.ResourceSpans[0].ScopeSpans[0].Spans[0].Attributes[:2]
+	checkJaegerSpan(t, data)
+
+	if _, err := decodeJaegerProto(req[:len(req)-3]); err == nil {
+		t.Error("expected an error for a truncated request")
+	}
+}
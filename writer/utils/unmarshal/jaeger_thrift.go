@@ -0,0 +1,351 @@
+package unmarshal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// Thrift binary protocol type ids.
+const (
+	thriftStop   = 0
+	thriftBool   = 2
+	thriftByte   = 3
+	thriftDouble = 4
+	thriftI16    = 6
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftMap    = 13
+	thriftSet    = 14
+	thriftList   = 15
+)
+
+const thriftMaxDepth = 32
+
+var errThriftEOF = fmt.Errorf("unexpected end of thrift payload")
+
+// thriftReader decodes the Thrift binary protocol (TBinaryProtocol) the Jaeger
+// clients use to serialize a Batch.
+type thriftReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *thriftReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf)-r.pos < n {
+		r.err = errThriftEOF
+		return nil
+	}
+	res := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return res
+}
+
+func (r *thriftReader) readByte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *thriftReader) readI16() int16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *thriftReader) readI32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *thriftReader) readI64() int64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (r *thriftReader) readDouble() float64 {
+	return math.Float64frombits(uint64(r.readI64()))
+}
+
+func (r *thriftReader) readBinary() []byte {
+	return r.next(int(r.readI32()))
+}
+
+func (r *thriftReader) readString() string {
+	return string(r.readBinary())
+}
+
+// readFieldBegin returns the type and id of the next field, or thriftStop at
+// the end of the struct.
+func (r *thriftReader) readFieldBegin() (byte, int16) {
+	tp := r.readByte()
+	if tp == thriftStop || r.err != nil {
+		return thriftStop, 0
+	}
+	return tp, r.readI16()
+}
+
+// readListBegin returns the element type and the size of a list or set.
+func (r *thriftReader) readListBegin() (byte, int) {
+	tp := r.readByte()
+	size := int(r.readI32())
+	// Every element takes at least one byte.
+	if size < 0 || size > len(r.buf)-r.pos {
+		if r.err == nil {
+			r.err = fmt.Errorf("invalid thrift list size %d", size)
+		}
+		return tp, 0
+	}
+	return tp, size
+}
+
+// readStruct calls onField for every field of a struct. onField must consume
+// the value or return false to skip it.
+func (r *thriftReader) readStruct(depth int, onField func(tp byte, id int16) bool) {
+	if depth > thriftMaxDepth {
+		r.err = fmt.Errorf("thrift payload is nested too deep")
+		return
+	}
+	for r.err == nil {
+		tp, id := r.readFieldBegin()
+		if tp == thriftStop {
+			return
+		}
+		if !onField(tp, id) {
+			r.skip(tp, depth+1)
+		}
+	}
+}
+
+// readList calls onElem for every element of a list of structs.
+func (r *thriftReader) readList(depth int, onElem func()) {
+	tp, size := r.readListBegin()
+	for i := 0; i < size && r.err == nil; i++ {
+		if tp != thriftStruct {
+			r.skip(tp, depth+1)
+			continue
+		}
+		onElem()
+	}
+}
+
+func (r *thriftReader) skip(tp byte, depth int) {
+	if depth > thriftMaxDepth {
+		r.err = fmt.Errorf("thrift payload is nested too deep")
+		return
+	}
+	switch tp {
+	case thriftBool, thriftByte:
+		r.next(1)
+	case thriftI16:
+		r.next(2)
+	case thriftI32:
+		r.next(4)
+	case thriftDouble, thriftI64:
+		r.next(8)
+	case thriftString:
+		r.readBinary()
+	case thriftStruct:
+		r.readStruct(depth, func(byte, int16) bool { return false })
+	case thriftMap:
+		kt, vt := r.readByte(), r.readByte()
+		size := int(r.readI32())
+		for i := 0; i < size && r.err == nil; i++ {
+			r.skip(kt, depth+1)
+			r.skip(vt, depth+1)
+		}
+	case thriftSet, thriftList:
+		et, size := r.readListBegin()
+		for i := 0; i < size && r.err == nil; i++ {
+			r.skip(et, depth+1)
+		}
+	default:
+		r.err = fmt.Errorf("unknown thrift type %d", tp)
+	}
+}
+
+// decodeJaegerThrift decodes a jaeger.thrift Batch to OTLP.
+func decodeJaegerThrift(buf []byte) (any, error) {
+	r := &thriftReader{buf: buf}
+	batch := &jaegerBatch{}
+	r.readStruct(0, func(tp byte, id int16) bool {
+		switch {
+		case id == 1 && tp == thriftStruct:
+			batch.process = r.readProcess()
+		case id == 2 && tp == thriftList:
+			r.readList(1, func() { batch.spans = append(batch.spans, r.readSpan()) })
+		default:
+			return false
+		}
+		return true
+	})
+	if r.err != nil {
+		return nil, customErrors.NewUnmarshalError(r.err)
+	}
+	return batch.toOTLP(), nil
+}
+
+func (r *thriftReader) readProcess() *jaegerProcess {
+	res := &jaegerProcess{}
+	r.readStruct(2, func(tp byte, id int16) bool {
+		switch {
+		case id == 1 && tp == thriftString:
+			res.serviceName = r.readString()
+		case id == 2 && tp == thriftList:
+			res.tags = r.readTags()
+		default:
+			return false
+		}
+		return true
+	})
+	return res
+}
+
+func (r *thriftReader) readSpan() *jaegerSpan {
+	res := &jaegerSpan{}
+	var traceIDLow, traceIDHigh, spanID, parentSpanID, startTime, duration int64
+	r.readStruct(2, func(tp byte, id int16) bool {
+		switch {
+		case id == 1 && tp == thriftI64:
+			traceIDLow = r.readI64()
+		case id == 2 && tp == thriftI64:
+			traceIDHigh = r.readI64()
+		case id == 3 && tp == thriftI64:
+			spanID = r.readI64()
+		case id == 4 && tp == thriftI64:
+			parentSpanID = r.readI64()
+		case id == 5 && tp == thriftString:
+			res.operationName = r.readString()
+		case id == 6 && tp == thriftList:
+			r.readList(3, func() { res.references = append(res.references, r.readSpanRef()) })
+		case id == 8 && tp == thriftI64:
+			startTime = r.readI64()
+		case id == 9 && tp == thriftI64:
+			duration = r.readI64()
+		case id == 10 && tp == thriftList:
+			res.tags = r.readTags()
+		case id == 11 && tp == thriftList:
+			r.readList(3, func() { res.logs = append(res.logs, r.readLog()) })
+		default:
+			return false
+		}
+		return true
+	})
+	res.traceID = jaegerTraceID(traceIDHigh, traceIDLow)
+	res.spanID = jaegerSpanID(spanID)
+	if parentSpanID != 0 {
+		res.parentSpanID = jaegerSpanID(parentSpanID)
+	}
+	// Thrift timestamps and durations are in microseconds.
+	res.startTimeNS = startTime * 1000
+	res.durationNS = duration * 1000
+	return res
+}
+
+func (r *thriftReader) readSpanRef() jaegerSpanRef {
+	var refType int32
+	var traceIDLow, traceIDHigh, spanID int64
+	r.readStruct(4, func(tp byte, id int16) bool {
+		switch {
+		case id == 1 && tp == thriftI32:
+			refType = r.readI32()
+		case id == 2 && tp == thriftI64:
+			traceIDLow = r.readI64()
+		case id == 3 && tp == thriftI64:
+			traceIDHigh = r.readI64()
+		case id == 4 && tp == thriftI64:
+			spanID = r.readI64()
+		default:
+			return false
+		}
+		return true
+	})
+	return jaegerSpanRef{
+		traceID:  jaegerTraceID(traceIDHigh, traceIDLow),
+		spanID:   jaegerSpanID(spanID),
+		followed: refType == 1, // FOLLOWS_FROM
+	}
+}
+
+func (r *thriftReader) readLog() jaegerLog {
+	var res jaegerLog
+	r.readStruct(4, func(tp byte, id int16) bool {
+		switch {
+		case id == 1 && tp == thriftI64:
+			res.timestampNS = r.readI64() * 1000
+		case id == 2 && tp == thriftList:
+			res.fields = r.readTags()
+		default:
+			return false
+		}
+		return true
+	})
+	return res
+}
+
+func (r *thriftReader) readTags() []*commonv1.KeyValue {
+	var res []*commonv1.KeyValue
+	r.readList(4, func() {
+		var key, vStr string
+		var vType int32
+		var vDouble float64
+		var vBool bool
+		var vLong int64
+		var vBinary []byte
+		r.readStruct(5, func(tp byte, id int16) bool {
+			switch {
+			case id == 1 && tp == thriftString:
+				key = r.readString()
+			case id == 2 && tp == thriftI32:
+				vType = r.readI32()
+			case id == 3 && tp == thriftString:
+				vStr = r.readString()
+			case id == 4 && tp == thriftDouble:
+				vDouble = r.readDouble()
+			case id == 5 && tp == thriftBool:
+				vBool = r.readByte() != 0
+			case id == 6 && tp == thriftI64:
+				vLong = r.readI64()
+			case id == 7 && tp == thriftString:
+				vBinary = r.readBinary()
+			default:
+				return false
+			}
+			return true
+		})
+		val := &commonv1.AnyValue{}
+		switch vType {
+		case 1: // DOUBLE
+			val.Value = &commonv1.AnyValue_DoubleValue{DoubleValue: vDouble}
+		case 2: // BOOL
+			val.Value = &commonv1.AnyValue_BoolValue{BoolValue: vBool}
+		case 3: // LONG
+			val.Value = &commonv1.AnyValue_IntValue{IntValue: vLong}
+		case 4: // BINARY
+			val.Value = &commonv1.AnyValue_BytesValue{BytesValue: append([]byte(nil), vBinary...)}
+		default: // STRING
+			val.Value = &commonv1.AnyValue_StringValue{StringValue: vStr}
+		}
+		res = append(res, &commonv1.KeyValue{Key: key, Value: val})
+	})
+	return res
+}
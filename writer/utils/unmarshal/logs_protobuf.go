@@ -7,8 +7,9 @@ import (
 )
 
 type logsProtoDec struct {
-	ctx       *ParserCtx
-	onEntries onEntriesHandler
+	ctx                  *ParserCtx
+	onEntries            onEntriesHandler
+	onStructuredMetadata onStructuredMetadataHandler
 }
 
 func (l *logsProtoDec) Decode() error {
@@ -24,10 +25,20 @@ func (l *logsProtoDec) Decode() error {
 		labels = sanitizeLabels(labels)
 		tsns := make([]int64, len(stream.GetEntries()))
 		msgs := make([]string, len(stream.GetEntries()))
+		meta := make([]string, len(stream.GetEntries()))
 
 		for i, e := range stream.GetEntries() {
 			tsns[i] = e.Timestamp.GetSeconds()*1000000000 + int64(e.Timestamp.GetNanos())
 			msgs[i] = e.GetLine()
+			meta[i] = structuredMetadataFromProto(e.GetStructuredMetadata())
+		}
+		if l.onStructuredMetadata != nil && hasStructuredMetadata(meta) {
+			err = l.onStructuredMetadata(labels, tsns, msgs, make([]float64, len(tsns)),
+				fastFillArray[uint8](len(tsns), model.SAMPLE_TYPE_LOG), meta)
+			if err != nil {
+				return err
+			}
+			continue
 		}
 		err = l.onEntries(labels, tsns, msgs, make([]float64, len(stream.GetEntries())),
 			fastFillArray[uint8](len(stream.GetEntries()), model.SAMPLE_TYPE_LOG))
@@ -42,6 +53,10 @@ func (l *logsProtoDec) SetOnEntries(h onEntriesHandler) {
 	l.onEntries = h
 }
 
+func (l *logsProtoDec) SetOnStructuredMetadata(h onStructuredMetadataHandler) {
+	l.onStructuredMetadata = h
+}
+
 var UnmarshalProtoV2 = Build(
 	withBufferedBody,
 	withParsedBody(func() proto.Message { return &logproto.PushRequest{} }),
@@ -4,13 +4,16 @@ import (
 	"time"
 
 	"github.com/metrico/qryn/v5/writer/model"
-	"github.com/metrico/qryn/v5/writer/utils/proto/prompb"
-	"google.golang.org/protobuf/proto"
+	"github.com/metrico/qryn/v5/writer/utils/errors"
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
 )
 
 type promMetricsProtoDec struct {
-	ctx       *ParserCtx
-	onEntries onEntriesHandler
+	ctx          *ParserCtx
+	onEntries    onEntriesHandler
+	onHistograms onHistogramsHandler
+	onExemplars  onExemplarsHandler
 }
 
 func (l *promMetricsProtoDec) Decode() error {
@@ -24,7 +27,7 @@ func (l *promMetricsProtoDec) Decode() error {
 	for _, ts := range req.GetTimeseries() {
 		oLblsBuf = oLblsBuf[:0]
 		for _, lbl := range ts.GetLabels() {
-			oLblsBuf = append(oLblsBuf, []string{lbl.GetName(), lbl.GetValue()})
+			oLblsBuf = append(oLblsBuf, []string{lbl.Name, lbl.Value})
 			labelsLen += len(lbl.GetName()) + len(lbl.GetValue())
 			_labelsLen += len(lbl.GetName()) + len(lbl.GetValue())
 		}
@@ -63,15 +66,72 @@ func (l *promMetricsProtoDec) Decode() error {
 				return err
 			}
 		}
+
+		if err := l.decodeHistograms(oLblsBuf, ts.GetHistograms()); err != nil {
+			return err
+		}
+		if err := l.decodeExemplars(oLblsBuf, ts.GetExemplars()); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// decodeHistograms stores the native histograms as the remote write 2.0
+// decoder does, converted to writev2.Histogram messages.
+func (l *promMetricsProtoDec) decodeHistograms(lbls [][]string, hists []prompb.Histogram) error {
+	if len(hists) == 0 || l.onHistograms == nil {
+		return nil
+	}
+	res := make([]writev2.Histogram, len(hists))
+	for i, h := range hists {
+		if h.IsFloatHistogram() {
+			res[i] = writev2.FromFloatHistogram(h.Timestamp, h.ToFloatHistogram())
+		} else {
+			res[i] = writev2.FromIntHistogram(h.Timestamp, h.ToIntHistogram())
+		}
+	}
+	return onEncodedHistograms(lbls, res, l.onHistograms)
+}
+
+func (l *promMetricsProtoDec) decodeExemplars(lbls [][]string, exemplars []prompb.Exemplar) error {
+	if len(exemplars) == 0 || l.onExemplars == nil {
+		return nil
+	}
+	var batch exemplarsBatch
+	for _, e := range exemplars {
+		eLbls := make([][]string, len(e.Labels))
+		for i, lbl := range e.Labels {
+			eLbls[i] = []string{lbl.Name, lbl.Value}
+		}
+		batch.add(e.Timestamp*1e6, e.Value, eLbls)
+	}
+	return batch.flush(lbls, l.onExemplars)
+}
+
 func (l *promMetricsProtoDec) SetOnEntries(h onEntriesHandler) {
 	l.onEntries = h
 }
 
+func (l *promMetricsProtoDec) SetOnHistograms(h onHistogramsHandler) {
+	l.onHistograms = h
+}
+
+func (l *promMetricsProtoDec) SetOnExemplars(h onExemplarsHandler) {
+	l.onExemplars = h
+}
+
+// decodeRemoteWriteV1 decodes a remote write 1.0 request. The upstream
+// prompb types are used as they carry exemplars and native histograms.
+func decodeRemoteWriteV1(buf []byte) (any, error) {
+	req := &prompb.WriteRequest{}
+	if err := req.Unmarshal(buf); err != nil {
+		return nil, errors.NewUnmarshalError(err)
+	}
+	return req, nil
+}
+
 var UnmarshallMetricsWriteProtoV2 = Build(
 	withBufferedBody,
-	withParsedBody(func() proto.Message { return &prompb.WriteRequest{} }),
+	withDecodedBody(decodeRemoteWriteV1),
 	withLogsParser(func(ctx *ParserCtx) iLogsParser { return &promMetricsProtoDec{ctx: ctx} }))
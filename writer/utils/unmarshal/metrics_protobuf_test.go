@@ -4,7 +4,8 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/metrico/qryn/v5/writer/utils/proto/prompb"
+	"github.com/prometheus/prometheus/prompb"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
 )
 
 // TestPromMetricsFlushLimitTypesLength verifies that when a time series has more
@@ -15,15 +16,15 @@ import (
 func TestPromMetricsFlushLimitTypesLength(t *testing.T) {
 	const totalSamples = 1001 // one more than flushLimit to trigger the mid-flush
 
-	samples := make([]*prompb.Sample, totalSamples)
+	samples := make([]prompb.Sample, totalSamples)
 	for i := range samples {
-		samples[i] = &prompb.Sample{Timestamp: int64(i), Value: float64(i)}
+		samples[i] = prompb.Sample{Timestamp: int64(i), Value: float64(i)}
 	}
 
 	req := &prompb.WriteRequest{
-		Timeseries: []*prompb.TimeSeries{
+		Timeseries: []prompb.TimeSeries{
 			{
-				Labels:  []*prompb.Label{{Name: "__name__", Value: "test_metric"}},
+				Labels:  []prompb.Label{{Name: "__name__", Value: "test_metric"}},
 				Samples: samples,
 			},
 		},
@@ -53,3 +54,101 @@ func TestPromMetricsFlushLimitTypesLength(t *testing.T) {
 		}
 	}
 }
+
+func TestPromMetricsDecodeExemplars(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests_total"}},
+				Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}},
+				Exemplars: []prompb.Exemplar{{
+					Labels:    []prompb.Label{{Name: "trace_id", Value: "abc"}},
+					Value:     0.5,
+					Timestamp: 1500,
+				}},
+			},
+		},
+	}
+	dec := &promMetricsProtoDec{ctx: &ParserCtx{bodyObject: req}}
+	dec.SetOnEntries(func([][]string, []int64, []string, []float64, []uint8) error { return nil })
+	var got []string
+	dec.SetOnExemplars(func(labels [][]string, timestampsNS []int64, value []float64,
+		traceIDs []string, exemplarLabels []string) error {
+		for i := range timestampsNS {
+			got = append(got, fmt.Sprintf("%s %d %v %s %s",
+				labels[0][1], timestampsNS[i], value[i], traceIDs[i], exemplarLabels[i]))
+		}
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `http_requests_total 1500000000 0.5 abc {"trace_id":"abc"}`
+	if len(got) != 1 || got[0] != expected {
+		t.Errorf("exemplars = %v, want [%s]", got, expected)
+	}
+}
+
+func TestPromMetricsDecodeHistograms(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			{
+				Labels: []prompb.Label{{Name: "__name__", Value: "rpc_duration_seconds"}},
+				Histograms: []prompb.Histogram{
+					{
+						Count:          &prompb.Histogram_CountInt{CountInt: 5},
+						Sum:            12.5,
+						ZeroThreshold:  1e-128,
+						ZeroCount:      &prompb.Histogram_ZeroCountInt{ZeroCountInt: 1},
+						PositiveSpans:  []prompb.BucketSpan{{Offset: 0, Length: 2}},
+						PositiveDeltas: []int64{2, 0},
+						Timestamp:      3000,
+					},
+					{
+						Count:          &prompb.Histogram_CountFloat{CountFloat: 2.5},
+						Sum:            1,
+						PositiveSpans:  []prompb.BucketSpan{{Offset: 1, Length: 1}},
+						PositiveCounts: []float64{2.5},
+						Timestamp:      4000,
+					},
+				},
+			},
+		},
+	}
+	dec := &promMetricsProtoDec{ctx: &ParserCtx{bodyObject: req}}
+	dec.SetOnEntries(func([][]string, []int64, []string, []float64, []uint8) error {
+		t.Fatal("onEntries must not be called for a histogram-only series")
+		return nil
+	})
+	var hists [][]byte
+	var counts, sums []float64
+	var tsns []int64
+	dec.SetOnHistograms(func(labels [][]string, timestampsNS []int64, count []float64, sum []float64, histograms [][]byte) error {
+		tsns = append(tsns, timestampsNS...)
+		counts = append(counts, count...)
+		sums = append(sums, sum...)
+		hists = append(hists, histograms...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hists) != 2 || tsns[0] != 3000*1e6 || counts[0] != 5 || sums[0] != 12.5 ||
+		tsns[1] != 4000*1e6 || counts[1] != 2.5 {
+		t.Fatalf("unexpected histograms: ts=%v count=%v sum=%v", tsns, counts, sums)
+	}
+	var h writev2.Histogram
+	if err := h.Unmarshal(hists[0]); err != nil {
+		t.Fatal(err)
+	}
+	if fh := h.ToFloatHistogram(); fh.Count != 5 || fh.ZeroCount != 1 || len(fh.PositiveBuckets) != 2 {
+		t.Errorf("unexpected decoded histogram: %v", fh)
+	}
+	var fh writev2.Histogram
+	if err := fh.Unmarshal(hists[1]); err != nil {
+		t.Fatal(err)
+	}
+	if !fh.IsFloatHistogram() || fh.ToFloatHistogram().Count != 2.5 {
+		t.Errorf("unexpected decoded float histogram: %v", fh.ToFloatHistogram())
+	}
+}
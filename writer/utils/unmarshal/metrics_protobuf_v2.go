@@ -0,0 +1,301 @@
+package unmarshal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/go-faster/city"
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/utils"
+	"github.com/metrico/qryn/v5/writer/utils/errors"
+	"github.com/metrico/qryn/v5/writer/utils/numbercache"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+)
+
+// promMetricsV2ProtoDec decodes Prometheus remote write 2.0 requests
+// (io.prometheus.write.v2.Request). Labels and metadata are resolved through
+// the request symbol table; metadata is passed on as __metric_*__ labels.
+// Native histograms are stored as encoded writev2.Histogram messages. The
+// start timestamps of the samples are stored as zero samples.
+type promMetricsV2ProtoDec struct {
+	ctx          *ParserCtx
+	onEntries    onEntriesHandler
+	onHistograms onHistogramsHandler
+	onExemplars  onExemplarsHandler
+	stats        *model.WriteStats
+}
+
+var remoteWriteV2MetricTypes = map[writev2.Metadata_MetricType]string{
+	writev2.Metadata_METRIC_TYPE_COUNTER:        "counter",
+	writev2.Metadata_METRIC_TYPE_GAUGE:          "gauge",
+	writev2.Metadata_METRIC_TYPE_HISTOGRAM:      "histogram",
+	writev2.Metadata_METRIC_TYPE_GAUGEHISTOGRAM: "gaugehistogram",
+	writev2.Metadata_METRIC_TYPE_SUMMARY:        "summary",
+	writev2.Metadata_METRIC_TYPE_INFO:           "info",
+	writev2.Metadata_METRIC_TYPE_STATESET:       "stateset",
+}
+
+func (l *promMetricsV2ProtoDec) Decode() error {
+	const flushLimit = 1000
+	req := l.ctx.bodyObject.(*writev2.Request)
+	if stats, ok := l.ctx.ctx.Value(utils.ContextKeyWriteStats).(*model.WriteStats); ok {
+		l.stats = stats
+	}
+	symbols := req.GetSymbols()
+	for i := range req.Timeseries {
+		ts := &req.Timeseries[i]
+		lbls, err := desymbolizeRemoteWriteV2(symbols, ts.GetLabelsRefs())
+		if err != nil {
+			return err
+		}
+		meta, err := remoteWriteV2MetaLabels(symbols, ts.GetMetadata())
+		if err != nil {
+			return err
+		}
+		lbls = append(sanitizeLabels(lbls), meta...)
+
+		tsns := make([]int64, 0, len(ts.GetSamples()))
+		value := make([]float64, 0, len(ts.GetSamples()))
+		msg := make([]string, 0, len(ts.GetSamples()))
+		lastST := int64(0)
+		for _, spl := range ts.GetSamples() {
+			if st := spl.StartTimestamp; st != lastST && l.isNewStartTimestamp(lbls, st, spl.Timestamp) {
+				tsns = append(tsns, st*1e6)
+				value = append(value, 0)
+				msg = append(msg, "")
+			}
+			lastST = spl.StartTimestamp
+			tsns = append(tsns, spl.Timestamp*1e6)
+			value = append(value, spl.Value)
+			msg = append(msg, "")
+			if len(tsns) >= flushLimit {
+				if err := l.flush(lbls, tsns, msg, value); err != nil {
+					return err
+				}
+				tsns = tsns[:0]
+				value = value[:0]
+				msg = msg[:0]
+			}
+		}
+		if len(tsns) > 0 {
+			if err := l.flush(lbls, tsns, msg, value); err != nil {
+				return err
+			}
+		}
+		if l.stats != nil {
+			l.stats.Samples.Add(int64(len(ts.GetSamples())))
+		}
+		if err := l.decodeHistograms(lbls, ts.GetHistograms()); err != nil {
+			return err
+		}
+		if err := l.decodeExemplars(lbls, symbols, ts.GetExemplars()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *promMetricsV2ProtoDec) decodeExemplars(lbls [][]string, symbols []string, exemplars []writev2.Exemplar) error {
+	if len(exemplars) == 0 || l.onExemplars == nil {
+		return nil
+	}
+	var batch exemplarsBatch
+	for _, e := range exemplars {
+		eLbls, err := desymbolizeRemoteWriteV2(symbols, e.GetLabelsRefs())
+		if err != nil {
+			return err
+		}
+		batch.add(e.Timestamp*1e6, e.Value, eLbls)
+	}
+	if err := batch.flush(lbls, l.onExemplars); err != nil {
+		return err
+	}
+	if l.stats != nil {
+		l.stats.Exemplars.Add(int64(len(exemplars)))
+	}
+	return nil
+}
+
+func (l *promMetricsV2ProtoDec) decodeHistograms(lbls [][]string, hists []writev2.Histogram) error {
+	if len(hists) == 0 || l.onHistograms == nil {
+		return nil
+	}
+	res := make([]writev2.Histogram, 0, len(hists))
+	lastST := int64(0)
+	for _, h := range hists {
+		if st := h.StartTimestamp; st != lastST && l.isNewStartTimestamp(lbls, st, h.Timestamp) {
+			res = append(res, zeroHistogram(&h, st))
+		}
+		lastST = h.StartTimestamp
+		res = append(res, h)
+	}
+	if err := onEncodedHistograms(lbls, res, l.onHistograms); err != nil {
+		return err
+	}
+	if l.stats != nil {
+		l.stats.Histograms.Add(int64(len(hists)))
+	}
+	return nil
+}
+
+// startTimestampsCacheBytes is the size of the cache of the start timestamps
+// the zero samples are stored for.
+const startTimestampsCacheBytes = 32 * 1024 * 1024
+
+var (
+	startTimestampsOnce sync.Once
+	startTimestamps     *fastcache.Cache
+)
+
+// isNewStartTimestamp reports whether the zero sample at the start (created)
+// timestamp st of a sample at ts is to be stored. As in Prometheus, a counter
+// or a histogram starts with a zero sample at its start timestamp. The start
+// timestamps of the series are cached, so the zero sample is stored once while
+// every sample of the series carries the start timestamp. They are forgotten
+// if the request is not stored, so its retry stores the zero sample.
+func (l *promMetricsV2ProtoDec) isNewStartTimestamp(lbls [][]string, st int64, ts int64) bool {
+	if st == 0 || st >= ts {
+		return false
+	}
+	startTimestampsOnce.Do(func() { startTimestamps = fastcache.New(startTimestampsCacheBytes) })
+	key := make([]byte, 0, 256)
+	for _, lbl := range lbls {
+		key = append(append(append(key, lbl[0]...), 0), lbl[1]...)
+		key = append(key, 0)
+	}
+	key = binary.LittleEndian.AppendUint64(key, uint64(st))
+	var hash [8]byte
+	binary.LittleEndian.PutUint64(hash[:], city.CH64(key))
+	if startTimestamps.Has(hash[:]) {
+		return false
+	}
+	startTimestamps.Set(hash[:], nil)
+	if fpCache, ok := l.ctx.fpCache.(*numbercache.RequestCache[uint64]); ok {
+		fpCache.OnRollback(func() { startTimestamps.Del(hash[:]) })
+	}
+	return true
+}
+
+// zeroHistogram returns the empty histogram of the layout of h at the start
+// timestamp st.
+func zeroHistogram(h *writev2.Histogram, st int64) writev2.Histogram {
+	res := writev2.Histogram{
+		Schema:        h.Schema,
+		ZeroThreshold: h.ZeroThreshold,
+		CustomValues:  h.CustomValues,
+		ResetHint:     writev2.Histogram_RESET_HINT_YES,
+		Timestamp:     st,
+	}
+	if h.IsFloatHistogram() {
+		res.Count = &writev2.Histogram_CountFloat{}
+		res.ZeroCount = &writev2.Histogram_ZeroCountFloat{}
+	} else {
+		res.Count = &writev2.Histogram_CountInt{}
+		res.ZeroCount = &writev2.Histogram_ZeroCountInt{}
+	}
+	return res
+}
+
+// onEncodedHistograms passes the histograms of a series to onHistograms as
+// encoded writev2.Histogram messages.
+func onEncodedHistograms(lbls [][]string, hists []writev2.Histogram, onHistograms onHistogramsHandler) error {
+	tsns := make([]int64, len(hists))
+	count := make([]float64, len(hists))
+	sum := make([]float64, len(hists))
+	encoded := make([][]byte, len(hists))
+	for i := range hists {
+		h := &hists[i]
+		buf, err := h.Marshal()
+		if err != nil {
+			return err
+		}
+		tsns[i] = h.Timestamp * 1e6
+		if h.IsFloatHistogram() {
+			count[i] = h.GetCountFloat()
+		} else {
+			count[i] = float64(h.GetCountInt())
+		}
+		sum[i] = h.GetSum()
+		encoded[i] = buf
+	}
+	return onHistograms(lbls, tsns, count, sum, encoded)
+}
+
+func (l *promMetricsV2ProtoDec) flush(lbls [][]string, tsns []int64, msg []string, value []float64) error {
+	return l.onEntries(lbls, tsns, msg, value, fastFillArray[uint8](len(tsns), model.SAMPLE_TYPE_METRIC))
+}
+
+func (l *promMetricsV2ProtoDec) SetOnEntries(h onEntriesHandler) {
+	l.onEntries = h
+}
+
+func (l *promMetricsV2ProtoDec) SetOnHistograms(h onHistogramsHandler) {
+	l.onHistograms = h
+}
+
+func (l *promMetricsV2ProtoDec) SetOnExemplars(h onExemplarsHandler) {
+	l.onExemplars = h
+}
+
+func remoteWriteV2Symbol(symbols []string, ref uint32) (string, error) {
+	if int(ref) >= len(symbols) {
+		return "", errors.New400Error(fmt.Sprintf("symbol reference %d out of range (%d symbols)", ref, len(symbols)))
+	}
+	return symbols[ref], nil
+}
+
+func desymbolizeRemoteWriteV2(symbols []string, refs []uint32) ([][]string, error) {
+	if len(refs)%2 != 0 {
+		return nil, errors.New400Error("odd number of label references")
+	}
+	res := make([][]string, 0, len(refs)/2)
+	for i := 0; i < len(refs); i += 2 {
+		name, err := remoteWriteV2Symbol(symbols, refs[i])
+		if err != nil {
+			return nil, err
+		}
+		val, err := remoteWriteV2Symbol(symbols, refs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, []string{name, val})
+	}
+	return res, nil
+}
+
+func remoteWriteV2MetaLabels(symbols []string, meta writev2.Metadata) ([][]string, error) {
+	var res [][]string
+	if tp, ok := remoteWriteV2MetricTypes[meta.GetType()]; ok {
+		res = append(res, []string{"__metric_type__", tp})
+	}
+	help, err := remoteWriteV2Symbol(symbols, meta.GetHelpRef())
+	if err != nil {
+		return nil, err
+	}
+	if help != "" {
+		res = append(res, []string{"__metric_help__", help})
+	}
+	unit, err := remoteWriteV2Symbol(symbols, meta.GetUnitRef())
+	if err != nil {
+		return nil, err
+	}
+	if unit != "" {
+		res = append(res, []string{"__metric_unit__", unit})
+	}
+	return res, nil
+}
+
+func decodeRemoteWriteV2(buf []byte) (any, error) {
+	req := &writev2.Request{}
+	if err := req.Unmarshal(buf); err != nil {
+		return nil, errors.NewUnmarshalError(err)
+	}
+	return req, nil
+}
+
+var UnmarshallMetricsWrite2ProtoV2 = Build(
+	withBufferedBody,
+	withDecodedBody(decodeRemoteWriteV2),
+	withLogsParser(func(ctx *ParserCtx) iLogsParser { return &promMetricsV2ProtoDec{ctx: ctx} }))
@@ -0,0 +1,290 @@
+package unmarshal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/utils"
+	"github.com/metrico/qryn/v5/writer/utils/numbercache"
+	writev2 "github.com/prometheus/prometheus/prompb/io/prometheus/write/v2"
+)
+
+// resetStartTimestamps forgets the start timestamps of the previous tests.
+func resetStartTimestamps() {
+	startTimestampsOnce.Do(func() {})
+	startTimestamps = fastcache.New(startTimestampsCacheBytes)
+}
+
+func TestPromMetricsV2Decode(t *testing.T) {
+	resetStartTimestamps()
+	req := &writev2.Request{
+		Symbols: []string{"", "__name__", "http_requests_total", "job", "api", "Total requests", "requests"},
+		Timeseries: []writev2.TimeSeries{
+			{
+				LabelsRefs: []uint32{1, 2, 3, 4},
+				Samples: []writev2.Sample{
+					{Value: 1, Timestamp: 1000},
+					{Value: 2, Timestamp: 2000, StartTimestamp: 500},
+				},
+				Metadata: writev2.Metadata{Type: writev2.Metadata_METRIC_TYPE_COUNTER, HelpRef: 5, UnitRef: 6},
+			},
+		},
+	}
+	buf, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := decodeRemoteWriteV2(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &model.WriteStats{}
+	dec := &promMetricsV2ProtoDec{ctx: &ParserCtx{
+		bodyObject: obj,
+		ctx:        context.WithValue(context.Background(), utils.ContextKeyWriteStats, stats),
+	}}
+	var lbls map[string]string
+	var tsns []int64
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		lbls = map[string]string{}
+		for _, l := range labels {
+			lbls[l[0]] = l[1]
+		}
+		tsns = append(tsns, timestampsNS...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"__name__":        "http_requests_total",
+		"job":             "api",
+		"__metric_type__": "counter",
+		"__metric_help__": "Total requests",
+		"__metric_unit__": "requests",
+	}
+	for k, v := range expected {
+		if lbls[k] != v {
+			t.Errorf("label %s = %q, want %q", k, lbls[k], v)
+		}
+	}
+	// The start timestamp of the second sample is stored as a zero sample.
+	if len(tsns) != 3 || tsns[0] != 1000*1e6 || tsns[1] != 500*1e6 || tsns[2] != 2000*1e6 {
+		t.Errorf("timestamps = %v", tsns)
+	}
+	// Only the samples of the client are reported as written.
+	if stats.Samples.Load() != 2 {
+		t.Errorf("samples written = %d, want 2", stats.Samples.Load())
+	}
+}
+
+func TestPromMetricsV2DecodeBadSymbolRef(t *testing.T) {
+	req := &writev2.Request{
+		Symbols:    []string{"", "__name__"},
+		Timeseries: []writev2.TimeSeries{{LabelsRefs: []uint32{1, 7}, Samples: []writev2.Sample{{Value: 1, Timestamp: 1}}}},
+	}
+	dec := &promMetricsV2ProtoDec{ctx: &ParserCtx{bodyObject: req, ctx: context.Background()}}
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		t.Fatal("onEntries must not be called for an invalid series")
+		return nil
+	})
+	if err := dec.Decode(); err == nil {
+		t.Fatal("expected an error for an out-of-range symbol reference")
+	}
+}
+
+func TestPromMetricsV2DecodeHistograms(t *testing.T) {
+	req := &writev2.Request{
+		Symbols: []string{"", "__name__", "rpc_duration_seconds"},
+		Timeseries: []writev2.TimeSeries{
+			{
+				LabelsRefs: []uint32{1, 2},
+				Histograms: []writev2.Histogram{
+					{
+						Count:          &writev2.Histogram_CountInt{CountInt: 5},
+						Sum:            12.5,
+						Schema:         0,
+						ZeroThreshold:  1e-128,
+						ZeroCount:      &writev2.Histogram_ZeroCountInt{ZeroCountInt: 1},
+						PositiveSpans:  []writev2.BucketSpan{{Offset: 0, Length: 2}},
+						PositiveDeltas: []int64{2, 0},
+						Timestamp:      3000,
+					},
+				},
+			},
+		},
+	}
+	stats := &model.WriteStats{}
+	dec := &promMetricsV2ProtoDec{ctx: &ParserCtx{
+		bodyObject: req,
+		ctx:        context.WithValue(context.Background(), utils.ContextKeyWriteStats, stats),
+	}}
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		t.Fatal("onEntries must not be called for a histogram-only series")
+		return nil
+	})
+	var hists [][]byte
+	var counts, sums []float64
+	var tsns []int64
+	dec.SetOnHistograms(func(labels [][]string, timestampsNS []int64, count []float64, sum []float64, histograms [][]byte) error {
+		tsns = append(tsns, timestampsNS...)
+		counts = append(counts, count...)
+		sums = append(sums, sum...)
+		hists = append(hists, histograms...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hists) != 1 || tsns[0] != 3000*1e6 || counts[0] != 5 || sums[0] != 12.5 {
+		t.Fatalf("unexpected histograms: ts=%v count=%v sum=%v", tsns, counts, sums)
+	}
+	var h writev2.Histogram
+	if err := h.Unmarshal(hists[0]); err != nil {
+		t.Fatal(err)
+	}
+	if fh := h.ToFloatHistogram(); fh.Count != 5 || fh.ZeroCount != 1 || len(fh.PositiveBuckets) != 2 {
+		t.Errorf("unexpected decoded histogram: %v", fh)
+	}
+	if stats.Histograms.Load() != 1 {
+		t.Errorf("histograms written = %d, want 1", stats.Histograms.Load())
+	}
+}
+
+func TestPromMetricsV2DecodeExemplars(t *testing.T) {
+	req := &writev2.Request{
+		Symbols: []string{"", "__name__", "http_requests_total", "trace_id", "4bf92f3577b34da6", "span_id", "00f067aa"},
+		Timeseries: []writev2.TimeSeries{
+			{
+				LabelsRefs: []uint32{1, 2},
+				Samples:    []writev2.Sample{{Value: 1, Timestamp: 1000}},
+				Exemplars:  []writev2.Exemplar{{LabelsRefs: []uint32{3, 4, 5, 6}, Value: 0.25, Timestamp: 1200}},
+			},
+		},
+	}
+	stats := &model.WriteStats{}
+	dec := &promMetricsV2ProtoDec{ctx: &ParserCtx{
+		bodyObject: req,
+		ctx:        context.WithValue(context.Background(), utils.ContextKeyWriteStats, stats),
+	}}
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		return nil
+	})
+	var tsns []int64
+	var traceIDs, exemplarLabels []string
+	dec.SetOnExemplars(func(labels [][]string, timestampsNS []int64, value []float64, traceID []string, eLabels []string) error {
+		tsns = append(tsns, timestampsNS...)
+		traceIDs = append(traceIDs, traceID...)
+		exemplarLabels = append(exemplarLabels, eLabels...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tsns) != 1 || tsns[0] != 1200*1e6 || traceIDs[0] != "4bf92f3577b34da6" {
+		t.Fatalf("unexpected exemplars: ts=%v trace_id=%v", tsns, traceIDs)
+	}
+	if exemplarLabels[0] != `{"trace_id":"4bf92f3577b34da6","span_id":"00f067aa"}` {
+		t.Errorf("exemplar labels = %s", exemplarLabels[0])
+	}
+	if stats.Exemplars.Load() != 1 {
+		t.Errorf("exemplars written = %d, want 1", stats.Exemplars.Load())
+	}
+}
+
+func TestPromMetricsV2DecodeStartTimestamps(t *testing.T) {
+	req := &writev2.Request{
+		Symbols: []string{"", "__name__", "http_requests_total", "rpc_duration_seconds"},
+		Timeseries: []writev2.TimeSeries{
+			{
+				LabelsRefs: []uint32{1, 2},
+				Samples: []writev2.Sample{
+					{Value: 3, Timestamp: 1000, StartTimestamp: 500},
+					{Value: 4, Timestamp: 2000, StartTimestamp: 500},
+					{Value: 1, Timestamp: 3000, StartTimestamp: 3000},
+				},
+			},
+			{
+				LabelsRefs: []uint32{1, 3},
+				Histograms: []writev2.Histogram{{
+					Count:          &writev2.Histogram_CountFloat{CountFloat: 2},
+					Schema:         1,
+					PositiveSpans:  []writev2.BucketSpan{{Offset: 0, Length: 1}},
+					PositiveCounts: []float64{2},
+					Timestamp:      2000,
+					StartTimestamp: 1500,
+				}},
+			},
+		},
+	}
+	resetStartTimestamps()
+	cache := numbercache.NewCache(time.Minute, func(val uint64) []byte {
+		return unsafe.Slice((*byte)(unsafe.Pointer(&val)), 8)
+	}, nil)
+	defer cache.Stop()
+	var fpCache *numbercache.RequestCache[uint64]
+	stats := &model.WriteStats{}
+	decode := func() (samples []string, hists []writev2.Histogram) {
+		fpCache = numbercache.NewRequestCache(cache)
+		stats = &model.WriteStats{}
+		dec := &promMetricsV2ProtoDec{ctx: &ParserCtx{
+			bodyObject: req,
+			fpCache:    fpCache,
+			ctx:        context.WithValue(context.Background(), utils.ContextKeyWriteStats, stats),
+		}}
+		dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+			for i := range timestampsNS {
+				samples = append(samples, fmt.Sprintf("%d=%v", timestampsNS[i]/1e6, value[i]))
+			}
+			return nil
+		})
+		dec.SetOnHistograms(func(labels [][]string, timestampsNS []int64, count []float64, sum []float64, histograms [][]byte) error {
+			for _, b := range histograms {
+				var h writev2.Histogram
+				if err := h.Unmarshal(b); err != nil {
+					t.Fatal(err)
+				}
+				hists = append(hists, h)
+			}
+			return nil
+		})
+		if err := dec.Decode(); err != nil {
+			t.Fatal(err)
+		}
+		return samples, hists
+	}
+
+	samples, hists := decode()
+	if want := []string{"500=0", "1000=3", "2000=4", "3000=1"}; !reflect.DeepEqual(samples, want) {
+		t.Errorf("samples = %v, want %v", samples, want)
+	}
+	if len(hists) != 2 || hists[0].Timestamp != 1500 || hists[0].ToFloatHistogram().Count != 0 ||
+		hists[0].Schema != 1 || hists[1].Timestamp != 2000 {
+		t.Errorf("histograms = %v", hists)
+	}
+	if stats.Samples.Load() != 3 || stats.Histograms.Load() != 1 {
+		t.Errorf("samples written = %d, histograms written = %d, want 3 and 1",
+			stats.Samples.Load(), stats.Histograms.Load())
+	}
+
+	// The retry of a request which is not stored stores the zero samples.
+	fpCache.Rollback()
+	samples, hists = decode()
+	if want := []string{"500=0", "1000=3", "2000=4", "3000=1"}; !reflect.DeepEqual(samples, want) || len(hists) != 2 {
+		t.Errorf("samples = %v, histograms = %v on the retry", samples, hists)
+	}
+
+	// The zero samples are stored once per series.
+	samples, hists = decode()
+	if want := []string{"1000=3", "2000=4", "3000=1"}; !reflect.DeepEqual(samples, want) || len(hists) != 1 {
+		t.Errorf("samples = %v, histograms = %v on the second request", samples, hists)
+	}
+}
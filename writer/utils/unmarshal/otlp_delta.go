@@ -0,0 +1,71 @@
+package unmarshal
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deltaSeriesTTL     = time.Hour
+	deltaCleanupPeriod = time.Minute
+)
+
+// deltaAccumulator turns OTLP delta points into the running totals Prometheus
+// counters expect. The state is kept per writer process, so senders using delta
+// temporality should stick to one writer (as they do with any stateful receiver).
+// The series of different tenants (X-CH-DSN) are accumulated apart.
+type deltaAccumulator struct {
+	mtx         sync.Mutex
+	series      map[string]*deltaSeries
+	lastCleanup time.Time
+}
+
+type deltaSeries struct {
+	value    float64
+	lastSeen time.Time
+}
+
+func newDeltaAccumulator() *deltaAccumulator {
+	return &deltaAccumulator{
+		series:      map[string]*deltaSeries{},
+		lastCleanup: time.Now(),
+	}
+}
+
+var otlpDeltas = newDeltaAccumulator()
+
+// add accumulates the delta for the series of the tenant identified by labels and
+// returns the new total.
+func (a *deltaAccumulator) add(tenant string, labels [][]string, delta float64) float64 {
+	key := deltaSeriesKey(tenant, labels)
+	now := time.Now()
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if now.Sub(a.lastCleanup) > deltaCleanupPeriod {
+		for k, s := range a.series {
+			if now.Sub(s.lastSeen) > deltaSeriesTTL {
+				delete(a.series, k)
+			}
+		}
+		a.lastCleanup = now
+	}
+	s, ok := a.series[key]
+	if !ok {
+		s = &deltaSeries{}
+		a.series[key] = s
+	}
+	s.value += delta
+	s.lastSeen = now
+	return s.value
+}
+
+func deltaSeriesKey(tenant string, labels [][]string) string {
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = l[0] + "\xff" + l[1]
+	}
+	sort.Strings(parts)
+	return tenant + "\xfd" + strings.Join(parts, "\xfe")
+}
@@ -0,0 +1,509 @@
+package unmarshal
+
+import (
+	"encoding/hex"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/utils"
+	"github.com/metrico/qryn/v5/writer/utils/errors"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+type otlpMetricsDec struct {
+	ctx         *ParserCtx
+	onEntries   onEntriesHandler
+	onExemplars onExemplarsHandler
+	deltas      *deltaAccumulator
+	tenant      string
+}
+
+func (d *otlpMetricsDec) Decode() error {
+	metrics := d.ctx.bodyObject.(*metricsv1.MetricsData)
+	if d.deltas == nil {
+		d.deltas = otlpDeltas
+	}
+	d.tenant, _ = d.ctx.ctx.Value(utils.ContextKeyDSN).(string)
+	for _, resMetrics := range metrics.ResourceMetrics {
+		resourceLabels := map[string]string{}
+		if resMetrics.Resource != nil {
+			otlpPromoteResourceAttrs(resMetrics.Resource.Attributes, resourceLabels)
+		}
+		for _, scopeMetrics := range resMetrics.ScopeMetrics {
+			scopeLabels := make(map[string]string, len(resourceLabels)+2)
+			for k, v := range resourceLabels {
+				scopeLabels[k] = v
+			}
+			if scope := scopeMetrics.Scope; scope != nil {
+				if scope.Name != "" {
+					scopeLabels["otel_scope_name"] = scope.Name
+				}
+				if scope.Version != "" {
+					scopeLabels["otel_scope_version"] = scope.Version
+				}
+				for _, kv := range scope.Attributes {
+					scopeLabels["otel_scope_"+SanitizeKey(kv.Key)] = SanitizeValue(kv.Value)
+				}
+			}
+			for _, metric := range scopeMetrics.Metrics {
+				err := d.decodeMetric(metric, scopeLabels)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (d *otlpMetricsDec) SetOnEntries(h onEntriesHandler) {
+	d.onEntries = h
+}
+
+func (d *otlpMetricsDec) SetOnExemplars(h onExemplarsHandler) {
+	d.onExemplars = h
+}
+
+func (d *otlpMetricsDec) decodeMetric(metric *metricsv1.Metric, commonLabels map[string]string) error {
+	switch data := metric.Data.(type) {
+	case *metricsv1.Metric_Gauge:
+		name := otlpPromMetricName(metric.Name, metric.Unit, "gauge")
+		meta := otlpMetaLabels("gauge", metric)
+		for _, dp := range data.Gauge.DataPoints {
+			if otlpNoRecordedValue(dp.Flags) {
+				continue
+			}
+			labels := otlpPointLabels(commonLabels, dp.Attributes, name, meta)
+			err := d.push(labels, dp.TimeUnixNano, otlpNumberValue(dp))
+			if err != nil {
+				return err
+			}
+			err = d.pushExemplars(labels, dp.Exemplars)
+			if err != nil {
+				return err
+			}
+		}
+	case *metricsv1.Metric_Sum:
+		tp := "gauge"
+		if data.Sum.IsMonotonic {
+			tp = "counter"
+		}
+		name := otlpPromMetricName(metric.Name, metric.Unit, tp)
+		meta := otlpMetaLabels(tp, metric)
+		delta := data.Sum.AggregationTemporality == metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.Sum.DataPoints {
+			if otlpNoRecordedValue(dp.Flags) {
+				continue
+			}
+			labels := otlpPointLabels(commonLabels, dp.Attributes, name, meta)
+			val := otlpNumberValue(dp)
+			// Only monotonic deltas can be turned into a Prometheus counter; a non-monotonic
+			// delta sum is the change over the interval and is stored as a gauge as-is.
+			if delta && data.Sum.IsMonotonic {
+				val = d.deltas.add(d.tenant, labels, val)
+			}
+			err := d.push(labels, dp.TimeUnixNano, val)
+			if err != nil {
+				return err
+			}
+			err = d.pushExemplars(labels, dp.Exemplars)
+			if err != nil {
+				return err
+			}
+		}
+	case *metricsv1.Metric_Histogram:
+		name := otlpPromMetricName(metric.Name, metric.Unit, "histogram")
+		meta := otlpMetaLabels("histogram", metric)
+		delta := data.Histogram.AggregationTemporality == metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.Histogram.DataPoints {
+			if otlpNoRecordedValue(dp.Flags) {
+				continue
+			}
+			bounds := make([]float64, 0, len(dp.BucketCounts))
+			counts := make([]uint64, 0, len(dp.BucketCounts))
+			for i, cnt := range dp.BucketCounts {
+				if i >= len(dp.ExplicitBounds) {
+					break
+				}
+				bounds = append(bounds, dp.ExplicitBounds[i])
+				counts = append(counts, cnt)
+			}
+			err := d.pushHistogram(commonLabels, dp.Attributes, name, meta, dp.TimeUnixNano,
+				bounds, counts, dp.Count, dp.Sum, delta, dp.Exemplars)
+			if err != nil {
+				return err
+			}
+		}
+	case *metricsv1.Metric_ExponentialHistogram:
+		name := otlpPromMetricName(metric.Name, metric.Unit, "histogram")
+		meta := otlpMetaLabels("histogram", metric)
+		delta := data.ExponentialHistogram.AggregationTemporality ==
+			metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.ExponentialHistogram.DataPoints {
+			if otlpNoRecordedValue(dp.Flags) {
+				continue
+			}
+			bounds, counts := otlpExpHistogramBuckets(dp)
+			err := d.pushHistogram(commonLabels, dp.Attributes, name, meta, dp.TimeUnixNano,
+				bounds, counts, dp.Count, dp.Sum, delta, dp.Exemplars)
+			if err != nil {
+				return err
+			}
+		}
+	case *metricsv1.Metric_Summary:
+		name := otlpPromMetricName(metric.Name, metric.Unit, "summary")
+		meta := otlpMetaLabels("summary", metric)
+		for _, dp := range data.Summary.DataPoints {
+			if otlpNoRecordedValue(dp.Flags) {
+				continue
+			}
+			for _, q := range dp.QuantileValues {
+				labels := otlpPointLabels(commonLabels, dp.Attributes, name, meta,
+					[]string{"quantile", strconv.FormatFloat(q.Quantile, 'f', -1, 64)})
+				err := d.push(labels, dp.TimeUnixNano, q.Value)
+				if err != nil {
+					return err
+				}
+			}
+			err := d.push(otlpPointLabels(commonLabels, dp.Attributes, name+"_sum", meta), dp.TimeUnixNano, dp.Sum)
+			if err != nil {
+				return err
+			}
+			err = d.push(otlpPointLabels(commonLabels, dp.Attributes, name+"_count", meta),
+				dp.TimeUnixNano, float64(dp.Count))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pushHistogram writes a histogram data point as the classic Prometheus series set:
+// cumulative `_bucket{le=...}` series, `_sum` (when present) and `_count`.
+// Every exemplar is attached to the first bucket whose upper bound covers its value.
+func (d *otlpMetricsDec) pushHistogram(commonLabels map[string]string, attrs []*otlpcommon.KeyValue,
+	name string, meta [][]string, timeNs uint64, bounds []float64, counts []uint64, count uint64,
+	sum *float64, delta bool, exemplars []*metricsv1.Exemplar) error {
+	value := func(labels [][]string, v float64) float64 {
+		if delta {
+			return d.deltas.add(d.tenant, labels, v)
+		}
+		return v
+	}
+	bucketExemplars := make([][]*metricsv1.Exemplar, len(bounds)+1)
+	for _, e := range exemplars {
+		i := sort.SearchFloat64s(bounds, otlpExemplarValue(e))
+		bucketExemplars[i] = append(bucketExemplars[i], e)
+	}
+	cumulative := uint64(0)
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		labels := otlpPointLabels(commonLabels, attrs, name+"_bucket", meta,
+			[]string{"le", strconv.FormatFloat(bound, 'f', -1, 64)})
+		err := d.push(labels, timeNs, value(labels, float64(cumulative)))
+		if err != nil {
+			return err
+		}
+		err = d.pushExemplars(labels, bucketExemplars[i])
+		if err != nil {
+			return err
+		}
+	}
+	labels := otlpPointLabels(commonLabels, attrs, name+"_bucket", meta, []string{"le", "+Inf"})
+	err := d.push(labels, timeNs, value(labels, float64(count)))
+	if err != nil {
+		return err
+	}
+	err = d.pushExemplars(labels, bucketExemplars[len(bounds)])
+	if err != nil {
+		return err
+	}
+	if sum != nil {
+		labels = otlpPointLabels(commonLabels, attrs, name+"_sum", meta)
+		err = d.push(labels, timeNs, value(labels, *sum))
+		if err != nil {
+			return err
+		}
+	}
+	labels = otlpPointLabels(commonLabels, attrs, name+"_count", meta)
+	return d.push(labels, timeNs, value(labels, float64(count)))
+}
+
+func (d *otlpMetricsDec) push(labels [][]string, timeNs uint64, value float64) error {
+	if timeNs == 0 {
+		timeNs = uint64(time.Now().UnixNano())
+	}
+	return d.onEntries(labels, []int64{int64(timeNs)}, []string{""}, []float64{value},
+		[]uint8{model.SAMPLE_TYPE_METRIC})
+}
+
+func (d *otlpMetricsDec) pushExemplars(labels [][]string, exemplars []*metricsv1.Exemplar) error {
+	if len(exemplars) == 0 || d.onExemplars == nil {
+		return nil
+	}
+	var batch exemplarsBatch
+	for _, e := range exemplars {
+		timeNs := e.TimeUnixNano
+		if timeNs == 0 {
+			timeNs = uint64(time.Now().UnixNano())
+		}
+		batch.add(int64(timeNs), otlpExemplarValue(e), otlpExemplarLabels(e))
+	}
+	return batch.flush(labels, d.onExemplars)
+}
+
+func otlpExemplarValue(e *metricsv1.Exemplar) float64 {
+	switch v := e.Value.(type) {
+	case *metricsv1.Exemplar_AsDouble:
+		return v.AsDouble
+	case *metricsv1.Exemplar_AsInt:
+		return float64(v.AsInt)
+	}
+	return 0
+}
+
+// otlpExemplarLabels returns the filtered attributes of an exemplar together
+// with its hex-encoded trace_id and span_id.
+func otlpExemplarLabels(e *metricsv1.Exemplar) [][]string {
+	res := make([][]string, 0, len(e.FilteredAttributes)+2)
+	if len(e.TraceId) > 0 {
+		res = append(res, []string{"trace_id", hex.EncodeToString(e.TraceId)})
+	}
+	if len(e.SpanId) > 0 {
+		res = append(res, []string{"span_id", hex.EncodeToString(e.SpanId)})
+	}
+	for _, kv := range e.FilteredAttributes {
+		res = append(res, []string{SanitizeKey(kv.Key), SanitizeValue(kv.Value)})
+	}
+	return res
+}
+
+func otlpNoRecordedValue(flags uint32) bool {
+	return flags&uint32(metricsv1.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func otlpNumberValue(dp *metricsv1.NumberDataPoint) float64 {
+	switch v := dp.Value.(type) {
+	case *metricsv1.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	case *metricsv1.NumberDataPoint_AsInt:
+		return float64(v.AsInt)
+	}
+	return 0
+}
+
+// otlpExpHistogramBuckets converts exponential buckets into ascending explicit upper bounds
+// with per-bucket counts, the same shape as a classic OTLP histogram.
+func otlpExpHistogramBuckets(dp *metricsv1.ExponentialHistogramDataPoint) ([]float64, []uint64) {
+	var bounds []float64
+	var counts []uint64
+	base := math.Exp2(math.Exp2(-float64(dp.Scale)))
+	if neg := dp.Negative; neg != nil {
+		for i := len(neg.BucketCounts) - 1; i >= 0; i-- {
+			bounds = append(bounds, -math.Pow(base, float64(neg.Offset)+float64(i)))
+			counts = append(counts, neg.BucketCounts[i])
+		}
+	}
+	if dp.ZeroCount > 0 || dp.ZeroThreshold > 0 {
+		bounds = append(bounds, dp.ZeroThreshold)
+		counts = append(counts, dp.ZeroCount)
+	}
+	if pos := dp.Positive; pos != nil {
+		for i, cnt := range pos.BucketCounts {
+			bounds = append(bounds, math.Pow(base, float64(pos.Offset)+float64(i)+1))
+			counts = append(counts, cnt)
+		}
+	}
+	return bounds, counts
+}
+
+// otlpPromoteResourceAttrs copies resource attributes into labels and derives the
+// Prometheus `job` and `instance` labels from the service.* semantic conventions.
+func otlpPromoteResourceAttrs(attrs []*otlpcommon.KeyValue, res map[string]string) {
+	serviceName, serviceNamespace := "", ""
+	for _, kv := range attrs {
+		val := SanitizeValue(kv.Value)
+		switch kv.Key {
+		case "service.name":
+			serviceName = val
+		case "service.namespace":
+			serviceNamespace = val
+		case "service.instance.id":
+			res["instance"] = val
+		}
+		res[SanitizeKey(kv.Key)] = val
+	}
+	if serviceName != "" {
+		res["job"] = serviceName
+		if serviceNamespace != "" {
+			res["job"] = serviceNamespace + "/" + serviceName
+		}
+	}
+}
+
+func otlpMetaLabels(tp string, metric *metricsv1.Metric) [][]string {
+	res := [][]string{{"__metric_type__", tp}}
+	if metric.Description != "" {
+		res = append(res, []string{"__metric_help__", metric.Description})
+	}
+	if metric.Unit != "" {
+		res = append(res, []string{"__metric_unit__", metric.Unit})
+	}
+	return res
+}
+
+func otlpPointLabels(commonLabels map[string]string, attrs []*otlpcommon.KeyValue, name string,
+	meta [][]string, extra ...[]string) [][]string {
+	lbls := make(map[string]string, len(commonLabels)+len(attrs)+len(extra)+1)
+	for k, v := range commonLabels {
+		lbls[k] = v
+	}
+	for _, kv := range attrs {
+		lbls[SanitizeKey(kv.Key)] = SanitizeValue(kv.Value)
+	}
+	for _, e := range extra {
+		lbls[e[0]] = e[1]
+	}
+	lbls["__name__"] = name
+	res := make([][]string, 0, len(lbls)+len(meta))
+	for k, v := range lbls {
+		res = append(res, []string{k, v})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i][0] < res[j][0] })
+	res = sanitizeLabels(res)
+	return append(res, meta...)
+}
+
+var otlpUnitNames = map[string]string{
+	"d":    "days",
+	"h":    "hours",
+	"min":  "minutes",
+	"s":    "seconds",
+	"ms":   "milliseconds",
+	"us":   "microseconds",
+	"ns":   "nanoseconds",
+	"By":   "bytes",
+	"KiBy": "kibibytes",
+	"MiBy": "mebibytes",
+	"GiBy": "gibibytes",
+	"TiBy": "tibibytes",
+	"KBy":  "kilobytes",
+	"MBy":  "megabytes",
+	"GBy":  "gigabytes",
+	"TBy":  "terabytes",
+	"m":    "meters",
+	"V":    "volts",
+	"A":    "amperes",
+	"J":    "joules",
+	"W":    "watts",
+	"g":    "grams",
+	"Cel":  "celsius",
+	"Hz":   "hertz",
+	"%":    "percent",
+}
+
+var otlpPerUnitNames = map[string]string{
+	"s":  "second",
+	"m":  "minute",
+	"h":  "hour",
+	"d":  "day",
+	"w":  "week",
+	"mo": "month",
+	"y":  "year",
+}
+
+// otlpPromMetricName builds a Prometheus-compatible metric name from an OTLP metric
+// name and unit: the unit becomes a suffix and monotonic counters end with `_total`.
+func otlpPromMetricName(name string, unit string, tp string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ':')
+	})
+	if tp == "counter" && len(parts) > 0 && parts[len(parts)-1] == "total" {
+		parts = parts[:len(parts)-1]
+	}
+	for _, suffix := range otlpUnitSuffixes(unit, tp) {
+		if len(parts) == 0 || parts[len(parts)-1] != suffix {
+			parts = append(parts, suffix)
+		}
+	}
+	if tp == "counter" {
+		parts = append(parts, "total")
+	}
+	res := strings.Join(parts, "_")
+	if res == "" {
+		return "_"
+	}
+	if res[0] >= '0' && res[0] <= '9' {
+		res = "_" + res
+	}
+	return res
+}
+
+func otlpUnitSuffixes(unit string, tp string) []string {
+	if unit == "1" && tp == "gauge" {
+		return []string{"ratio"}
+	}
+	// Annotations in curly braces (e.g. `{requests}`) carry no unit information.
+	if idx := strings.IndexByte(unit, '{'); idx >= 0 {
+		unit = unit[:idx]
+	}
+	unit = strings.TrimSpace(unit)
+	if unit == "" || unit == "1" {
+		return nil
+	}
+	var res []string
+	main, per, hasPer := strings.Cut(unit, "/")
+	if main != "" {
+		if name, ok := otlpUnitNames[main]; ok {
+			main = name
+		}
+		res = append(res, otlpCleanUnit(main))
+	}
+	if hasPer && per != "" {
+		if name, ok := otlpPerUnitNames[per]; ok {
+			per = name
+		}
+		res = append(res, "per", otlpCleanUnit(per))
+	}
+	return res
+}
+
+func otlpCleanUnit(unit string) string {
+	return strings.Trim(sanitizeRe.ReplaceAllString(unit, "_"), "_")
+}
+
+func decodeOTLPMetricsJSON(buf []byte) (any, error) {
+	md, err := (&pmetric.JSONUnmarshaler{}).UnmarshalMetrics(buf)
+	if err != nil {
+		return nil, errors.NewUnmarshalError(err)
+	}
+	bProto, err := (&pmetric.ProtoMarshaler{}).MarshalMetrics(md)
+	if err != nil {
+		return nil, err
+	}
+	res := &metricsv1.MetricsData{}
+	err = proto.Unmarshal(bProto, res)
+	return res, err
+}
+
+var UnmarshalOTLPMetricsV2 = Build(
+	withBufferedBody,
+	withParsedBody(func() proto.Message { return &metricsv1.MetricsData{} }),
+	withLogsParser(func(ctx *ParserCtx) iLogsParser {
+		return &otlpMetricsDec{ctx: ctx}
+	}))
+
+var UnmarshalOTLPMetricsJSONV2 = Build(
+	withBufferedBody,
+	withDecodedBody(decodeOTLPMetricsJSON),
+	withLogsParser(func(ctx *ParserCtx) iLogsParser {
+		return &otlpMetricsDec{ctx: ctx}
+	}))
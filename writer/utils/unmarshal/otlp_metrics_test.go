@@ -0,0 +1,346 @@
+package unmarshal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/metrico/qryn/v5/writer/utils"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+type otlpMetricSample struct {
+	labels map[string]string
+	value  float64
+}
+
+func decodeOTLPMetrics(t *testing.T, metrics ...*metricsv1.Metric) []otlpMetricSample {
+	t.Helper()
+	return decodeOTLPMetricsCtx(t, context.Background(), newDeltaAccumulator(), metrics...)
+}
+
+func decodeOTLPMetricsCtx(t *testing.T, ctx context.Context, deltas *deltaAccumulator,
+	metrics ...*metricsv1.Metric) []otlpMetricSample {
+	t.Helper()
+	data := &metricsv1.MetricsData{
+		ResourceMetrics: []*metricsv1.ResourceMetrics{
+			{
+				Resource: &resourcev1.Resource{Attributes: []*commonv1.KeyValue{
+					otlpStringAttr("service.name", "checkout"),
+					otlpStringAttr("service.instance.id", "pod-1"),
+				}},
+				ScopeMetrics: []*metricsv1.ScopeMetrics{
+					{
+						Scope:   &commonv1.InstrumentationScope{Name: "otel-go", Version: "1.0"},
+						Metrics: metrics,
+					},
+				},
+			},
+		},
+	}
+	var res []otlpMetricSample
+	dec := &otlpMetricsDec{
+		ctx:    &ParserCtx{bodyObject: data, ctx: ctx},
+		deltas: deltas,
+	}
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, msg []string, value []float64, types []uint8) error {
+		lbls := map[string]string{}
+		for _, l := range labels {
+			lbls[l[0]] = l[1]
+		}
+		for _, v := range value {
+			res = append(res, otlpMetricSample{labels: lbls, value: v})
+		}
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func findOTLPSample(samples []otlpMetricSample, name string, extra ...string) []float64 {
+	var res []float64
+	for _, s := range samples {
+		if s.labels["__name__"] != name {
+			continue
+		}
+		match := true
+		for i := 0; i+1 < len(extra); i += 2 {
+			if s.labels[extra[i]] != extra[i+1] {
+				match = false
+			}
+		}
+		if match {
+			res = append(res, s.value)
+		}
+	}
+	return res
+}
+
+func TestOTLPPromMetricName(t *testing.T) {
+	cases := []struct {
+		name, unit, tp, want string
+	}{
+		{"http.server.duration", "s", "histogram", "http_server_duration_seconds"},
+		{"http.server.requests", "{requests}", "counter", "http_server_requests_total"},
+		{"process.memory", "By", "gauge", "process_memory_bytes"},
+		{"cpu.utilization", "1", "gauge", "cpu_utilization_ratio"},
+		{"network.io", "By/s", "gauge", "network_io_bytes_per_second"},
+		{"jobs_total", "", "counter", "jobs_total"},
+		{"latency_seconds", "s", "gauge", "latency_seconds"},
+	}
+	for _, c := range cases {
+		if got := otlpPromMetricName(c.name, c.unit, c.tp); got != c.want {
+			t.Errorf("otlpPromMetricName(%q, %q, %q) = %q, want %q", c.name, c.unit, c.tp, got, c.want)
+		}
+	}
+}
+
+func TestOTLPMetricsGaugeLabels(t *testing.T) {
+	samples := decodeOTLPMetrics(t, &metricsv1.Metric{
+		Name: "queue.size",
+		Data: &metricsv1.Metric_Gauge{Gauge: &metricsv1.Gauge{DataPoints: []*metricsv1.NumberDataPoint{
+			{
+				TimeUnixNano: 1700000000000000000,
+				Attributes:   []*commonv1.KeyValue{otlpStringAttr("queue.name", "orders")},
+				Value:        &metricsv1.NumberDataPoint_AsInt{AsInt: 5},
+			},
+		}}},
+	})
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(samples))
+	}
+	lbls := samples[0].labels
+	expected := map[string]string{
+		"__name__":           "queue_size",
+		"job":                "checkout",
+		"instance":           "pod-1",
+		"queue_name":         "orders",
+		"otel_scope_name":    "otel-go",
+		"otel_scope_version": "1.0",
+		"__metric_type__":    "gauge",
+	}
+	for k, v := range expected {
+		if lbls[k] != v {
+			t.Errorf("label %s = %q, want %q", k, lbls[k], v)
+		}
+	}
+	if samples[0].value != 5 {
+		t.Errorf("value = %v, want 5", samples[0].value)
+	}
+}
+
+func TestOTLPMetricsDeltaSumAccumulates(t *testing.T) {
+	point := func(v float64) *metricsv1.NumberDataPoint {
+		return &metricsv1.NumberDataPoint{
+			TimeUnixNano: 1700000000000000000,
+			Value:        &metricsv1.NumberDataPoint_AsDouble{AsDouble: v},
+		}
+	}
+	samples := decodeOTLPMetrics(t, &metricsv1.Metric{
+		Name: "requests",
+		Data: &metricsv1.Metric_Sum{Sum: &metricsv1.Sum{
+			IsMonotonic:            true,
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints:             []*metricsv1.NumberDataPoint{point(2), point(3)},
+		}},
+	}, &metricsv1.Metric{
+		Name: "inflight",
+		Data: &metricsv1.Metric_Sum{Sum: &metricsv1.Sum{
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			DataPoints:             []*metricsv1.NumberDataPoint{point(2), point(-1)},
+		}},
+	})
+	got := findOTLPSample(samples, "requests_total")
+	if len(got) != 2 || got[0] != 2 || got[1] != 5 {
+		t.Errorf("requests_total = %v, want [2 5]", got)
+	}
+	got = findOTLPSample(samples, "inflight")
+	if len(got) != 2 || got[0] != 2 || got[1] != -1 {
+		t.Errorf("inflight = %v, want [2 -1]", got)
+	}
+}
+
+func TestOTLPMetricsDeltaSumPerTenant(t *testing.T) {
+	metric := func(v float64) *metricsv1.Metric {
+		return &metricsv1.Metric{
+			Name: "requests",
+			Data: &metricsv1.Metric_Sum{Sum: &metricsv1.Sum{
+				IsMonotonic:            true,
+				AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints: []*metricsv1.NumberDataPoint{{
+					TimeUnixNano: 1700000000000000000,
+					Value:        &metricsv1.NumberDataPoint_AsDouble{AsDouble: v},
+				}},
+			}},
+		}
+	}
+	deltas := newDeltaAccumulator()
+	tenant := func(dsn string) context.Context {
+		return context.WithValue(context.Background(), utils.ContextKeyDSN, dsn)
+	}
+	for _, c := range []struct {
+		dsn   string
+		delta float64
+		want  float64
+	}{
+		{"tcp://tenant-a", 2, 2},
+		{"tcp://tenant-b", 10, 10},
+		{"tcp://tenant-a", 3, 5},
+		{"tcp://tenant-b", 1, 11},
+	} {
+		samples := decodeOTLPMetricsCtx(t, tenant(c.dsn), deltas, metric(c.delta))
+		if got := findOTLPSample(samples, "requests_total"); len(got) != 1 || got[0] != c.want {
+			t.Errorf("%s: requests_total = %v, want [%v]", c.dsn, got, c.want)
+		}
+	}
+}
+
+func TestOTLPMetricsHistogram(t *testing.T) {
+	sum := 12.5
+	samples := decodeOTLPMetrics(t, &metricsv1.Metric{
+		Name: "rpc.duration",
+		Unit: "ms",
+		Data: &metricsv1.Metric_Histogram{Histogram: &metricsv1.Histogram{
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricsv1.HistogramDataPoint{
+				{
+					TimeUnixNano:   1700000000000000000,
+					Count:          6,
+					Sum:            &sum,
+					ExplicitBounds: []float64{1, 5},
+					BucketCounts:   []uint64{1, 2, 3},
+				},
+			},
+		}},
+	})
+	for le, want := range map[string]float64{"1": 1, "5": 3, "+Inf": 6} {
+		got := findOTLPSample(samples, "rpc_duration_milliseconds_bucket", "le", le)
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("bucket le=%s = %v, want %v", le, got, want)
+		}
+	}
+	if got := findOTLPSample(samples, "rpc_duration_milliseconds_sum"); len(got) != 1 || got[0] != 12.5 {
+		t.Errorf("sum = %v, want 12.5", got)
+	}
+	if got := findOTLPSample(samples, "rpc_duration_milliseconds_count"); len(got) != 1 || got[0] != 6 {
+		t.Errorf("count = %v, want 6", got)
+	}
+}
+
+func TestOTLPMetricsHistogramExemplars(t *testing.T) {
+	dec := &otlpMetricsDec{
+		ctx: &ParserCtx{bodyObject: &metricsv1.MetricsData{ResourceMetrics: []*metricsv1.ResourceMetrics{{
+			ScopeMetrics: []*metricsv1.ScopeMetrics{{Metrics: []*metricsv1.Metric{{
+				Name: "latency",
+				Data: &metricsv1.Metric_Histogram{Histogram: &metricsv1.Histogram{
+					AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints: []*metricsv1.HistogramDataPoint{{
+						TimeUnixNano:   1700000000000000000,
+						Count:          3,
+						ExplicitBounds: []float64{1, 5},
+						BucketCounts:   []uint64{1, 1, 1},
+						Exemplars: []*metricsv1.Exemplar{
+							{TimeUnixNano: 1700000000000000001, Value: &metricsv1.Exemplar_AsDouble{AsDouble: 3},
+								TraceId: []byte{0xab, 0xcd}, SpanId: []byte{0x01}},
+							{TimeUnixNano: 1700000000000000002, Value: &metricsv1.Exemplar_AsDouble{AsDouble: 9}},
+						},
+					}},
+				}},
+			}}}},
+		}}}, ctx: context.Background()},
+		deltas: newDeltaAccumulator(),
+	}
+	dec.SetOnEntries(func([][]string, []int64, []string, []float64, []uint8) error { return nil })
+	got := map[string]string{}
+	dec.SetOnExemplars(func(labels [][]string, timestampsNS []int64, value []float64,
+		traceIDs []string, exemplarLabels []string) error {
+		for _, l := range labels {
+			if l[0] == "le" {
+				got[l[1]] = traceIDs[0] + " " + exemplarLabels[0]
+			}
+		}
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"5":    `abcd {"trace_id":"abcd","span_id":"01"}`,
+		"+Inf": ` {}`,
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("exemplars = %v, want %v", got, expected)
+	}
+	for le, want := range expected {
+		if got[le] != want {
+			t.Errorf("exemplar le=%s = %q, want %q", le, got[le], want)
+		}
+	}
+}
+
+func TestOTLPMetricsExponentialHistogram(t *testing.T) {
+	samples := decodeOTLPMetrics(t, &metricsv1.Metric{
+		Name: "payload",
+		Data: &metricsv1.Metric_ExponentialHistogram{ExponentialHistogram: &metricsv1.ExponentialHistogram{
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricsv1.ExponentialHistogramDataPoint{
+				{
+					TimeUnixNano: 1700000000000000000,
+					Count:        4,
+					Scale:        0,
+					ZeroCount:    1,
+					Positive:     &metricsv1.ExponentialHistogramDataPoint_Buckets{Offset: 0, BucketCounts: []uint64{1, 2}},
+				},
+			},
+		}},
+	})
+	for le, want := range map[string]float64{"0": 1, "2": 2, "4": 4, "+Inf": 4} {
+		got := findOTLPSample(samples, "payload_bucket", "le", le)
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("bucket le=%s = %v, want %v", le, got, want)
+		}
+	}
+}
+
+func TestOTLPMetricsSummary(t *testing.T) {
+	samples := decodeOTLPMetrics(t, &metricsv1.Metric{
+		Name: "gc.pause",
+		Data: &metricsv1.Metric_Summary{Summary: &metricsv1.Summary{DataPoints: []*metricsv1.SummaryDataPoint{
+			{
+				TimeUnixNano: 1700000000000000000,
+				Count:        10,
+				Sum:          20,
+				QuantileValues: []*metricsv1.SummaryDataPoint_ValueAtQuantile{
+					{Quantile: 0.5, Value: 1.5},
+					{Quantile: 0.99, Value: 4},
+				},
+			},
+		}}},
+	})
+	if got := findOTLPSample(samples, "gc_pause", "quantile", "0.99"); len(got) != 1 || got[0] != 4 {
+		t.Errorf("quantile 0.99 = %v, want 4", got)
+	}
+	if got := findOTLPSample(samples, "gc_pause_count"); len(got) != 1 || got[0] != 10 {
+		t.Errorf("count = %v, want 10", got)
+	}
+}
+
+func TestOTLPMetricsJSON(t *testing.T) {
+	body := []byte(`{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},
+"scopeMetrics":[{"metrics":[{"name":"up","gauge":{"dataPoints":[{"timeUnixNano":"1700000000000000000","asInt":"1"}]}}]}]}]}`)
+	obj, err := decodeOTLPMetricsJSON(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := obj.(*metricsv1.MetricsData)
+	metric := data.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if metric.Name != "up" {
+		t.Fatalf("metric name = %q, want %q", metric.Name, "up")
+	}
+	if v := metric.GetGauge().DataPoints[0].GetAsInt(); v != 1 {
+		t.Errorf("value = %d, want 1", v)
+	}
+}
@@ -9,6 +9,8 @@ import (
 type timeSeriesAndSamples struct {
 	ts   *model.TimeSeriesData
 	spl  *model.TimeSamplesData
+	hist *model.HistogramsData
+	exm  *model.ExemplarsData
 	size int
 	c    chan *model.ParserResponse
 	meta string
@@ -30,13 +32,22 @@ func (t *timeSeriesAndSamples) reset() {
 		MMessage:     make([]string, 0, 1000),
 		MValue:       make([]float64, 0, 1000),
 	}
+	t.hist = &model.HistogramsData{}
+	t.exm = &model.ExemplarsData{}
 }
 
 func (t *timeSeriesAndSamples) flush() {
-	t.c <- &model.ParserResponse{
+	res := &model.ParserResponse{
 		TimeSeriesRequest: t.ts,
 		SamplesRequest:    t.spl,
 	}
+	if len(t.hist.MFingerprint) > 0 {
+		res.HistogramsRequest = t.hist
+	}
+	if len(t.exm.MFingerprint) > 0 {
+		res.ExemplarsRequest = t.exm
+	}
+	t.c <- res
 }
 
 func newTimeSeriesAndSamples(c chan *model.ParserResponse,
@@ -0,0 +1,91 @@
+package unmarshal
+
+import (
+	"github.com/go-faster/jx"
+	"github.com/metrico/qryn/v5/writer/utils/proto/logproto"
+)
+
+// decodeStructuredMetadata reads the structured metadata of a Loki log line.
+// Both the object form {"name":"value"} and the list form
+// [{"name":"name","value":"value"}] are accepted. The result is a JSON object
+// or an empty string if the line carries no metadata.
+func decodeStructuredMetadata(d *jx.Decoder) (string, error) {
+	var lbls [][]string
+	var err error
+	switch d.Next() {
+	case jx.Object:
+		err = d.Obj(func(d *jx.Decoder, key string) error {
+			val, err := d.Str()
+			if err != nil {
+				return err
+			}
+			lbls = append(lbls, []string{key, val})
+			return nil
+		})
+	case jx.Array:
+		err = d.Arr(func(d *jx.Decoder) error {
+			var name, val string
+			err := d.Obj(func(d *jx.Decoder, key string) error {
+				var err error
+				switch key {
+				case "name":
+					name, err = d.Str()
+				case "value":
+					val, err = d.Str()
+				default:
+					err = d.Skip()
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			lbls = append(lbls, []string{name, val})
+			return nil
+		})
+	default:
+		err = d.Skip()
+	}
+	if err != nil {
+		return "", err
+	}
+	return encodeStructuredMetadata(lbls), nil
+}
+
+// structuredMetadataFromProto converts the structured metadata of a protobuf
+// log entry to a JSON object.
+func structuredMetadataFromProto(pairs []*logproto.LabelPairAdapter) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	lbls := make([][]string, 0, len(pairs))
+	for _, p := range pairs {
+		lbls = append(lbls, []string{p.GetName(), p.GetValue()})
+	}
+	return encodeStructuredMetadata(lbls)
+}
+
+func encodeStructuredMetadata(lbls [][]string) string {
+	res := lbls[:0]
+	for _, l := range lbls {
+		if l[0] == "" || l[1] == "" {
+			continue
+		}
+		l[0] = sanitizeRe.ReplaceAllString(l[0], "_")
+		res = append(res, l)
+	}
+	if len(res) == 0 {
+		return ""
+	}
+	return encodeLabels(res)
+}
+
+// hasStructuredMetadata reports if any of the lines carries structured metadata.
+func hasStructuredMetadata(structuredMetadata []string) bool {
+	for _, m := range structuredMetadata {
+		if m != "" {
+			return true
+		}
+	}
+	return false
+}
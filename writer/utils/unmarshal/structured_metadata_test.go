@@ -0,0 +1,134 @@
+package unmarshal
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	clconfig "github.com/metrico/cloki-config"
+	"github.com/metrico/qryn/v5/writer/config"
+	"github.com/metrico/qryn/v5/writer/model"
+	"github.com/metrico/qryn/v5/writer/utils/numbercache"
+	"github.com/metrico/qryn/v5/writer/utils/proto/logproto"
+)
+
+func TestPushRequestDecodeStructuredMetadata(t *testing.T) {
+	body := `{"streams":[{"stream":{"app":"api"},"values":[` +
+		`["1000","GET /",{"trace_id":"4bf92f35","user.id":"42"}],` +
+		`["2000","GET /health"]]},` +
+		`{"stream":{"app":"web"},"entries":[` +
+		`{"ts":"3000","line":"POST /","structuredMetadata":[{"name":"trace_id","value":"00f067aa"}]}]}]}`
+	dec := &pushRequestDec{ctx: &ParserCtx{bodyReader: strings.NewReader(body)}}
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		t.Fatal("onEntries must not be called for streams with structured metadata")
+		return nil
+	})
+	var meta []string
+	var streams int
+	dec.SetOnStructuredMetadata(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8, structuredMetadata []string) error {
+		if len(labels) != 1 {
+			t.Errorf("structured metadata leaked into stream labels: %v", labels)
+		}
+		streams++
+		meta = append(meta, structuredMetadata...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`{"trace_id":"4bf92f35","user_id":"42"}`, ``, `{"trace_id":"00f067aa"}`}
+	if streams != 2 || len(meta) != len(expected) {
+		t.Fatalf("unexpected structured metadata: %v", meta)
+	}
+	for i, m := range expected {
+		if meta[i] != m {
+			t.Errorf("structured metadata %d = %s, want %s", i, meta[i], m)
+		}
+	}
+}
+
+func TestLogsProtoDecodeStructuredMetadata(t *testing.T) {
+	req := &logproto.PushRequest{
+		Streams: []*logproto.StreamAdapter{
+			{
+				Labels: `{app="api"}`,
+				Entries: []*logproto.EntryAdapter{
+					{
+						Timestamp:          &logproto.Timestamp{Seconds: 1},
+						Line:               "GET /",
+						StructuredMetadata: []*logproto.LabelPairAdapter{{Name: "trace_id", Value: "4bf92f35"}},
+					},
+				},
+			},
+			{
+				Labels:  `{app="web"}`,
+				Entries: []*logproto.EntryAdapter{{Timestamp: &logproto.Timestamp{Seconds: 2}, Line: "POST /"}},
+			},
+		},
+	}
+	dec := &logsProtoDec{ctx: &ParserCtx{bodyObject: req}}
+	var plain []string
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		plain = append(plain, message...)
+		return nil
+	})
+	var meta []string
+	dec.SetOnStructuredMetadata(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8, structuredMetadata []string) error {
+		meta = append(meta, structuredMetadata...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta) != 1 || meta[0] != `{"trace_id":"4bf92f35"}` {
+		t.Errorf("structured metadata = %v", meta)
+	}
+	if len(plain) != 1 || plain[0] != "POST /" {
+		t.Errorf("lines without metadata = %v", plain)
+	}
+}
+
+func TestPushRequestStoresStructuredMetadata(t *testing.T) {
+	body := `{"streams":[{"stream":{"app":"api"},"values":[` +
+		`["1000","GET /",{"trace_id":"4bf92f35"}],` +
+		`["2000","GET /health"],` +
+		`["3000","POST /",0.5,{"trace_id":"00f067aa"}]]}]}`
+	if config.Cloki == nil {
+		config.Cloki = clconfig.New(clconfig.CLOKI_WRITER, nil, "", "")
+	}
+	fpCache := numbercache.NewCache(time.Minute, func(val uint64) []byte {
+		return unsafe.Slice((*byte)(unsafe.Pointer(&val)), 8)
+	}, nil)
+	defer fpCache.Stop()
+	var spl *model.TimeSamplesData
+	for res := range DecodePushRequestStringV2(context.Background(), strings.NewReader(body), fpCache) {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		if s := res.SamplesRequest.(*model.TimeSamplesData); len(s.MTimestampNS) > 0 {
+			spl = s
+		}
+	}
+	if spl == nil {
+		t.Fatal("no samples stored")
+	}
+	expectedMeta := []string{`{"trace_id":"4bf92f35"}`, ``, `{"trace_id":"00f067aa"}`}
+	if !reflect.DeepEqual(spl.MStructuredMetadata, expectedMeta) {
+		t.Errorf("structured metadata = %q, want %q", spl.MStructuredMetadata, expectedMeta)
+	}
+	if !reflect.DeepEqual(spl.MMessage, []string{"GET /", "GET /health", "POST /"}) {
+		t.Errorf("messages = %q", spl.MMessage)
+	}
+	if !reflect.DeepEqual(spl.MValue, []float64{0, 0, 0.5}) {
+		t.Errorf("values = %v", spl.MValue)
+	}
+	if !reflect.DeepEqual(spl.MType, []uint8{model.SAMPLE_TYPE_LOG, model.SAMPLE_TYPE_LOG, 0}) {
+		t.Errorf("types = %v", spl.MType)
+	}
+	if fp := spl.MFingerprint; fp[0] != fp[1] || fp[1] != fp[2] {
+		t.Errorf("structured metadata must not split the stream: %v", fp)
+	}
+}
@@ -0,0 +1,314 @@
+package unmarshal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metrico/qryn/v5/writer/model"
+	customErrors "github.com/metrico/qryn/v5/writer/utils/errors"
+)
+
+// SyslogMaxMessageSize is the largest syslog frame accepted.
+const SyslogMaxMessageSize = 64 * 1024
+
+// syslogMaxFrameLengthDigits is the longest MSG-LEN of an accepted frame.
+var syslogMaxFrameLengthDigits = len(strconv.Itoa(SyslogMaxMessageSize))
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{
+	"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug",
+}
+
+// ReadSyslogFrame reads a single syslog message framed with octet counting
+// (RFC 6587 "MSG-LEN SP SYSLOG-MSG") or terminated by a newline. The framing is
+// detected from the first byte of every frame.
+func ReadSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\n' && b[0] != '\r' && b[0] != 0 {
+			break
+		}
+		r.ReadByte()
+	}
+	b, _ := r.Peek(1)
+	if b[0] < '1' || b[0] > '9' {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("syslog message is larger than %d bytes", r.Size())
+		}
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+		return bytes.Clone(bytes.TrimRight(line, "\r\n")), nil
+	}
+	strLen, err := readSyslogFrameLength(r)
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.Atoi(strLen)
+	if err != nil || size > SyslogMaxMessageSize {
+		return nil, fmt.Errorf("invalid syslog frame length %q", strLen)
+	}
+	msg := make([]byte, size)
+	_, err = io.ReadFull(r, msg)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return msg, err
+}
+
+// readSyslogFrameLength reads the MSG-LEN of an octet counted frame and the
+// space following it. The length is read up to the digits of
+// SyslogMaxMessageSize, so the clients not sending the space are not buffered.
+func readSyslogFrameLength(r *bufio.Reader) (string, error) {
+	var strLen []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == ' ' {
+			return string(strLen), nil
+		}
+		if len(strLen) == syslogMaxFrameLengthDigits {
+			return "", fmt.Errorf("invalid syslog frame length %q", append(strLen, c))
+		}
+		strLen = append(strLen, c)
+	}
+}
+
+// AppendSyslogFrame appends msg to buf with octet counting framing.
+func AppendSyslogFrame(buf []byte, msg []byte) []byte {
+	buf = strconv.AppendInt(buf, int64(len(msg)), 10)
+	buf = append(buf, ' ')
+	return append(buf, msg...)
+}
+
+type syslogMessage struct {
+	timestampNS int64
+	labels      [][]string
+	metadata    [][]string
+	message     string
+}
+
+// parseSyslogMessage parses an RFC 5424 or RFC 3164 message. Messages without
+// a valid PRI are stored as is with the user.notice priority.
+func parseSyslogMessage(msg []byte, now time.Time) *syslogMessage {
+	pri, rest, ok := parseSyslogPri(msg)
+	if !ok {
+		pri, rest = 13, msg
+	}
+	var res *syslogMessage
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		res = parseRFC5424(rest[2:], now)
+	} else {
+		res = parseRFC3164(rest, now)
+	}
+	facility := "unknown"
+	if pri/8 < len(syslogFacilities) {
+		facility = syslogFacilities[pri/8]
+	}
+	res.labels = append([][]string{
+		{"facility", facility},
+		{"severity", syslogSeverities[pri%8]},
+	}, res.labels...)
+	return res
+}
+
+func parseSyslogPri(msg []byte) (int, []byte, bool) {
+	if len(msg) < 3 || msg[0] != '<' {
+		return 0, nil, false
+	}
+	end := bytes.IndexByte(msg[:min(len(msg), 5)], '>')
+	if end < 2 {
+		return 0, nil, false
+	}
+	pri, err := strconv.Atoi(string(msg[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, nil, false
+	}
+	return pri, msg[end+1:], true
+}
+
+// nextSyslogField returns the next space separated field. "-" is the RFC 5424
+// NILVALUE and is returned as an empty string.
+func nextSyslogField(msg []byte) (string, []byte) {
+	field, rest, _ := bytes.Cut(msg, []byte{' '})
+	if string(field) == "-" {
+		return "", rest
+	}
+	return string(field), rest
+}
+
+func parseRFC5424(msg []byte, now time.Time) *syslogMessage {
+	res := &syslogMessage{timestampNS: now.UnixNano()}
+	var timestamp, hostname, appName, procID, msgID string
+	timestamp, msg = nextSyslogField(msg)
+	hostname, msg = nextSyslogField(msg)
+	appName, msg = nextSyslogField(msg)
+	procID, msg = nextSyslogField(msg)
+	msgID, msg = nextSyslogField(msg)
+	if ts, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		res.timestampNS = ts.UnixNano()
+	}
+	res.labels = appendSyslogLabel(res.labels, "hostname", hostname)
+	res.labels = appendSyslogLabel(res.labels, "app_name", appName)
+	res.metadata = appendSyslogLabel(res.metadata, "procid", procID)
+	res.metadata = appendSyslogLabel(res.metadata, "msgid", msgID)
+
+	if len(msg) > 0 && msg[0] == '-' {
+		msg = msg[1:]
+	} else {
+		msg = parseStructuredData(msg, res)
+	}
+	msg = bytes.TrimPrefix(bytes.TrimPrefix(msg, []byte{' '}), []byte("\xef\xbb\xbf"))
+	res.message = string(msg)
+	return res
+}
+
+// parseStructuredData adds the params of the SD-ELEMENTs to the metadata as
+// <SD-ID>_<PARAM-NAME> and returns the rest of the message.
+func parseStructuredData(msg []byte, res *syslogMessage) []byte {
+	for len(msg) > 0 && msg[0] == '[' {
+		i := 1
+		for i < len(msg) && msg[i] != ' ' && msg[i] != ']' {
+			i++
+		}
+		sdID := string(msg[1:i])
+		for i < len(msg) && msg[i] == ' ' {
+			eq := bytes.IndexByte(msg[i:], '=')
+			if eq < 0 || i+eq+1 >= len(msg) || msg[i+eq+1] != '"' {
+				return msg[i:]
+			}
+			name := string(msg[i+1 : i+eq])
+			i += eq + 2
+			var val strings.Builder
+			for i < len(msg) && msg[i] != '"' {
+				if msg[i] == '\\' && i+1 < len(msg) && (msg[i+1] == '"' || msg[i+1] == '\\' || msg[i+1] == ']') {
+					i++
+				}
+				val.WriteByte(msg[i])
+				i++
+			}
+			i++
+			res.metadata = appendSyslogLabel(res.metadata, sdID+"_"+name, val.String())
+		}
+		if i >= len(msg) || msg[i] != ']' {
+			return msg[min(i, len(msg)):]
+		}
+		msg = msg[i+1:]
+	}
+	return msg
+}
+
+func parseRFC3164(msg []byte, now time.Time) *syslogMessage {
+	res := &syslogMessage{timestampNS: now.UnixNano()}
+	hasTimestamp := false
+	if len(msg) >= 16 && msg[15] == ' ' {
+		if ts, err := time.ParseInLocation(time.Stamp, string(msg[:15]), now.Location()); err == nil {
+			// RFC 3164 timestamps have no year, messages from the last days of
+			// December may arrive in January.
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			res.timestampNS = ts.UnixNano()
+			msg = msg[16:]
+			hasTimestamp = true
+		}
+	}
+
+	// The HOSTNAME follows the TIMESTAMP but is often omitted: a first field
+	// ending with ':' or holding a PID is the TAG.
+	hostname, rest := nextSyslogField(msg)
+	if hasTimestamp && hostname != "" && !strings.HasSuffix(hostname, ":") && !strings.Contains(hostname, "[") {
+		res.labels = appendSyslogLabel(res.labels, "hostname", hostname)
+		msg = rest
+	}
+
+	end := 0
+	for end < len(msg) && end < 48 && msg[end] != ':' && msg[end] != '[' && msg[end] != ' ' {
+		end++
+	}
+	if end > 0 && end < len(msg) && (msg[end] == ':' || msg[end] == '[') {
+		res.labels = appendSyslogLabel(res.labels, "app_name", string(msg[:end]))
+		msg = msg[end:]
+		if msg[0] == '[' {
+			if pidEnd := bytes.IndexByte(msg, ']'); pidEnd > 0 {
+				res.metadata = appendSyslogLabel(res.metadata, "procid", string(msg[1:pidEnd]))
+				msg = msg[pidEnd+1:]
+			}
+		}
+		msg = bytes.TrimPrefix(msg, []byte{':'})
+		msg = bytes.TrimPrefix(msg, []byte{' '})
+	}
+	res.message = string(msg)
+	return res
+}
+
+func appendSyslogLabel(labels [][]string, name string, value string) [][]string {
+	if value == "" {
+		return labels
+	}
+	return append(labels, []string{name, value})
+}
+
+type syslogDec struct {
+	ctx                  *ParserCtx
+	onEntries            onEntriesHandler
+	onStructuredMetadata onStructuredMetadataHandler
+}
+
+func (s *syslogDec) Decode() error {
+	r := bufio.NewReaderSize(s.ctx.bodyReader, SyslogMaxMessageSize)
+	now := time.Now()
+	for {
+		frame, err := ReadSyslogFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return customErrors.NewUnmarshalError(err)
+		}
+		msg := parseSyslogMessage(frame, now)
+		ts := []int64{msg.timestampNS}
+		line := []string{msg.message}
+		meta := encodeStructuredMetadata(msg.metadata)
+		if meta != "" && s.onStructuredMetadata != nil {
+			err = s.onStructuredMetadata(msg.labels, ts, line, []float64{0}, []uint8{model.SAMPLE_TYPE_LOG}, []string{meta})
+		} else {
+			err = s.onEntries(msg.labels, ts, line, []float64{0}, []uint8{model.SAMPLE_TYPE_LOG})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *syslogDec) SetOnEntries(h onEntriesHandler) {
+	s.onEntries = h
+}
+
+func (s *syslogDec) SetOnStructuredMetadata(h onStructuredMetadataHandler) {
+	s.onStructuredMetadata = h
+}
+
+// UnmarshalSyslogV2 parses a batch of syslog messages framed as read by
+// ReadSyslogFrame.
+var UnmarshalSyslogV2 = Build(
+	withLogsParser(func(ctx *ParserCtx) iLogsParser {
+		return &syslogDec{ctx: ctx}
+	}))
@@ -0,0 +1,141 @@
+package unmarshal
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogRFC5424(t *testing.T) {
+	msg := parseSyslogMessage([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 `+
+		`[exampleSDID@32473 iut="3" eventSource="App\"lication"][origin ip="192.0.2.1"] `+"\xef\xbb\xbf"+`An application event`),
+		time.Now())
+	if msg.timestampNS != time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC).UnixNano() {
+		t.Errorf("timestamp = %d", msg.timestampNS)
+	}
+	expectedLabels := [][]string{
+		{"facility", "local4"}, {"severity", "notice"},
+		{"hostname", "mymachine.example.com"}, {"app_name", "evntslog"},
+	}
+	if !reflect.DeepEqual(msg.labels, expectedLabels) {
+		t.Errorf("labels = %v", msg.labels)
+	}
+	expectedMeta := [][]string{
+		{"procid", "1234"}, {"msgid", "ID47"},
+		{"exampleSDID@32473_iut", "3"}, {"exampleSDID@32473_eventSource", `App"lication`},
+		{"origin_ip", "192.0.2.1"},
+	}
+	if !reflect.DeepEqual(msg.metadata, expectedMeta) {
+		t.Errorf("metadata = %v", msg.metadata)
+	}
+	if msg.message != "An application event" {
+		t.Errorf("message = %q", msg.message)
+	}
+}
+
+func TestParseSyslogRFC5424NilValues(t *testing.T) {
+	msg := parseSyslogMessage([]byte(`<34>1 - - - - - -`), time.Unix(100, 0))
+	if msg.timestampNS != time.Unix(100, 0).UnixNano() || len(msg.metadata) != 0 || msg.message != "" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if !reflect.DeepEqual(msg.labels, [][]string{{"facility", "auth"}, {"severity", "critical"}}) {
+		t.Errorf("labels = %v", msg.labels)
+	}
+}
+
+func TestParseSyslogRFC3164(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	msg := parseSyslogMessage([]byte(`<34>Dec 31 22:14:15 mymachine su[42]: 'su root' failed`), now)
+	if msg.timestampNS != time.Date(2023, 12, 31, 22, 14, 15, 0, time.UTC).UnixNano() {
+		t.Errorf("timestamp = %v", time.Unix(0, msg.timestampNS))
+	}
+	expectedLabels := [][]string{
+		{"facility", "auth"}, {"severity", "critical"}, {"hostname", "mymachine"}, {"app_name", "su"},
+	}
+	if !reflect.DeepEqual(msg.labels, expectedLabels) {
+		t.Errorf("labels = %v", msg.labels)
+	}
+	if !reflect.DeepEqual(msg.metadata, [][]string{{"procid", "42"}}) {
+		t.Errorf("metadata = %v", msg.metadata)
+	}
+	if msg.message != "'su root' failed" {
+		t.Errorf("message = %q", msg.message)
+	}
+
+	msg = parseSyslogMessage([]byte(`<13>Jan  2 00:00:00 kernel: oops`), now)
+	if len(msg.labels) != 3 || msg.labels[2][1] != "kernel" || msg.message != "oops" {
+		t.Errorf("without hostname: %+v", msg)
+	}
+
+	msg = parseSyslogMessage([]byte(`plain text`), now)
+	if msg.labels[0][1] != "user" || msg.labels[1][1] != "notice" || msg.message != "plain text" {
+		t.Errorf("without PRI: %+v", msg)
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	body := AppendSyslogFrame(nil, []byte("<13>1 - - - - - first\nline"))
+	body = append(body, "<13>second\r\n\n<13>third\n"...)
+	body = AppendSyslogFrame(body, []byte("<13>fourth"))
+	r := bufio.NewReader(bytes.NewReader(body))
+	var frames []string
+	for {
+		frame, err := ReadSyslogFrame(r)
+		if err != nil {
+			break
+		}
+		frames = append(frames, string(frame))
+	}
+	expected := []string{"<13>1 - - - - - first\nline", "<13>second", "<13>third", "<13>fourth"}
+	if !reflect.DeepEqual(frames, expected) {
+		t.Errorf("frames = %q", frames)
+	}
+}
+
+// digitsReader sends digits forever, counting them.
+type digitsReader struct{ read int }
+
+func (d *digitsReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = '1'
+	}
+	d.read += len(p)
+	return len(p), nil
+}
+
+func TestReadSyslogFrameLengthLimit(t *testing.T) {
+	d := &digitsReader{}
+	if _, err := ReadSyslogFrame(bufio.NewReader(d)); err == nil {
+		t.Fatal("a frame length without a space must be rejected")
+	}
+	if d.read > 4096 {
+		t.Errorf("read %d bytes of the frame length", d.read)
+	}
+	if _, err := ReadSyslogFrame(bufio.NewReader(bytes.NewReader([]byte("70000 x")))); err == nil {
+		t.Error("a frame larger than SyslogMaxMessageSize must be rejected")
+	}
+}
+
+func TestSyslogDecode(t *testing.T) {
+	var body []byte
+	body = AppendSyslogFrame(body, []byte(`<14>1 2024-01-01T00:00:00Z host app - - - hello`))
+	body = AppendSyslogFrame(body, []byte(`<14>1 2024-01-01T00:00:01Z host app 7 - - world`))
+	dec := &syslogDec{ctx: &ParserCtx{bodyReader: bytes.NewReader(body)}}
+	var lines, withMeta []string
+	dec.SetOnEntries(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8) error {
+		lines = append(lines, message...)
+		return nil
+	})
+	dec.SetOnStructuredMetadata(func(labels [][]string, timestampsNS []int64, message []string, value []float64, types []uint8, metadata []string) error {
+		withMeta = append(withMeta, message...)
+		return nil
+	})
+	if err := dec.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lines, []string{"hello"}) || !reflect.DeepEqual(withMeta, []string{"world"}) {
+		t.Errorf("lines = %v, with metadata = %v", lines, withMeta)
+	}
+}
@@ -22,15 +22,17 @@ import (
 )
 
 type pushRequestDec struct {
-	ctx       *ParserCtx
-	onEntries onEntriesHandler
+	ctx                  *ParserCtx
+	onEntries            onEntriesHandler
+	onStructuredMetadata onStructuredMetadataHandler
 
 	Labels [][]string
 
-	TsNs   []int64
-	String []string
-	Value  []float64
-	Types  []uint8
+	TsNs               []int64
+	String             []string
+	Value              []float64
+	Types              []uint8
+	StructuredMetadata []string
 }
 
 func (p *pushRequestDec) Decode() error {
@@ -39,6 +41,7 @@ func (p *pushRequestDec) Decode() error {
 	p.Value = make([]float64, 0, 1000)
 	p.Labels = make([][]string, 0, 10)
 	p.Types = make([]uint8, 0, 1000)
+	p.StructuredMetadata = make([]string, 0, 1000)
 
 	d := jx.Decode(p.ctx.bodyReader, 64*1024)
 	return jsonParseError(d.Obj(func(d *jx.Decoder, key string) error {
@@ -50,11 +53,15 @@ func (p *pushRequestDec) Decode() error {
 				p.Value = p.Value[:0]
 				p.Labels = p.Labels[:0]
 				p.Types = p.Types[:0]
+				p.StructuredMetadata = p.StructuredMetadata[:0]
 
 				err := p.decodeStream(d)
 				if err != nil {
 					return err
 				}
+				if p.onStructuredMetadata != nil && hasStructuredMetadata(p.StructuredMetadata) {
+					return p.onStructuredMetadata(p.Labels, p.TsNs, p.String, p.Value, p.Types, p.StructuredMetadata)
+				}
 				return p.onEntries(p.Labels, p.TsNs, p.String, p.Value, p.Types)
 			})
 		default:
@@ -68,6 +75,10 @@ func (p *pushRequestDec) SetOnEntries(h onEntriesHandler) {
 	p.onEntries = h
 }
 
+func (p *pushRequestDec) SetOnStructuredMetadata(h onStructuredMetadataHandler) {
+	p.onStructuredMetadata = h
+}
+
 func (p *pushRequestDec) decodeStream(d *jx.Decoder) error {
 	err := d.Obj(func(d *jx.Decoder, key string) error {
 		switch key {
@@ -130,6 +141,7 @@ func (p *pushRequestDec) decodeStreamValue(d *jx.Decoder) error {
 		tsNs int64
 		str  string
 		val  float64
+		meta string
 		err  error
 		tp   uint8
 	)
@@ -148,12 +160,23 @@ func (p *pushRequestDec) decodeStreamValue(d *jx.Decoder) error {
 			tp |= model.SAMPLE_TYPE_LOG
 			return err
 		case 2:
+			if d.Next() == jx.Object {
+				meta, err = decodeStructuredMetadata(d)
+				return err
+			}
 			if d.Next() != jx.Number {
 				return d.Skip()
 			}
 			val, err = d.Float64()
 			tp |= model.SAMPLE_TYPE_METRIC
 			return err
+		case 3:
+			// The structured metadata of a line with a value
+			if d.Next() == jx.Object {
+				meta, err = decodeStructuredMetadata(d)
+				return err
+			}
+			return d.Skip()
 		default:
 			d.Skip()
 		}
@@ -172,6 +195,7 @@ func (p *pushRequestDec) decodeStreamValue(d *jx.Decoder) error {
 	p.String = append(p.String, str)
 	p.Value = append(p.Value, val)
 	p.Types = append(p.Types, tp)
+	p.StructuredMetadata = append(p.StructuredMetadata, meta)
 
 	return nil
 }
@@ -187,6 +211,7 @@ func (p *pushRequestDec) decodeStreamEntry(d *jx.Decoder) error {
 		tsNs int64
 		str  string
 		val  float64
+		meta string
 		err  error
 		tp   uint8
 	)
@@ -214,6 +239,9 @@ func (p *pushRequestDec) decodeStreamEntry(d *jx.Decoder) error {
 			val, err = d.Float64()
 			tp |= model.SAMPLE_TYPE_METRIC
 			return err
+		case "structuredMetadata":
+			meta, err = decodeStructuredMetadata(d)
+			return err
 		default:
 			return d.Skip()
 		}
@@ -230,6 +258,7 @@ func (p *pushRequestDec) decodeStreamEntry(d *jx.Decoder) error {
 	p.String = append(p.String, str)
 	p.Value = append(p.Value, val)
 	p.Types = append(p.Types, tp)
+	p.StructuredMetadata = append(p.StructuredMetadata, meta)
 	if err != nil {
 		return errors.NewUnmarshalError(err)
 	}
@@ -5,7 +5,10 @@ import (
 	clconfig "github.com/metrico/cloki-config"
 	"github.com/metrico/qryn/v5/writer/config"
 	controllerv1 "github.com/metrico/qryn/v5/writer/controller"
+	"github.com/metrico/qryn/v5/writer/limits"
+	"github.com/metrico/qryn/v5/writer/otlpgrpc"
 	"github.com/metrico/qryn/v5/writer/plugin"
+	"github.com/metrico/qryn/v5/writer/syslog"
 	"github.com/metrico/qryn/v5/writer/utils/logger"
 )
 
@@ -25,13 +28,18 @@ func Init(cfg *clconfig.ClokiConfig, router *mux.Router) {
 	if len(qrynPlugin.ServicesObject.Dbv2Map) > 0 {
 		controllerv1.DbClient = qrynPlugin.ServicesObject.Dbv2Map[0]
 	}
+	controllerv1.IngestLimiter = limits.New(limits.ConfigFromEnv())
 	proMiddlewareConfig := controllerv1.NewMiddlewareConfig(controllerv1.WithExtraMiddlewareDefault...)
 	tempoMiddlewareConfig := controllerv1.NewMiddlewareConfig(controllerv1.WithExtraMiddlewareTempo...)
 	qrynPlugin.RegisterRoutes(*config.Cloki.Setting, proMiddlewareConfig, tempoMiddlewareConfig, router)
+	otlpgrpc.Init(config.Cloki)
+	syslog.Init(config.Cloki)
 }
 
 func Stop() {
 	logger.Info("Stopping Writer module...")
+	otlpgrpc.Stop()
+	syslog.Stop()
 	if qrynPlugin != nil {
 		if err := qrynPlugin.Stop(); err != nil {
 			logger.Error("Error during writer module shutdown:", err)